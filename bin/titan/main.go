@@ -22,6 +22,7 @@ import (
 	"github.com/distributedio/titan/context"
 	"github.com/distributedio/titan/db"
 	"github.com/distributedio/titan/metrics"
+	"github.com/distributedio/titan/pubsub"
 	"github.com/distributedio/titan/server"
 )
 
@@ -53,8 +54,9 @@ func main() {
 		fmt.Println("The memory mode can only be used for experience, configure the tikv.pd-addrs to use the TiKV as a backend")
 	}
 
-	if err := ConfigureZap(config.Logger.Name, config.Logger.Path, config.Logger.Level,
-		config.Logger.TimeRotate, config.Logger.Compress); err != nil {
+	level, err := ConfigureZap(config.Logger.Name, config.Logger.Path, config.Logger.Level,
+		config.Logger.TimeRotate, config.Logger.Compress)
+	if err != nil {
 		fmt.Printf("create logger failed, %s\n", err)
 		os.Exit(1)
 	}
@@ -71,13 +73,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	hub, err := pubsub.Open(&config.TiKV)
+	if err != nil {
+		zap.L().Fatal("open pubsub failed", zap.Error(err))
+		os.Exit(1)
+	}
+
 	svr := metrics.NewServer(&config.Status)
 
-	serv := titan.New(&context.ServerContext{
-		RequirePass:      config.Server.Auth,
-		Store:            store,
-		ListZipThreshold: config.Server.ListZipThreshold,
-	})
+	servCtx := &context.ServerContext{
+		RequirePass: config.Server.Auth,
+		Store:       store,
+		PubSub:      hub,
+		Config:      config,
+		ConfigFile:  confPath,
+		LogLevel:    &level,
+	}
+	servCtx.SetOptions(context.ServerOptions(&config.Server))
+	serv := titan.New(servCtx)
 
 	var servOpts, statusOpts []continuous.ServerOption
 
@@ -117,14 +130,14 @@ func main() {
 	}
 }
 
-// ConfigureZap customize the zap logger
-func ConfigureZap(name, path, level, pattern string, compress bool) error {
+// ConfigureZap customize the zap logger, the level returned is able to be changed at runtime
+func ConfigureZap(name, path, level, pattern string, compress bool) (zap.AtomicLevel, error) {
+	var lv = zap.NewAtomicLevel()
 	writer, err := Writer(path, pattern, compress)
 	if err != nil {
-		return err
+		return lv, err
 	}
 
-	var lv = zap.NewAtomicLevel()
 	switch level {
 	case "debug":
 		lv.SetLevel(zap.DebugLevel)
@@ -139,7 +152,7 @@ func ConfigureZap(name, path, level, pattern string, compress bool) error {
 	case "fatal":
 		lv.SetLevel(zap.FatalLevel)
 	default:
-		return fmt.Errorf("unknown log level(%s)", level)
+		return lv, fmt.Errorf("unknown log level(%s)", level)
 	}
 	timeEncoder := func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.Local().Format("2006-01-02 15:04:05.999999999"))
@@ -170,7 +183,7 @@ func ConfigureZap(name, path, level, pattern string, compress bool) error {
 	//http change log level
 	http.Handle("/titan/log/level", lv)
 
-	return nil
+	return lv, nil
 }
 
 // ConfigureLogrus customize the logrus logger, which is used by TiKV SDK
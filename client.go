@@ -24,6 +24,8 @@ type client struct {
 
 	eofLock sync.Mutex //the lock of reading_writing 'eof'
 	eof     bool       //is over when read data from socket
+
+	writeLock sync.Mutex //the lock of writing to conn, pub/sub messages are written by other goroutines
 }
 
 func newClient(cliCtx *context.ClientContext, s *Server, exec *command.Executor) *client {
@@ -52,7 +54,9 @@ func (c *client) isEof() bool {
 // Write to conn and log error if needed
 func (c *client) Write(p []byte) (int, error) {
 	zap.L().Debug("write to client", zap.Int64("clientid", c.cliCtx.ID), zap.String("msg", string(p)))
+	c.writeLock.Lock()
 	n, err := c.conn.Write(p)
+	c.writeLock.Unlock()
 	if err != nil {
 		c.conn.Close()
 		if err == io.EOF {
@@ -108,6 +112,12 @@ func (c *client) serve(conn net.Conn) error {
 		c.cliCtx.Updated = time.Now()
 		c.cliCtx.LastCmd = cmd[0]
 
+		// only the subscribe-family commands are allowed after the client subscribes
+		if c.cliCtx.Subscribed() && !command.AllowedInSubscribeMode(cmd[0]) {
+			resp.ReplyError(c, command.ErrSubscribeMode(cmd[0]).Error())
+			continue
+		}
+
 		ctx := &command.Context{
 			Name:    cmd[0],
 			Args:    cmd[1:],
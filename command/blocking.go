@@ -0,0 +1,192 @@
+package command
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
+	"go.uber.org/zap"
+)
+
+var (
+	// errWouldBlock is returned by a blocking command when there is nothing to serve the client now
+	errWouldBlock = errors.New("would block")
+
+	// ErrTimeout timeout is not a float
+	ErrTimeout = errors.New("ERR timeout is not a float or out of range")
+
+	// ErrTimeoutNegative timeout is negative
+	ErrTimeoutNegative = errors.New("ERR timeout is negative")
+
+	// ErrUnblocked the client is unblocked by CLIENT UNBLOCK with error
+	ErrUnblocked = errors.New("UNBLOCKED client unblocked via CLIENT UNBLOCK")
+
+	// blocked clients check their keys periodically in case a signal is lost
+	blockingRecheckInterval = 5 * time.Second
+)
+
+// BlockingKeys returns the keys a blocking command waits for
+type BlockingKeys func(args []string) []string
+
+// BlockingTimeout returns the timeout of a blocking command, the command
+// does not block if block is false
+type BlockingTimeout func(args []string) (timeout time.Duration, block bool, err error)
+
+// lastArgTimeout parses the timeout from the last argument
+func lastArgTimeout(args []string) (time.Duration, bool, error) {
+	timeout, err := parseTimeout(args[len(args)-1])
+	return timeout, true, err
+}
+
+// parseTimeout parses the timeout of a blocking command in seconds, 0 means blocking forever
+func parseTimeout(s string) (time.Duration, error) {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(secs) || math.IsInf(secs, 0) {
+		return 0, ErrTimeout
+	}
+	if secs < 0 {
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// signal wakes up the clients blocked on the keys after the transaction is committed
+func signal(ctx *Context, onCommit OnCommit, keys ...[]byte) OnCommit {
+	return signalDB(ctx, onCommit, ctx.Client.DB, keys...)
+}
+
+// signalDB works like signal for the keys in another db
+func signalDB(ctx *Context, onCommit OnCommit, target *db.DB, keys ...[]byte) OnCommit {
+	return func() {
+		if onCommit != nil {
+			onCommit()
+		}
+		notify := func() {
+			notifier := ctx.Server.PubSub.Notifier()
+			for _, key := range keys {
+				notifier.Signal(string(db.MetaKey(target, key)))
+			}
+		}
+		// commands called by a script reply before the script is committed,
+		// so the signals are deferred to the commit of the script
+		if ctx.script != nil {
+			ctx.script.signals = append(ctx.script.signals, notify)
+			return
+		}
+		notify()
+	}
+}
+
+// NonBlocking runs a blocking command without blocking, null is replied if the command would block,
+// it is used when the command is called in a multi/exec block
+func NonBlocking(cmd TxnCommand, null func(w io.Writer) OnCommit) TxnCommand {
+	return func(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+		onCommit, err := cmd(ctx, txn)
+		if err == errWouldBlock {
+			return null(ctx.Out), nil
+		}
+		return onCommit, err
+	}
+}
+
+// Blocking runs cmd in transaction and blocks the client until cmd could be served or it times out.
+// The last argument of the command is the timeout, cmd returns errWouldBlock if it has nothing to serve
+func Blocking(cmd TxnCommand, keys BlockingKeys) Command {
+	return BlockingWithTimeout(cmd, keys, lastArgTimeout)
+}
+
+// BlockingWithTimeout is like Blocking but the timeout is parsed by timeoutOf, a null array
+// is replied if the command has nothing to serve and it does not block
+func BlockingWithTimeout(cmd TxnCommand, keys BlockingKeys, timeoutOf BlockingTimeout) Command {
+	nonBlocking := AutoCommit(NonBlocking(cmd, nullArray))
+	return func(ctx *Context) {
+		timeout, block, err := timeoutOf(ctx.Args)
+		if err != nil {
+			resp.ReplyError(ctx.Out, err.Error())
+			return
+		}
+		if !block {
+			nonBlocking(ctx)
+			return
+		}
+
+		blocked := false
+		try := AutoCommit(func(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+			onCommit, err := cmd(ctx, txn)
+			blocked = err == errWouldBlock
+			if blocked {
+				return nil, nil
+			}
+			return onCommit, err
+		})
+
+		// most calls are served at once without registering the keys to the notifier
+		try(ctx)
+		if !blocked {
+			return
+		}
+
+		// register before trying again so that a key signaled in between will not be missed, a signal
+		// skipped by another instance which has not seen the registration yet is caught up by the recheck
+		notifier := ctx.Server.PubSub.Notifier()
+		var mkeys []string
+		for _, key := range keys(ctx.Args) {
+			mkeys = append(mkeys, string(db.MetaKey(ctx.Client.DB, []byte(key))))
+		}
+		waiter := notifier.Wait(ctx.Client.ID, mkeys...)
+		defer notifier.Done(waiter)
+
+		try(ctx)
+		if !blocked {
+			return
+		}
+
+		var deadline <-chan time.Time
+		if timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		recheck := time.NewTicker(blockingRecheckInterval)
+		defer recheck.Stop()
+
+		for {
+			rechecked := false
+			select {
+			case <-waiter.Ready():
+			case <-recheck.C:
+				rechecked = true
+			case withError := <-waiter.Unblocked():
+				if withError {
+					resp.ReplyError(ctx.Out, ErrUnblocked.Error())
+					return
+				}
+				encoder(ctx).NullArray()
+				return
+			case <-deadline:
+				encoder(ctx).NullArray()
+				return
+			case <-ctx.Client.Done:
+				return
+			}
+
+			try(ctx)
+			if !blocked {
+				if rechecked {
+					zap.L().Warn("blocked client served by the recheck, the signal is missed",
+						zap.Int64("clientid", ctx.Client.ID), zap.String("command", ctx.Name))
+				}
+				return
+			}
+			// other clients have taken what we are waiting for, wait for the next signal
+			notifier.Rearm(waiter)
+			if env := zap.L().Check(zap.DebugLevel, "blocked client woken up with nothing to serve"); env != nil {
+				env.Write(zap.Int64("clientid", ctx.Client.ID), zap.String("command", ctx.Name))
+			}
+		}
+	}
+}
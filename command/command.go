@@ -22,6 +22,12 @@ type Context struct {
 	Out     io.Writer
 	TraceID string
 	*context.Context
+
+	// script is set when the command is called by a lua script
+	script *scriptRun
+
+	// txnCost is recorded by AutoCommit for the slow log
+	txnCost txnCost
 }
 
 // Command is a redis command implementation
@@ -51,6 +57,21 @@ func NullBulkString(w io.Writer) OnCommit {
 	}
 }
 
+// Null replies a null when commit, it is a null bulkstring in RESP2
+func Null(ctx *Context) OnCommit {
+	e := encoder(ctx)
+	return func() {
+		e.Null()
+	}
+}
+
+// nullArray replies a null array when commit
+func nullArray(w io.Writer) OnCommit {
+	return func() {
+		resp.ReplyNullArray(w)
+	}
+}
+
 // Integer replies in integer when commit
 func Integer(w io.Writer, v int64) OnCommit {
 	return func() {
@@ -85,6 +106,60 @@ func BytesArray(w io.Writer, a [][]byte) OnCommit {
 	}
 }
 
+// BytesMap replies a [][]byte of keys and values as a map when commit, it is an array in RESP2
+func BytesMap(ctx *Context, a [][]byte) OnCommit {
+	e := encoder(ctx)
+	return func() {
+		if err := e.Map(len(a) / 2); err != nil {
+			return
+		}
+		bulkStrings(e, a)
+	}
+}
+
+// BytesSet replies a [][]byte as a set when commit, it is an array in RESP2
+func BytesSet(ctx *Context, a [][]byte) OnCommit {
+	e := encoder(ctx)
+	return func() {
+		if err := e.Set(len(a)); err != nil {
+			return
+		}
+		bulkStrings(e, a)
+	}
+}
+
+// Double replies a float as a double when commit, it is a bulkstring in RESP2
+func Double(ctx *Context, v float64) OnCommit {
+	e := encoder(ctx)
+	return func() {
+		e.Double(v)
+	}
+}
+
+// bulkStrings replies the elements of an aggregate, a nil element is replied as a null
+func bulkStrings(e *resp.Encoder, a [][]byte) {
+	for i := range a {
+		var err error
+		if a[i] == nil {
+			err = e.NullBulkString()
+		} else {
+			err = e.BulkString(string(a[i]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// encoder returns an encoder of the version of RESP the client negotiated, the commands
+// called by scripts always reply in RESP2 to be converted to lua values
+func encoder(ctx *Context) *resp.Encoder {
+	if ctx.script != nil {
+		return resp.NewEncoder(ctx.Out)
+	}
+	return resp.NewEncoderVersion(ctx.Out, ctx.Client.Protocol)
+}
+
 // TxnCommand runs a command in transaction
 type TxnCommand func(ctx *Context, txn *db.Transaction) (OnCommit, error)
 
@@ -92,69 +167,98 @@ type TxnCommand func(ctx *Context, txn *db.Transaction) (OnCommit, error)
 func Call(ctx *Context) {
 	ctx.Name = strings.ToLower(ctx.Name)
 
-	if ctx.Name != "auth" &&
+	// record the error replied by the command for the statistics
+	out := ctx.Out
+	recorder := &replyRecorder{Writer: out}
+	ctx.Out = recorder
+	stat, cost, executed := call(ctx)
+	ctx.Out = out
+
+	kind := recorder.seal()
+	if kind != "" {
+		recordError(kind)
+	}
+	if stat != nil {
+		stat.record(cost, executed, kind != "")
+	}
+}
+
+// call calls a command and returns its statistic if the command is known, executed is false if the
+// command is rejected or queued
+func call(ctx *Context) (*Statistic, time.Duration, bool) {
+	stat := txnStats[ctx.Name]
+	cmdInfoCommand, ok := commands[ctx.Name]
+	if ok {
+		stat = cmdInfoCommand.Stat
+	}
+
+	if ctx.Name != "auth" && ctx.Name != "hello" &&
 		ctx.Server.RequirePass != "" &&
 		ctx.Client.Authenticated == false {
 		resp.ReplyError(ctx.Out, ErrNoAuth.Error())
-		return
+		return stat, 0, false
 	}
 	// Exec all queued commands if this is an exec command
 	if ctx.Name == "exec" {
 		if len(ctx.Args) != 0 {
 			resp.ReplyError(ctx.Out, ErrWrongArgs(ctx.Name).Error())
-			return
+			return stat, 0, false
 		}
 		// Exec must begin with multi
 		if !ctx.Client.Multi {
 			resp.ReplyError(ctx.Out, ErrExec.Error())
-			return
+			return stat, 0, false
 		}
 
+		start := time.Now()
 		Exec(ctx)
+		cost := time.Since(start)
 		feedMonitors(ctx)
-		return
+		slowlogPush(ctx, start, cost)
+		return stat, cost, true
 	}
 	// Discard all queued commands and return
 	if ctx.Name == "discard" {
 		if !ctx.Client.Multi {
 			resp.ReplyError(ctx.Out, ErrDiscard.Error())
-			return
+			return stat, 0, false
 		}
 
+		start := time.Now()
 		Discard(ctx)
+		cost := time.Since(start)
 		feedMonitors(ctx)
-		return
+		return stat, cost, true
 	}
 
-	cmdInfoCommand, ok := commands[ctx.Name]
 	if !ok {
 		resp.ReplyError(ctx.Out, ErrUnKnownCommand(ctx.Name).Error())
-		return
+		return nil, 0, false
 	}
 	argc := len(ctx.Args) + 1 // include the command name
 	arity := cmdInfoCommand.Cons.Arity
 
 	if arity > 0 && argc != arity {
 		resp.ReplyError(ctx.Out, ErrWrongArgs(ctx.Name).Error())
-		return
+		return stat, 0, false
 	}
 
 	if arity < 0 && argc < -arity {
 		resp.ReplyError(ctx.Out, ErrWrongArgs(ctx.Name).Error())
-		return
+		return stat, 0, false
 	}
 
 	// We now in a multi block, queue the command and return
 	if ctx.Client.Multi {
 		if ctx.Name == "multi" {
 			resp.ReplyError(ctx.Out, ErrMultiNested.Error())
-			return
+			return stat, 0, false
 		}
 		commands := ctx.Client.Commands
 		commands = append(commands, &context.Command{Name: ctx.Name, Args: ctx.Args})
 		ctx.Client.Commands = commands
 		resp.ReplySimpleString(ctx.Out, "QUEUED")
-		return
+		return stat, 0, false
 	}
 
 	feedMonitors(ctx)
@@ -162,8 +266,8 @@ func Call(ctx *Context) {
 	cmdInfoCommand.Proc(ctx)
 	cost := time.Since(start)
 
-	cmdInfoCommand.Stat.Calls++
-	cmdInfoCommand.Stat.Microseconds += cost.Nanoseconds() / int64(1000)
+	slowlogPush(ctx, start, cost)
+	return stat, cost, true
 }
 
 // TxnCall calls a command with transaction, it is used with multi/exec
@@ -192,6 +296,7 @@ func AutoCommit(cmd TxnCommand) Command {
 					mt.CommandArgsNumHistogramVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Observe(float64(len(ctx.Args) - 1))
 				}
 			}
+			ctx.txnCost.begin += time.Since(start)
 			cost := time.Since(start).Seconds()
 			zap.L().Debug("transation begin", zap.String("name", ctx.Name), zap.String("key", key), zap.Int64("cost(us)", int64(cost*1000000)))
 			mt.TxnBeginHistogramVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Observe(cost)
@@ -208,6 +313,7 @@ func AutoCommit(cmd TxnCommand) Command {
 
 			start = time.Now()
 			onCommit, err := cmd(ctx, txn)
+			ctx.txnCost.execute += time.Since(start)
 			cost = time.Since(start).Seconds()
 			zap.L().Debug("command done", zap.String("name", ctx.Name), zap.String("key", key), zap.Int64("cost(us)", int64(cost*1000000)))
 			mt.CommandFuncDoneHistogramVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Observe(cost)
@@ -228,7 +334,9 @@ func AutoCommit(cmd TxnCommand) Command {
 				cost = time.Since(start).Seconds()
 				mt.TxnCommitHistogramVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Observe(cost)
 			}
-			if err := txn.Commit(ctx); err != nil {
+			err = txn.Commit(ctx)
+			ctx.txnCost.commit += time.Since(start)
+			if err != nil {
 				txn.Rollback()
 				mt.TxnFailuresCounterVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Inc()
 				if db.IsRetryableError(err) {
@@ -257,6 +365,7 @@ func AutoCommit(cmd TxnCommand) Command {
 			if onCommit != nil {
 				onCommit()
 			}
+			ctx.txnCost.reply += time.Since(start)
 			cost = time.Since(start).Seconds()
 			zap.L().Debug("onCommit ", zap.String("name", ctx.Name), zap.String("key", key), zap.Int64("cost(us)", int64(cost*1000000)))
 			mt.ReplyFuncDoneHistogramVec.WithLabelValues(ctx.Client.Namespace, ctx.Name).Observe(cost)
@@ -311,6 +420,6 @@ func (e *Executor) Execute(ctx *Context) {
 type Desc struct {
 	Proc Command
 	Txn  TxnCommand
-	Stat Statistic
+	Stat *Statistic
 	Cons Constraint
 }
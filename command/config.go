@@ -0,0 +1,352 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/distributedio/configo"
+	"github.com/distributedio/titan/conf"
+	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/encoding/resp"
+	"go.uber.org/zap/zapcore"
+)
+
+// configMu serializes the CONFIG commands which share the config of the server
+var configMu sync.Mutex
+
+// configField is an option of the config, it is named by its path in the toml file
+// like "server.list-zip-threshold"
+type configField struct {
+	name  string
+	value reflect.Value
+}
+
+// configOption is an option which is able to be changed at runtime
+type configOption struct {
+	valid func(v reflect.Value) bool
+	apply func(ctx *Context, cfg *conf.Titan)
+}
+
+var (
+	configNonNegative = func(v reflect.Value) bool { return v.Int() >= 0 }
+	configPositive    = func(v reflect.Value) bool { return v.Int() > 0 }
+	configLogLevel    = func(v reflect.Value) bool {
+		switch v.String() {
+		case "debug", "info", "warn", "error", "panic", "fatal":
+			return true
+		}
+		return false
+	}
+
+	// the server works with its own copy of the options which are read by every client
+	configServer = func(ctx *Context, cfg *conf.Titan) { ctx.Server.SetOptions(context.ServerOptions(&cfg.Server)) }
+
+	// the store works with its own copy of the tikv config
+	configTiKV = func(ctx *Context, cfg *conf.Titan) { ctx.Server.Store.SetConf(cfg.TiKV) }
+
+	// configOptions are the options able to be changed by CONFIG SET, the others are
+	// only loaded when the server starts
+	configOptions = map[string]configOption{
+		"server.max-connection":          {configNonNegative, configServer},
+		"server.list-zip-threshold":      {configNonNegative, configServer},
+		"server.sort-max-elements":       {configNonNegative, configServer},
+		"server.slowlog-log-slower-than": {func(reflect.Value) bool { return true }, configServer},
+		"server.slowlog-max-len":         {configNonNegative, configServer},
+		"server.lua-time-limit":          {configNonNegative, configServer},
+		"logger.level": {configLogLevel, func(ctx *Context, cfg *conf.Titan) {
+			var level zapcore.Level
+			if ctx.Server.LogLevel != nil && level.UnmarshalText([]byte(cfg.Logger.Level)) == nil {
+				ctx.Server.LogLevel.SetLevel(level)
+			}
+		}},
+		"tikv.gc.interval":        {configPositive, configTiKV},
+		"tikv.gc.batch-limit":     {configPositive, configTiKV},
+		"tikv.expire.interval":    {configPositive, configTiKV},
+		"tikv.expire.batch-limit": {configPositive, configTiKV},
+		"tikv.zt.interval":        {configPositive, configTiKV},
+		"tikv.zt.batch":           {configPositive, configTiKV},
+	}
+)
+
+// Config gets, sets or persists the config of the server
+func Config(ctx *Context) {
+	subcmd := strings.ToLower(ctx.Args[0])
+	args := ctx.Args[1:]
+	if ctx.Client.Namespace != sysAdminNamespace {
+		resp.ReplyError(ctx.Out, "ERR config can be used by $sys.admin only")
+		return
+	}
+	if (subcmd == "get" && len(args) == 0) || (subcmd == "set" && (len(args) == 0 || len(args)%2 != 0)) ||
+		(subcmd == "rewrite" && len(args) != 0) {
+		resp.ReplyError(ctx.Out, fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP.", ctx.Args[0]))
+		return
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg := ctx.Server.Config
+	if cfg == nil {
+		resp.ReplyError(ctx.Out, "ERR The server is running without a config")
+		return
+	}
+
+	switch subcmd {
+	case "get":
+		var vals []string
+		for _, field := range configFields("", reflect.ValueOf(cfg).Elem()) {
+			for _, pattern := range args {
+				// the names of the options are in lower case
+				if globMatch([]byte(strings.ToLower(pattern)), []byte(field.name), true) {
+					vals = append(vals, field.name, configString(field.value))
+					break
+				}
+			}
+		}
+		resp.ReplyArray(ctx.Out, len(vals))
+		for _, val := range vals {
+			resp.ReplyBulkString(ctx.Out, val)
+		}
+	case "set":
+		if err := configSet(ctx, cfg, args); err != nil {
+			resp.ReplyError(ctx.Out, err.Error())
+			return
+		}
+		resp.ReplySimpleString(ctx.Out, OK)
+	case "rewrite":
+		if ctx.Server.ConfigFile == "" {
+			resp.ReplyError(ctx.Out, "ERR The server is running without a config file")
+			return
+		}
+		if err := configRewrite(ctx.Server.ConfigFile, cfg); err != nil {
+			resp.ReplyError(ctx.Out, "ERR Rewriting config file: "+err.Error())
+			return
+		}
+		resp.ReplySimpleString(ctx.Out, OK)
+	default:
+		resp.ReplyError(ctx.Out, fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try CONFIG HELP.", ctx.Args[0]))
+	}
+}
+
+// configSet changes the options in pairs of name and value, none of them is changed if any fails
+func configSet(ctx *Context, cfg *conf.Titan, args []string) error {
+	next := *cfg
+	fields := make(map[string]reflect.Value)
+	for _, field := range configFields("", reflect.ValueOf(&next).Elem()) {
+		fields[field.name] = field.value
+	}
+
+	names := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name, val := strings.ToLower(args[i]), args[i+1]
+		field, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[i])
+		}
+		opt, ok := configOptions[name]
+		if !ok {
+			return fmt.Errorf("ERR CONFIG SET failed, '%s' can not be changed at runtime, "+
+				"change it in the config file and restart the server", name)
+		}
+		if err := configParse(field, val); err != nil || !opt.valid(field) {
+			return fmt.Errorf("ERR Invalid argument '%s' for CONFIG SET '%s'", val, name)
+		}
+		names = append(names, name)
+	}
+
+	*cfg = next
+	for _, name := range names {
+		configOptions[name].apply(ctx, cfg)
+	}
+	return nil
+}
+
+// configRewrite sets the options of the config file which differ from the running ones, the
+// other lines and the comments of the file are kept
+func configRewrite(file string, cfg *conf.Titan) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	saved := &conf.Titan{}
+	if err := configo.Unmarshal(data, saved); err != nil {
+		return err
+	}
+	savedFields := configFields("", reflect.ValueOf(saved).Elem())
+	values := make(map[string]string)
+	var names []string
+	for i, field := range configFields("", reflect.ValueOf(cfg).Elem()) {
+		if configString(field.value) != configString(savedFields[i].value) {
+			values[field.name] = configTOML(field.value)
+			names = append(names, field.name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	// find the line of each option and the end of each table, an option
+	// commented out is replaced if it is not set in the table
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	found := make(map[string]int)
+	ends := map[string]int{"": 0}
+	table := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			table = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			ends[table] = i + 1
+			continue
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			ends[table] = i + 1
+		}
+		kv := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+		eq := strings.IndexByte(kv, '=')
+		if eq < 0 {
+			continue
+		}
+		name := strings.TrimSpace(kv[:eq])
+		if table != "" {
+			name = table + "." + name
+		}
+		if _, ok := values[name]; !ok {
+			continue
+		}
+		if j, ok := found[name]; !ok || (!strings.HasPrefix(trimmed, "#") &&
+			strings.HasPrefix(strings.TrimSpace(lines[j]), "#")) {
+			found[name] = i
+		}
+	}
+
+	inserts := make(map[int][]string)
+	var appends []string
+	for _, name := range names {
+		table, key := "", name
+		if idx := strings.LastIndexByte(name, '.'); idx >= 0 {
+			table, key = name[:idx], name[idx+1:]
+		}
+		line := key + " = " + values[name]
+		if i, ok := found[name]; ok {
+			lines[i] = line
+		} else if end, ok := ends[table]; ok {
+			inserts[end] = append(inserts[end], line)
+		} else {
+			appends = append(appends, "", "["+table+"]", line)
+		}
+	}
+
+	var out []string
+	for i := 0; i <= len(lines); i++ {
+		out = append(out, inserts[i]...)
+		if i < len(lines) {
+			out = append(out, lines[i])
+		}
+	}
+	out = append(out, appends...)
+
+	// replace the file at once so it is never left half written, the new file keeps the mode
+	// and the owner of the old one as it may hold the passwords
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strings.Join(out, "\n")+"\n"), info.Mode().Perm()); err != nil {
+		return err
+	}
+	// the mode is masked by umask when the file is created
+	if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if err := os.Chown(tmp, int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, file)
+}
+
+// configFields returns the options of the config in the order of the toml file
+func configFields(prefix string, v reflect.Value) []configField {
+	var fields []configField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("cfg")
+		if tag == "" {
+			continue
+		}
+		name := strings.TrimSpace(strings.SplitN(tag, ";", 2)[0])
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if v.Field(i).Kind() == reflect.Struct {
+			fields = append(fields, configFields(name, v.Field(i))...)
+			continue
+		}
+		fields = append(fields, configField{name: name, value: v.Field(i)})
+	}
+	return fields
+}
+
+// configString formats the value of an option
+func configString(v reflect.Value) string {
+	switch val := v.Interface().(type) {
+	case time.Duration:
+		return val.String()
+	case []string:
+		return strings.Join(val, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// configTOML formats the value of an option in toml
+func configTOML(v reflect.Value) string {
+	switch val := v.Interface().(type) {
+	case time.Duration:
+		return strconv.Quote(val.String())
+	case string:
+		return strconv.Quote(val)
+	case []string:
+		quoted := make([]string, len(val))
+		for i := range val {
+			quoted[i] = strconv.Quote(val[i])
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// configParse parses the value of an option
+func configParse(v reflect.Value, val string) error {
+	if _, ok := v.Interface().(time.Duration); ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	default:
+		return errors.New("unsupported type")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/distributedio/configo"
+	"github.com/distributedio/titan/conf"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "titan-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "titan.toml")
+	data, err := ioutil.ReadFile("../conf/titan.toml")
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(file, data, 0600))
+
+	cfg := &conf.Titan{}
+	assert.NoError(t, configo.Load(file, cfg))
+	level := zap.NewAtomicLevel()
+	serv := ContextTest("config").Server
+	serv.Config, serv.ConfigFile, serv.LogLevel = cfg, file, &level
+	defer serv.Store.SetConf(serv.Store.Conf())
+
+	call := func(args ...string) string {
+		ctx := ContextTest("config", args...)
+		ctx.Client.Namespace = sysAdminNamespace
+		ctx.Server = serv
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+
+	assert.Equal(t, "*2\r\n$25\r\nserver.list-zip-threshold\r\n$3\r\n100\r\n", call("get", "server.list-zip-threshold"))
+	assert.Equal(t, "*4\r\n$19\r\ntikv.gc.batch-limit\r\n$3\r\n256\r\n$12\r\nlogger.level\r\n$4\r\ninfo\r\n",
+		call("get", "tikv.gc.batch*", "LOGGER.LEVEL"))
+	assert.Equal(t, "*0\r\n", call("get", "none"))
+
+	assert.Equal(t, "+OK\r\n", call("set", "server.list-zip-threshold", "5", "tikv.gc.interval", "2s", "logger.level", "debug"))
+	assert.Equal(t, 5, serv.Options().ListZipThreshold)
+	assert.Equal(t, 2*time.Second, serv.Store.Conf().GC.Interval)
+	assert.Equal(t, zap.DebugLevel, level.Level())
+	assert.Equal(t, "*2\r\n$16\r\ntikv.gc.interval\r\n$2\r\n2s\r\n", call("get", "tikv.gc.interval"))
+
+	// none of the options is changed if any fails
+	assert.Equal(t, "-ERR Invalid argument '0' for CONFIG SET 'tikv.zt.batch'\r\n",
+		call("set", "server.max-connection", "10", "tikv.zt.batch", "0"))
+	assert.Equal(t, "-ERR Invalid argument 'verbose' for CONFIG SET 'logger.level'\r\n", call("set", "logger.level", "verbose"))
+	assert.Equal(t, "-ERR Invalid argument '1' for CONFIG SET 'tikv.expire.interval'\r\n", call("set", "tikv.expire.interval", "1"))
+	assert.Equal(t, int64(1000), serv.Options().MaxConnection)
+	assert.Equal(t, int64(1000), cfg.Server.MaxConnection)
+	assert.Contains(t, call("set", "server.listen", "0.0.0.0:6379"), "'server.listen' can not be changed at runtime")
+	assert.Contains(t, call("set", "server.none", "1"), "Unknown option")
+	assert.Contains(t, call("set", "server.max-connection"), "wrong number of arguments")
+	assert.Contains(t, call("reset"), "Unknown subcommand")
+
+	assert.Equal(t, "+OK\r\n", call("rewrite"))
+	rewritten := &conf.Titan{}
+	assert.NoError(t, configo.Load(file, rewritten))
+	assert.Equal(t, cfg, rewritten)
+	assert.Equal(t, 5, rewritten.Server.ListZipThreshold)
+	data, err = ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "\nlist-zip-threshold = 5\n")
+	assert.NotContains(t, string(data), "#list-zip-threshold")
+	// the file may hold the passwords, its mode is kept
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// the options and tables missing in the file are added
+	assert.NoError(t, ioutil.WriteFile(file, []byte("pid-filename = \"titan.pid\"\n[server]\nauth = \"\"\n"), 0644))
+	assert.Equal(t, "+OK\r\n", call("rewrite"))
+	rewritten = &conf.Titan{}
+	assert.NoError(t, configo.Load(file, rewritten))
+	assert.Equal(t, cfg, rewritten)
+
+	ctx := ContextTest("config", "get", "*")
+	ctx.Server = serv
+	Call(ctx)
+	assert.Equal(t, "-ERR config can be used by $sys.admin only\r\n", ctxString(ctx.Out))
+}
@@ -1,33 +1,119 @@
 package command
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 
+	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/db"
 	"github.com/distributedio/titan/encoding/resp"
 	"github.com/distributedio/titan/metrics"
 )
 
 // Auth verifies the client
 func Auth(ctx *Context) {
-	args := ctx.Args
+	if err := authenticate(ctx, ctx.Args[0]); err != nil {
+		resp.ReplyError(ctx.Out, err.Error())
+		return
+	}
+	resp.ReplySimpleString(ctx.Out, OK)
+}
+
+// authenticate verifies the token and switches the client to the namespace of the token
+func authenticate(ctx *Context, token string) error {
 	serverauth := []byte(ctx.Server.RequirePass)
 	if len(serverauth) == 0 {
-		resp.ReplyError(ctx.Out, "ERR Client sent AUTH, but no password is set")
-		return
+		return errors.New("ERR Client sent AUTH, but no password is set")
 	}
 
-	token := []byte(args[0])
-	namespace, err := Verify(token, serverauth)
+	namespace, err := Verify([]byte(token), serverauth)
 	if err != nil {
-		resp.ReplyError(ctx.Out, "ERR invalid password")
-		return
+		return errors.New("ERR invalid password")
 	}
 	metrics.GetMetrics().ConnectionOnlineGaugeVec.WithLabelValues(ctx.Client.Namespace).Dec()
 	metrics.GetMetrics().ConnectionOnlineGaugeVec.WithLabelValues(string(namespace)).Inc()
 	ctx.Client.Namespace = string(namespace)
 	ctx.Client.DB.Namespace = string(namespace)
 	ctx.Client.Authenticated = true
-	resp.ReplySimpleString(ctx.Out, OK)
+	return nil
+}
+
+// Hello switches the connection to the version of RESP and replies the properties of the server,
+// the client is authenticated and named at the same time if AUTH and SETNAME are given
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func Hello(ctx *Context) {
+	args := ctx.Args
+	protocol := resp.RESP2
+	if ctx.Client.Protocol == resp.RESP3 {
+		protocol = resp.RESP3
+	}
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			resp.ReplyError(ctx.Out, "ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if version != resp.RESP2 && version != resp.RESP3 {
+			resp.ReplyError(ctx.Out, "NOPROTO unsupported protocol version")
+			return
+		}
+		protocol = version
+		args = args[1:]
+	}
+
+	var token, name string
+	var auth, setname bool
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); {
+		case opt == "auth" && i+2 < len(args):
+			// the username is ignored, the namespace is decided by the token
+			auth, token = true, args[i+2]
+			i += 2
+		case opt == "setname" && i+1 < len(args):
+			setname, name = true, args[i+1]
+			i++
+		default:
+			resp.ReplyError(ctx.Out, fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+			return
+		}
+	}
+	if auth {
+		if err := authenticate(ctx, token); err != nil {
+			resp.ReplyError(ctx.Out, err.Error())
+			return
+		}
+	}
+	if ctx.Server.RequirePass != "" && !ctx.Client.Authenticated {
+		resp.ReplyError(ctx.Out, "NOAUTH HELLO must be called with the client already authenticated, "+
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client "+
+			"and select the RESP protocol version at the same time")
+		return
+	}
+	if setname {
+		ctx.Client.Name = name
+	}
+
+	ctx.Client.Protocol = protocol
+
+	e := encoder(ctx)
+	e.Map(7)
+	e.BulkString("server")
+	e.BulkString("titan")
+	e.BulkString("version")
+	e.BulkString(context.ReleaseVersion)
+	e.BulkString("proto")
+	e.Integer(int64(protocol))
+	e.BulkString("id")
+	e.Integer(ctx.Client.ID)
+	e.BulkString("mode")
+	e.BulkString("standalone")
+	e.BulkString("role")
+	e.BulkString("master")
+	e.BulkString("modules")
+	e.Array(0)
 }
 
 // Echo the given string
@@ -38,6 +124,19 @@ func Echo(ctx *Context) {
 // Ping the server
 func Ping(ctx *Context) {
 	args := ctx.Args
+	// in the subscribe mode, ping replies a pong message as redis does unless the client speaks RESP3
+	if ctx.Client.Subscribed() && ctx.Client.Protocol != resp.RESP3 {
+		msg := ""
+		if len(args) > 0 {
+			msg = args[0]
+		}
+		buf := bytes.NewBuffer(nil)
+		resp.ReplyArray(buf, 2)
+		resp.ReplyBulkString(buf, "pong")
+		resp.ReplyBulkString(buf, msg)
+		ctx.Out.Write(buf.Bytes())
+		return
+	}
 	if len(args) > 0 {
 		resp.ReplyBulkString(ctx.Out, args[0])
 		return
@@ -47,18 +146,13 @@ func Ping(ctx *Context) {
 
 // Select the logical database
 func Select(ctx *Context) {
-	args := ctx.Args
-	idx, err := strconv.Atoi(args[0])
+	idx, err := parseDBIndex(ctx.Args[0])
 	if err != nil {
-		resp.ReplyError(ctx.Out, "ERR invalid DB index")
-		return
-	}
-	if idx < 0 || idx > 255 {
-		resp.ReplyError(ctx.Out, "ERR invalid DB index")
+		resp.ReplyError(ctx.Out, err.Error())
 		return
 	}
 	namespace := ctx.Client.Namespace
-	ctx.Client.DB = ctx.Server.Store.DB(namespace, idx)
+	ctx.Client.DB = ctx.Server.Store.DB(namespace, int(idx))
 	resp.ReplySimpleString(ctx.Out, OK)
 }
 
@@ -69,6 +163,17 @@ func Quit(ctx *Context) {
 }
 
 // SwapDB swaps two Redis databases
-func SwapDB(ctx *Context) {
-	resp.ReplyError(ctx.Out, "ERR not supported")
+func SwapDB(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	a, err := parseDBIndex(ctx.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseDBIndex(ctx.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := txn.Kv().SwapDB(a, b); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return SimpleString(ctx.Out, OK), nil
 }
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/encoding/resp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHello(t *testing.T) {
+	cli := ContextTest("hello").Client
+	cli.ID = 7
+	call := func(args ...string) string {
+		ctx := ContextTest("hello", args...)
+		ctx.Context = context.New(cli, ctx.Server)
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+
+	version := "$7\r\nversion\r\n$" + strconv.Itoa(len(context.ReleaseVersion)) + "\r\n" + context.ReleaseVersion + "\r\n"
+	assert.Equal(t, "*14\r\n$6\r\nserver\r\n$5\r\ntitan\r\n"+version+"$5\r\nproto\r\n:2\r\n$2\r\nid\r\n:7\r\n"+
+		"$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", call())
+	assert.Equal(t, "%7\r\n$6\r\nserver\r\n$5\r\ntitan\r\n"+version+"$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:7\r\n"+
+		"$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n", call("3", "setname", "hello-client"))
+	assert.Equal(t, resp.RESP3, cli.Protocol)
+	assert.Equal(t, "hello-client", cli.Name)
+
+	assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", call("4"))
+	assert.Equal(t, "-ERR Protocol version is not an integer or out of range\r\n", call("x"))
+	assert.Equal(t, "-ERR Syntax error in HELLO option 'auth'\r\n", call("2", "auth", "default"))
+	assert.Equal(t, resp.RESP3, cli.Protocol)
+	assert.Contains(t, call("2"), "$5\r\nproto\r\n:2\r\n")
+	assert.Equal(t, resp.RESP2, cli.Protocol)
+}
+
+func TestHelloAuth(t *testing.T) {
+	key := "hello-auth-key"
+	token, err := Token([]byte(key), []byte("hellons"), time.Now().Unix())
+	assert.NoError(t, err)
+	cli := ContextTest("hello").Client
+	call := func(name string, args ...string) string {
+		ctx := ContextTest(name, args...)
+		ctx.Context = context.New(cli, ctx.Server)
+		ctx.Server.RequirePass = key
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+
+	assert.Contains(t, call("hello", "3"), "-NOAUTH HELLO must be called with the client already authenticated")
+	assert.Equal(t, "-"+ErrNoAuth.Error()+"\r\n", call("ping"))
+	assert.Equal(t, "-ERR invalid password\r\n", call("hello", "3", "auth", "default", "wrong"))
+	assert.Equal(t, 0, cli.Protocol)
+
+	assert.Contains(t, call("hello", "3", "AUTH", "default", string(token)), "%7\r\n")
+	assert.True(t, cli.Authenticated)
+	assert.Equal(t, "hellons", cli.Namespace)
+	assert.Equal(t, "+PONG\r\n", call("ping"))
+}
+
+func TestRESP3Replies(t *testing.T) {
+	call := func(name string, args ...string) string {
+		ctx := ContextTest(name, args...)
+		ctx.Client.Protocol = resp.RESP3
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+	call("hset", "resp3-hash", "f", "v")
+	call("zadd", "resp3-zset", "1.5", "m")
+	call("sadd", "resp3-set", "m")
+
+	assert.Equal(t, "%1\r\n$1\r\nf\r\n$1\r\nv\r\n", call("hgetall", "resp3-hash"))
+	assert.Equal(t, ",1.5\r\n", call("zscore", "resp3-zset", "m"))
+	assert.Equal(t, ",3\r\n", call("zincrby", "resp3-zset", "1.5", "m"))
+	assert.Equal(t, "_\r\n", call("zscore", "resp3-zset", "none"))
+	assert.Equal(t, "~1\r\n$1\r\nm\r\n", call("smembers", "resp3-set"))
+	assert.Equal(t, "_\r\n", call("get", "resp3-none"))
+
+	// the replies are kept in RESP2
+	assert.Equal(t, "*2\r\n$1\r\nf\r\n$1\r\nv\r\n", CallTest("hgetall", "resp3-hash").String())
+	assert.Equal(t, "$1\r\n3\r\n", CallTest("zscore", "resp3-zset", "m").String())
+	assert.Equal(t, "$-1\r\n", CallTest("get", "resp3-none").String())
+
+	// the commands called by scripts reply in RESP2
+	assert.Equal(t, "$1\r\n3\r\n", call("eval", "return redis.call('zscore', KEYS[1], 'm')", "1", "resp3-zset"))
+}
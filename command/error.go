@@ -43,9 +43,15 @@ var (
 	//ErrExpire expire time in setex
 	ErrExpireSetEx = errors.New("ERR invalid expire time in setex")
 
+	//ErrExpireGetEx expire time in getex
+	ErrExpireGetEx = errors.New("ERR invalid expire time in 'getex' command")
+
 	// ErrInteger value is not an integer or out of range
 	ErrInteger = errors.New("ERR value is not an integer or out of range")
 
+	// ErrOutOfRange value is out of range
+	ErrOutOfRange = errors.New("ERR value is out of range")
+
 	// ErrFloat value is not a valid float
 	ErrFloat = errors.New("ERR value is not a valid float")
 
@@ -59,7 +65,16 @@ var (
 	ErrBitOffset = errors.New("ERR bit offset is not an integer or out of range")
 
 	//ErrBitOp not must be called with a single source key.
-	ErrBitOp = errors.New("BITOP NOT must be called with a single source key.")
+	ErrBitOp = errors.New("ERR BITOP NOT must be called with a single source key.")
+
+	// ErrBitFieldType the type of a bit field is invalid
+	ErrBitFieldType = errors.New("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+
+	// ErrBitFieldOverflow the overflow type of a bit field is invalid
+	ErrBitFieldOverflow = errors.New("ERR Invalid OVERFLOW type specified")
+
+	// ErrBitFieldRO BITFIELD_RO is called with a subcommand other than GET
+	ErrBitFieldRO = errors.New("ERR BITFIELD_RO only supports the GET subcommand")
 
 	// ErrOffset offset is out of range
 	ErrOffset = errors.New("ERR offset is out of range")
@@ -76,6 +91,39 @@ var (
 	// ErrNoSuchKey reteurn on lset for key which no exist
 	ErrNoSuchKey = errors.New("ERR no such key")
 
+	// ErrSameObject the source and destination of a command are the same
+	ErrSameObject = errors.New("ERR source and destination objects are the same")
+
+	// ErrBusyKey the target key of RESTORE exists
+	ErrBusyKey = errors.New("BUSYKEY Target key name already exists.")
+
+	// ErrInvalidTTL the ttl of RESTORE is negative
+	ErrInvalidTTL = errors.New("ERR Invalid TTL value, must be >= 0")
+
+	// ErrInvalidIdleTime the idle time of RESTORE is negative
+	ErrInvalidIdleTime = errors.New("ERR Invalid IDLETIME value, must be >= 0")
+
+	// ErrInvalidFreq the frequency of RESTORE is out of range
+	ErrInvalidFreq = errors.New("ERR Invalid FREQ value, must be >= 0 and <= 255")
+
+	// ErrDumpStream streams can not be dumped
+	ErrDumpStream = errors.New("ERR DUMP of stream keys is not supported")
+
+	// ErrExpireNX NX is used with the other options of EXPIRE
+	ErrExpireNX = errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+
+	// ErrExpireGTLT GT and LT of EXPIRE are used together
+	ErrExpireGTLT = errors.New("ERR GT and LT options at the same time are not compatible")
+
+	// ErrSortScore the weight of SORT is not a number
+	ErrSortScore = errors.New("ERR One or more scores can't be converted into double")
+
+	// ErrSortTooLarge SORT is called on a key with more elements than sort-max-elements
+	ErrSortTooLarge = errors.New("ERR the number of elements to sort exceeds sort-max-elements")
+
+	// ErrRemoveTooMany the range of a sorted set is too large to be removed in a transaction
+	ErrRemoveTooMany = errors.New("ERR too many members to remove in a transaction")
+
 	// ErrReturnType return data type error
 	ErrReturnType = errors.New("ERR return data type error")
 
@@ -99,6 +147,18 @@ var (
 
 	//argument min or max isn't float
 	ErrMinOrMaxNotFloat = errors.New("ERR min or max is not a float")
+
+	// ErrNXAndXX NX and XX are used at the same time
+	ErrNXAndXX = errors.New("ERR XX and NX options at the same time are not compatible")
+
+	// ErrPositive the value must be positive
+	ErrPositive = errors.New("ERR value is out of range, must be positive")
+
+	// ErrGTLTAndNX GT, LT and NX are used at the same time
+	ErrGTLTAndNX = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+
+	// ErrZAddIncr INCR is used with multiple score and member pairs
+	ErrZAddIncr = errors.New("ERR INCR option supports a single increment-element pair")
 )
 
 //ErrUnKnownCommand return RedisError of the cmd
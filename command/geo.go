@@ -0,0 +1,634 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
+)
+
+var (
+	// ErrGeoAddSyntax is returned when the arguments of geoadd are not triples
+	ErrGeoAddSyntax = errors.New("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+
+	// ErrGeoUnit is returned when the unit is not supported
+	ErrGeoUnit = errors.New("ERR unsupported unit provided. please use M, KM, FT, MI")
+
+	// ErrGeoMember is returned when the center member does not exist
+	ErrGeoMember = errors.New("ERR could not decode requested zset member")
+
+	// ErrGeoRadius is returned when the radius is negative
+	ErrGeoRadius = errors.New("ERR radius cannot be negative")
+
+	// ErrGeoBox is returned when the width or height of the box is negative
+	ErrGeoBox = errors.New("ERR height or width cannot be negative")
+
+	// ErrGeoCount is returned when the count is not positive
+	ErrGeoCount = errors.New("ERR COUNT must be > 0")
+
+	// ErrGeoAny is returned when ANY is used without COUNT
+	ErrGeoAny = errors.New("ERR the ANY argument requires COUNT argument")
+
+	// ErrGeoStore is returned when store is used with the WITH* options
+	ErrGeoStore = errors.New("ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORDS options")
+
+	// ErrGeoFrom is returned when the center of geosearch is not specified exactly once
+	ErrGeoFrom = errors.New("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for geosearch")
+
+	// ErrGeoBy is returned when the shape of geosearch is not specified exactly once
+	ErrGeoBy = errors.New("ERR exactly one of BYRADIUS and BYBOX can be specified for geosearch")
+)
+
+func errGeoPosition(longitude, latitude float64) error {
+	return fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", longitude, latitude)
+}
+
+// geoUnit returns the meters of a unit
+func geoUnit(unit string) (float64, error) {
+	switch strings.ToLower(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, ErrGeoUnit
+}
+
+func parseGeoPosition(lon, lat string) (float64, float64, error) {
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return 0, 0, ErrFloat
+	}
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return 0, 0, ErrFloat
+	}
+	if !validGeoPosition(longitude, latitude) {
+		return 0, 0, errGeoPosition(longitude, latitude)
+	}
+	return longitude, latitude, nil
+}
+
+// formatGeoCoord formats a coordinate like the human readable long double of redis
+func formatGeoCoord(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func formatGeoDistance(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+// getGeoSet returns the sorted set holding the positions
+func getGeoSet(txn *db.Transaction, key []byte) (*db.ZSet, error) {
+	zset, err := txn.ZSet(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return zset, nil
+}
+
+// geoPositions returns the positions of the members, ok is false if the member does not exist
+func geoPositions(zset *db.ZSet, members [][]byte) (scores []float64, ok []bool, err error) {
+	scores = make([]float64, len(members))
+	ok = make([]bool, len(members))
+	if !zset.Exist() {
+		return scores, ok, nil
+	}
+	vals, err := zset.MGet(members)
+	if err != nil {
+		return nil, nil, errors.New("ERR " + err.Error())
+	}
+	for i := range vals {
+		if vals[i] != nil {
+			scores[i] = db.DecodeFloat64(vals[i])
+			ok[i] = true
+		}
+	}
+	return scores, ok, nil
+}
+
+// GeoAdd adds the specified geospatial items to the specified key
+func GeoAdd(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	var nx, xx, ch bool
+	args := ctx.Args[1:]
+	for ; len(args) > 0; args = args[1:] {
+		switch strings.ToUpper(args[0]) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+	if nx && xx {
+		return nil, ErrNXAndXX
+	}
+	if len(args) == 0 || len(args)%3 != 0 {
+		return nil, ErrGeoAddSyntax
+	}
+
+	// the last one wins if a member is specified more than once
+	index := make(map[string]int)
+	var members [][]byte
+	var scores []float64
+	for i := 0; i < len(args); i += 3 {
+		longitude, latitude, err := parseGeoPosition(args[i], args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		score := float64(geoEncodeWGS84(longitude, latitude).bits)
+		if j, ok := index[args[i+2]]; ok {
+			scores[j] = score
+			continue
+		}
+		index[args[i+2]] = len(members)
+		members = append(members, []byte(args[i+2]))
+		scores = append(scores, score)
+	}
+
+	zset, err := getGeoSet(txn, key)
+	if err != nil {
+		return nil, err
+	}
+	olds, exists, err := geoPositions(zset, members)
+	if err != nil {
+		return nil, err
+	}
+	var changed int64
+	updates, updateScores := members[:0:0], scores[:0:0]
+	for i := range members {
+		if (nx && exists[i]) || (xx && !exists[i]) {
+			continue
+		}
+		if exists[i] && olds[i] == scores[i] {
+			continue
+		}
+		if exists[i] {
+			changed++
+		}
+		updates = append(updates, members[i])
+		updateScores = append(updateScores, scores[i])
+	}
+	if len(updates) == 0 {
+		return Integer(ctx.Out, 0), nil
+	}
+	added, err := zset.ZAdd(updates, updateScores)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if ch {
+		return signal(ctx, Integer(ctx.Out, added+changed), key), nil
+	}
+	return signal(ctx, Integer(ctx.Out, added), key), nil
+}
+
+// GeoPos returns the positions of the members
+func GeoPos(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	zset, err := getGeoSet(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	members := make([][]byte, len(ctx.Args)-1)
+	for i, member := range ctx.Args[1:] {
+		members[i] = []byte(member)
+	}
+	scores, exists, err := geoPositions(zset, members)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		resp.ReplyArray(ctx.Out, len(members))
+		for i := range members {
+			if !exists[i] {
+				encoder(ctx).NullArray()
+				continue
+			}
+			longitude, latitude := geoDecodeScore(scores[i])
+			resp.ReplyArray(ctx.Out, 2)
+			resp.ReplyBulkString(ctx.Out, formatGeoCoord(longitude))
+			resp.ReplyBulkString(ctx.Out, formatGeoCoord(latitude))
+		}
+	}, nil
+}
+
+// GeoHash returns the standard geohash strings of the members
+func GeoHash(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	zset, err := getGeoSet(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	members := make([][]byte, len(ctx.Args)-1)
+	for i, member := range ctx.Args[1:] {
+		members[i] = []byte(member)
+	}
+	scores, exists, err := geoPositions(zset, members)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, len(members))
+	for i := range members {
+		if exists[i] {
+			hashes[i] = []byte(geoHashString(geoDecodeScore(scores[i])))
+		}
+	}
+	return BytesArray(ctx.Out, hashes), nil
+}
+
+// GeoDist returns the distance between two members
+func GeoDist(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	conversion := 1.0
+	if len(ctx.Args) > 4 {
+		return nil, ErrSyntax
+	}
+	if len(ctx.Args) == 4 {
+		var err error
+		if conversion, err = geoUnit(ctx.Args[3]); err != nil {
+			return nil, err
+		}
+	}
+	zset, err := getGeoSet(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	scores, exists, err := geoPositions(zset, [][]byte{[]byte(ctx.Args[1]), []byte(ctx.Args[2])})
+	if err != nil {
+		return nil, err
+	}
+	if !exists[0] || !exists[1] {
+		return Null(ctx), nil
+	}
+	lon1, lat1 := geoDecodeScore(scores[0])
+	lon2, lat2 := geoDecodeScore(scores[1])
+	return BulkString(ctx.Out, formatGeoDistance(geoDistance(lon1, lat1, lon2, lat2)/conversion)), nil
+}
+
+// geoSearch is a search parsed from the arguments of georadius or geosearch
+type geoSearch struct {
+	shape geoShape
+	// the center is the position of the member if it is not nil
+	member []byte
+
+	withDist, withHash, withCoord bool
+	// sort is 1 for ASC, -1 for DESC and 0 for unsorted
+	sort  int
+	count int64
+	any   bool
+
+	store     []byte
+	storeDist bool
+}
+
+// geoPoint is a member found by a search
+type geoPoint struct {
+	member              []byte
+	score               float64
+	distance            float64
+	longitude, latitude float64
+}
+
+// parseGeoRadius parses the shape of georadius, it is "longitude latitude radius unit" or "member radius unit"
+func parseGeoRadius(args []string, byMember bool) (*geoSearch, []string, error) {
+	s := &geoSearch{}
+	if byMember {
+		s.member = []byte(args[0])
+		args = args[1:]
+	} else {
+		longitude, latitude, err := parseGeoPosition(args[0], args[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		s.shape.longitude, s.shape.latitude = longitude, latitude
+		args = args[2:]
+	}
+	if len(args) < 2 {
+		return nil, nil, ErrSyntax
+	}
+	radius, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return nil, nil, ErrFloat
+	}
+	if radius < 0 {
+		return nil, nil, ErrGeoRadius
+	}
+	if s.shape.conversion, err = geoUnit(args[1]); err != nil {
+		return nil, nil, err
+	}
+	s.shape.radius = radius
+	return s, args[2:], nil
+}
+
+// parseOptions parses the options of georadius and geosearch,
+// store is true for the commands which are able to store the result
+func (s *geoSearch) parseOptions(args []string, search, store bool) error {
+	var from, by int
+	if !search {
+		from, by = 1, 1
+	}
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "WITHDIST":
+			s.withDist = true
+		case opt == "WITHHASH":
+			s.withHash = true
+		case opt == "WITHCOORD":
+			s.withCoord = true
+		case opt == "ANY":
+			s.any = true
+		case opt == "ASC":
+			s.sort = 1
+		case opt == "DESC":
+			s.sort = -1
+		case opt == "COUNT" && remain >= 1:
+			count, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return ErrInteger
+			}
+			if count <= 0 {
+				return ErrGeoCount
+			}
+			s.count = count
+			i++
+		case !search && store && (opt == "STORE" || opt == "STOREDIST") && remain >= 1:
+			s.store = []byte(args[i+1])
+			s.storeDist = opt == "STOREDIST"
+			i++
+		case search && store && opt == "STOREDIST":
+			s.storeDist = true
+		case search && opt == "FROMMEMBER" && remain >= 1:
+			s.member = []byte(args[i+1])
+			from++
+			i++
+		case search && opt == "FROMLONLAT" && remain >= 2:
+			longitude, latitude, err := parseGeoPosition(args[i+1], args[i+2])
+			if err != nil {
+				return err
+			}
+			s.shape.longitude, s.shape.latitude = longitude, latitude
+			from++
+			i += 2
+		case search && opt == "BYRADIUS" && remain >= 2:
+			radius, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				return ErrFloat
+			}
+			if radius < 0 {
+				return ErrGeoRadius
+			}
+			if s.shape.conversion, err = geoUnit(args[i+2]); err != nil {
+				return err
+			}
+			s.shape.radius = radius
+			by++
+			i += 2
+		case search && opt == "BYBOX" && remain >= 3:
+			width, err := strconv.ParseFloat(args[i+1], 64)
+			if err != nil {
+				return ErrFloat
+			}
+			height, err := strconv.ParseFloat(args[i+2], 64)
+			if err != nil {
+				return ErrFloat
+			}
+			if width < 0 || height < 0 {
+				return ErrGeoBox
+			}
+			if s.shape.conversion, err = geoUnit(args[i+3]); err != nil {
+				return err
+			}
+			s.shape.width, s.shape.height = width, height
+			by++
+			i += 3
+		default:
+			return ErrSyntax
+		}
+	}
+
+	if from != 1 {
+		return ErrGeoFrom
+	}
+	if by != 1 {
+		return ErrGeoBy
+	}
+	if s.any && s.count == 0 {
+		return ErrGeoAny
+	}
+	if s.store != nil && (s.withDist || s.withHash || s.withCoord) {
+		if search {
+			return ErrSyntax
+		}
+		return ErrGeoStore
+	}
+	// the nearest ones are returned when the count is limited
+	if s.count > 0 && !s.any && s.sort == 0 {
+		s.sort = 1
+	}
+	return nil
+}
+
+// run searches the members in the shape, the cells covering the shape are
+// scanned with bounded score ranges
+func (s *geoSearch) run(zset *db.ZSet) ([]*geoPoint, error) {
+	var points []*geoPoint
+	seen := make(map[geoHash]bool)
+	for _, hash := range s.shape.areas() {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		min, max := hash.scoreRange()
+		items, err := zset.ZAnyOrderRangeByScore(min, true, max, false, true, 0, math.MaxInt64, true)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		for i := 0; i+1 < len(items); i += 2 {
+			score, err := strconv.ParseFloat(string(items[i+1]), 64)
+			if err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+			longitude, latitude := geoDecodeScore(score)
+			distance, ok := s.shape.distance(longitude, latitude)
+			if !ok {
+				continue
+			}
+			points = append(points, &geoPoint{
+				member:    items[i],
+				score:     score,
+				distance:  distance,
+				longitude: longitude,
+				latitude:  latitude,
+			})
+		}
+		if s.any && int64(len(points)) >= s.count {
+			break
+		}
+	}
+
+	if s.sort != 0 {
+		sort.SliceStable(points, func(i, j int) bool {
+			if s.sort > 0 {
+				return points[i].distance < points[j].distance
+			}
+			return points[i].distance > points[j].distance
+		})
+	}
+	if s.count > 0 && int64(len(points)) > s.count {
+		points = points[:s.count]
+	}
+	return points, nil
+}
+
+// do runs the search on the key and replies or stores the result
+func (s *geoSearch) do(ctx *Context, txn *db.Transaction, key []byte) (OnCommit, error) {
+	zset, err := getGeoSet(txn, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []*geoPoint
+	if zset.Exist() {
+		if s.member != nil {
+			scores, exists, err := geoPositions(zset, [][]byte{s.member})
+			if err != nil {
+				return nil, err
+			}
+			if !exists[0] {
+				return nil, ErrGeoMember
+			}
+			s.shape.longitude, s.shape.latitude = geoDecodeScore(scores[0])
+		}
+		if points, err = s.run(zset); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.store != nil {
+		return s.save(ctx, txn, points)
+	}
+	return s.reply(ctx, points), nil
+}
+
+func (s *geoSearch) reply(ctx *Context, points []*geoPoint) OnCommit {
+	if !s.withDist && !s.withHash && !s.withCoord {
+		members := make([][]byte, len(points))
+		for i := range points {
+			members[i] = points[i].member
+		}
+		return BytesArray(ctx.Out, members)
+	}
+	return func() {
+		resp.ReplyArray(ctx.Out, len(points))
+		for _, p := range points {
+			size := 1
+			for _, with := range []bool{s.withDist, s.withHash, s.withCoord} {
+				if with {
+					size++
+				}
+			}
+			resp.ReplyArray(ctx.Out, size)
+			resp.ReplyBulkString(ctx.Out, string(p.member))
+			if s.withDist {
+				resp.ReplyBulkString(ctx.Out, formatGeoDistance(p.distance/s.shape.conversion))
+			}
+			if s.withHash {
+				resp.ReplyInteger(ctx.Out, int64(p.score))
+			}
+			if s.withCoord {
+				resp.ReplyArray(ctx.Out, 2)
+				resp.ReplyBulkString(ctx.Out, formatGeoCoord(p.longitude))
+				resp.ReplyBulkString(ctx.Out, formatGeoCoord(p.latitude))
+			}
+		}
+	}
+}
+
+// save stores the members found into the destination sorted set, which is overwritten
+func (s *geoSearch) save(ctx *Context, txn *db.Transaction, points []*geoPoint) (OnCommit, error) {
+	members := make([][]byte, len(points))
+	scores := make([]float64, len(points))
+	for i, p := range points {
+		members[i] = p.member
+		scores[i] = p.score
+		if s.storeDist {
+			scores[i] = p.distance / s.shape.conversion
+		}
+	}
+	added, err := zsetStore(txn, s.store, members, scores)
+	if err != nil {
+		return nil, err
+	}
+	if added == 0 {
+		return Integer(ctx.Out, 0), nil
+	}
+	return signal(ctx, Integer(ctx.Out, added), s.store), nil
+}
+
+func geoRadius(ctx *Context, txn *db.Transaction, byMember, store bool) (OnCommit, error) {
+	s, opts, err := parseGeoRadius(ctx.Args[1:], byMember)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.parseOptions(opts, false, store); err != nil {
+		return nil, err
+	}
+	return s.do(ctx, txn, []byte(ctx.Args[0]))
+}
+
+// GeoRadius queries the members within the radius of a position
+func GeoRadius(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return geoRadius(ctx, txn, false, true)
+}
+
+// GeoRadiusRO is the read only variant of georadius
+func GeoRadiusRO(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return geoRadius(ctx, txn, false, false)
+}
+
+// GeoRadiusByMember queries the members within the radius of a member
+func GeoRadiusByMember(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return geoRadius(ctx, txn, true, true)
+}
+
+// GeoRadiusByMemberRO is the read only variant of georadiusbymember
+func GeoRadiusByMemberRO(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return geoRadius(ctx, txn, true, false)
+}
+
+// GeoSearch queries the members within the area of a circle or a box
+func GeoSearch(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	s := &geoSearch{}
+	if err := s.parseOptions(ctx.Args[1:], true, false); err != nil {
+		return nil, err
+	}
+	return s.do(ctx, txn, []byte(ctx.Args[0]))
+}
+
+// GeoSearchStore is like geosearch but stores the result to the destination
+func GeoSearchStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	s := &geoSearch{store: []byte(ctx.Args[0])}
+	if err := s.parseOptions(ctx.Args[2:], true, true); err != nil {
+		return nil, err
+	}
+	return s.do(ctx, txn, []byte(ctx.Args[1]))
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func initGeo(key string) {
+	CallTest("geoadd", key, "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")
+}
+
+func TestGeoAdd(t *testing.T) {
+	key := "geo-geoadd"
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("geoadd", key, "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("geoadd", key, "13.361389", "38.115556", "Palermo")))
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", ctxString(CallTest("zscore", key, "Palermo")))
+
+	// the options
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("geoadd", key, "XX", "13", "38", "Palermo", "13", "38", "Rome")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zcard", key)))
+	assert.Equal(t, "$16\r\n3479065152021743\r\n", ctxString(CallTest("zscore", key, "Palermo")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("geoadd", key, "NX", "CH", "13.361389", "38.115556", "Palermo", "12.496366", "41.902782", "Rome")))
+	assert.Equal(t, "$16\r\n3479065152021743\r\n", ctxString(CallTest("zscore", key, "Palermo")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zcard", key)))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("geoadd", key, "CH", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania")))
+	// the last one wins
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("geoadd", key, "13", "38", "Palermo", "13.361389", "38.115556", "Palermo")))
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", ctxString(CallTest("zscore", key, "Palermo")))
+
+	assert.Equal(t, "-"+ErrNXAndXX.Error()+"\r\n", ctxString(CallTest("geoadd", key, "NX", "XX", "13", "38", "Palermo")))
+	assert.Equal(t, "-"+ErrGeoAddSyntax.Error()+"\r\n", ctxString(CallTest("geoadd", key, "13", "38", "Palermo", "15")))
+	assert.Equal(t, "-ERR invalid longitude,latitude pair 181.000000,38.000000\r\n", ctxString(CallTest("geoadd", key, "181", "38", "Palermo")))
+	assert.Equal(t, "-ERR invalid longitude,latitude pair 13.000000,86.000000\r\n", ctxString(CallTest("geoadd", key, "13", "86", "Palermo")))
+	assert.Equal(t, "-"+ErrFloat.Error()+"\r\n", ctxString(CallTest("geoadd", key, "a", "38", "Palermo")))
+}
+
+func TestGeoPos(t *testing.T) {
+	key := "geo-geopos"
+	initGeo(key)
+	assert.Equal(t, "*3\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n"+
+		"*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n*-1\r\n",
+		ctxString(CallTest("geopos", key, "Palermo", "Catania", "NonExisting")))
+	assert.Equal(t, "*1\r\n*-1\r\n", ctxString(CallTest("geopos", "geo-geopos-none", "Palermo")))
+}
+
+func TestGeoDist(t *testing.T) {
+	key := "geo-geodist"
+	initGeo(key)
+	assert.Equal(t, "$11\r\n166274.1516\r\n", ctxString(CallTest("geodist", key, "Palermo", "Catania")))
+	assert.Equal(t, "$8\r\n166.2742\r\n", ctxString(CallTest("geodist", key, "Palermo", "Catania", "km")))
+	assert.Equal(t, "$8\r\n103.3182\r\n", ctxString(CallTest("geodist", key, "Palermo", "Catania", "MI")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("geodist", key, "Palermo", "NonExisting")))
+	assert.Equal(t, "-"+ErrGeoUnit.Error()+"\r\n", ctxString(CallTest("geodist", key, "Palermo", "Catania", "cm")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("geodist", key, "Palermo", "Catania", "km", "m")))
+}
+
+func TestGeoHash(t *testing.T) {
+	key := "geo-geohash"
+	initGeo(key)
+	assert.Equal(t, "*3\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n$-1\r\n",
+		ctxString(CallTest("geohash", key, "Palermo", "Catania", "NonExisting")))
+}
+
+func TestGeoRadius(t *testing.T) {
+	key := "geo-georadius"
+	initGeo(key)
+	assert.Equal(t, "*2\r\n*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n",
+		ctxString(CallTest("georadius", key, "15", "37", "200", "km", "WITHDIST")))
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n",
+		ctxString(CallTest("georadius", key, "15", "37", "200", "km", "ASC")))
+	assert.Equal(t, "*2\r\n$7\r\nPalermo\r\n$7\r\nCatania\r\n",
+		ctxString(CallTest("georadius", key, "15", "37", "200", "km", "DESC")))
+	assert.Equal(t, "*1\r\n*2\r\n$7\r\nCatania\r\n:3479447370796909\r\n",
+		ctxString(CallTest("georadius_ro", key, "15", "37", "200", "km", "WITHHASH", "COUNT", "1")))
+	assert.Equal(t, "*1\r\n*2\r\n$7\r\nCatania\r\n*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n",
+		ctxString(CallTest("georadius", key, "15", "37", "100", "km", "WITHCOORD")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("georadius", key, "15", "37", "10", "km")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("georadius", "geo-georadius-none", "15", "37", "200", "km")))
+
+	assert.Equal(t, "*2\r\n$7\r\nPalermo\r\n$7\r\nCatania\r\n",
+		ctxString(CallTest("georadiusbymember", key, "Palermo", "200", "km", "ASC")))
+	assert.Equal(t, "*1\r\n$7\r\nPalermo\r\n",
+		ctxString(CallTest("georadiusbymember_ro", key, "Palermo", "100", "km")))
+	assert.Equal(t, "-"+ErrGeoMember.Error()+"\r\n", ctxString(CallTest("georadiusbymember", key, "NonExisting", "100", "km")))
+
+	assert.Equal(t, "-"+ErrGeoRadius.Error()+"\r\n", ctxString(CallTest("georadius", key, "15", "37", "-1", "km")))
+	assert.Equal(t, "-"+ErrGeoCount.Error()+"\r\n", ctxString(CallTest("georadius", key, "15", "37", "1", "km", "COUNT", "0")))
+	assert.Equal(t, "-"+ErrGeoAny.Error()+"\r\n", ctxString(CallTest("georadius", key, "15", "37", "1", "km", "ANY")))
+	assert.Equal(t, "-"+ErrGeoStore.Error()+"\r\n", ctxString(CallTest("georadius", key, "15", "37", "1", "km", "WITHDIST", "STORE", "dest")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("georadius_ro", key, "15", "37", "1", "km", "STORE", "dest")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("georadius", key, "15", "37", "1", "km", "WITH")))
+}
+
+func TestGeoRadiusStore(t *testing.T) {
+	key := "geo-georadiusstore"
+	dest := "geo-georadiusstore-dest"
+	initGeo(key)
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("georadius", key, "15", "37", "200", "km", "STORE", dest)))
+	assert.Equal(t, "$16\r\n3479099956230698\r\n", ctxString(CallTest("zscore", dest, "Palermo")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("georadius", key, "15", "37", "200", "km", "COUNT", "1", "STOREDIST", dest)))
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$16\r\n56.4412578701582\r\n",
+		ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	// the destination is removed if nothing is found
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("georadius", key, "15", "37", "1", "km", "STORE", dest)))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", dest)))
+}
+
+func TestGeoSearch(t *testing.T) {
+	key := "geo-geosearch"
+	initGeo(key)
+	CallTest("geoadd", key, "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2")
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$7\r\nPalermo\r\n",
+		ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC")))
+	assert.Equal(t, "*4\r\n*2\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n*2\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n"+
+		"*2\r\n$5\r\nedge2\r\n$8\r\n279.7403\r\n*2\r\n$5\r\nedge1\r\n$8\r\n279.7405\r\n",
+		ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHDIST")))
+	assert.Equal(t, "*1\r\n$7\r\nCatania\r\n",
+		ctxString(CallTest("geosearch", key, "FROMMEMBER", "Palermo", "BYBOX", "400", "400", "km", "DESC", "COUNT", "1")))
+
+	assert.Equal(t, "-"+ErrGeoFrom.Error()+"\r\n", ctxString(CallTest("geosearch", key, "BYRADIUS", "200", "km", "ASC", "WITHDIST")))
+	assert.Equal(t, "-"+ErrGeoFrom.Error()+"\r\n",
+		ctxString(CallTest("geosearch", key, "FROMMEMBER", "Palermo", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km")))
+	assert.Equal(t, "-"+ErrGeoBy.Error()+"\r\n", ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "ASC", "WITHDIST")))
+	assert.Equal(t, "-"+ErrGeoBy.Error()+"\r\n",
+		ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "BYBOX", "1", "1", "km")))
+	assert.Equal(t, "-"+ErrGeoBox.Error()+"\r\n", ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "BYBOX", "-1", "1", "km")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST")))
+}
+
+func TestGeoSearchStore(t *testing.T) {
+	key := "geo-geosearchstore"
+	dest := "geo-geosearchstore-dest"
+	initGeo(key)
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("geosearchstore", dest, key, "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zcard", dest)))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("geosearchstore", dest, key, "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "STOREDIST")))
+	assert.Equal(t, "*2\r\n$7\r\nCatania\r\n$16\r\n56.4412578701582\r\n",
+		ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n",
+		ctxString(CallTest("geosearchstore", dest, key, "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "WITHDIST")))
+}
@@ -0,0 +1,314 @@
+package command
+
+import (
+	"math"
+)
+
+// The geohash implementation is compatible with redis, a position is encoded as a
+// 52 bits integer interleaving 26 bits latitude(even bits) and 26 bits longitude(odd bits),
+// which is used as the score of the member so the positions near each other have scores
+// near each other as well.
+
+const (
+	geoStepMax = 26
+
+	geoLatMin  = -85.05112878
+	geoLatMax  = 85.05112878
+	geoLongMin = -180.0
+	geoLongMax = 180.0
+
+	// the standard latitude range used to output a geohash string
+	geoStandardLatMin = -90.0
+	geoStandardLatMax = 90.0
+
+	earthRadiusInMeters = 6372797.560856
+	mercatorMax         = 20037726.37
+
+	geoAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+type geoRange struct {
+	min, max float64
+}
+
+var (
+	geoLatRange         = geoRange{geoLatMin, geoLatMax}
+	geoLongRange        = geoRange{geoLongMin, geoLongMax}
+	geoStandardLatRange = geoRange{geoStandardLatMin, geoStandardLatMax}
+)
+
+// geoHash is the geohash of a position with step*2 bits
+type geoHash struct {
+	bits uint64
+	step uint
+}
+
+// geoArea is the area covered by a geohash
+type geoArea struct {
+	hash      geoHash
+	longitude geoRange
+	latitude  geoRange
+}
+
+// interleave64 interleaves the bits of x and y, x is in the even bits
+func interleave64(x, y uint32) uint64 {
+	spread := func(v uint64) uint64 {
+		v = (v | v<<16) & 0x0000FFFF0000FFFF
+		v = (v | v<<8) & 0x00FF00FF00FF00FF
+		v = (v | v<<4) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v<<2) & 0x3333333333333333
+		v = (v | v<<1) & 0x5555555555555555
+		return v
+	}
+	return spread(uint64(x)) | spread(uint64(y))<<1
+}
+
+// deinterleave64 is the reverse of interleave64
+func deinterleave64(v uint64) (x, y uint32) {
+	squash := func(v uint64) uint32 {
+		v &= 0x5555555555555555
+		v = (v | v>>1) & 0x3333333333333333
+		v = (v | v>>2) & 0x0F0F0F0F0F0F0F0F
+		v = (v | v>>4) & 0x00FF00FF00FF00FF
+		v = (v | v>>8) & 0x0000FFFF0000FFFF
+		v = (v | v>>16) & 0x00000000FFFFFFFF
+		return uint32(v)
+	}
+	return squash(v), squash(v >> 1)
+}
+
+// validGeoPosition checks if a position can be indexed
+func validGeoPosition(longitude, latitude float64) bool {
+	return longitude >= geoLongMin && longitude <= geoLongMax &&
+		latitude >= geoLatMin && latitude <= geoLatMax
+}
+
+func geoEncode(longRange, latRange geoRange, longitude, latitude float64, step uint) geoHash {
+	latOffset := (latitude - latRange.min) / (latRange.max - latRange.min)
+	longOffset := (longitude - longRange.min) / (longRange.max - longRange.min)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return geoHash{bits: interleave64(uint32(latOffset), uint32(longOffset)), step: step}
+}
+
+// geoEncodeWGS84 encodes a position to a geohash with the max precision
+func geoEncodeWGS84(longitude, latitude float64) geoHash {
+	return geoEncode(geoLongRange, geoLatRange, longitude, latitude, geoStepMax)
+}
+
+func geoDecode(longRange, latRange geoRange, hash geoHash) geoArea {
+	ilat, ilong := deinterleave64(hash.bits)
+	latScale := latRange.max - latRange.min
+	longScale := longRange.max - longRange.min
+	cells := float64(uint64(1) << hash.step)
+	return geoArea{
+		hash: hash,
+		latitude: geoRange{
+			min: latRange.min + float64(ilat)/cells*latScale,
+			max: latRange.min + float64(ilat+1)/cells*latScale,
+		},
+		longitude: geoRange{
+			min: longRange.min + float64(ilong)/cells*longScale,
+			max: longRange.min + float64(ilong+1)/cells*longScale,
+		},
+	}
+}
+
+// geoDecodeScore decodes the score of a member to the position
+func geoDecodeScore(score float64) (longitude, latitude float64) {
+	area := geoDecode(geoLongRange, geoLatRange, geoHash{bits: uint64(score), step: geoStepMax})
+	longitude = math.Min(math.Max((area.longitude.min+area.longitude.max)/2, geoLongMin), geoLongMax)
+	latitude = math.Min(math.Max((area.latitude.min+area.latitude.max)/2, geoLatMin), geoLatMax)
+	return longitude, latitude
+}
+
+// geoHashString returns the standard 11 characters geohash string of a position
+func geoHashString(longitude, latitude float64) string {
+	hash := geoEncode(geoLongRange, geoStandardLatRange, longitude, latitude, geoStepMax)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		// there are only 52 bits, the last character is always zero
+		if i < 10 {
+			idx = int(hash.bits>>(52-uint(i+1)*5)) & 0x1f
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf)
+}
+
+func geoMoveX(hash geoHash, d int) geoHash {
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.step*2)
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+	x &= 0xaaaaaaaaaaaaaaaa >> (64 - hash.step*2)
+	return geoHash{bits: x | y, step: hash.step}
+}
+
+func geoMoveY(hash geoHash, d int) geoHash {
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= 0x5555555555555555 >> (64 - hash.step*2)
+	return geoHash{bits: x | y, step: hash.step}
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad / (math.Pi / 180)
+}
+
+// geoDistance returns the distance in meters of two positions with the haversine formula
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := degRad(lat1), degRad(lon1)
+	lat2r, lon2r := degRad(lat2), degRad(lon2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2.0 * earthRadiusInMeters * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// geoShape is the area to search, it is a circle if width and height are zero, or a box otherwise
+type geoShape struct {
+	longitude, latitude float64
+	// the unit of radius, width and height, in meters
+	conversion    float64
+	radius        float64
+	width, height float64
+}
+
+func (s *geoShape) isBox() bool {
+	return s.width > 0 || s.height > 0
+}
+
+// boundingBox returns the min and max longitude and latitude covering the shape
+func (s *geoShape) boundingBox() (minLon, minLat, maxLon, maxLat float64) {
+	width, height := s.radius, s.radius
+	if s.isBox() {
+		width, height = s.width/2, s.height/2
+	}
+	width *= s.conversion
+	height *= s.conversion
+
+	latDelta := radDeg(height / earthRadiusInMeters)
+	longDeltaTop := radDeg(width / earthRadiusInMeters / math.Cos(degRad(s.latitude+latDelta)))
+	longDeltaBottom := radDeg(width / earthRadiusInMeters / math.Cos(degRad(s.latitude-latDelta)))
+	// the directions of the northern and southern hemispheres are opposite
+	if s.latitude < 0 {
+		return s.longitude - longDeltaBottom, s.latitude - latDelta, s.longitude + longDeltaBottom, s.latitude + latDelta
+	}
+	return s.longitude - longDeltaTop, s.latitude - latDelta, s.longitude + longDeltaTop, s.latitude + latDelta
+}
+
+// distance returns the distance in meters to the shape center if the position is in the shape
+func (s *geoShape) distance(longitude, latitude float64) (float64, bool) {
+	if s.isBox() {
+		// the latitude distance is cheaper, so it is checked first
+		if earthRadiusInMeters*math.Abs(degRad(latitude)-degRad(s.latitude)) > s.height*s.conversion/2 {
+			return 0, false
+		}
+		if geoDistance(longitude, latitude, s.longitude, latitude) > s.width*s.conversion/2 {
+			return 0, false
+		}
+		return geoDistance(s.longitude, s.latitude, longitude, latitude), true
+	}
+	distance := geoDistance(s.longitude, s.latitude, longitude, latitude)
+	return distance, distance <= s.radius*s.conversion
+}
+
+// estimateSteps returns the precision of the geohash whose cells are large enough to cover the range
+func estimateSteps(rangeMeters, latitude float64) uint {
+	if rangeMeters == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for rangeMeters < mercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	// make sure the range is included in most of the base cases
+	step -= 2
+	// the range is wider towards the poles
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	if step < 1 {
+		step = 1
+	}
+	if step > geoStepMax {
+		step = geoStepMax
+	}
+	return uint(step)
+}
+
+// areas returns the geohash cells to search, they are the cell of the center and its
+// neighbors except those out of the bounding box of the shape
+func (s *geoShape) areas() []geoHash {
+	minLon, minLat, maxLon, maxLat := s.boundingBox()
+	radius := s.radius * s.conversion
+	if s.isBox() {
+		radius = math.Sqrt((s.width/2)*(s.width/2)+(s.height/2)*(s.height/2)) * s.conversion
+	}
+	steps := estimateSteps(radius, s.latitude)
+
+	center := geoEncode(geoLongRange, geoLatRange, s.longitude, s.latitude, steps)
+	north, south := geoMoveY(center, 1), geoMoveY(center, -1)
+	east, west := geoMoveX(center, 1), geoMoveX(center, -1)
+	// the step is not enough when the shape is near the edge of the center cell
+	if steps > 1 && (geoDecode(geoLongRange, geoLatRange, north).latitude.max < maxLat ||
+		geoDecode(geoLongRange, geoLatRange, south).latitude.min > minLat ||
+		geoDecode(geoLongRange, geoLatRange, east).longitude.max < maxLon ||
+		geoDecode(geoLongRange, geoLatRange, west).longitude.min > minLon) {
+		steps--
+		center = geoEncode(geoLongRange, geoLatRange, s.longitude, s.latitude, steps)
+	}
+
+	area := geoDecode(geoLongRange, geoLatRange, center)
+	// the neighbors in the directions, -1 for south or west and 1 for north or east
+	type neighbor struct {
+		dx, dy int
+	}
+	neighbors := []neighbor{{0, 1}, {0, -1}, {1, 0}, {-1, 0}, {1, 1}, {-1, 1}, {1, -1}, {-1, -1}}
+	hashes := []geoHash{center}
+	for _, n := range neighbors {
+		// exclude the useless neighbors
+		if steps >= 2 {
+			if (n.dy < 0 && area.latitude.min < minLat) || (n.dy > 0 && area.latitude.max > maxLat) ||
+				(n.dx < 0 && area.longitude.min < minLon) || (n.dx > 0 && area.longitude.max > maxLon) {
+				continue
+			}
+		}
+		hash := center
+		if n.dx != 0 {
+			hash = geoMoveX(hash, n.dx)
+		}
+		if n.dy != 0 {
+			hash = geoMoveY(hash, n.dy)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes
+}
+
+// scoreRange returns the score range [min, max) of the members in the cell
+func (h geoHash) scoreRange() (float64, float64) {
+	shift := 52 - h.step*2
+	return float64(h.bits << shift), float64((h.bits + 1) << shift)
+}
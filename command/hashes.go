@@ -90,7 +90,7 @@ func HGet(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if val == nil {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 	return BulkString(ctx.Out, string(val)), nil
 }
@@ -116,7 +116,7 @@ func HGetAll(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		results[i*2+1] = vals[i]
 	}
 
-	return BytesArray(ctx.Out, results), nil
+	return BytesMap(ctx, results), nil
 }
 
 // HExists returns if field is an existing field in the hash stored at key
@@ -0,0 +1,111 @@
+package command
+
+import (
+	"errors"
+
+	"github.com/distributedio/titan/db"
+)
+
+var (
+	// ErrHLLType is returned when the string is not a HyperLogLog
+	ErrHLLType = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+
+	// ErrHLLCorrupted is returned when the HyperLogLog is corrupted
+	ErrHLLCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// getHyperLogLog returns the string and the HyperLogLog stored in it, the HyperLogLog is nil if the key does not exist
+func getHyperLogLog(txn *db.Transaction, key []byte) (*db.String, *db.HyperLogLog, error) {
+	str, err := txn.String(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, nil, ErrTypeMismatch
+		}
+		return nil, nil, errors.New("ERR " + err.Error())
+	}
+	if !str.Exist() {
+		return str, nil, nil
+	}
+	val, err := str.Get()
+	if err != nil {
+		return nil, nil, errors.New("ERR " + err.Error())
+	}
+	hll, err := db.DecodeHyperLogLog(val)
+	if err != nil {
+		if err == db.ErrHLLCorrupted {
+			return nil, nil, ErrHLLCorrupted
+		}
+		return nil, nil, ErrHLLType
+	}
+	return str, hll, nil
+}
+
+// PFAdd adds the specified elements to the specified HyperLogLog
+func PFAdd(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	str, hll, err := getHyperLogLog(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	updated := false
+	if hll == nil {
+		hll = db.NewHyperLogLog()
+		updated = true
+	}
+	for _, element := range ctx.Args[1:] {
+		if hll.Add([]byte(element)) {
+			updated = true
+		}
+	}
+	if !updated {
+		return Integer(ctx.Out, 0), nil
+	}
+	if err := str.Update(hll.Encode()); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, 1), nil
+}
+
+// PFCount returns the approximated cardinality of the union of the HyperLogLogs
+func PFCount(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	union := db.NewHyperLogLog()
+	for _, key := range ctx.Args {
+		_, hll, err := getHyperLogLog(txn, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		if hll == nil {
+			continue
+		}
+		// the cached cardinality is used if there is only one key
+		if len(ctx.Args) == 1 {
+			union = hll
+			break
+		}
+		union.Merge(hll)
+	}
+	return Integer(ctx.Out, int64(union.Count())), nil
+}
+
+// PFMerge merges the source HyperLogLogs into the destination HyperLogLog
+func PFMerge(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	str, dest, err := getHyperLogLog(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if dest == nil {
+		dest = db.NewHyperLogLog()
+	}
+	for _, key := range ctx.Args[1:] {
+		_, hll, err := getHyperLogLog(txn, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		if hll != nil {
+			dest.Merge(hll)
+		}
+	}
+	if err := str.Update(dest.Encode()); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return SimpleString(ctx.Out, OK), nil
+}
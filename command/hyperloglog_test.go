@@ -0,0 +1,52 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPFAdd(t *testing.T) {
+	key := "hll-pfadd"
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("pfadd", key)))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("pfadd", key)))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("pfadd", key, "a", "b", "c")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("pfadd", key, "a", "b")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("pfcount", key)))
+
+	// the value is a string in the format of redis
+	assert.Equal(t, "+string\r\n", ctxString(CallTest("type", key)))
+	assert.Contains(t, ctxString(CallTest("get", key)), "HYLL")
+
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "hll-pfadd-string", "value")))
+	assert.Equal(t, "-"+ErrHLLType.Error()+"\r\n", ctxString(CallTest("pfadd", "hll-pfadd-string", "a")))
+	assert.Equal(t, "-"+ErrHLLType.Error()+"\r\n", ctxString(CallTest("pfcount", "hll-pfadd-string")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("lpush", "pfadd-list", "a")))
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("pfadd", "pfadd-list", "a")))
+}
+
+func TestPFCount(t *testing.T) {
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("pfcount", "hll-pfcount-none")))
+	CallTest("pfadd", "hll-pfcount-1", "a", "b", "c")
+	CallTest("pfadd", "hll-pfcount-2", "c", "d")
+	assert.Equal(t, ":4\r\n", ctxString(CallTest("pfcount", "hll-pfcount-1", "hll-pfcount-2", "hll-pfcount-none")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("pfcount", "hll-pfcount-2")))
+}
+
+func TestPFMerge(t *testing.T) {
+	CallTest("pfadd", "hll-pfmerge-1", "a", "b", "c")
+	CallTest("pfadd", "hll-pfmerge-2", "c", "d")
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("pfmerge", "hll-pfmerge", "hll-pfmerge-1", "hll-pfmerge-2")))
+	assert.Equal(t, ":4\r\n", ctxString(CallTest("pfcount", "hll-pfmerge")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("pfmerge", "hll-pfmerge-empty")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("exists", "hll-pfmerge-empty")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("pfcount", "hll-pfmerge-empty")))
+
+	// the ttl is kept
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("expire", "hll-pfmerge", "100")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("pfmerge", "hll-pfmerge", "hll-pfmerge-1")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("pfadd", "hll-pfmerge", "e")))
+	ttl := ctxString(CallTest("ttl", "hll-pfmerge"))
+	assert.NotEqual(t, ":-1\r\n", ttl)
+	assert.NotEqual(t, ":-2\r\n", ttl)
+}
@@ -8,11 +8,20 @@ func init() {
 	commands = map[string]Desc{
 		// connections
 		"auth":   Desc{Proc: Auth, Cons: Constraint{2, flags("sltF"), 0, 0, 0}},
+		"hello":  Desc{Proc: Hello, Cons: Constraint{-1, flags("sltF"), 0, 0, 0}},
 		"echo":   Desc{Proc: Echo, Cons: Constraint{2, flags("F"), 0, 0, 0}},
 		"ping":   Desc{Proc: Ping, Cons: Constraint{-1, flags("tF"), 0, 0, 0}},
 		"quit":   Desc{Proc: Quit, Cons: Constraint{1, 0, 0, 0, 0}},
 		"select": Desc{Proc: Select, Cons: Constraint{2, flags("lF"), 0, 0, 0}},
-		"swapdb": Desc{Proc: SwapDB, Cons: Constraint{3, flags("wF"), 0, 0, 0}},
+		"swapdb": Desc{Proc: AutoCommit(SwapDB), Txn: SwapDB, Cons: Constraint{3, flags("wF"), 0, 0, 0}},
+
+		// pubsub
+		"subscribe":    Desc{Proc: Subscribe, Cons: Constraint{-2, flags("pslt"), 0, 0, 0}},
+		"unsubscribe":  Desc{Proc: Unsubscribe, Cons: Constraint{-1, flags("pslt"), 0, 0, 0}},
+		"psubscribe":   Desc{Proc: PSubscribe, Cons: Constraint{-2, flags("pslt"), 0, 0, 0}},
+		"punsubscribe": Desc{Proc: PUnsubscribe, Cons: Constraint{-1, flags("pslt"), 0, 0, 0}},
+		"publish":      Desc{Proc: Publish, Cons: Constraint{3, flags("pltF"), 0, 0, 0}},
+		"pubsub":       Desc{Proc: PubSub, Cons: Constraint{-2, flags("pltR"), 0, 0, 0}},
 
 		// transactions, exec and discard should called explicitly, so they are registered here
 		"multi":   Desc{Proc: Multi, Cons: Constraint{1, flags("sF"), 0, 0, 0}},
@@ -34,6 +43,13 @@ func init() {
 		"rpoplpush": Desc{Proc: AutoCommit(RPopLPush), Txn: RPopLPush, Cons: Constraint{3, flags("wF"), 1, 2, 1}},
 		"rpush":     Desc{Proc: AutoCommit(RPush), Txn: RPush, Cons: Constraint{-3, flags("wmF"), 1, 1, 1}},
 		"rpushx":    Desc{Proc: AutoCommit(RPushx), Txn: RPushx, Cons: Constraint{-3, flags("wmF"), 1, 1, 1}},
+		"lmove":     Desc{Proc: AutoCommit(LMove), Txn: LMove, Cons: Constraint{5, flags("wm"), 1, 2, 1}},
+
+		// blocking lists, they do not block in a multi/exec block
+		"blpop":      Desc{Proc: Blocking(BLPop, blpopKeys), Txn: NonBlocking(BLPop, nullArray), Cons: Constraint{-3, flags("ws"), 1, -2, 1}},
+		"brpop":      Desc{Proc: Blocking(BRPop, blpopKeys), Txn: NonBlocking(BRPop, nullArray), Cons: Constraint{-3, flags("ws"), 1, -2, 1}},
+		"brpoplpush": Desc{Proc: Blocking(BRPopLPush, bmoveKeys), Txn: NonBlocking(BRPopLPush, NullBulkString), Cons: Constraint{4, flags("wms"), 1, 2, 1}},
+		"blmove":     Desc{Proc: Blocking(BLMove, bmoveKeys), Txn: NonBlocking(BLMove, NullBulkString), Cons: Constraint{6, flags("wms"), 1, 2, 1}},
 
 		// strings
 		"get":         Desc{Proc: AutoCommit(Get), Txn: Get, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
@@ -54,30 +70,43 @@ func init() {
 		"decrby":      Desc{Proc: AutoCommit(DecrBy), Txn: DecrBy, Cons: Constraint{3, flags("wmF"), 1, 1, 1}},
 		"incrbyfloat": Desc{Proc: AutoCommit(IncrByFloat), Txn: IncrByFloat, Cons: Constraint{3, flags("wmF"), 1, 1, 1}},
 		"setbit":      Desc{Proc: AutoCommit(SetBit), Txn: SetBit, Cons: Constraint{4, flags("wm"), 1, 1, 1}},
-		// "bitop":       Desc{Proc: AutoCommit(BitOp), Cons: Constraint{-4, flags("wm"), 2, -1, 1}},
-		// "bitfield":    Desc{Proc: AutoCommit(BitField), Cons: Constraint{-2, flags("wm"), 1, 1, 1}},
-		"getbit":   Desc{Proc: AutoCommit(GetBit), Txn: GetBit, Cons: Constraint{3, flags("r"), 1, 1, 1}},
-		"bitcount": Desc{Proc: AutoCommit(BitCount), Txn: BitCount, Cons: Constraint{-2, flags("r"), 1, 1, 1}},
-		"bitpos":   Desc{Proc: AutoCommit(BitPos), Txn: BitPos, Cons: Constraint{-3, flags("r"), 1, 1, 1}},
-		"getset":   Desc{Proc: AutoCommit(GetSet), Txn: GetSet, Cons: Constraint{3, flags("wm"), 1, 1, 1}},
+		"bitop":       Desc{Proc: AutoCommit(BitOp), Txn: BitOp, Cons: Constraint{-4, flags("wm"), 2, -1, 1}},
+		"bitfield":    Desc{Proc: AutoCommit(BitField), Txn: BitField, Cons: Constraint{-2, flags("wm"), 1, 1, 1}},
+		"bitfield_ro": Desc{Proc: AutoCommit(BitFieldRO), Txn: BitFieldRO, Cons: Constraint{-2, flags("rF"), 1, 1, 1}},
+		"getbit":      Desc{Proc: AutoCommit(GetBit), Txn: GetBit, Cons: Constraint{3, flags("r"), 1, 1, 1}},
+		"bitcount":    Desc{Proc: AutoCommit(BitCount), Txn: BitCount, Cons: Constraint{-2, flags("r"), 1, 1, 1}},
+		"bitpos":      Desc{Proc: AutoCommit(BitPos), Txn: BitPos, Cons: Constraint{-3, flags("r"), 1, 1, 1}},
+		"getset":      Desc{Proc: AutoCommit(GetSet), Txn: GetSet, Cons: Constraint{3, flags("wm"), 1, 1, 1}},
+		"getex":       Desc{Proc: AutoCommit(GetEx), Txn: GetEx, Cons: Constraint{-2, flags("wF"), 1, 1, 1}},
+		"getdel":      Desc{Proc: AutoCommit(GetDel), Txn: GetDel, Cons: Constraint{2, flags("wF"), 1, 1, 1}},
 
 		// keys
-		"type":      Desc{Proc: AutoCommit(Type), Txn: Type, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
-		"exists":    Desc{Proc: AutoCommit(Exists), Txn: Exists, Cons: Constraint{-2, flags("rF"), 1, -1, 1}},
-		"keys":      Desc{Proc: AutoCommit(Keys), Txn: Keys, Cons: Constraint{-2, flags("rS"), 0, 0, 0}},
-		"del":       Desc{Proc: AutoCommit(Delete), Txn: Delete, Cons: Constraint{-2, flags("w"), 1, -1, 1}},
-		"unlink":    Desc{Proc: AutoCommit(Delete), Txn: Delete, Cons: Constraint{-2, flags("w"), 1, -1, 1}},
-		"expire":    Desc{Proc: AutoCommit(Expire), Txn: Expire, Cons: Constraint{3, flags("wF"), 1, 1, 1}},
-		"expireat":  Desc{Proc: AutoCommit(ExpireAt), Txn: ExpireAt, Cons: Constraint{3, flags("wF"), 1, 1, 1}},
-		"pexpire":   Desc{Proc: AutoCommit(PExpire), Txn: PExpire, Cons: Constraint{3, flags("wF"), 1, 1, 1}},
-		"pexpireat": Desc{Proc: AutoCommit(PExpireAt), Txn: PExpireAt, Cons: Constraint{3, flags("wF"), 1, 1, 1}},
-		"persist":   Desc{Proc: AutoCommit(Persist), Txn: Persist, Cons: Constraint{2, flags("wF"), 1, 1, 1}},
-		"ttl":       Desc{Proc: AutoCommit(TTL), Txn: TTL, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
-		"pttl":      Desc{Proc: AutoCommit(PTTL), Txn: PTTL, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
-		"object":    Desc{Proc: AutoCommit(Object), Txn: Object, Cons: Constraint{-2, flags("rR"), 0, 0, 0}},
-		"scan":      Desc{Proc: AutoCommit(Scan), Txn: Scan, Cons: Constraint{-2, flags("rR"), 0, 0, 0}},
-		"randomkey": Desc{Proc: AutoCommit(RandomKey), Txn: RandomKey, Cons: Constraint{1, flags("rR"), 0, 0, 0}},
-		"touch":     Desc{Proc: AutoCommit(Touch), Txn: Touch, Cons: Constraint{-2, flags("rF"), 1, -1, 1}},
+		"type":        Desc{Proc: AutoCommit(Type), Txn: Type, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"exists":      Desc{Proc: AutoCommit(Exists), Txn: Exists, Cons: Constraint{-2, flags("rF"), 1, -1, 1}},
+		"keys":        Desc{Proc: AutoCommit(Keys), Txn: Keys, Cons: Constraint{-2, flags("rS"), 0, 0, 0}},
+		"del":         Desc{Proc: AutoCommit(Delete), Txn: Delete, Cons: Constraint{-2, flags("w"), 1, -1, 1}},
+		"unlink":      Desc{Proc: AutoCommit(Delete), Txn: Delete, Cons: Constraint{-2, flags("w"), 1, -1, 1}},
+		"expire":      Desc{Proc: AutoCommit(Expire), Txn: Expire, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"expireat":    Desc{Proc: AutoCommit(ExpireAt), Txn: ExpireAt, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"pexpire":     Desc{Proc: AutoCommit(PExpire), Txn: PExpire, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"pexpireat":   Desc{Proc: AutoCommit(PExpireAt), Txn: PExpireAt, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"persist":     Desc{Proc: AutoCommit(Persist), Txn: Persist, Cons: Constraint{2, flags("wF"), 1, 1, 1}},
+		"ttl":         Desc{Proc: AutoCommit(TTL), Txn: TTL, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"pttl":        Desc{Proc: AutoCommit(PTTL), Txn: PTTL, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"expiretime":  Desc{Proc: AutoCommit(ExpireTime), Txn: ExpireTime, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"pexpiretime": Desc{Proc: AutoCommit(PExpireTime), Txn: PExpireTime, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"object":      Desc{Proc: AutoCommit(Object), Txn: Object, Cons: Constraint{-2, flags("rR"), 0, 0, 0}},
+		"scan":        Desc{Proc: AutoCommit(Scan), Txn: Scan, Cons: Constraint{-2, flags("rR"), 0, 0, 0}},
+		"randomkey":   Desc{Proc: AutoCommit(RandomKey), Txn: RandomKey, Cons: Constraint{1, flags("rR"), 0, 0, 0}},
+		"touch":       Desc{Proc: AutoCommit(Touch), Txn: Touch, Cons: Constraint{-2, flags("rF"), 1, -1, 1}},
+		"rename":      Desc{Proc: AutoCommit(Rename), Txn: Rename, Cons: Constraint{3, flags("w"), 1, 2, 1}},
+		"renamenx":    Desc{Proc: AutoCommit(RenameNx), Txn: RenameNx, Cons: Constraint{3, flags("wF"), 1, 2, 1}},
+		"move":        Desc{Proc: AutoCommit(Move), Txn: Move, Cons: Constraint{3, flags("wF"), 1, 1, 1}},
+		"copy":        Desc{Proc: AutoCommit(Copy), Txn: Copy, Cons: Constraint{-3, flags("wm"), 1, 2, 1}},
+		"dump":        Desc{Proc: AutoCommit(Dump), Txn: Dump, Cons: Constraint{2, flags("rR"), 1, 1, 1}},
+		"restore":     Desc{Proc: AutoCommit(Restore), Txn: Restore, Cons: Constraint{-4, flags("wm"), 1, 1, 1}},
+		"sort":        Desc{Proc: AutoCommit(Sort), Txn: Sort, Cons: Constraint{-2, flags("wm"), 1, 1, 1}},
+		"sort_ro":     Desc{Proc: AutoCommit(SortRO), Txn: SortRO, Cons: Constraint{-2, flags("r"), 1, 1, 1}},
 
 		// server
 		"monitor":  Desc{Proc: Monitor, Cons: Constraint{1, flags("as"), 0, 0, 0}},
@@ -85,9 +114,12 @@ func init() {
 		"debug":    Desc{Proc: AutoCommit(Debug), Cons: Constraint{-2, flags("as"), 0, 0, 0}},
 		"command":  Desc{Proc: RedisCommand, Cons: Constraint{0, flags("lt"), 0, 0, 0}},
 		"flushdb":  Desc{Proc: AutoCommit(FlushDB), Cons: Constraint{-1, flags("w"), 0, 0, 0}},
+		"dbsize":   Desc{Proc: AutoCommit(DBSize), Txn: DBSize, Cons: Constraint{1, flags("rF"), 0, 0, 0}},
 		"flushall": Desc{Proc: AutoCommit(FlushAll), Cons: Constraint{-1, flags("w"), 0, 0, 0}},
 		"time":     Desc{Proc: Time, Cons: Constraint{1, flags("RF"), 0, 0, 0}},
 		"info":     Desc{Proc: Info, Cons: Constraint{-1, flags("lt"), 0, 0, 0}},
+		"slowlog":  Desc{Proc: SlowLog, Cons: Constraint{-2, flags("aRlt"), 0, 0, 0}},
+		"config":   Desc{Proc: Config, Cons: Constraint{-2, flags("aslt"), 0, 0, 0}},
 
 		// hashes
 		"hdel":         Desc{Proc: AutoCommit(HDel), Txn: HDel, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
@@ -107,16 +139,23 @@ func init() {
 		"hscan":        Desc{Proc: AutoCommit(HScan), Txn: HScan, Cons: Constraint{-3, flags("rR"), 0, 0, 0}},
 
 		// sets
-		"sadd":      Desc{Proc: AutoCommit(SAdd), Txn: SAdd, Cons: Constraint{-3, flags("wmF"), 1, 1, 1}},
-		"smembers":  Desc{Proc: AutoCommit(SMembers), Txn: SMembers, Cons: Constraint{2, flags("rS"), 1, 1, 1}},
-		"scard":     Desc{Proc: AutoCommit(SCard), Txn: SCard, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
-		"sismember": Desc{Proc: AutoCommit(SIsmember), Txn: SIsmember, Cons: Constraint{3, flags("rF"), 1, 1, 1}},
-		"spop":      Desc{Proc: AutoCommit(SPop), Txn: SPop, Cons: Constraint{-2, flags("wRF"), 1, 1, 1}},
-		"srem":      Desc{Proc: AutoCommit(SRem), Txn: SRem, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
-		"sunion":    Desc{Proc: AutoCommit(SUnion), Txn: SUnion, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
-		"sinter":    Desc{Proc: AutoCommit(SInter), Txn: SInter, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
-		"sdiff":     Desc{Proc: AutoCommit(SDiff), Txn: SDiff, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
-		"smove":     Desc{Proc: AutoCommit(SMove), Txn: SMove, Cons: Constraint{4, flags("wF"), 1, 2, 1}},
+		"sadd":        Desc{Proc: AutoCommit(SAdd), Txn: SAdd, Cons: Constraint{-3, flags("wmF"), 1, 1, 1}},
+		"smembers":    Desc{Proc: AutoCommit(SMembers), Txn: SMembers, Cons: Constraint{2, flags("rS"), 1, 1, 1}},
+		"scard":       Desc{Proc: AutoCommit(SCard), Txn: SCard, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"sismember":   Desc{Proc: AutoCommit(SIsmember), Txn: SIsmember, Cons: Constraint{3, flags("rF"), 1, 1, 1}},
+		"spop":        Desc{Proc: AutoCommit(SPop), Txn: SPop, Cons: Constraint{-2, flags("wRF"), 1, 1, 1}},
+		"srem":        Desc{Proc: AutoCommit(SRem), Txn: SRem, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"sunion":      Desc{Proc: AutoCommit(SUnion), Txn: SUnion, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
+		"sinter":      Desc{Proc: AutoCommit(SInter), Txn: SInter, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
+		"sdiff":       Desc{Proc: AutoCommit(SDiff), Txn: SDiff, Cons: Constraint{-2, flags("rS"), 1, -1, 1}},
+		"smove":       Desc{Proc: AutoCommit(SMove), Txn: SMove, Cons: Constraint{4, flags("wF"), 1, 2, 1}},
+		"smismember":  Desc{Proc: AutoCommit(SMIsmember), Txn: SMIsmember, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"srandmember": Desc{Proc: AutoCommit(SRandMember), Txn: SRandMember, Cons: Constraint{-2, flags("rR"), 1, 1, 1}},
+		"sscan":       Desc{Proc: AutoCommit(SScan), Txn: SScan, Cons: Constraint{-3, flags("rR"), 1, 1, 1}},
+		"sintercard":  Desc{Proc: AutoCommit(SInterCard), Txn: SInterCard, Cons: Constraint{-3, flags("r"), 0, 0, 0}},
+		"sunionstore": Desc{Proc: AutoCommit(SUnionStore), Txn: SUnionStore, Cons: Constraint{-3, flags("wm"), 1, -1, 1}},
+		"sinterstore": Desc{Proc: AutoCommit(SInterStore), Txn: SInterStore, Cons: Constraint{-3, flags("wm"), 1, -1, 1}},
+		"sdiffstore":  Desc{Proc: AutoCommit(SDiffStore), Txn: SDiffStore, Cons: Constraint{-3, flags("wm"), 1, -1, 1}},
 
 		// zsets
 		"zadd":             Desc{Proc: AutoCommit(ZAdd), Txn: ZAdd, Cons: Constraint{-4, flags("wmF"), 1, 1, 1}},
@@ -127,15 +166,79 @@ func init() {
 		"zrangebylex":      Desc{Proc: AutoCommit(ZRangeByLex), Txn: ZRangeByScore, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
 		"zrevrangebylex":   Desc{Proc: AutoCommit(ZRevRangeByLex), Txn: ZRevRangeByScore, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
 
-		"zrem":           Desc{Proc: AutoCommit(ZRem), Txn: ZRem, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
-		"zremrangebylex": Desc{Proc: AutoCommit(ZRemRangeByLex), Txn: ZRemRangeByLex, Cons: Constraint{-4, flags("wF"), 1, 1, 1}},
-		"zcard":          Desc{Proc: AutoCommit(ZCard), Txn: ZCard, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
-		"zcount":         Desc{Proc: AutoCommit(ZCount), Txn: ZCount, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
-		"zlexcount":      Desc{Proc: AutoCommit(ZLexCount), Txn: ZLexCount, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
-		"zscore":         Desc{Proc: AutoCommit(ZScore), Txn: ZScore, Cons: Constraint{3, flags("rF"), 1, 1, 1}},
-		"zscan":          Desc{Proc: AutoCommit(ZScan), Txn: ZScan, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"zrem":             Desc{Proc: AutoCommit(ZRem), Txn: ZRem, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"zremrangebylex":   Desc{Proc: AutoCommit(ZRemRangeByLex), Txn: ZRemRangeByLex, Cons: Constraint{-4, flags("wF"), 1, 1, 1}},
+		"zremrangebyscore": Desc{Proc: AutoCommit(ZRemRangeByScore), Txn: ZRemRangeByScore, Cons: Constraint{4, flags("w"), 1, 1, 1}},
+		"zremrangebyrank":  Desc{Proc: AutoCommit(ZRemRangeByRank), Txn: ZRemRangeByRank, Cons: Constraint{4, flags("w"), 1, 1, 1}},
+		"zcard":            Desc{Proc: AutoCommit(ZCard), Txn: ZCard, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"zcount":           Desc{Proc: AutoCommit(ZCount), Txn: ZCount, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
+		"zlexcount":        Desc{Proc: AutoCommit(ZLexCount), Txn: ZLexCount, Cons: Constraint{-4, flags("rF"), 1, 1, 1}},
+		"zscore":           Desc{Proc: AutoCommit(ZScore), Txn: ZScore, Cons: Constraint{3, flags("rF"), 1, 1, 1}},
+		"zscan":            Desc{Proc: AutoCommit(ZScan), Txn: ZScan, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"zincrby":          Desc{Proc: AutoCommit(ZIncrBy), Txn: ZIncrBy, Cons: Constraint{4, flags("wmF"), 1, 1, 1}},
+		"zrank":            Desc{Proc: AutoCommit(ZRank), Txn: ZRank, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"zrevrank":         Desc{Proc: AutoCommit(ZRevRank), Txn: ZRevRank, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"zmscore":          Desc{Proc: AutoCommit(ZMScore), Txn: ZMScore, Cons: Constraint{-3, flags("rF"), 1, 1, 1}},
+		"zunion":           Desc{Proc: AutoCommit(ZUnion), Txn: ZUnion, Cons: Constraint{-3, flags("r"), 0, 0, 0}},
+		"zinter":           Desc{Proc: AutoCommit(ZInter), Txn: ZInter, Cons: Constraint{-3, flags("r"), 0, 0, 0}},
+		"zdiff":            Desc{Proc: AutoCommit(ZDiff), Txn: ZDiff, Cons: Constraint{-3, flags("r"), 0, 0, 0}},
+		"zunionstore":      Desc{Proc: AutoCommit(ZUnionStore), Txn: ZUnionStore, Cons: Constraint{-4, flags("wm"), 1, 1, 1}},
+		"zinterstore":      Desc{Proc: AutoCommit(ZInterStore), Txn: ZInterStore, Cons: Constraint{-4, flags("wm"), 1, 1, 1}},
+		"zdiffstore":       Desc{Proc: AutoCommit(ZDiffStore), Txn: ZDiffStore, Cons: Constraint{-4, flags("wm"), 1, 1, 1}},
+		"zrangestore":      Desc{Proc: AutoCommit(ZRangeStore), Txn: ZRangeStore, Cons: Constraint{-5, flags("wm"), 1, 2, 1}},
+		"zpopmin":          Desc{Proc: AutoCommit(ZPopMin), Txn: ZPopMin, Cons: Constraint{-2, flags("wF"), 1, 1, 1}},
+		"zpopmax":          Desc{Proc: AutoCommit(ZPopMax), Txn: ZPopMax, Cons: Constraint{-2, flags("wF"), 1, 1, 1}},
+
+		// blocking zsets, they do not block in a multi/exec block
+		"bzpopmin": Desc{Proc: Blocking(BZPopMin, blpopKeys), Txn: NonBlocking(BZPopMin, nullArray), Cons: Constraint{-3, flags("ws"), 1, -2, 1}},
+		"bzpopmax": Desc{Proc: Blocking(BZPopMax, blpopKeys), Txn: NonBlocking(BZPopMax, nullArray), Cons: Constraint{-3, flags("ws"), 1, -2, 1}},
+
+		// geo, the positions are stored in zsets
+		"geoadd":               Desc{Proc: AutoCommit(GeoAdd), Txn: GeoAdd, Cons: Constraint{-5, flags("wm"), 1, 1, 1}},
+		"geopos":               Desc{Proc: AutoCommit(GeoPos), Txn: GeoPos, Cons: Constraint{-2, flags("r"), 1, 1, 1}},
+		"geodist":              Desc{Proc: AutoCommit(GeoDist), Txn: GeoDist, Cons: Constraint{-4, flags("r"), 1, 1, 1}},
+		"geohash":              Desc{Proc: AutoCommit(GeoHash), Txn: GeoHash, Cons: Constraint{-2, flags("r"), 1, 1, 1}},
+		"georadius":            Desc{Proc: AutoCommit(GeoRadius), Txn: GeoRadius, Cons: Constraint{-6, flags("wm"), 1, 1, 1}},
+		"georadius_ro":         Desc{Proc: AutoCommit(GeoRadiusRO), Txn: GeoRadiusRO, Cons: Constraint{-6, flags("r"), 1, 1, 1}},
+		"georadiusbymember":    Desc{Proc: AutoCommit(GeoRadiusByMember), Txn: GeoRadiusByMember, Cons: Constraint{-5, flags("wm"), 1, 1, 1}},
+		"georadiusbymember_ro": Desc{Proc: AutoCommit(GeoRadiusByMemberRO), Txn: GeoRadiusByMemberRO, Cons: Constraint{-5, flags("r"), 1, 1, 1}},
+		"geosearch":            Desc{Proc: AutoCommit(GeoSearch), Txn: GeoSearch, Cons: Constraint{-7, flags("r"), 1, 1, 1}},
+		"geosearchstore":       Desc{Proc: AutoCommit(GeoSearchStore), Txn: GeoSearchStore, Cons: Constraint{-8, flags("wm"), 1, 2, 1}},
+
+		// streams
+		"xadd":      Desc{Proc: AutoCommit(XAdd), Txn: XAdd, Cons: Constraint{-5, flags("wmF"), 1, 1, 1}},
+		"xlen":      Desc{Proc: AutoCommit(XLen), Txn: XLen, Cons: Constraint{2, flags("rF"), 1, 1, 1}},
+		"xrange":    Desc{Proc: AutoCommit(XRange), Txn: XRange, Cons: Constraint{-4, flags("r"), 1, 1, 1}},
+		"xrevrange": Desc{Proc: AutoCommit(XRevRange), Txn: XRevRange, Cons: Constraint{-4, flags("r"), 1, 1, 1}},
+		"xdel":      Desc{Proc: AutoCommit(XDel), Txn: XDel, Cons: Constraint{-3, flags("wF"), 1, 1, 1}},
+		"xtrim":     Desc{Proc: AutoCommit(XTrim), Txn: XTrim, Cons: Constraint{-4, flags("w"), 1, 1, 1}},
+		"xread":     Desc{Proc: BlockingWithTimeout(XRead, xreadKeys("xread"), xreadTimeout("xread")), Txn: NonBlocking(XRead, nullArray), Cons: Constraint{-4, flags("rs"), 0, 0, 0}},
+
+		// stream consumer groups
+		"xgroup":     Desc{Proc: AutoCommit(XGroup), Txn: XGroup, Cons: Constraint{-2, flags("wm"), 2, 2, 1}},
+		"xreadgroup": Desc{Proc: BlockingWithTimeout(XReadGroup, xreadKeys("xreadgroup"), xreadTimeout("xreadgroup")), Txn: NonBlocking(XReadGroup, nullArray), Cons: Constraint{-7, flags("wm"), 0, 0, 0}},
+		"xack":       Desc{Proc: AutoCommit(XAck), Txn: XAck, Cons: Constraint{-4, flags("wF"), 1, 1, 1}},
+		"xpending":   Desc{Proc: AutoCommit(XPending), Txn: XPending, Cons: Constraint{-3, flags("r"), 1, 1, 1}},
+		"xclaim":     Desc{Proc: AutoCommit(XClaim), Txn: XClaim, Cons: Constraint{-6, flags("wF"), 1, 1, 1}},
+		"xautoclaim": Desc{Proc: AutoCommit(XAutoClaim), Txn: XAutoClaim, Cons: Constraint{-6, flags("wF"), 1, 1, 1}},
+
+		// hyperloglog
+		"pfadd":   Desc{Proc: AutoCommit(PFAdd), Txn: PFAdd, Cons: Constraint{-2, flags("wmF"), 1, 1, 1}},
+		"pfcount": Desc{Proc: AutoCommit(PFCount), Txn: PFCount, Cons: Constraint{-2, flags("r"), 1, -1, 1}},
+		"pfmerge": Desc{Proc: AutoCommit(PFMerge), Txn: PFMerge, Cons: Constraint{-2, flags("wm"), 1, -1, 1}},
+
+		// scripting, keys are declared by numkeys
+		"eval":    Desc{Proc: AutoCommit(Eval), Txn: Eval, Cons: Constraint{-3, flags("s"), 0, 0, 0}},
+		"evalsha": Desc{Proc: AutoCommit(EvalSha), Txn: EvalSha, Cons: Constraint{-3, flags("s"), 0, 0, 0}},
+		"script":  Desc{Proc: AutoCommit(Script), Txn: Script, Cons: Constraint{-2, flags("s"), 0, 0, 0}},
 
 		// extension commands
 		"escan": Desc{Proc: AutoCommit(Escan), Txn: Escan, Cons: Constraint{-1, flags("rR"), 0, 0, 0}},
 	}
+
+	// the statistics are shared by the copies of the descriptions
+	for name, desc := range commands {
+		desc.Stat = &Statistic{}
+		commands[name] = desc
+	}
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/rdb"
 	"github.com/distributedio/titan/encoding/resp"
 )
 
@@ -49,27 +50,17 @@ func Exists(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 // Expire sets a timeout on key
 func Expire(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	kv := txn.Kv()
-	key := []byte(ctx.Args[0])
 	seconds, err := strconv.ParseInt(ctx.Args[1], 10, 64)
 	if err != nil {
 		return nil, ErrInteger
 	}
 
 	at := time.Now().Add(time.Second * time.Duration(seconds)).UnixNano()
-	if err := kv.ExpireAt(key, at); err != nil {
-		if err == db.ErrKeyNotFound {
-			return Integer(ctx.Out, 0), nil
-		}
-		return nil, errors.New("ERR " + err.Error())
-	}
-	return Integer(ctx.Out, 1), nil
+	return expire(ctx, txn, at)
 }
 
 // ExpireAt sets an absolute timestamp to expire on key
 func ExpireAt(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	kv := txn.Kv()
-	key := []byte(ctx.Args[0])
 	timestamp, err := strconv.ParseInt(ctx.Args[1], 10, 64)
 	if err != nil {
 		return nil, ErrInteger
@@ -79,14 +70,40 @@ func ExpireAt(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	if at <= 0 {
 		at = 1
 	}
+	return expire(ctx, txn, at)
+}
+
+// expire sets the timeout of the key with the NX, XX, GT and LT options following the time
+func expire(ctx *Context, txn *db.Transaction, at int64) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	var flag db.ExpireFlag
+	for _, arg := range ctx.Args[2:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			flag |= db.ExpireNX
+		case "XX":
+			flag |= db.ExpireXX
+		case "GT":
+			flag |= db.ExpireGT
+		case "LT":
+			flag |= db.ExpireLT
+		default:
+			return nil, fmt.Errorf("ERR Unsupported option %s", arg)
+		}
+	}
+	if flag&db.ExpireNX != 0 && flag != db.ExpireNX {
+		return nil, ErrExpireNX
+	}
+	if flag&db.ExpireGT != 0 && flag&db.ExpireLT != 0 {
+		return nil, ErrExpireGTLT
+	}
 
-	if err := kv.ExpireAt(key, at); err != nil {
-		if err == db.ErrKeyNotFound {
+	if err := txn.Kv().ExpireAt(key, at, flag); err != nil {
+		if err == db.ErrKeyNotFound || err == db.ErrExpireCondition {
 			return Integer(ctx.Out, 0), nil
 		}
 		return nil, errors.New("ERR " + err.Error())
 	}
-
 	return Integer(ctx.Out, 1), nil
 }
 
@@ -113,28 +130,17 @@ func Persist(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 // PExpire works exactly like expire but the time to live of the key is specified in milliseconds instead of seconds
 func PExpire(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	kv := txn.Kv()
-	key := []byte(ctx.Args[0])
 	ms, err := strconv.ParseInt(ctx.Args[1], 10, 64)
 	if err != nil {
 		return nil, ErrInteger
 	}
 	at := time.Now().Add(time.Millisecond * time.Duration(ms)).UnixNano()
-	if err := kv.ExpireAt(key, at); err != nil {
-		if err == db.ErrKeyNotFound {
-			return Integer(ctx.Out, 0), nil
-		}
-		return nil, errors.New("ERR " + err.Error())
-	}
-	return Integer(ctx.Out, 1), nil
-
+	return expire(ctx, txn, at)
 }
 
 // PExpireAt has the same effect and semantic as expireAt,
 // but the Unix time at which the key will expire is specified in milliseconds instead of seconds
 func PExpireAt(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	kv := txn.Kv()
-	key := []byte(ctx.Args[0])
 	ms, err := strconv.ParseInt(ctx.Args[1], 10, 64)
 	if err != nil {
 		return nil, ErrInteger
@@ -143,13 +149,32 @@ func PExpireAt(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	if at <= 0 {
 		at = 1
 	}
-	if err := kv.ExpireAt(key, at); err != nil {
+	return expire(ctx, txn, at)
+}
+
+// ExpireTime returns the absolute Unix timestamp in seconds at which the key will expire
+func ExpireTime(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return expireTime(ctx, txn, int64(time.Second))
+}
+
+// PExpireTime returns the absolute Unix timestamp in milliseconds at which the key will expire
+func PExpireTime(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return expireTime(ctx, txn, int64(time.Millisecond))
+}
+
+func expireTime(ctx *Context, txn *db.Transaction, unit int64) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	obj, err := txn.Object(key)
+	if err != nil {
 		if err == db.ErrKeyNotFound {
-			return Integer(ctx.Out, 0), nil
+			return Integer(ctx.Out, -2), nil
 		}
 		return nil, errors.New("ERR " + err.Error())
 	}
-	return Integer(ctx.Out, 1), nil
+	if obj.ExpireAt == 0 {
+		return Integer(ctx.Out, -1), nil
+	}
+	return Integer(ctx.Out, obj.ExpireAt/unit), nil
 }
 
 // TTL returns the remaining time to live of a key that has a timeout
@@ -213,7 +238,7 @@ func Object(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		obj, err := txn.Object(key)
 		if err != nil {
 			if err == db.ErrKeyNotFound {
-				return NullBulkString(ctx.Out), nil
+				return Null(ctx), nil
 			}
 			return nil, errors.New("ERR " + err.Error())
 		}
@@ -356,7 +381,7 @@ func RandomKey(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if key == nil {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 	return BulkString(ctx.Out, string(key)), nil
 }
@@ -374,3 +399,300 @@ func Touch(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	}
 	return Integer(ctx.Out, count), nil
 }
+
+// Rename renames key to newkey, newkey is overwritten if it exists
+func Rename(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	newkey := []byte(ctx.Args[1])
+	if _, err := txn.Kv().Rename([]byte(ctx.Args[0]), newkey, false); err != nil {
+		if err == db.ErrKeyNotFound {
+			return nil, ErrNoSuchKey
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return signal(ctx, SimpleString(ctx.Out, OK), newkey), nil
+}
+
+// RenameNx renames key to newkey if newkey does not exist
+func RenameNx(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	newkey := []byte(ctx.Args[1])
+	ok, err := txn.Kv().Rename([]byte(ctx.Args[0]), newkey, true)
+	if err != nil {
+		if err == db.ErrKeyNotFound {
+			return nil, ErrNoSuchKey
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !ok {
+		return Integer(ctx.Out, 0), nil
+	}
+	return signal(ctx, Integer(ctx.Out, 1), newkey), nil
+}
+
+// Move moves a key to another database
+func Move(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	id, err := parseDBIndex(ctx.Args[1])
+	if err != nil {
+		return nil, err
+	}
+	if id == ctx.Client.DB.ID {
+		return nil, ErrSameObject
+	}
+	ok, err := txn.Kv().Move(key, id)
+	if err != nil {
+		if err == db.ErrKeyNotFound {
+			return Integer(ctx.Out, 0), nil
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !ok {
+		return Integer(ctx.Out, 0), nil
+	}
+	target := ctx.Server.Store.DB(ctx.Client.Namespace, int(id))
+	return signalDB(ctx, Integer(ctx.Out, 1), target, key), nil
+}
+
+// Copy copies the value of a key to a new key
+func Copy(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key, newkey := []byte(ctx.Args[0]), []byte(ctx.Args[1])
+	id := ctx.Client.DB.ID
+	var replace bool
+	for i := 2; i < len(ctx.Args); i++ {
+		switch strings.ToUpper(ctx.Args[i]) {
+		case "DB":
+			if i+1 >= len(ctx.Args) {
+				return nil, ErrSyntax
+			}
+			var err error
+			if id, err = parseDBIndex(ctx.Args[i+1]); err != nil {
+				return nil, err
+			}
+			i++
+		case "REPLACE":
+			replace = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if id == ctx.Client.DB.ID && bytes.Equal(key, newkey) {
+		return nil, ErrSameObject
+	}
+
+	ok, err := txn.Kv().Copy(key, newkey, id, replace)
+	if err != nil {
+		if err == db.ErrKeyNotFound {
+			return Integer(ctx.Out, 0), nil
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !ok {
+		return Integer(ctx.Out, 0), nil
+	}
+	target := ctx.Server.Store.DB(ctx.Client.Namespace, int(id))
+	return signalDB(ctx, Integer(ctx.Out, 1), target, newkey), nil
+}
+
+// parseDBIndex parses the index of a database like SELECT
+func parseDBIndex(arg string) (db.DBID, error) {
+	idx, err := strconv.Atoi(arg)
+	if err != nil || idx < 0 || idx > 255 {
+		return 0, ErrInvalidDB
+	}
+	return db.DBID(idx), nil
+}
+
+// Dump returns a serialized version of the value stored at the specified key
+func Dump(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	obj, err := txn.Object(key)
+	if err != nil {
+		if err == db.ErrKeyNotFound {
+			return Null(ctx), nil
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	v, err := dumpValue(txn, key, obj)
+	if err != nil {
+		return nil, err
+	}
+	return BulkString(ctx.Out, string(rdb.Dump(v))), nil
+}
+
+// dumpValue reads the whole value of the object
+func dumpValue(txn *db.Transaction, key []byte, obj *db.Object) (*rdb.Value, error) {
+	v := &rdb.Value{}
+	var err error
+	switch obj.Type {
+	case db.ObjectString:
+		v.Kind = rdb.String
+		var str *db.String
+		if str, err = txn.String(key); err == nil {
+			v.String, err = str.Get()
+		}
+	case db.ObjectList:
+		v.Kind = rdb.List
+		var lst db.List
+		if lst, err = txn.List(key); err == nil {
+			v.Members, err = lst.Range(0, -1)
+		}
+	case db.ObjectSet:
+		v.Kind = rdb.Set
+		var set *db.Set
+		if set, err = txn.Set(key); err == nil {
+			v.Members, err = set.SMembers()
+		}
+	case db.ObjectHash:
+		v.Kind = rdb.Hash
+		var hash *db.Hash
+		if hash, err = txn.Hash(key); err == nil {
+			v.Members, v.Values, err = hash.HGetAll()
+		}
+	case db.ObjectZSet:
+		v.Kind = rdb.ZSet
+		var zset *db.ZSet
+		var items [][]byte
+		if zset, err = txn.ZSet(key); err == nil {
+			items, err = zset.ZAnyOrderRange(0, -1, true, true)
+		}
+		for i := 0; err == nil && i < len(items); i += 2 {
+			var score float64
+			score, err = strconv.ParseFloat(string(items[i+1]), 64)
+			v.Members = append(v.Members, items[i])
+			v.Scores = append(v.Scores, score)
+		}
+	default:
+		return nil, ErrDumpStream
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return v, nil
+}
+
+// Restore creates a key using the provided serialized value, previously obtained using DUMP
+func Restore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	ttl, err := strconv.ParseInt(ctx.Args[1], 10, 64)
+	if err != nil {
+		return nil, ErrInteger
+	}
+	if ttl < 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	var replace, absttl bool
+	idle, freq := int64(-1), int64(-1)
+	for i := 3; i < len(ctx.Args); i++ {
+		switch strings.ToUpper(ctx.Args[i]) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absttl = true
+		case "IDLETIME", "FREQ":
+			if i+1 >= len(ctx.Args) || idle != -1 || freq != -1 {
+				return nil, ErrSyntax
+			}
+			v, err := strconv.ParseInt(ctx.Args[i+1], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			if strings.ToUpper(ctx.Args[i]) == "IDLETIME" {
+				if v < 0 {
+					return nil, ErrInvalidIdleTime
+				}
+				idle = v
+			} else {
+				// the access frequency is not tracked, it is only validated
+				if v < 0 || v > 255 {
+					return nil, ErrInvalidFreq
+				}
+				freq = v
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	v, err := rdb.Load([]byte(ctx.Args[2]))
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	kv := txn.Kv()
+	if _, err := txn.Object(key); err != db.ErrKeyNotFound {
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if !replace {
+			return nil, ErrBusyKey
+		}
+		if _, err := kv.Delete([][]byte{key}); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+
+	var at int64
+	if ttl > 0 {
+		at = time.Now().Add(time.Millisecond * time.Duration(ttl)).UnixNano()
+		if absttl {
+			at = int64(time.Millisecond * time.Duration(ttl))
+		}
+		// an expired key is not created, but the old one is still replaced
+		if at <= db.Now() {
+			return SimpleString(ctx.Out, OK), nil
+		}
+	}
+
+	if err := restoreValue(ctx, txn, key, v); err != nil {
+		return nil, err
+	}
+	if at > 0 {
+		if err := kv.ExpireAt(key, at); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	if idle > 0 {
+		if _, err := kv.TouchAt([][]byte{key}, db.Now()-int64(time.Second*time.Duration(idle))); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	return signal(ctx, SimpleString(ctx.Out, OK), key), nil
+}
+
+// restoreValue creates the object of the value
+func restoreValue(ctx *Context, txn *db.Transaction, key []byte, v *rdb.Value) error {
+	var err error
+	switch v.Kind {
+	case rdb.String:
+		err = db.NewString(txn, key).Set(v.String)
+	case rdb.List:
+		var opts []db.ListOption
+		if len(v.Members) > ctx.Server.Options().ListZipThreshold {
+			opts = append(opts, db.UseZip())
+		}
+		var lst db.List
+		if lst, err = txn.List(key, opts...); err == nil {
+			err = lst.RPush(v.Members...)
+		}
+	case rdb.Set:
+		var set *db.Set
+		if set, err = txn.Set(key); err == nil {
+			_, err = set.SAdd(v.Members...)
+		}
+	case rdb.Hash:
+		var hash *db.Hash
+		if hash, err = txn.Hash(key); err == nil {
+			err = hash.HMSet(v.Members, v.Values)
+		}
+	case rdb.ZSet:
+		var zset *db.ZSet
+		if zset, err = txn.ZSet(key); err == nil {
+			_, err = zset.ZAdd(v.Members, v.Scores)
+		}
+	}
+	if err != nil {
+		return errors.New("ERR " + err.Error())
+	}
+	return nil
+}
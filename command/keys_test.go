@@ -2,9 +2,11 @@ package command
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/distributedio/titan/encoding/rdb"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -411,3 +413,140 @@ func TestRandomkey(t *testing.T) {
 	lines := ctxLines(ctx.Out)
 	assert.NotEqual(t, 0, len(lines))
 }
+
+func TestRename(t *testing.T) {
+	CallTest("rpush", "rename-list", "a", "b")
+	CallTest("expire", "rename-list", "100")
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("rename", "rename-list", "rename-list2")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "rename-list")))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", ctxString(CallTest("lrange", "rename-list2", "0", "-1")))
+	assert.NotEqual(t, ":-1\r\n", ctxString(CallTest("ttl", "rename-list2")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("rename", "rename-list2", "rename-list2")))
+
+	// the destination is overwritten
+	CallTest("set", "rename-str", "value")
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("rename", "rename-str", "rename-list2")))
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("get", "rename-list2")))
+	assert.Equal(t, ":-1\r\n", ctxString(CallTest("ttl", "rename-list2")))
+
+	CallTest("set", "rename-str", "value2")
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("renamenx", "rename-str", "rename-list2")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("renamenx", "rename-str", "rename-str2")))
+	assert.Equal(t, "$6\r\nvalue2\r\n", ctxString(CallTest("get", "rename-str2")))
+
+	assert.Equal(t, "-"+ErrNoSuchKey.Error()+"\r\n", ctxString(CallTest("rename", "rename-none", "rename-str2")))
+	assert.Equal(t, "-"+ErrNoSuchKey.Error()+"\r\n", ctxString(CallTest("renamenx", "rename-none", "rename-str2")))
+}
+
+func TestMoveCopy(t *testing.T) {
+	// callDB calls the command in db 2
+	callDB := func(name string, args ...string) string {
+		ctx := ContextTest(name, args...)
+		ctx.Client.DB = mockdb.DB("defalut", 2)
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+
+	CallTest("sadd", "move-set", "a", "b")
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("move", "move-set", "2")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "move-set")))
+	assert.Equal(t, ":2\r\n", callDB("scard", "move-set"))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("move", "move-set", "2")))
+	CallTest("set", "move-set", "value")
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("move", "move-set", "2")))
+	assert.Equal(t, "-"+ErrSameObject.Error()+"\r\n", ctxString(CallTest("move", "move-set", "1")))
+	assert.Equal(t, "-"+ErrInvalidDB.Error()+"\r\n", ctxString(CallTest("move", "move-set", "256")))
+
+	CallTest("zadd", "copy-zset", "1", "a", "2", "b")
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("copy", "copy-zset", "copy-zset2")))
+	CallTest("zadd", "copy-zset2", "3", "c")
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zcard", "copy-zset")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zcard", "copy-zset2")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("copy", "copy-zset", "copy-zset2")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("copy", "copy-zset", "copy-zset2", "REPLACE")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zcard", "copy-zset2")))
+
+	// the set moved to db 2 is not replaced
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("copy", "copy-zset", "move-set", "db", "2")))
+	assert.Equal(t, "+set\r\n", callDB("type", "move-set"))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("copy", "copy-zset", "move-set", "db", "2", "replace")))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", callDB("zrange", "move-set", "0", "-1"))
+
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("copy", "copy-none", "copy-zset2")))
+	assert.Equal(t, "-"+ErrSameObject.Error()+"\r\n", ctxString(CallTest("copy", "copy-zset", "copy-zset")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("copy", "copy-zset", "copy-zset2", "db")))
+}
+
+func TestDumpRestore(t *testing.T) {
+	// dump returns the payload in the bulk string reply
+	dump := func(key string) string {
+		out := ctxString(CallTest("dump", key))
+		out = out[strings.Index(out, "\r\n")+2:]
+		return out[:len(out)-2]
+	}
+
+	CallTest("set", "dump-string", "value")
+	CallTest("rpush", "dump-list", "a", "b", "a")
+	CallTest("sadd", "dump-set", "a", "b")
+	CallTest("hmset", "dump-hash", "f1", "v1", "f2", "v2")
+	CallTest("zadd", "dump-zset", "1.5", "a", "-2", "b")
+	reads := map[string][]string{
+		"dump-string": {"get", "dump-string-r"},
+		"dump-list":   {"lrange", "dump-list-r", "0", "-1"},
+		"dump-set":    {"smembers", "dump-set-r"},
+		"dump-hash":   {"hgetall", "dump-hash-r"},
+		"dump-zset":   {"zrange", "dump-zset-r", "0", "-1", "withscores"},
+	}
+	for key, read := range reads {
+		assert.Equal(t, "+OK\r\n", ctxString(CallTest("restore", key+"-r", "0", dump(key))))
+		src := append([]string{key}, read[2:]...)
+		assert.Equal(t, ctxString(CallTest(read[0], src...)), ctxString(CallTest(read[0], read[1:]...)), key)
+	}
+
+	// the integer 10 dumped by redis
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("restore", "dump-redis", "0", "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n")))
+	assert.Equal(t, "$2\r\n10\r\n", ctxString(CallTest("get", "dump-redis")))
+
+	p := dump("dump-string")
+	assert.Equal(t, "-"+ErrBusyKey.Error()+"\r\n", ctxString(CallTest("restore", "dump-list", "0", p)))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("restore", "dump-list", "100000", p, "REPLACE", "IDLETIME", "1000")))
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("get", "dump-list")))
+	assert.NotEqual(t, ":-1\r\n", ctxString(CallTest("ttl", "dump-list")))
+	assert.NotEqual(t, ":0\r\n", ctxString(CallTest("object", "idletime", "dump-list")))
+
+	// an expired absolute ttl only removes the old key
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("restore", "dump-list", "1000", p, "REPLACE", "ABSTTL")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "dump-list")))
+
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("dump", "dump-none")))
+	wrong := p[:len(p)-1] + "x"
+	assert.Equal(t, "-ERR "+rdb.ErrChecksum.Error()+"\r\n", ctxString(CallTest("restore", "dump-none", "0", wrong)))
+	assert.Equal(t, "-"+ErrInvalidTTL.Error()+"\r\n", ctxString(CallTest("restore", "dump-none", "-1", p)))
+	assert.Equal(t, "-"+ErrInvalidFreq.Error()+"\r\n", ctxString(CallTest("restore", "dump-none", "0", p, "FREQ", "256")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("restore", "dump-none", "0", p, "FREQ", "1", "IDLETIME", "1")))
+}
+
+func TestExpireFlags(t *testing.T) {
+	CallTest("set", "expire-flags", "value")
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("expire", "expire-flags", "100", "xx")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("expire", "expire-flags", "100", "gt")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("expire", "expire-flags", "100", "nx")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("expire", "expire-flags", "200", "nx")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("pexpire", "expire-flags", "200000", "lt")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("pexpire", "expire-flags", "200000", "xx", "gt")))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("expireat", "expire-flags", strconv.FormatInt(at, 10), "GT")))
+	assert.Equal(t, ":"+strconv.FormatInt(at, 10)+"\r\n", ctxString(CallTest("expiretime", "expire-flags")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("pexpireat", "expire-flags", strconv.FormatInt(at*1000-1, 10), "lt")))
+	assert.Equal(t, ":"+strconv.FormatInt(at*1000-1, 10)+"\r\n", ctxString(CallTest("pexpiretime", "expire-flags")))
+
+	CallTest("set", "expire-flags", "value")
+	assert.Equal(t, ":-1\r\n", ctxString(CallTest("expiretime", "expire-flags")))
+	assert.Equal(t, ":-2\r\n", ctxString(CallTest("pexpiretime", "expire-flags-none")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("expire", "expire-flags-none", "100", "nx")))
+
+	assert.Equal(t, "-"+ErrExpireNX.Error()+"\r\n", ctxString(CallTest("expire", "expire-flags", "100", "nx", "gt")))
+	assert.Equal(t, "-"+ErrExpireGTLT.Error()+"\r\n", ctxString(CallTest("expire", "expire-flags", "100", "gt", "lt")))
+	assert.Equal(t, "-ERR Unsupported option foo\r\n", ctxString(CallTest("expire", "expire-flags", "100", "foo")))
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"bytes"
 	"errors"
 	"strconv"
 	"strings"
@@ -20,7 +21,7 @@ func LPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 	// Create a ziplist if lpush with too much items
 	var opts []db.ListOption
-	if len(args[1:]) > ctx.Server.ListZipThreshold { //ListZipThreshold
+	if len(args[1:]) > ctx.Server.Options().ListZipThreshold { //ListZipThreshold
 		opts = append(opts, db.UseZip())
 	}
 
@@ -39,7 +40,7 @@ func LPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 			return nil, errors.New("ERR " + err.Error())
 		}
 	}
-	return Integer(ctx.Out, lst.Length()), nil
+	return signal(ctx, Integer(ctx.Out, lst.Length()), key), nil
 }
 
 // LPushx prepend a value to a list, only if the list exists
@@ -61,7 +62,7 @@ func LPushx(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 			return nil, errors.New("ERR " + err.Error())
 		}
 	}
-	return Integer(ctx.Out, lst.Length()), nil
+	return signal(ctx, Integer(ctx.Out, lst.Length()), key), nil
 }
 
 // LPop removes and returns the first element of the list stored at key
@@ -81,7 +82,7 @@ func LPop(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	}
 
 	if !lst.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 
 	val, err := lst.LPop()
@@ -160,7 +161,7 @@ func LInsert(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	if err != nil {
 		return nil, errors.New("ERR " + err.Error())
 	}
-	return Integer(ctx.Out, lst.Length()), nil
+	return signal(ctx, Integer(ctx.Out, lst.Length()), key), nil
 }
 
 //LIndex get an element from a list by its index
@@ -179,12 +180,12 @@ func LIndex(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if !lst.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 	val, err := lst.Index(n)
 	if err != nil {
 		if err == db.ErrOutOfRange {
-			return NullBulkString(ctx.Out), nil
+			return Null(ctx), nil
 		}
 		return nil, errors.New("ERR " + err.Error())
 
@@ -304,7 +305,7 @@ func RPop(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	}
 
 	if !lst.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 	val, err := lst.RPop()
 	if err != nil {
@@ -315,34 +316,11 @@ func RPop(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 // RPopLPush remove the last element in a list, prepend it to another list and return it
 func RPopLPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	listsrc, err := txn.List([]byte(ctx.Args[0]))
-	if err != nil {
-		if err == db.ErrTypeMismatch {
-			return nil, ErrTypeMismatch
-		}
-		return nil, errors.New("ERR " + err.Error())
-	}
-
-	if !listsrc.Exist() {
-		return NullBulkString(ctx.Out), nil
-	}
-	val, err := listsrc.RPop()
-	if err != nil {
-		return nil, errors.New("ERR " + err.Error())
+	onCommit, err := move(ctx, txn, []byte(ctx.Args[0]), []byte(ctx.Args[1]), false, true)
+	if err == errWouldBlock {
+		return Null(ctx), nil
 	}
-
-	// create dst list on not exist
-	listdst, err := txn.List([]byte(ctx.Args[1]))
-	if err != nil {
-		if err == db.ErrTypeMismatch {
-			return nil, ErrTypeMismatch
-		}
-		return nil, ErrSyntax
-	}
-	if err = listdst.LPush(val); err != nil {
-		return nil, ErrTypeMismatch
-	}
-	return BulkString(ctx.Out, string(val)), nil
+	return onCommit, err
 }
 
 // RPush append one or multiple values to a list
@@ -352,7 +330,7 @@ func RPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 	// Create a ziplist if lpush with too much items
 	var opts []db.ListOption
-	if len(args[1:]) > ctx.Server.ListZipThreshold { //ListZipThreshold
+	if len(args[1:]) > ctx.Server.Options().ListZipThreshold { //ListZipThreshold
 		opts = append(opts, db.UseZip())
 	}
 
@@ -369,7 +347,7 @@ func RPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 			return nil, errors.New("ERR " + err.Error())
 		}
 	}
-	return Integer(ctx.Out, lst.Length()), nil
+	return signal(ctx, Integer(ctx.Out, lst.Length()), key), nil
 }
 
 // RPushx append a value to a list, only if the list exists
@@ -390,5 +368,163 @@ func RPushx(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 			return nil, errors.New("ERR " + err.Error())
 		}
 	}
-	return Integer(ctx.Out, lst.Length()), nil
+	return signal(ctx, Integer(ctx.Out, lst.Length()), key), nil
+}
+
+// parseDirection parses the LEFT|RIGHT argument of LMOVE/BLMOVE, it returns true for left
+func parseDirection(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, ErrSyntax
+}
+
+// move pops an element from src and pushes it to dst, errWouldBlock is returned if src is empty
+func move(ctx *Context, txn *db.Transaction, src, dst []byte, fromLeft, toLeft bool) (OnCommit, error) {
+	srcList, err := txn.List(src)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !srcList.Exist() {
+		return nil, errWouldBlock
+	}
+
+	// a list object can not be loaded twice in one transaction, or the changes will be lost
+	dstList := srcList
+	if !bytes.Equal(src, dst) {
+		if dstList, err = txn.List(dst); err != nil {
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+
+	var val []byte
+	if fromLeft {
+		val, err = srcList.LPop()
+	} else {
+		val, err = srcList.RPop()
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if toLeft {
+		err = dstList.LPush(val)
+	} else {
+		err = dstList.RPush(val)
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	keys := [][]byte{dst}
+	// wake up the next client blocked on src if there are elements left
+	if !bytes.Equal(src, dst) && srcList.Length() > 0 {
+		keys = append(keys, src)
+	}
+	return signal(ctx, BulkString(ctx.Out, string(val)), keys...), nil
+}
+
+// LMove atomically returns and removes the first/last element of the source list,
+// and pushes the element at the first/last element of the destination list
+func LMove(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	fromLeft, err := parseDirection(ctx.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	toLeft, err := parseDirection(ctx.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	onCommit, err := move(ctx, txn, []byte(ctx.Args[0]), []byte(ctx.Args[1]), fromLeft, toLeft)
+	if err == errWouldBlock {
+		return Null(ctx), nil
+	}
+	return onCommit, err
+}
+
+// bpop pops an element from the first non-empty list, errWouldBlock is returned if all the lists are empty
+func bpop(ctx *Context, txn *db.Transaction, left bool) (OnCommit, error) {
+	if _, err := parseTimeout(ctx.Args[len(ctx.Args)-1]); err != nil {
+		return nil, err
+	}
+	for _, key := range ctx.Args[:len(ctx.Args)-1] {
+		lst, err := txn.List([]byte(key))
+		if err != nil {
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if !lst.Exist() {
+			continue
+		}
+
+		var val []byte
+		if left {
+			val, err = lst.LPop()
+		} else {
+			val, err = lst.RPop()
+		}
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		onCommit := BytesArray(ctx.Out, [][]byte{[]byte(key), val})
+		// wake up the next client blocked on the key if there are elements left
+		if lst.Length() > 0 {
+			onCommit = signal(ctx, onCommit, []byte(key))
+		}
+		return onCommit, nil
+	}
+	return nil, errWouldBlock
+}
+
+// blpopKeys returns the keys of BLPOP/BRPOP
+func blpopKeys(args []string) []string {
+	return args[:len(args)-1]
+}
+
+// bmoveKeys returns the keys of BRPOPLPUSH/BLMOVE
+func bmoveKeys(args []string) []string {
+	return args[:1]
+}
+
+// BLPop removes and gets the first element in a list, or blocks until one is available
+func BLPop(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return bpop(ctx, txn, true)
+}
+
+// BRPop removes and gets the last element in a list, or blocks until one is available
+func BRPop(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return bpop(ctx, txn, false)
+}
+
+// BRPopLPush pops an element from a list, pushes it to another list and returns it; or blocks until one is available
+func BRPopLPush(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	if _, err := parseTimeout(ctx.Args[2]); err != nil {
+		return nil, err
+	}
+	return move(ctx, txn, []byte(ctx.Args[0]), []byte(ctx.Args[1]), false, true)
+}
+
+// BLMove pops an element from a list, pushes it to another list and returns it; or blocks until one is available
+func BLMove(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	fromLeft, err := parseDirection(ctx.Args[2])
+	if err != nil {
+		return nil, err
+	}
+	toLeft, err := parseDirection(ctx.Args[3])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTimeout(ctx.Args[4]); err != nil {
+		return nil, err
+	}
+	return move(ctx, txn, []byte(ctx.Args[0]), []byte(ctx.Args[1]), fromLeft, toLeft)
 }
@@ -3,7 +3,9 @@ package command
 import (
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/distributedio/titan/context"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -541,3 +543,164 @@ func TestLRem(t *testing.T) {
 	clearList(t, key)
 
 }
+
+// blockingTest calls a blocking command in background, the returned channel receives the reply
+func blockingTest(id int64, name string, args ...string) <-chan string {
+	ctx := ContextTest(name, args...)
+	ctx.Client.ID = id
+	done := make(chan string, 1)
+	go func() {
+		Call(ctx)
+		done <- ctxString(ctx.Out)
+	}()
+	return done
+}
+
+// blockingReply waits for the reply of a blocking command
+func blockingReply(t *testing.T, done <-chan string) string {
+	select {
+	case reply := <-done:
+		return reply
+	case <-time.After(10 * time.Second):
+		t.Fatal("blocking command is not served")
+	}
+	return ""
+}
+
+// waitBlocked waits until n clients are blocked
+func waitBlocked(t *testing.T, n int) {
+	for i := 0; i < 100 && mockhub.Notifier().Blocked() != n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, n, mockhub.Notifier().Blocked())
+}
+
+func TestLMove(t *testing.T) {
+	key := "list-lmove-key"
+	dst := "list-lmove-dst"
+	initList(t, key, 3)
+
+	ctx := ContextTest("lmove", key, dst, "left", "right")
+	Call(ctx)
+	assert.Equal(t, "$1\r\n1\r\n", ctxString(ctx.Out))
+
+	// rotate the list in place
+	ctx = ContextTest("lmove", key, key, "left", "right")
+	Call(ctx)
+	assert.Equal(t, "$1\r\n2\r\n", ctxString(ctx.Out))
+	ctx = ContextTest("lrange", key, "0", "-1")
+	Call(ctx)
+	assert.Equal(t, "*2\r\n$1\r\n3\r\n$1\r\n2\r\n", ctxString(ctx.Out))
+
+	ctx = ContextTest("lmove", key, dst, "up", "right")
+	Call(ctx)
+	assert.Equal(t, ErrSyntax.Error(), ctxLines(ctx.Out)[0][1:])
+
+	ctx = ContextTest("lmove", "list-lmove-none", dst, "left", "right")
+	Call(ctx)
+	assert.Equal(t, "$-1\r\n", ctxString(ctx.Out))
+	clearList(t, key)
+	clearList(t, dst)
+}
+
+func TestBLPop(t *testing.T) {
+	key := "list-blpop-key"
+	initList(t, key, 2)
+
+	// served immediately
+	ctx := ContextTest("blpop", "list-blpop-none", key, "0")
+	Call(ctx)
+	assert.Equal(t, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\n1\r\n", ctxString(ctx.Out))
+	ctx = ContextTest("brpop", key, "0")
+	Call(ctx)
+	assert.Equal(t, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\n2\r\n", ctxString(ctx.Out))
+
+	// times out
+	ctx = ContextTest("blpop", key, "0.1")
+	Call(ctx)
+	assert.Equal(t, "*-1\r\n", ctxString(ctx.Out))
+
+	ctx = ContextTest("blpop", key, "-1")
+	Call(ctx)
+	assert.Equal(t, ErrTimeoutNegative.Error(), ctxLines(ctx.Out)[0][1:])
+	ctx = ContextTest("blpop", key, "abc")
+	Call(ctx)
+	assert.Equal(t, ErrTimeout.Error(), ctxLines(ctx.Out)[0][1:])
+
+	// waiters are served in the order they are blocked
+	first := blockingTest(1001, "blpop", key, "5")
+	waitBlocked(t, 1)
+	second := blockingTest(1002, "brpop", key, "5")
+	waitBlocked(t, 2)
+	rpushList(t, key, "a")
+	assert.Equal(t, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\na\r\n", blockingReply(t, first))
+	rpushList(t, key, "b")
+	assert.Equal(t, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\nb\r\n", blockingReply(t, second))
+	waitBlocked(t, 0)
+
+	// pushing many elements wakes up many waiters
+	first = blockingTest(1003, "blpop", key, "5")
+	second = blockingTest(1004, "blpop", key, "5")
+	waitBlocked(t, 2)
+	ctx = ContextTest("rpush", key, "c", "d")
+	Call(ctx)
+	replies := []string{blockingReply(t, first), blockingReply(t, second)}
+	assert.Contains(t, replies, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\nc\r\n")
+	assert.Contains(t, replies, "*2\r\n$14\r\nlist-blpop-key\r\n$1\r\nd\r\n")
+	waitBlocked(t, 0)
+}
+
+func TestBRPopLPush(t *testing.T) {
+	src := "list-brpoplpush-src"
+	dst := "list-brpoplpush-dst"
+
+	done := blockingTest(1011, "brpoplpush", src, dst, "5")
+	waitBlocked(t, 1)
+	rpushList(t, src, "a")
+	assert.Equal(t, "$1\r\na\r\n", blockingReply(t, done))
+
+	done = blockingTest(1012, "blmove", dst, src, "left", "left", "5")
+	assert.Equal(t, "$1\r\na\r\n", blockingReply(t, done))
+	ctx := ContextTest("lrange", src, "0", "-1")
+	Call(ctx)
+	assert.Equal(t, "*1\r\n$1\r\na\r\n", ctxString(ctx.Out))
+	clearList(t, src)
+
+	// the next waiter of src is woken up if there are elements left, before the recheck
+	first := blockingTest(1013, "brpoplpush", src, dst, "3")
+	second := blockingTest(1014, "brpoplpush", src, dst, "3")
+	waitBlocked(t, 2)
+	ctx = ContextTest("rpush", src, "b", "c")
+	Call(ctx)
+	replies := []string{blockingReply(t, first), blockingReply(t, second)}
+	assert.Contains(t, replies, "$1\r\nb\r\n")
+	assert.Contains(t, replies, "$1\r\nc\r\n")
+	waitBlocked(t, 0)
+	clearList(t, dst)
+}
+
+func TestClientUnblock(t *testing.T) {
+	key := "list-unblock-key"
+	ctx := ContextTest("client", "unblock", "1021")
+	cli := &context.ClientContext{ID: 1021, Namespace: ctx.Client.Namespace}
+	ctx.Server.Clients.Store(cli.ID, cli)
+
+	done := blockingTest(1021, "blpop", key, "0")
+	waitBlocked(t, 1)
+	Call(ctx)
+	assert.Equal(t, ":1\r\n", ctxString(ctx.Out))
+	assert.Equal(t, "*-1\r\n", blockingReply(t, done))
+
+	done = blockingTest(1021, "blpop", key, "0")
+	waitBlocked(t, 1)
+	ctx = ContextTest("client", "unblock", "1021", "error")
+	ctx.Server.Clients.Store(cli.ID, cli)
+	Call(ctx)
+	assert.Equal(t, ":1\r\n", ctxString(ctx.Out))
+	assert.Equal(t, "-"+ErrUnblocked.Error()+"\r\n", blockingReply(t, done))
+
+	ctx = ContextTest("client", "unblock", "1021")
+	ctx.Server.Clients.Store(cli.ID, cli)
+	Call(ctx)
+	assert.Equal(t, ":0\r\n", ctxString(ctx.Out))
+}
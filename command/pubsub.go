@@ -0,0 +1,150 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/distributedio/titan/encoding/resp"
+	"github.com/distributedio/titan/pubsub"
+)
+
+// commands allowed when a client is in the subscribe mode
+var subscribeModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+// AllowedInSubscribeMode returns true if the command can be called after the client subscribes
+func AllowedInSubscribeMode(name string) bool {
+	return subscribeModeCommands[strings.ToLower(name)]
+}
+
+// ErrSubscribeMode returns the error replied when a command is not allowed in the subscribe mode
+func ErrSubscribeMode(name string) error {
+	return fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", strings.ToLower(name))
+}
+
+// subscription returns the subscription of the client, a new one is created if the client
+// is not subscribing anything. The messages are written to the connection even if the
+// replies are skipped by CLIENT REPLY
+func subscription(ctx *Context) *pubsub.Subscription {
+	if !ctx.Client.Subscribed() {
+		out := ctx.Client.Writer
+		if out == nil {
+			out = ctx.Out
+		}
+		ctx.Client.Subscription = pubsub.NewSubscription(ctx.Client.ID, ctx.Client.Namespace, out)
+		ctx.Client.Subscription.Protocol = ctx.Client.Protocol
+		ctx.Client.Subscription.Close = ctx.Client.Close
+	}
+	return ctx.Client.Subscription
+}
+
+// replySubscription replies the result of (un)subscribing in one write, messages are delivered
+// from other goroutines and should not be interleaved with the reply
+func replySubscription(ctx *Context, kind string, names []string, counts []int) {
+	buf := bytes.NewBuffer(nil)
+	e := resp.NewEncoderVersion(buf, ctx.Client.Protocol)
+	if len(names) == 0 {
+		e.Push(3)
+		e.BulkString(kind)
+		e.NullBulkString()
+		e.Integer(0)
+	}
+	for i := range names {
+		e.Push(3)
+		e.BulkString(kind)
+		e.BulkString(names[i])
+		e.Integer(int64(counts[i]))
+	}
+	ctx.Out.Write(buf.Bytes())
+}
+
+// Subscribe subscribes the client to the specified channels
+func Subscribe(ctx *Context) {
+	sub := subscription(ctx)
+	counts := ctx.Server.PubSub.Subscribe(sub, ctx.Args...)
+	replySubscription(ctx, "subscribe", ctx.Args, counts)
+}
+
+// PSubscribe subscribes the client to the given patterns
+func PSubscribe(ctx *Context) {
+	sub := subscription(ctx)
+	counts := ctx.Server.PubSub.PSubscribe(sub, ctx.Args...)
+	replySubscription(ctx, "psubscribe", ctx.Args, counts)
+}
+
+// Unsubscribe unsubscribes the client from the given channels, or from all of them if none is given
+func Unsubscribe(ctx *Context) {
+	if ctx.Client.Subscription == nil {
+		replySubscription(ctx, "unsubscribe", ctx.Args, make([]int, len(ctx.Args)))
+		return
+	}
+	channels, counts := ctx.Server.PubSub.Unsubscribe(ctx.Client.Subscription, ctx.Args...)
+	replySubscription(ctx, "unsubscribe", channels, counts)
+}
+
+// PUnsubscribe unsubscribes the client from the given patterns, or from all of them if none is given
+func PUnsubscribe(ctx *Context) {
+	if ctx.Client.Subscription == nil {
+		replySubscription(ctx, "punsubscribe", ctx.Args, make([]int, len(ctx.Args)))
+		return
+	}
+	patterns, counts := ctx.Server.PubSub.PUnsubscribe(ctx.Client.Subscription, ctx.Args...)
+	replySubscription(ctx, "punsubscribe", patterns, counts)
+}
+
+// Publish posts a message to the given channel of all titan instances, it replies
+// the number of clients on this instance that received the message, the clients of
+// other instances are not counted
+func Publish(ctx *Context) {
+	n, err := ctx.Server.PubSub.Publish(ctx.Client.Namespace, ctx.Args[0], []byte(ctx.Args[1]))
+	if err != nil {
+		resp.ReplyError(ctx.Out, "ERR "+err.Error())
+		return
+	}
+	resp.ReplyInteger(ctx.Out, n)
+}
+
+// PubSub introspects the state of the pub/sub subsystem of this instance
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func PubSub(ctx *Context) {
+	hub := ctx.Server.PubSub
+	namespace := ctx.Client.Namespace
+	args := ctx.Args[1:]
+	switch strings.ToLower(ctx.Args[0]) {
+	case "channels":
+		if len(args) > 1 {
+			resp.ReplyError(ctx.Out, ErrWrongArgs("pubsub|channels").Error())
+			return
+		}
+		pattern := ""
+		if len(args) == 1 {
+			pattern = args[0]
+		}
+		channels := hub.Channels(namespace, pattern)
+		resp.ReplyArray(ctx.Out, len(channels))
+		for _, channel := range channels {
+			resp.ReplyBulkString(ctx.Out, channel)
+		}
+	case "numsub":
+		resp.ReplyArray(ctx.Out, len(args)*2)
+		for _, channel := range args {
+			resp.ReplyBulkString(ctx.Out, channel)
+			resp.ReplyInteger(ctx.Out, hub.NumSub(namespace, channel))
+		}
+	case "numpat":
+		if len(args) != 0 {
+			resp.ReplyError(ctx.Out, ErrWrongArgs("pubsub|numpat").Error())
+			return
+		}
+		resp.ReplyInteger(ctx.Out, hub.NumPat(namespace))
+	default:
+		resp.ReplyError(ctx.Out, "ERR Unknown subcommand or wrong number of arguments for '"+ctx.Args[0]+"'. Try PUBSUB HELP.")
+	}
+}
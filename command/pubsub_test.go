@@ -0,0 +1,113 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/pubsub"
+	"github.com/stretchr/testify/assert"
+)
+
+func pubsubContext(cli *context.ClientContext, serv *context.ServerContext, out *bytes.Buffer, name string, args ...string) *Context {
+	return &Context{
+		Name:    name,
+		Args:    args,
+		Out:     out,
+		Context: context.New(cli, serv),
+	}
+}
+
+// messageBuffer receives the messages written by the subscriptions in other goroutines
+type messageBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *messageBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// wait returns the messages once they contain s or it times out
+func (b *messageBuffer) wait(s string) string {
+	for i := 0; i < 100; i++ {
+		b.mu.Lock()
+		msgs := b.buf.String()
+		b.mu.Unlock()
+		if strings.Contains(msgs, s) || i == 99 {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return ""
+}
+
+func TestPubSub(t *testing.T) {
+	assert := assert.New(t)
+	serv := &context.ServerContext{PubSub: pubsub.NewHub()}
+	msgs := &messageBuffer{}
+	// the messages are written to the connection rather than the replies of the commands
+	subscriber := &context.ClientContext{ID: 1, Namespace: "$unittest", Writer: msgs}
+	publisher := &context.ClientContext{ID: 2, Namespace: "$unittest"}
+	subOut, pubOut := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	Subscribe(pubsubContext(subscriber, serv, subOut, "subscribe", "ch1", "ch2"))
+	assert.Equal("*3\r\n$9\r\nsubscribe\r\n$3\r\nch1\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$3\r\nch2\r\n:2\r\n", subOut.String())
+	assert.True(subscriber.Subscribed())
+
+	subOut.Reset()
+	PSubscribe(pubsubContext(subscriber, serv, subOut, "psubscribe", "ch*"))
+	assert.Equal("*3\r\n$10\r\npsubscribe\r\n$3\r\nch*\r\n:3\r\n", subOut.String())
+
+	subOut.Reset()
+	Publish(pubsubContext(publisher, serv, pubOut, "publish", "ch1", "hello"))
+	assert.Equal(":2\r\n", pubOut.String())
+	assert.Contains(msgs.wait("*3\r\n$7\r\nmessage\r\n"), "*3\r\n$7\r\nmessage\r\n$3\r\nch1\r\n$5\r\nhello\r\n")
+	assert.Contains(msgs.wait("*4\r\n$8\r\npmessage\r\n"), "*4\r\n$8\r\npmessage\r\n$3\r\nch*\r\n$3\r\nch1\r\n$5\r\nhello\r\n")
+	assert.Empty(subOut.String())
+
+	// other namespaces can not see the message
+	pubOut.Reset()
+	Publish(pubsubContext(&context.ClientContext{Namespace: "other"}, serv, pubOut, "publish", "ch1", "hello"))
+	assert.Equal(":0\r\n", pubOut.String())
+
+	pubOut.Reset()
+	PubSub(pubsubContext(publisher, serv, pubOut, "pubsub", "numsub", "ch1", "ch3"))
+	assert.Equal("*4\r\n$3\r\nch1\r\n:1\r\n$3\r\nch3\r\n:0\r\n", pubOut.String())
+
+	pubOut.Reset()
+	PubSub(pubsubContext(publisher, serv, pubOut, "pubsub", "numpat"))
+	assert.Equal(":1\r\n", pubOut.String())
+
+	// ping replies in a pong message
+	subOut.Reset()
+	Ping(pubsubContext(subscriber, serv, subOut, "ping"))
+	assert.Equal("*2\r\n$4\r\npong\r\n$0\r\n\r\n", subOut.String())
+
+	subOut.Reset()
+	Unsubscribe(pubsubContext(subscriber, serv, subOut, "unsubscribe"))
+	assert.Equal("*3\r\n$11\r\nunsubscribe\r\n$3\r\nch1\r\n:2\r\n*3\r\n$11\r\nunsubscribe\r\n$3\r\nch2\r\n:1\r\n", subOut.String())
+
+	subOut.Reset()
+	PUnsubscribe(pubsubContext(subscriber, serv, subOut, "punsubscribe"))
+	assert.Equal("*3\r\n$12\r\npunsubscribe\r\n$3\r\nch*\r\n:0\r\n", subOut.String())
+	assert.False(subscriber.Subscribed())
+
+	subOut.Reset()
+	Unsubscribe(pubsubContext(subscriber, serv, subOut, "unsubscribe"))
+	assert.Equal("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n", subOut.String())
+}
+
+func TestAllowedInSubscribeMode(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(AllowedInSubscribeMode("SUBSCRIBE"))
+	assert.True(AllowedInSubscribeMode("ping"))
+	assert.False(AllowedInSubscribeMode("get"))
+	assert.Equal("ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context",
+		ErrSubscribeMode("GET").Error())
+}
@@ -0,0 +1,663 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNoScript is returned by evalsha when the script is not cached
+	ErrNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+	// ErrNumKeys is returned when numkeys is larger than the number of arguments
+	ErrNumKeys = errors.New("ERR Number of keys can't be greater than number of args")
+
+	// ErrNumKeysNegative is returned when numkeys is negative
+	ErrNumKeysNegative = errors.New("ERR Number of keys can't be negative")
+
+	// ErrScriptNotAllowed is returned when a script calls a command which can not be called from scripts
+	ErrScriptNotAllowed = errors.New("ERR This Redis command is not allowed from scripts")
+
+	// ErrScriptUnknownCommand is returned when a script calls an unknown command
+	ErrScriptUnknownCommand = errors.New("ERR Unknown Redis command called from script")
+
+	// ErrScriptWrongArgs is returned when a script calls a command with wrong number of arguments
+	ErrScriptWrongArgs = errors.New("ERR Wrong number of args calling Redis command from script")
+
+	// ErrScriptNoArgs is returned when redis.call is called without arguments
+	ErrScriptNoArgs = errors.New("ERR Please specify at least one argument for this redis lib call")
+
+	// ErrScriptArgType is returned when the arguments of redis.call are not strings or numbers
+	ErrScriptArgType = errors.New("ERR Lua redis lib command arguments must be strings or integers")
+
+	// ErrScriptKilled is returned when the script is killed by script kill
+	ErrScriptKilled = errors.New("ERR Script killed by user with SCRIPT KILL...")
+
+	// ErrScriptTimeout is returned when the script runs longer than lua-time-limit, its writes are discarded
+	ErrScriptTimeout = errors.New("ERR Script exceeded lua-time-limit, the writes of the script are discarded")
+
+	// ErrNotBusy is returned by script kill when there is no script running
+	ErrNotBusy = errors.New("NOTBUSY No scripts in execution right now.")
+
+	// ErrUnkillable is returned by script kill when the scripts running have called write commands
+	ErrUnkillable = errors.New("UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+		"You can wait for the script to terminate or to exceed lua-time-limit.")
+)
+
+// Log levels of redis.log
+const (
+	scriptLogDebug = iota
+	scriptLogVerbose
+	scriptLogNotice
+	scriptLogWarning
+)
+
+// scriptChunkName is the chunk name shown in the errors of a script
+const scriptChunkName = "@user_script"
+
+// scriptSavedTTL is how long an instance remembers that a script is stored, a script flushed
+// by another instance is stored again by eval once it expires
+const scriptSavedTTL = time.Minute
+
+// scripts are shared by all the instances through the storage, the compiled
+// functions are cached locally so a script is only compiled once by an instance
+var scripts = &scriptCache{protos: make(map[string]*lua.FunctionProto), stored: make(map[string]time.Time)}
+
+type scriptCache struct {
+	sync.RWMutex
+	protos map[string]*lua.FunctionProto
+
+	// stored are the scripts known to be stored by namespace and sha, eval only
+	// writes the scripts it has not seen
+	stored map[string]time.Time
+}
+
+// saved returns true if the script of the namespace is known to be stored
+func (c *scriptCache) saved(namespace, sha string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	at, ok := c.stored[namespace+":"+sha]
+	return ok && time.Since(at) < scriptSavedTTL
+}
+
+// save remembers that the script of the namespace is stored
+func (c *scriptCache) save(namespace, sha string) {
+	c.Lock()
+	c.stored[namespace+":"+sha] = time.Now()
+	c.Unlock()
+}
+
+// compile returns the compiled function of a script
+func (c *scriptCache) compile(sha, body string) (*lua.FunctionProto, error) {
+	c.RLock()
+	proto, ok := c.protos[sha]
+	c.RUnlock()
+	if ok {
+		return proto, nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(body), scriptChunkName)
+	if err != nil {
+		return nil, errors.New("ERR Error compiling script (new function): " + err.Error())
+	}
+	proto, err = lua.Compile(chunk, scriptChunkName)
+	if err != nil {
+		return nil, errors.New("ERR Error compiling script (new function): " + err.Error())
+	}
+
+	c.Lock()
+	c.protos[sha] = proto
+	c.Unlock()
+	return proto, nil
+}
+
+// flush drops all the compiled functions and forgets the stored scripts
+func (c *scriptCache) flush() {
+	c.Lock()
+	c.protos = make(map[string]*lua.FunctionProto)
+	c.stored = make(map[string]time.Time)
+	c.Unlock()
+}
+
+// runningScripts are the scripts running on this instance, the ones of a namespace
+// are able to be killed by script kill if they have not called write commands
+var runningScripts = &scriptRegistry{runs: make(map[*scriptRun]struct{})}
+
+type scriptRegistry struct {
+	sync.Mutex
+	runs map[*scriptRun]struct{}
+}
+
+func (r *scriptRegistry) add(run *scriptRun) {
+	r.Lock()
+	r.runs[run] = struct{}{}
+	r.Unlock()
+}
+
+func (r *scriptRegistry) remove(run *scriptRun) {
+	r.Lock()
+	delete(r.runs, run)
+	r.Unlock()
+}
+
+// written marks the script as having called write commands, it returns false if the script has been killed
+func (r *scriptRegistry) written(run *scriptRun) bool {
+	r.Lock()
+	defer r.Unlock()
+	run.written = true
+	return !run.killed
+}
+
+// kill stops the scripts of the namespace which have not called write commands
+func (r *scriptRegistry) kill(namespace string) error {
+	r.Lock()
+	defer r.Unlock()
+	killed, unkillable := false, false
+	for run := range r.runs {
+		if run.ctx.Client.Namespace != namespace || run.killed {
+			continue
+		}
+		if run.written {
+			unkillable = true
+			continue
+		}
+		run.killed = true
+		run.cancel()
+		killed = true
+	}
+	switch {
+	case killed:
+		return nil
+	case unkillable:
+		return ErrUnkillable
+	}
+	return ErrNotBusy
+}
+
+func sha1hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// scriptRun is a running script, all the commands called by the script share
+// the same transaction
+type scriptRun struct {
+	ctx *Context
+	txn *db.Transaction
+
+	// cancel stops the script, killed and written are guarded by runningScripts
+	cancel  context.CancelFunc
+	killed  bool
+	written bool
+
+	// signals of the keys touched by the script, they are deferred after the
+	// transaction is committed or the blocked clients may see nothing
+	signals []func()
+}
+
+// onCommit replies with reply and then fires the deferred signals
+func (run *scriptRun) onCommit(reply OnCommit) OnCommit {
+	return func() {
+		reply()
+		for _, signal := range run.signals {
+			signal()
+		}
+	}
+}
+
+// newState creates a sandboxed lua state for the script, the script is stopped when lctx is done
+func (run *scriptRun) newState(lctx *context.Context, keys, argv []string) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	L.SetContext(lctx)
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// scripts should never touch the file system of the server, load code at runtime, or get
+	// around the protection of the globals and the environments like the sandbox of redis
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring", "rawset", "rawget",
+		"getmetatable", "setmetatable", "getfenv", "setfenv", "collectgarbage", "_printregs"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	L.SetGlobal("KEYS", stringsTable(L, keys))
+	L.SetGlobal("ARGV", stringsTable(L, argv))
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return run.call(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return run.call(L, false)
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1hex(L.CheckString(1))))
+			return 1
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(replyTable(L, "err", L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(replyTable(L, "ok", L.CheckString(1)))
+			return 1
+		},
+		"log": run.log,
+	})
+	redis.RawSetString("LOG_DEBUG", lua.LNumber(scriptLogDebug))
+	redis.RawSetString("LOG_VERBOSE", lua.LNumber(scriptLogVerbose))
+	redis.RawSetString("LOG_NOTICE", lua.LNumber(scriptLogNotice))
+	redis.RawSetString("LOG_WARNING", lua.LNumber(scriptLogWarning))
+	L.SetGlobal("redis", redis)
+
+	// the global variables are protected so that scripts can not leak states
+	mt := L.NewTable()
+	L.SetFuncs(mt, map[string]lua.LGFunction{
+		"__newindex": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to create global variable '%s'", L.CheckString(2))
+			return 0
+		},
+		"__index": func(L *lua.LState) int {
+			L.RaiseError("Script attempted to access nonexistent global variable '%s'", L.CheckString(2))
+			return 0
+		},
+	})
+	L.SetMetatable(L.G.Global, mt)
+	return L
+}
+
+func stringsTable(L *lua.LState, ss []string) *lua.LTable {
+	t := L.CreateTable(len(ss), 0)
+	for _, s := range ss {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+func replyTable(L *lua.LState, field, msg string) *lua.LTable {
+	t := L.CreateTable(0, 1)
+	t.RawSetString(field, lua.LString(msg))
+	return t
+}
+
+// errorReply returns the error message if v is an error reply
+func errorReply(v lua.LValue) (string, bool) {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return "", false
+	}
+	msg, ok := t.RawGetString("err").(lua.LString)
+	return string(msg), ok
+}
+
+// call implements redis.call and redis.pcall, an error is raised by redis.call
+// and returned as an error reply by redis.pcall
+func (run *scriptRun) call(L *lua.LState, raise bool) int {
+	reply, err := run.exec(L)
+	if err != nil {
+		reply = replyTable(L, "err", err.Error())
+	}
+	if raise {
+		if _, ok := errorReply(reply); ok {
+			L.Error(reply, 0)
+			return 0
+		}
+	}
+	L.Push(reply)
+	return 1
+}
+
+// exec calls the command with the arguments on the stack of L
+func (run *scriptRun) exec(L *lua.LState) (lua.LValue, error) {
+	n := L.GetTop()
+	if n == 0 {
+		return nil, ErrScriptNoArgs
+	}
+	args := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			args[i-1] = string(v)
+		case lua.LNumber:
+			args[i-1] = v.String()
+		default:
+			return nil, ErrScriptArgType
+		}
+	}
+
+	name := strings.ToLower(args[0])
+	desc, ok := commands[name]
+	if !ok {
+		return nil, ErrScriptUnknownCommand
+	}
+	if desc.Txn == nil || desc.Cons.Flags&CmdNoScript != 0 {
+		return nil, ErrScriptNotAllowed
+	}
+	arity := desc.Cons.Arity
+	if (arity > 0 && n != arity) || (arity < 0 && n < -arity) {
+		return nil, ErrScriptWrongArgs
+	}
+	// a script is unkillable once it writes
+	if desc.Cons.Flags&CmdWrite != 0 && !runningScripts.written(run) {
+		return nil, ErrScriptKilled
+	}
+
+	out := &bytes.Buffer{}
+	subCtx := &Context{
+		Name:    name,
+		Args:    args[1:],
+		In:      run.ctx.In,
+		Out:     out,
+		TraceID: run.ctx.TraceID,
+		Context: run.ctx.Context,
+		script:  run,
+	}
+	onCommit, err := TxnCall(subCtx, run.txn)
+	if err != nil {
+		return nil, err
+	}
+	if onCommit != nil {
+		onCommit()
+	}
+	return readReply(L, bufio.NewReader(out))
+}
+
+// log implements redis.log
+func (run *scriptRun) log(L *lua.LState) int {
+	level := L.CheckInt(1)
+	n := L.GetTop()
+	msg := make([]string, 0, n-1)
+	for i := 2; i <= n; i++ {
+		msg = append(msg, L.ToStringMeta(L.Get(i)).String())
+	}
+	fields := []zap.Field{
+		zap.Int64("clientid", run.ctx.Client.ID),
+		zap.String("command", run.ctx.Name),
+		zap.String("traceid", run.ctx.TraceID),
+	}
+	switch level {
+	case scriptLogDebug, scriptLogVerbose:
+		zap.L().Debug(strings.Join(msg, " "), fields...)
+	case scriptLogNotice:
+		zap.L().Info(strings.Join(msg, " "), fields...)
+	case scriptLogWarning:
+		zap.L().Warn(strings.Join(msg, " "), fields...)
+	default:
+		L.RaiseError("Invalid debug level.")
+	}
+	return 0
+}
+
+// readReply converts a RESP reply to a lua value
+func readReply(L *lua.LState, r *bufio.Reader) (lua.LValue, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return nil, resp.ErrInvalidProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return replyTable(L, "ok", line[1:]), nil
+	case '-':
+		return replyTable(L, "err", line[1:]), nil
+	case ':':
+		v, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, resp.ErrInvalidProtocol
+		}
+		return lua.LNumber(v), nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, resp.ErrInvalidProtocol
+		}
+		if size < 0 {
+			return lua.LFalse, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return lua.LString(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, resp.ErrInvalidProtocol
+		}
+		if size < 0 {
+			return lua.LFalse, nil
+		}
+		t := L.CreateTable(size, 0)
+		for i := 0; i < size; i++ {
+			v, err := readReply(L, r)
+			if err != nil {
+				return nil, err
+			}
+			t.Append(v)
+		}
+		return t, nil
+	}
+	return nil, resp.ErrInvalidProtocol
+}
+
+// writeReply converts a lua value to a RESP reply
+func writeReply(w io.Writer, v lua.LValue) {
+	switch v := v.(type) {
+	case lua.LString:
+		resp.ReplyBulkString(w, string(v))
+	case lua.LNumber:
+		resp.ReplyInteger(w, int64(v))
+	case lua.LBool:
+		if v {
+			resp.ReplyInteger(w, 1)
+			return
+		}
+		resp.ReplyNullBulkString(w)
+	case *lua.LTable:
+		if msg, ok := errorReply(v); ok {
+			resp.ReplyError(w, msg)
+			return
+		}
+		if msg, ok := v.RawGetString("ok").(lua.LString); ok {
+			resp.ReplySimpleString(w, string(msg))
+			return
+		}
+		// an array ends at the first nil like redis does
+		size := 0
+		for v.RawGetInt(size+1) != lua.LNil {
+			size++
+		}
+		resp.ReplyArray(w, size)
+		for i := 1; i <= size; i++ {
+			writeReply(w, v.RawGetInt(i))
+		}
+	default:
+		resp.ReplyNullBulkString(w)
+	}
+}
+
+// runScript runs the script with the arguments "numkeys key [key ...] arg [arg ...]"
+func runScript(ctx *Context, txn *db.Transaction, sha, body string, args []string) (OnCommit, error) {
+	numkeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, ErrInteger
+	}
+	if numkeys < 0 {
+		return nil, ErrNumKeysNegative
+	}
+	if numkeys > len(args)-1 {
+		return nil, ErrNumKeys
+	}
+	proto, err := scripts.compile(sha, body)
+	if err != nil {
+		return nil, err
+	}
+
+	lctx, cancel := context.WithCancel(ctx.Context)
+	if limit := ctx.Server.Options().LuaTimeLimit; limit > 0 {
+		lctx, cancel = context.WithTimeout(ctx.Context, limit)
+	}
+	defer cancel()
+	run := &scriptRun{ctx: ctx, txn: txn, cancel: cancel}
+	runningScripts.add(run)
+	defer runningScripts.remove(run)
+	L := run.newState(lctx, args[1:1+numkeys], args[1+numkeys:])
+	defer L.Close()
+
+	// the writes before an error are kept like redis does, so the transaction
+	// is committed even if the script fails, except that it is stopped
+	out := &bytes.Buffer{}
+	L.Push(L.NewFunctionFromProto(proto))
+	err = L.PCall(0, 1, nil)
+	runningScripts.Lock()
+	killed := run.killed
+	runningScripts.Unlock()
+	if killed {
+		return nil, ErrScriptKilled
+	}
+	if err != nil && lctx.Err() == context.DeadlineExceeded {
+		return nil, ErrScriptTimeout
+	}
+	if err != nil {
+		msg := "ERR Error running script (call to f_" + sha + "): " + err.Error()
+		if e, ok := err.(*lua.ApiError); ok {
+			msg = "ERR Error running script (call to f_" + sha + "): " + e.Object.String()
+			// errors raised by redis.call are replied as they are
+			if reply, ok := errorReply(e.Object); ok {
+				msg = reply
+			}
+		}
+		resp.ReplyError(out, msg)
+	} else {
+		writeReply(out, L.Get(-1))
+	}
+	return run.onCommit(func() {
+		ctx.Out.Write(out.Bytes())
+	}), nil
+}
+
+// Eval runs a lua script, all the commands called by the script are committed in a single transaction
+func Eval(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	body := ctx.Args[0]
+	sha := sha1hex(body)
+	onCommit, err := runScript(ctx, txn, sha, body, ctx.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	// cache the script so it can be called by evalsha on every instance, it is only
+	// stored the first time the instance sees it
+	namespace := ctx.Client.DB.Namespace
+	if scripts.saved(namespace, sha) {
+		return onCommit, nil
+	}
+	if err := txn.SetScript(sha, []byte(body)); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return func() {
+		scripts.save(namespace, sha)
+		onCommit()
+	}, nil
+}
+
+// EvalSha runs a script cached by eval or script load
+func EvalSha(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	sha := strings.ToLower(ctx.Args[0])
+	body, err := txn.Script(sha)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if body == nil {
+		return nil, ErrNoScript
+	}
+	return runScript(ctx, txn, sha, string(body), ctx.Args[1:])
+}
+
+// Script manages the script cache
+func Script(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	subcommand := strings.ToLower(ctx.Args[0])
+	args := ctx.Args[1:]
+	switch {
+	case subcommand == "load" && len(args) == 1:
+		sha := sha1hex(args[0])
+		if _, err := scripts.compile(sha, args[0]); err != nil {
+			return nil, err
+		}
+		if err := txn.SetScript(sha, []byte(args[0])); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		namespace := ctx.Client.DB.Namespace
+		return func() {
+			scripts.save(namespace, sha)
+			resp.ReplyBulkString(ctx.Out, sha)
+		}, nil
+	case subcommand == "exists" && len(args) > 0:
+		shas := make([]string, len(args))
+		for i := range args {
+			shas[i] = strings.ToLower(args[i])
+		}
+		exists, err := txn.ScriptsExist(shas)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return func() {
+			resp.ReplyArray(ctx.Out, len(exists))
+			for _, exist := range exists {
+				if exist {
+					resp.ReplyInteger(ctx.Out, 1)
+					continue
+				}
+				resp.ReplyInteger(ctx.Out, 0)
+			}
+		}, nil
+	case subcommand == "kill" && len(args) == 0:
+		// only the scripts running on this instance are killed
+		if err := runningScripts.kill(ctx.Client.Namespace); err != nil {
+			return nil, err
+		}
+		return SimpleString(ctx.Out, OK), nil
+	case subcommand == "flush" && len(args) <= 1:
+		// scripts are always flushed synchronously
+		if len(args) == 1 {
+			if mode := strings.ToLower(args[0]); mode != "sync" && mode != "async" {
+				return nil, ErrSyntax
+			}
+		}
+		if err := txn.FlushScripts(); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return func() {
+			scripts.flush()
+			resp.ReplySimpleString(ctx.Out, OK)
+		}, nil
+	}
+	return nil, errors.New("ERR Unknown subcommand or wrong number of arguments for '" + ctx.Args[0] + "'. Try SCRIPT HELP.")
+}
@@ -0,0 +1,154 @@
+package command
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/distributedio/titan/context"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("eval", "return 1", "0")))
+	assert.Equal(t, "$5\r\nhello\r\n", ctxString(CallTest("eval", "return 'hello'", "0")))
+	assert.Equal(t, "*3\r\n$2\r\nk1\r\n$2\r\na1\r\n$2\r\na2\r\n", ctxString(CallTest("eval", "return {KEYS[1], ARGV[1], ARGV[2]}", "1", "k1", "a1", "a2")))
+	assert.Equal(t, "*2\r\n:1\r\n:2\r\n", ctxString(CallTest("eval", "return {1, 2, nil, 3}", "0")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("eval", "return true", "0")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("eval", "return false", "0")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("eval", "return 3.99", "0")))
+	assert.Equal(t, "+fine\r\n", ctxString(CallTest("eval", "return redis.status_reply('fine')", "0")))
+	assert.Equal(t, "-My Error\r\n", ctxString(CallTest("eval", "return redis.error_reply('My Error')", "0")))
+	assert.Equal(t, "$40\r\nda39a3ee5e6b4b0d3255bfef95601890afd80709\r\n", ctxString(CallTest("eval", "return redis.sha1hex('')", "0")))
+
+	assert.Equal(t, "-"+ErrNumKeys.Error()+"\r\n", ctxString(CallTest("eval", "return 1", "2", "k")))
+	assert.Equal(t, "-"+ErrNumKeysNegative.Error()+"\r\n", ctxString(CallTest("eval", "return 1", "-1")))
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", ctxString(CallTest("eval", "return 1", "a")))
+	assert.Contains(t, ctxString(CallTest("eval", "return (", "0")), "-ERR Error compiling script")
+	assert.Contains(t, ctxString(CallTest("eval", "a = 1", "0")), "Script attempted to create global variable 'a'")
+	assert.Contains(t, ctxString(CallTest("eval", "return a", "0")), "Script attempted to access nonexistent global variable 'a'")
+	assert.Contains(t, ctxString(CallTest("eval", "return dofile('/etc/passwd')", "0")), "-ERR Error running script")
+	for _, script := range []string{
+		"setmetatable(_G, nil); a = 1",
+		"return getmetatable(_G)",
+		"rawset(_G, 'a', 1)",
+		"return loadstring('return 1')()",
+		"return load(function() return nil end)",
+		"return collectgarbage('count')",
+		"setfenv(1, {})",
+	} {
+		assert.Contains(t, ctxString(CallTest("eval", script, "0")), "Script attempted to access nonexistent global variable", script)
+	}
+}
+
+func TestEvalCall(t *testing.T) {
+	key := "eval-call"
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("eval", "return redis.call('set', KEYS[1], ARGV[1])", "1", key, "v")))
+	assert.Equal(t, "$1\r\nv\r\n", ctxString(CallTest("eval", "return redis.call('get', KEYS[1])", "1", key)))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("eval", "return redis.call('get', KEYS[1]) == false and 1 or 0", "1", key+"-none")))
+	assert.Equal(t, "$2\r\nOK\r\n", ctxString(CallTest("eval", "return redis.call('set', KEYS[1], 1)['ok']", "1", key)))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("eval", "return redis.call('incr', KEYS[1])", "1", key)))
+
+	// commands called by a script see the writes of the script
+	script := `
+redis.call('rpush', KEYS[1], 'a', 'b', 'c')
+redis.call('lpop', KEYS[1])
+return redis.call('lrange', KEYS[1], 0, -1)`
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", ctxString(CallTest("eval", script, "1", key+"-list")))
+
+	// redis.call raises the error and redis.pcall returns it
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('lpush', KEYS[1], 'a')", "1", key)))
+	assert.Equal(t, "$"+strconv.Itoa(len(ErrTypeMismatch.Error()))+"\r\n"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("eval", "return redis.pcall('lpush', KEYS[1], 'a')['err']", "1", key)))
+	assert.Equal(t, "-"+ErrScriptUnknownCommand.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('nosuchcommand')", "0")))
+	assert.Equal(t, "-"+ErrScriptNotAllowed.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('multi')", "0")))
+	assert.Equal(t, "-"+ErrScriptNotAllowed.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('eval', 'return 1', 0)", "0")))
+	assert.Equal(t, "-"+ErrScriptWrongArgs.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('get')", "0")))
+	assert.Equal(t, "-"+ErrScriptArgType.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call('get', {})", "0")))
+	assert.Equal(t, "-"+ErrScriptNoArgs.Error()+"\r\n", ctxString(CallTest("eval", "return redis.call()", "0")))
+
+	// the writes before an error are kept
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("eval", "redis.call('set', KEYS[1], 'x'); return redis.call('lpush', KEYS[1], 'a')", "1", key)))
+	assert.Equal(t, "$1\r\nx\r\n", ctxString(CallTest("get", key)))
+}
+
+func TestEvalSha(t *testing.T) {
+	body := "return ARGV[1]"
+	sha := sha1hex(body)
+	assert.Equal(t, "-"+ErrNoScript.Error()+"\r\n", ctxString(CallTest("evalsha", sha, "0", "a")))
+	assert.Equal(t, "*1\r\n:0\r\n", ctxString(CallTest("script", "exists", sha)))
+
+	assert.Equal(t, "$40\r\n"+sha+"\r\n", ctxString(CallTest("script", "load", body)))
+	assert.Equal(t, "$1\r\na\r\n", ctxString(CallTest("evalsha", sha, "0", "a")))
+
+	// scripts are stored, evalsha works when the compiled script is missing
+	scripts.flush()
+	assert.Equal(t, "$1\r\nb\r\n", ctxString(CallTest("evalsha", sha, "0", "b")))
+
+	eval := "return 'eval'"
+	ctx := ContextTest("eval", eval, "0")
+	Call(ctx)
+	assert.Equal(t, "$4\r\neval\r\n", ctxString(ctx.Out))
+	assert.True(t, scripts.saved(ctx.Client.DB.Namespace, sha1hex(eval)))
+	assert.Equal(t, "*3\r\n:1\r\n:1\r\n:0\r\n", ctxString(CallTest("script", "exists", sha, sha1hex(eval), "none")))
+
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("script", "flush")))
+	assert.Equal(t, "-"+ErrNoScript.Error()+"\r\n", ctxString(CallTest("evalsha", sha, "0", "a")))
+	assert.Equal(t, "*2\r\n:0\r\n:0\r\n", ctxString(CallTest("script", "exists", sha, sha1hex(eval))))
+
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("script", "flush", "now")))
+	assert.Contains(t, ctxString(CallTest("script", "load", "return (")), "-ERR Error compiling script")
+	assert.Contains(t, ctxString(CallTest("script", "kill", "now")), "-ERR Unknown subcommand")
+}
+
+// runScriptTest runs the script in background with the time limit
+func runScriptTest(limit time.Duration, script string, args ...string) <-chan string {
+	ctx := ContextTest("eval", append([]string{script}, args...)...)
+	ctx.Server.SetOptions(context.Options{LuaTimeLimit: limit})
+	done := make(chan string, 1)
+	go func() {
+		Call(ctx)
+		done <- ctxString(ctx.Out)
+	}()
+	// wait until the script is running
+	for i := 0; i < 100; i++ {
+		runningScripts.Lock()
+		n := len(runningScripts.runs)
+		runningScripts.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return done
+}
+
+func TestScriptKill(t *testing.T) {
+	key := "script-kill"
+	assert.Equal(t, "-"+ErrNotBusy.Error()+"\r\n", ctxString(CallTest("script", "kill")))
+
+	done := runScriptTest(0, "while true do end", "0")
+	ctx := ContextTest("script", "kill")
+	ctx.Client.Namespace = "script-kill-other"
+	Call(ctx)
+	assert.Equal(t, "-"+ErrNotBusy.Error()+"\r\n", ctxString(ctx.Out))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("script", "kill")))
+	assert.Equal(t, "-"+ErrScriptKilled.Error()+"\r\n", blockingReply(t, done))
+
+	// scripts having written are unkillable, they are stopped by the time limit and the writes are discarded
+	done = runScriptTest(500*time.Millisecond, "redis.call('set', KEYS[1], 'v') while true do end", "1", key)
+	assert.Equal(t, "-"+ErrUnkillable.Error()+"\r\n", ctxString(CallTest("script", "kill")))
+	assert.Equal(t, "-"+ErrScriptTimeout.Error()+"\r\n", blockingReply(t, done))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("get", key)))
+
+	assert.Equal(t, "-"+ErrScriptTimeout.Error()+"\r\n", blockingReply(t, runScriptTest(100*time.Millisecond, "while true do end", "0")))
+	assert.Equal(t, "-"+ErrNotBusy.Error()+"\r\n", ctxString(CallTest("script", "kill")))
+}
+
+func TestEvalSignal(t *testing.T) {
+	key := "eval-signal"
+	done := blockingTest(1, "blpop", key, "0")
+	waitBlocked(t, 1)
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("eval", "return redis.call('rpush', KEYS[1], 'v')", "1", key)))
+	assert.Equal(t, "*2\r\n$11\r\neval-signal\r\n$1\r\nv\r\n", blockingReply(t, done))
+	waitBlocked(t, 0)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/distributedio/titan/context"
@@ -24,7 +26,7 @@ func Monitor(ctx *Context) {
 
 // Client manages client connections
 func Client(ctx *Context) {
-	syntaxErr := "ERR Syntax error, try CLIENT (LIST | KILL | GETNAME | SETNAME | PAUSE | REPLY)"
+	syntaxErr := "ERR Syntax error, try CLIENT (LIST | KILL | GETNAME | SETNAME | PAUSE | REPLY | UNBLOCK)"
 	list := func(ctx *Context) {
 		now := time.Now()
 		var lines []string
@@ -57,7 +59,7 @@ func Client(ctx *Context) {
 			resp.ReplyBulkString(ctx.Out, name)
 			return
 		}
-		resp.ReplyNullBulkString(ctx.Out)
+		encoder(ctx).NullBulkString()
 	}
 	setname := func(ctx *Context) {
 		args := ctx.Args[1:]
@@ -189,6 +191,45 @@ func Client(ctx *Context) {
 		}
 	}
 
+	unblock := func(ctx *Context) {
+		args := ctx.Args[1:]
+		if len(args) != 1 && len(args) != 2 {
+			resp.ReplyError(ctx.Out, syntaxErr)
+			return
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			resp.ReplyError(ctx.Out, ErrInteger.Error())
+			return
+		}
+		withError := false
+		if len(args) == 2 {
+			switch strings.ToLower(args[1]) {
+			case "timeout":
+			case "error":
+				withError = true
+			default:
+				resp.ReplyError(ctx.Out, "ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+				return
+			}
+		}
+		v, ok := ctx.Server.Clients.Load(id)
+		if !ok {
+			resp.ReplyInteger(ctx.Out, 0)
+			return
+		}
+		cli := v.(*context.ClientContext)
+		if ctx.Client.Namespace != sysAdminNamespace && cli.Namespace != ctx.Client.Namespace {
+			resp.ReplyInteger(ctx.Out, 0)
+			return
+		}
+		if !ctx.Server.PubSub.Notifier().Unblock(id, withError) {
+			resp.ReplyInteger(ctx.Out, 0)
+			return
+		}
+		resp.ReplyInteger(ctx.Out, 1)
+	}
+
 	args := ctx.Args
 	switch strings.ToLower(args[0]) {
 	case "list":
@@ -203,6 +244,8 @@ func Client(ctx *Context) {
 		reply(ctx)
 	case "pause":
 		pause(ctx)
+	case "unblock":
+		unblock(ctx)
 	default:
 		resp.ReplyError(ctx.Out, syntaxErr)
 	}
@@ -285,7 +328,7 @@ func RedisCommand(ctx *Context) {
 				resp.ReplyInteger(ctx.Out, int64(cmd.Cons.LastKey))
 				resp.ReplyInteger(ctx.Out, int64(cmd.Cons.KeyStep))
 			} else {
-				resp.ReplyNullBulkString(ctx.Out)
+				encoder(ctx).NullBulkString()
 			}
 		}
 	}
@@ -336,6 +379,15 @@ func FlushDB(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return SimpleString(ctx.Out, "OK"), nil
 }
 
+// DBSize returns the number of keys in the currently-selected database
+func DBSize(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	keys, _, err := txn.Kv().DBSize()
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, keys), nil
+}
+
 // FlushAll cleans up all databases
 // This function is **VERY DANGEROUS**. It's not only running on one single region, but it can
 // delete a large range that spans over many regions, bypassing the Raft layer.
@@ -347,6 +399,25 @@ func FlushAll(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return SimpleString(ctx.Out, "OK"), nil
 }
 
+// keyspace returns the number of keys of the dbs in the namespace of the client
+func keyspace(ctx *Context) ([]db.DBStat, error) {
+	txn, err := ctx.Client.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := txn.Kv().DBStats()
+	if err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+	// the counters of the dbs may be built by scanning them
+	if err := txn.Commit(ctx); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+	return stats, nil
+}
+
 // Time returns the server time
 func Time(ctx *Context) {
 	now := time.Now().UnixNano() / int64(time.Microsecond)
@@ -357,22 +428,80 @@ func Time(ctx *Context) {
 	resp.ReplyBulkString(ctx.Out, strconv.Itoa(int(msec)))
 }
 
+// infoGCBacklogLimit is the most objects waiting for gc counted by INFO
+const infoGCBacklogLimit = 10000
+
+// the sections of INFO are shown by default, by "all" and "everything", or only by their names
+const (
+	infoByDefault = iota
+	infoByAll
+	infoByName
+)
+
+// infoSections are the sections of INFO in order, the sections of admin are only shown to $sys.admin
+var infoSections = []struct {
+	name  string
+	title string
+	shown int
+	admin bool
+	lines func(ctx *Context) ([]string, error)
+}{
+	{"server", "Server", infoByDefault, false, infoServer},
+	{"clients", "Clients", infoByDefault, false, infoClients},
+	{"stats", "Stats", infoByDefault, false, infoStats},
+	{"commandstats", "Commandstats", infoByAll, false, infoCommandStats},
+	{"errorstats", "Errorstats", infoByDefault, false, infoErrorStats},
+	{"keyspace", "Keyspace", infoByDefault, false, infoKeyspace},
+	// the gc backlog is counted by scanning the storage
+	{"tikv", "TiKV", infoByName, true, infoTiKV},
+}
+
 // Info returns information and statistics about the server in a format that is simple to parse by computers and easy to read by humans
 func Info(ctx *Context) {
+	selected := map[string]bool{"default": len(ctx.Args) == 0}
+	for _, arg := range ctx.Args {
+		selected[strings.ToLower(arg)] = true
+	}
+	// titan persists everything to tikv
+	if selected["persistence"] {
+		selected["tikv"] = true
+	}
+	all := selected["all"] || selected["everything"]
+
+	var lines []string
+	for _, section := range infoSections {
+		if section.admin && ctx.Client.Namespace != sysAdminNamespace {
+			continue
+		}
+		if !selected[section.name] && !(all && section.shown <= infoByAll) &&
+			!(selected["default"] && section.shown == infoByDefault) {
+			continue
+		}
+		sectionLines, err := section.lines(ctx)
+		if err != nil {
+			resp.ReplyError(ctx.Out, "ERR "+err.Error())
+			return
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "# "+section.title)
+		lines = append(lines, sectionLines...)
+	}
+	if len(lines) == 0 {
+		resp.ReplyBulkString(ctx.Out, "")
+		return
+	}
+	resp.ReplyBulkString(ctx.Out, strings.Join(lines, "\n")+"\n")
+}
+
+func infoServer(ctx *Context) ([]string, error) {
 	exe, err := os.Executable()
 	if err != nil {
-		resp.ReplyError(ctx.Out, "ERR "+err.Error())
+		return nil, err
 	}
 
-	// count the number of clients
-	var numberOfClients int
-	ctx.Server.Clients.Range(func(k, v interface{}) bool {
-		numberOfClients++
-		return true
-	})
-
 	var lines []string
-	lines = append(lines, "# Server")
 	lines = append(lines, "titan_version:"+context.ReleaseVersion)
 	lines = append(lines, "titan_git_sha1:"+context.GitHash)
 	lines = append(lines, "titan_build_id:"+context.BuildTS)
@@ -383,14 +512,116 @@ func Info(ctx *Context) {
 	lines = append(lines, "uptime_in_seconds:"+strconv.FormatInt(int64(time.Since(ctx.Server.StartAt)/time.Second), 10))
 	lines = append(lines, "uptime_in_days:"+strconv.FormatInt(int64(time.Since(ctx.Server.StartAt)/time.Second/86400), 10))
 	lines = append(lines, "executable:"+exe)
+	return lines, nil
+}
 
-	lines = append(lines, "# Clients")
+func infoClients(ctx *Context) ([]string, error) {
+	// count the number of clients
+	var numberOfClients int
+	ctx.Server.Clients.Range(func(k, v interface{}) bool {
+		numberOfClients++
+		return true
+	})
+	var blockedClients int
+	if ctx.Server.PubSub != nil {
+		blockedClients = ctx.Server.PubSub.Notifier().Blocked()
+	}
+
+	var lines []string
 	lines = append(lines, "connected_clients:"+strconv.Itoa(numberOfClients))
 	lines = append(lines, "client_longest_output_list:0")
 	lines = append(lines, "client_biggest_input_buf:0")
-	lines = append(lines, "blocked_clients:0")
+	lines = append(lines, "blocked_clients:"+strconv.Itoa(blockedClients))
 	lines = append(lines, "client_namespace:"+ctx.Client.Namespace)
+	return lines, nil
+}
 
-	resp.ReplyBulkString(ctx.Out, strings.Join(lines, "\n")+"\n")
-	return
+func infoStats(ctx *Context) ([]string, error) {
+	var commandsProcessed int64
+	for _, stat := range loadCommandStats() {
+		commandsProcessed += stat.Calls
+	}
+	errorReplies, _ := loadErrorStats()
+
+	var lines []string
+	lines = append(lines, "total_connections_received:"+strconv.FormatInt(atomic.LoadInt64(&ctx.Server.ConnectionsReceived), 10))
+	lines = append(lines, "total_commands_processed:"+strconv.FormatInt(commandsProcessed, 10))
+	lines = append(lines, "rejected_connections:"+strconv.FormatInt(atomic.LoadInt64(&ctx.Server.RejectedConnections), 10))
+	lines = append(lines, "total_error_replies:"+strconv.FormatInt(errorReplies, 10))
+	return lines, nil
+}
+
+func infoCommandStats(ctx *Context) ([]string, error) {
+	stats := loadCommandStats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		stat := stats[name]
+		var perCall float64
+		if stat.Calls > 0 {
+			perCall = float64(stat.Microseconds) / float64(stat.Calls)
+		}
+		lines = append(lines, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			name, stat.Calls, stat.Microseconds, perCall, stat.RejectedCalls, stat.FailedCalls))
+	}
+	return lines, nil
+}
+
+func infoErrorStats(ctx *Context) ([]string, error) {
+	_, counts := loadErrorStats()
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	lines := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		lines = append(lines, fmt.Sprintf("errorstat_%s:count=%d", kind, counts[kind]))
+	}
+	return lines, nil
+}
+
+func infoKeyspace(ctx *Context) ([]string, error) {
+	if ctx.Client.DB == nil {
+		return nil, nil
+	}
+	stats, err := keyspace(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, stat := range stats {
+		lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0", stat.ID, stat.Keys, stat.Expires))
+	}
+	return lines, nil
+}
+
+func infoTiKV(ctx *Context) ([]string, error) {
+	if ctx.Server.Store == nil {
+		return nil, nil
+	}
+	status, err := ctx.Server.Store.Status(infoGCBacklogLimit)
+	if err != nil {
+		return nil, err
+	}
+	var lastSafePoint string
+	if status.LastSafePoint != nil {
+		lastSafePoint = status.LastSafePoint.Format(time.RFC3339)
+	}
+
+	var lines []string
+	lines = append(lines, "pd_addrs:"+status.PdAddrs)
+	for _, task := range status.Tasks {
+		lines = append(lines, task.Name+"_task:"+task.State)
+	}
+	lines = append(lines, "last_safe_point:"+lastSafePoint)
+	lines = append(lines, "gc_backlog:"+strconv.Itoa(status.GCBacklog))
+	lines = append(lines, "gc_backlog_capped:"+strconv.FormatBool(status.GCBacklogCapped))
+	return lines, nil
 }
@@ -2,6 +2,7 @@ package command
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -32,6 +33,59 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+func TestInfoSections(t *testing.T) {
+	call := func(name string, args ...string) string {
+		ctx := ContextTest(name, args...)
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+	admin := func(args ...string) string {
+		ctx := ContextTest("info", args...)
+		ctx.Client.Namespace = sysAdminNamespace
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+	before := loadCommandStats()["ping"]
+	call("ping")
+	call("get")
+	call("set", "info-wrongtype", "v")
+	call("lpush", "info-wrongtype", "v")
+
+	ping := loadCommandStats()["ping"]
+	assert.Equal(t, before.Calls+1, ping.Calls)
+	get := loadCommandStats()["get"]
+	assert.True(t, get.RejectedCalls > 0)
+	lpush := loadCommandStats()["lpush"]
+	assert.True(t, lpush.FailedCalls > 0)
+
+	out := call("info")
+	assert.Contains(t, out, "# Server\n")
+	assert.Contains(t, out, "\n\n# Stats\ntotal_connections_received:")
+	assert.Contains(t, out, "\n\n# Keyspace\n")
+	assert.Contains(t, out, "\nerrorstat_WRONGTYPE:count=")
+	assert.NotContains(t, out, "# Commandstats")
+	assert.NotContains(t, out, "# TiKV")
+
+	out = call("info", "commandstats")
+	assert.True(t, strings.HasPrefix(out, "$"), out)
+	assert.Contains(t, out, "\r\n# Commandstats\n")
+	assert.Contains(t, out, fmt.Sprintf("\ncmdstat_ping:calls=%d,usec=", ping.Calls))
+	assert.Contains(t, out, fmt.Sprintf(",rejected_calls=%d,failed_calls=%d\n", lpush.RejectedCalls, lpush.FailedCalls))
+	assert.NotContains(t, out, "# Server")
+
+	// the tikv section is only shown to $sys.admin by its name
+	out = admin("SERVER", "persistence")
+	assert.Contains(t, out, "# Server\n")
+	assert.Contains(t, out, "# TiKV\n")
+	assert.Contains(t, out, "\ngc_task:disabled\nexpire_task:disabled\nzt_task:disabled\ntikvgc_task:disabled\nkeycount_task:disabled\n")
+	assert.Contains(t, out, "\ngc_backlog_capped:false\n")
+	assert.NotContains(t, out, "# Clients")
+	assert.NotContains(t, admin("all"), "# TiKV")
+	assert.Equal(t, "$0\r\n\r\n", call("info", "tikv"))
+	assert.Contains(t, call("info", "all"), "# Commandstats\n")
+	assert.Equal(t, "$0\r\n\r\n", call("info", "none"))
+}
+
 func TestMonitor(t *testing.T) {
 	assert := assert.New(t)
 	cli := &context.ClientContext{
@@ -93,3 +147,38 @@ func TestClient_List(t *testing.T) {
 
 	assert.Contains(out.String(), "id=1 addr=127.0.0.1")
 }
+
+func TestDBSizeAndSwapDB(t *testing.T) {
+	call := func(id int, name string, args ...string) string {
+		ctx := ContextTest(name, args...)
+		ctx.Client.DB = mockdb.DB("swapdb-ns", id)
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+
+	call(1, "set", "swapdb-a", "1")
+	call(1, "set", "swapdb-b", "1")
+	call(1, "expire", "swapdb-b", "100")
+	call(2, "set", "swapdb-c", "1")
+	assert.Equal(t, ":2\r\n", call(1, "dbsize"))
+	assert.Equal(t, ":1\r\n", call(2, "dbsize"))
+
+	out := bytes.NewBuffer(nil)
+	ctx := ContextTest("info")
+	ctx.Client.DB = mockdb.DB("swapdb-ns", 1)
+	ctx.Out = out
+	Info(ctx)
+	assert.Contains(t, out.String(), "db1:keys=2,expires=1,avg_ttl=0")
+	assert.Contains(t, out.String(), "db2:keys=1,expires=0,avg_ttl=0")
+
+	assert.Equal(t, "+OK\r\n", call(1, "swapdb", "1", "2"))
+	assert.Equal(t, ":1\r\n", call(1, "dbsize"))
+	assert.Equal(t, ":1\r\n", call(1, "exists", "swapdb-c"))
+	assert.Equal(t, ":2\r\n", call(2, "exists", "swapdb-a", "swapdb-b"))
+
+	assert.Equal(t, "+OK\r\n", call(2, "swapdb", "2", "1"))
+	assert.Equal(t, ":2\r\n", call(1, "dbsize"))
+	assert.Equal(t, ":1\r\n", call(1, "del", "swapdb-a"))
+	assert.Equal(t, ":1\r\n", call(1, "dbsize"))
+	assert.Equal(t, "-"+ErrInvalidDB.Error()+"\r\n", call(1, "swapdb", "1", "256"))
+}
@@ -1,12 +1,12 @@
 package command
 
 import (
-	"bytes"
-	"container/heap"
 	"errors"
 	"strconv"
+	"strings"
 
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
 )
 
 // SAdd adds the specified members to the set stored at key
@@ -44,7 +44,7 @@ func SMembers(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	if err != nil {
 		return nil, errors.New("ERR " + err.Error())
 	}
-	return BytesArray(ctx.Out, members), nil
+	return BytesSet(ctx, members), nil
 }
 
 // SCard returns the set cardinality (number of elements) of the set stored at key
@@ -154,183 +154,319 @@ func SMove(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return Integer(ctx.Out, int64(count)), nil
 }
 
-// SUnion returns the members of the set resulting from the union of all the given sets.
-func SUnion(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	var members [][]byte
-	var setsIter []*db.SetIter
-	for _, key := range ctx.Args {
-		set, err := txn.Set([]byte(key))
-		if err != nil {
-			if err == db.ErrTypeMismatch {
-				return nil, ErrTypeMismatch
+// SMIsmember returns whether each member is a member of the set stored at key
+func SMIsmember(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	members := make([][]byte, len(ctx.Args[1:]))
+	for i, member := range ctx.Args[1:] {
+		members[i] = []byte(member)
+	}
+	set, err := txn.Set(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	exists, err := set.SMIsmember(members)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return func() {
+		resp.ReplyArray(ctx.Out, len(exists))
+		for _, exist := range exists {
+			if exist {
+				resp.ReplyInteger(ctx.Out, 1)
+			} else {
+				resp.ReplyInteger(ctx.Out, 0)
 			}
-			return nil, errors.New("ERR " + err.Error())
 		}
-		if !set.Exists() {
-			continue
+	}, nil
+}
+
+// srandmemberMaxCount limits the number of the members SRANDMEMBER returns with a negative count
+const srandmemberMaxCount = 1 << 20
+
+// SRandMember returns one or more random members from the set value store at key
+func SRandMember(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	if len(ctx.Args) > 2 {
+		return nil, ErrSyntax
+	}
+	key := []byte(ctx.Args[0])
+	count := int64(1)
+	var err error
+	if len(ctx.Args) == 2 {
+		if count, err = strconv.ParseInt(ctx.Args[1], 10, 64); err != nil {
+			return nil, ErrInteger
 		}
-		siter, err := set.Iter()
-		if err != nil {
-			return nil, errors.New("ERR " + err.Error())
+		// a negative count is negated to be the number of the members
+		if count < -srandmemberMaxCount {
+			return nil, ErrOutOfRange
 		}
-		defer siter.Iter.Close()
-		setsIter = append(setsIter, siter)
 	}
 
-	h := MinHeap(setsIter)
-	heap.Init(&h)
-	var last []byte
-	for len(h) != 0 {
-		min := h[0].Value()
+	set, err := txn.Set(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	members, err := set.SRandMember(count)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if len(ctx.Args) == 2 {
+		return BytesArray(ctx.Out, members), nil
+	}
+	if len(members) == 0 {
+		return Null(ctx), nil
+	}
+	return BulkString(ctx.Out, string(members[0])), nil
+}
 
-		// ignore the duplicated member
-		if last == nil || !bytes.Equal(min, last) {
-			members = append(members, min)
+// SScan incrementally iterates the members of the set stored at key
+func SScan(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	var (
+		key        []byte
+		cursor     []byte
+		lastCursor = []byte("0")
+		count      = uint64(defaultScanCount)
+		members    = [][]byte{}
+		pattern    []byte
+		isAll      bool
+		err        error
+	)
+	key = []byte(ctx.Args[0])
+	if strings.Compare(ctx.Args[1], "0") != 0 {
+		cursor = []byte(ctx.Args[1])
+	}
+
+	// define return result
+	result := func() {
+		if _, err := resp.ReplyArray(ctx.Out, 2); err != nil {
+			return
+		}
+		resp.ReplyBulkString(ctx.Out, string(lastCursor))
+		if _, err := resp.ReplyArray(ctx.Out, len(members)); err != nil {
+			return
 		}
-		last = min
+		for i := range members {
+			resp.ReplyBulkString(ctx.Out, string(members[i]))
+		}
+	}
+	set, err := txn.Set(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	if !set.Exists() {
+		return result, nil
+	}
+
+	if len(ctx.Args)%2 != 0 {
+		return nil, ErrSyntax
+	}
 
-		if err := h[0].Iter.Next(); err != nil {
-			return nil, err
+	for i := 2; i < len(ctx.Args); i += 2 {
+		arg := strings.ToLower(ctx.Args[i])
+		next := ctx.Args[i+1]
+		switch arg {
+		case "count":
+			if count, err = strconv.ParseUint(next, 10, 64); err != nil {
+				return nil, ErrInteger
+			}
+			if count > ScanMaxCount {
+				count = ScanMaxCount
+			}
+			if count == 0 {
+				count = uint64(defaultScanCount)
+			}
+		case "match":
+			pattern = []byte(next)
+			isAll = (pattern[0] == '*' && len(pattern) == 1)
 		}
-		if h[0].Valid() {
-			heap.Fix(&h, 0)
-		} else {
-			heap.Remove(&h, 0)
+	}
+
+	if len(pattern) == 0 {
+		isAll = true
+	}
+	f := func(member []byte) bool {
+		if count <= 0 {
+			lastCursor = member
+			return false
+		}
+		if isAll || globMatch(pattern, member, false) {
+			members = append(members, member)
+			count--
 		}
+		return true
 	}
-	return BytesArray(ctx.Out, members), nil
+
+	if err := set.SScan(cursor, f); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return result, nil
 }
 
-type MinHeap []*db.SetIter
+// setStoreBatch is the number of the members added to the destination at a time
+const setStoreBatch = 256
 
-func (h MinHeap) Len() int           { return len(h) }
-func (h MinHeap) Less(i, j int) bool { return bytes.Compare(h[i].Value(), h[j].Value()) < 0 }
-func (h MinHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
-func (h *MinHeap) Push(x interface{}) {
-	item := x.(*db.SetIter)
-	*h = append(*h, item)
+// setCombineStore stores the union, intersection or difference of the sets in dest, the members are
+// added to a new set as they are merged, which replaces dest at last
+func setCombineStore(ctx *Context, txn *db.Transaction, op db.SetOp, dest []byte, keys []string) (OnCommit, error) {
+	set := txn.NewSet(dest)
+	batch := make([][]byte, 0, setStoreBatch)
+	var added int64
+	var err error
+	flush := func() bool {
+		var n int64
+		n, err = set.SAdd(batch...)
+		added += n
+		batch = batch[:0]
+		return err == nil
+	}
+	if err := setCombine(txn, op, keys, func(member []byte) bool {
+		batch = append(batch, append([]byte{}, member...))
+		return len(batch) < setStoreBatch || flush()
+	}); err != nil {
+		return nil, err
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if err := set.Replace(); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, added), nil
 }
 
-func (h *MinHeap) Pop() interface{} {
-	old := *h
-	n := len(old)
-	item := old[n-1]
-	*h = old[0 : n-1]
-	return item
+// SUnion returns the members of the set resulting from the union of all the given sets.
+func SUnion(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	members, err := setCombineMembers(txn, db.SetUnion, ctx.Args)
+	if err != nil {
+		return nil, err
+	}
+	return BytesSet(ctx, members), nil
+}
+
+// SUnionStore stores the members of the set resulting from the union of all the given sets in destination
+func SUnionStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return setCombineStore(ctx, txn, db.SetUnion, []byte(ctx.Args[0]), ctx.Args[1:])
 }
 
 // SInter returns the members of the set resulting from the intersection of all the given sets.
 func SInter(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	var members [][]byte
-	setsIter := make([]*db.SetIter, len(ctx.Args))
-	for i, key := range ctx.Args {
-		set, err := txn.Set([]byte(key))
-		if err != nil {
-			if err == db.ErrTypeMismatch {
-				return nil, ErrTypeMismatch
-			}
-			return nil, errors.New("ERR " + err.Error())
-		}
-		// If the set corresponding to key does not exist, it is processed as an empty set
-		if !set.Exists() {
-			return BytesArray(ctx.Out, members), nil
-		}
-		siter, err := set.Iter()
-		if err != nil {
-			return nil, errors.New("ERR " + err.Error())
-		}
-		defer siter.Iter.Close()
-		setsIter[i] = siter
-	}
-
-	h := MinHeap(setsIter)
-	heap.Init(&h)
-	var last []byte
-	k := len(h) //k-way merge
-	n := k
-	for len(h) != 0 {
-		min := h[0].Value()
-		if last == nil || bytes.Equal(last, min) {
-			n--
-		} else {
-			n = k - 1
-		}
-		last = min
+	members, err := setCombineMembers(txn, db.SetInter, ctx.Args)
+	if err != nil {
+		return nil, err
+	}
+	return BytesSet(ctx, members), nil
+}
 
-		// it is a member of intersection if there are k equal values continuously
-		if n == 0 {
-			members = append(members, min)
-		}
+// SInterStore stores the members of the set resulting from the intersection of all the given sets in destination
+func SInterStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return setCombineStore(ctx, txn, db.SetInter, []byte(ctx.Args[0]), ctx.Args[1:])
+}
 
-		if err := h[0].Iter.Next(); err != nil {
-			return nil, err
+// SInterCard returns the cardinality of the intersection of all the given sets,
+// it stops counting when the cardinality reaches the limit
+func SInterCard(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	numkeys, err := strconv.ParseInt(ctx.Args[0], 10, 64)
+	if err != nil {
+		return nil, ErrInteger
+	}
+	if numkeys < 1 {
+		return nil, errors.New("ERR numkeys should be greater than 0")
+	}
+	args := ctx.Args[1:]
+	if numkeys > int64(len(args)) {
+		return nil, errors.New("ERR Number of keys can't be greater than number of args")
+	}
+	keys := args[:numkeys]
+	args = args[numkeys:]
+	var limit int64
+	for i := 0; i < len(args); i++ {
+		if strings.ToUpper(args[i]) != "LIMIT" || i+1 >= len(args) {
+			return nil, ErrSyntax
+		}
+		if limit, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+			return nil, ErrInteger
 		}
-		if h[0].Valid() {
-			heap.Fix(&h, 0)
-		} else {
-			heap.Remove(&h, 0)
+		if limit < 0 {
+			return nil, errors.New("ERR LIMIT can't be negative")
 		}
+		i++
 	}
-	return BytesArray(ctx.Out, members), nil
+	var count int64
+	if err := setCombine(txn, db.SetInter, keys, func(member []byte) bool {
+		count++
+		return limit == 0 || count < limit
+	}); err != nil {
+		return nil, err
+	}
+	return Integer(ctx.Out, count), nil
 }
 
 // SDiff returns the members of the set resulting from the difference between the first set and all the successive sets.
 func SDiff(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	var members [][]byte
-	var setsIter []*db.SetIter
-	for i, key := range ctx.Args {
+	members, err := setCombineMembers(txn, db.SetDiff, ctx.Args)
+	if err != nil {
+		return nil, err
+	}
+	return BytesSet(ctx, members), nil
+}
+
+// SDiffStore stores the members of the set resulting from the difference between the first set and all the successive sets in destination
+func SDiffStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return setCombineStore(ctx, txn, db.SetDiff, []byte(ctx.Args[0]), ctx.Args[1:])
+}
+
+// setCombine calls f with the members of the union, intersection or difference of the sets in order
+// until it returns false, the sets are merged in stream
+func setCombine(txn *db.Transaction, op db.SetOp, keys []string, f func(member []byte) bool) error {
+	iters := make([]*db.SetIter, len(keys))
+	defer func() {
+		for _, iter := range iters {
+			if iter != nil {
+				iter.Iter.Close()
+			}
+		}
+	}()
+	for i, key := range keys {
 		set, err := txn.Set([]byte(key))
 		if err != nil {
 			if err == db.ErrTypeMismatch {
-				return nil, ErrTypeMismatch
+				return ErrTypeMismatch
 			}
-			return nil, errors.New("ERR " + err.Error())
-		}
-		if !set.Exists() && i != 0 {
-			continue
+			return errors.New("ERR " + err.Error())
 		}
-		siter, err := set.Iter()
-		if err != nil {
-			return nil, errors.New("ERR " + err.Error())
-		}
-		defer siter.Iter.Close()
-		setsIter = append(setsIter, siter)
-	}
-	iter := setsIter[0]
-	h := MinHeap(setsIter[1:])
-	heap.Init(&h)
-	for iter.Valid() {
-		member := iter.Value()
-		if len(h) == 0 {
-			members = append(members, member)
-			if err := iter.Iter.Next(); err != nil {
-				return nil, errors.New("ERR " + err.Error())
-			}
+		// If the set corresponding to key does not exist, it is processed as an empty set
+		if !set.Exists() {
 			continue
 		}
-
-		min := h[0].Value()
-		switch bytes.Compare(member, min) {
-		case -1:
-			members = append(members, member)
-			if err := iter.Iter.Next(); err != nil {
-				return nil, errors.New("ERR " + err.Error())
-			}
-		case 0:
-			if err := iter.Iter.Next(); err != nil {
-				return nil, errors.New("ERR " + err.Error())
-			}
-			fallthrough
-		case 1:
-			if err := h[0].Iter.Next(); err != nil {
-				return nil, errors.New("ERR " + err.Error())
-			}
-			if h[0].Valid() {
-				heap.Fix(&h, 0)
-			} else {
-				heap.Remove(&h, 0)
-			}
+		if iters[i], err = set.Iter(); err != nil {
+			return errors.New("ERR " + err.Error())
 		}
 	}
-	return BytesArray(ctx.Out, members), nil
+	if err := db.SetCombine(op, iters, f); err != nil {
+		return errors.New("ERR " + err.Error())
+	}
+	return nil
+}
+
+// setCombineMembers returns the members of the union, intersection or difference of the sets
+func setCombineMembers(txn *db.Transaction, op db.SetOp, keys []string) ([][]byte, error) {
+	var members [][]byte
+	err := setCombine(txn, op, keys, func(member []byte) bool {
+		members = append(members, append([]byte{}, member...))
+		return true
+	})
+	return members, err
 }
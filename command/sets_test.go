@@ -492,3 +492,191 @@ func TestSDiff(t *testing.T) {
 	clearSets(t, key6)
 
 }
+
+func TestSMIsmember(t *testing.T) {
+	key := "set-smismember"
+	setSets(t, key, "a", "b")
+
+	ctx := ContextTest("smismember", key, "a", "c", "b")
+	Call(ctx)
+	assert.Equal(t, []string{"*3", ":1", ":0", ":1"}, ctxLines(ctx.Out)[:4])
+
+	ctx = ContextTest("smismember", "set-smismember-none", "a")
+	Call(ctx)
+	assert.Equal(t, []string{"*1", ":0"}, ctxLines(ctx.Out)[:2])
+	clearSets(t, key)
+}
+
+func TestSRandMember(t *testing.T) {
+	key := "set-srandmember"
+	setSets(t, key, "a", "b", "c", "d", "e")
+	all := map[string]bool{"a": true, "b": true, "c": true, "d": true, "e": true}
+
+	ctx := ContextTest("srandmember", key)
+	Call(ctx)
+	lines := ctxLines(ctx.Out)
+	assert.Equal(t, "$1", lines[0])
+	assert.True(t, all[lines[1]])
+
+	// distinct members
+	ctx = ContextTest("srandmember", key, "3")
+	Call(ctx)
+	lines = ctxLines(ctx.Out)
+	assert.Equal(t, "*3", lines[0])
+	seen := make(map[string]bool)
+	for i := 2; i < 7; i += 2 {
+		assert.True(t, all[lines[i]])
+		assert.False(t, seen[lines[i]])
+		seen[lines[i]] = true
+	}
+
+	ctx = ContextTest("srandmember", key, "10")
+	Call(ctx)
+	assert.Equal(t, "*5", ctxLines(ctx.Out)[0])
+
+	// the members may be repeated
+	ctx = ContextTest("srandmember", key, "-10")
+	Call(ctx)
+	lines = ctxLines(ctx.Out)
+	assert.Equal(t, "*10", lines[0])
+	for i := 2; i < 21; i += 2 {
+		assert.True(t, all[lines[i]])
+	}
+
+	ctx = ContextTest("srandmember", key, "0")
+	Call(ctx)
+	assert.Equal(t, "*0", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("srandmember", "set-srandmember-none")
+	Call(ctx)
+	assert.Equal(t, "$-1", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("srandmember", key, "a")
+	Call(ctx)
+	assert.Equal(t, "-"+ErrInteger.Error(), ctxLines(ctx.Out)[0])
+	for _, count := range []string{"-9223372036854775808", "-10000000000"} {
+		ctx = ContextTest("srandmember", key, count)
+		Call(ctx)
+		assert.Equal(t, "-"+ErrOutOfRange.Error(), ctxLines(ctx.Out)[0])
+	}
+	clearSets(t, key)
+}
+
+func TestSScan(t *testing.T) {
+	key := "set-sscan"
+	setSets(t, key, "a1", "a2", "b1", "b2")
+
+	ctx := ContextTest("sscan", key, "0", "count", "2")
+	Call(ctx)
+	assert.Equal(t, []string{"*2", "$2", "b1", "*2", "$2", "a1", "$2", "a2"}, ctxLines(ctx.Out)[:8])
+
+	ctx = ContextTest("sscan", key, "b1", "count", "2")
+	Call(ctx)
+	assert.Equal(t, []string{"*2", "$1", "0", "*2", "$2", "b1", "$2", "b2"}, ctxLines(ctx.Out)[:8])
+
+	ctx = ContextTest("sscan", key, "0", "match", "*2")
+	Call(ctx)
+	assert.Equal(t, []string{"*2", "$1", "0", "*2", "$2", "a2", "$2", "b2"}, ctxLines(ctx.Out)[:8])
+
+	ctx = ContextTest("sscan", "set-sscan-none", "0")
+	Call(ctx)
+	assert.Equal(t, []string{"*2", "$1", "0", "*0"}, ctxLines(ctx.Out)[:4])
+	clearSets(t, key)
+}
+
+func TestSInterCard(t *testing.T) {
+	key1 := "set-sintercard1"
+	key2 := "set-sintercard2"
+	setSets(t, key1, "a", "b", "c", "d")
+	setSets(t, key2, "b", "c", "d", "e")
+
+	ctx := ContextTest("sintercard", "2", key1, key2)
+	Call(ctx)
+	assert.Equal(t, ":3", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sintercard", "2", key1, key2, "LIMIT", "2")
+	Call(ctx)
+	assert.Equal(t, ":2", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sintercard", "2", key1, "set-sintercard-none")
+	Call(ctx)
+	assert.Equal(t, ":0", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sintercard", "0", key1)
+	Call(ctx)
+	assert.Equal(t, "-ERR numkeys should be greater than 0", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sintercard", "3", key1, key2)
+	Call(ctx)
+	assert.Equal(t, "-ERR Number of keys can't be greater than number of args", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sintercard", "2", key1, key2, "LIMIT", "-1")
+	Call(ctx)
+	assert.Equal(t, "-ERR LIMIT can't be negative", ctxLines(ctx.Out)[0])
+	clearSets(t, key1)
+	clearSets(t, key2)
+}
+
+func TestSStore(t *testing.T) {
+	key1 := "set-sstore1"
+	key2 := "set-sstore2"
+	dest := "set-sstore-dest"
+	setSets(t, key1, "a", "b", "c")
+	setSets(t, key2, "b", "c", "d")
+
+	ctx := ContextTest("sunionstore", dest, key1, key2)
+	Call(ctx)
+	assert.Equal(t, ":4", ctxLines(ctx.Out)[0])
+	ctx = ContextTest("scard", dest)
+	Call(ctx)
+	assert.Equal(t, ":4", ctxLines(ctx.Out)[0])
+
+	ctx = ContextTest("sinterstore", dest, key1, key2)
+	Call(ctx)
+	assert.Equal(t, ":2", ctxLines(ctx.Out)[0])
+	ctx = ContextTest("smembers", dest)
+	Call(ctx)
+	assert.Equal(t, []string{"*2", "$1", "b", "$1", "c"}, ctxLines(ctx.Out)[:5])
+
+	// the destination is one of the sources
+	ctx = ContextTest("sdiffstore", dest, key1, dest)
+	Call(ctx)
+	assert.Equal(t, ":1", ctxLines(ctx.Out)[0])
+	ctx = ContextTest("smembers", dest)
+	Call(ctx)
+	assert.Equal(t, []string{"*1", "$1", "a"}, ctxLines(ctx.Out)[:3])
+
+	// the destination is removed if the result is empty
+	ctx = ContextTest("sinterstore", dest, key1, "set-sstore-none")
+	Call(ctx)
+	assert.Equal(t, ":0", ctxLines(ctx.Out)[0])
+	ctx = ContextTest("exists", dest)
+	Call(ctx)
+	assert.Equal(t, ":0", ctxLines(ctx.Out)[0])
+
+	// the destination of another type is overwritten
+	ctx = ContextTest("set", dest, "value")
+	Call(ctx)
+	ctx = ContextTest("sunionstore", dest, key1)
+	Call(ctx)
+	assert.Equal(t, ":3", ctxLines(ctx.Out)[0])
+	ctx = ContextTest("type", dest)
+	Call(ctx)
+	assert.Equal(t, "+set", ctxLines(ctx.Out)[0])
+
+	// the result is stored in batches while the sources are merged
+	var members []string
+	for i := 0; i < setStoreBatch*2+1; i++ {
+		members = append(members, strconv.Itoa(i))
+	}
+	setSets(t, append([]string{key2}, members...)...)
+	ctx = ContextTest("sunionstore", key2, key2, key1)
+	Call(ctx)
+	assert.Equal(t, ":"+strconv.Itoa(len(members)+4), ctxLines(ctx.Out)[0])
+	ctx = ContextTest("scard", key2)
+	Call(ctx)
+	assert.Equal(t, ":"+strconv.Itoa(len(members)+4), ctxLines(ctx.Out)[0])
+	clearSets(t, key1)
+	clearSets(t, key2)
+	clearSets(t, dest)
+}
@@ -0,0 +1,249 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distributedio/titan/encoding/resp"
+)
+
+// the arguments recorded by the slow log are truncated like redis does
+const (
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+// txnCost is the time a command spends in the stages of its transaction, the
+// retries are summed up
+type txnCost struct {
+	begin   time.Duration
+	execute time.Duration
+	commit  time.Duration
+	reply   time.Duration
+}
+
+// slowlogEntry is a command slower than the threshold
+type slowlogEntry struct {
+	id        int64
+	start     time.Time
+	cost      time.Duration
+	args      []string
+	addr      string
+	name      string
+	namespace string
+	traceID   string
+	txn       txnCost
+}
+
+// slowlogRing keeps the latest entries in a ring, the oldest is at head
+type slowlogRing struct {
+	entries []*slowlogEntry
+	head    int
+	n       int
+}
+
+// push adds the entry and drops the oldest one if the ring is full, the ring is
+// resized if its size is changed
+func (r *slowlogRing) push(entry *slowlogEntry, size int) {
+	if size != len(r.entries) {
+		r.reset(r.all(), size)
+	}
+	if r.n < len(r.entries) {
+		r.entries[(r.head+r.n)%len(r.entries)] = entry
+		r.n++
+		return
+	}
+	r.entries[r.head] = entry
+	r.head = (r.head + 1) % len(r.entries)
+}
+
+// all returns the entries, the oldest comes first
+func (r *slowlogRing) all() []*slowlogEntry {
+	entries := make([]*slowlogEntry, r.n)
+	for i := range entries {
+		entries[i] = r.entries[(r.head+i)%len(r.entries)]
+	}
+	return entries
+}
+
+// reset replaces the entries with the latest ones of entries which fit in size
+func (r *slowlogRing) reset(entries []*slowlogEntry, size int) {
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	r.entries = make([]*slowlogEntry, size)
+	r.head = 0
+	r.n = copy(r.entries, entries)
+}
+
+// slowlog keeps the latest slow commands of all the clients
+var slowlog struct {
+	sync.Mutex
+	id   int64
+	ring slowlogRing
+}
+
+// slowlogRedacted are the commands whose arguments are secrets, the arguments are
+// replaced from the index, or those following the options are replaced
+var slowlogRedacted = map[string]struct {
+	from    int
+	options map[string]int
+}{
+	"auth":  {from: 1},
+	"hello": {from: -1, options: map[string]int{"auth": 2}},
+}
+
+// slowlogRedact replaces the secrets in argv with "(redacted)" like redis does
+func slowlogRedact(argv []string) {
+	redacted, ok := slowlogRedacted[argv[0]]
+	if !ok {
+		return
+	}
+	for i := 1; i < len(argv); i++ {
+		if redacted.from >= 0 && i >= redacted.from {
+			argv[i] = "(redacted)"
+			continue
+		}
+		if n, ok := redacted.options[strings.ToLower(argv[i])]; ok {
+			for j := i + 1; j <= i+n && j < len(argv); j++ {
+				argv[j] = "(redacted)"
+			}
+			i += n
+		}
+	}
+}
+
+// slowlogPush records the command if it is slower than the threshold
+func slowlogPush(ctx *Context, start time.Time, cost time.Duration) {
+	opts := ctx.Server.Options()
+	threshold, maxLen := opts.SlowlogLogSlowerThan, opts.SlowlogMaxLen
+	if threshold < 0 || maxLen <= 0 || cost < threshold {
+		return
+	}
+
+	argv := append([]string{ctx.Name}, ctx.Args...)
+	slowlogRedact(argv)
+	argc := len(argv)
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	args := make([]string, argc)
+	for i := range args {
+		if i == slowlogMaxArgc-1 && len(argv) > slowlogMaxArgc {
+			args[i] = fmt.Sprintf("... (%d more arguments)", len(argv)-slowlogMaxArgc+1)
+			break
+		}
+		args[i] = argv[i]
+		if len(args[i]) > slowlogMaxArgLen {
+			args[i] = fmt.Sprintf("%s... (%d more bytes)", args[i][:slowlogMaxArgLen], len(args[i])-slowlogMaxArgLen)
+		}
+	}
+	entry := &slowlogEntry{
+		start:     start,
+		cost:      cost,
+		args:      args,
+		addr:      ctx.Client.RemoteAddr,
+		name:      ctx.Client.Name,
+		namespace: ctx.Client.Namespace,
+		traceID:   ctx.TraceID,
+		txn:       ctx.txnCost,
+	}
+
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	entry.id = slowlog.id
+	slowlog.id++
+	slowlog.ring.push(entry, maxLen)
+}
+
+// slowlogEntries returns the entries of the namespace of the client, the newest comes first
+func slowlogEntries(ctx *Context) []*slowlogEntry {
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	all := slowlog.ring.all()
+	var entries []*slowlogEntry
+	for i := len(all) - 1; i >= 0; i-- {
+		if ctx.Client.Namespace == sysAdminNamespace || all[i].namespace == ctx.Client.Namespace {
+			entries = append(entries, all[i])
+		}
+	}
+	return entries
+}
+
+// slowlogReset removes the entries of the namespace of the client
+func slowlogReset(ctx *Context) {
+	slowlog.Lock()
+	defer slowlog.Unlock()
+	var entries []*slowlogEntry
+	if ctx.Client.Namespace != sysAdminNamespace {
+		for _, entry := range slowlog.ring.all() {
+			if entry.namespace != ctx.Client.Namespace {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	slowlog.ring.reset(entries, len(slowlog.ring.entries))
+}
+
+// SlowLog reads or resets the slow log, the clients only see the commands of their namespaces
+// except those of $sys.admin
+func SlowLog(ctx *Context) {
+	subcmd := strings.ToLower(ctx.Args[0])
+	args := ctx.Args[1:]
+	switch {
+	case subcmd == "get" && len(args) <= 1:
+		count := 10
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < -1 {
+				resp.ReplyError(ctx.Out, ErrInteger.Error())
+				return
+			}
+			count = n
+		}
+		entries := slowlogEntries(ctx)
+		if count >= 0 && count < len(entries) {
+			entries = entries[:count]
+		}
+
+		// the fields after the client name are added by titan
+		resp.ReplyArray(ctx.Out, len(entries))
+		for _, entry := range entries {
+			resp.ReplyArray(ctx.Out, 9)
+			resp.ReplyInteger(ctx.Out, entry.id)
+			resp.ReplyInteger(ctx.Out, entry.start.Unix())
+			resp.ReplyInteger(ctx.Out, int64(entry.cost/time.Microsecond))
+			resp.ReplyArray(ctx.Out, len(entry.args))
+			for _, arg := range entry.args {
+				resp.ReplyBulkString(ctx.Out, arg)
+			}
+			resp.ReplyBulkString(ctx.Out, entry.addr)
+			resp.ReplyBulkString(ctx.Out, entry.name)
+			resp.ReplyBulkString(ctx.Out, entry.namespace)
+			resp.ReplyBulkString(ctx.Out, entry.traceID)
+			resp.ReplyArray(ctx.Out, 8)
+			for _, stage := range []struct {
+				name string
+				cost time.Duration
+			}{
+				{"begin", entry.txn.begin},
+				{"execute", entry.txn.execute},
+				{"commit", entry.txn.commit},
+				{"reply", entry.txn.reply},
+			} {
+				resp.ReplyBulkString(ctx.Out, stage.name)
+				resp.ReplyInteger(ctx.Out, int64(stage.cost/time.Microsecond))
+			}
+		}
+	case subcmd == "len" && len(args) == 0:
+		resp.ReplyInteger(ctx.Out, int64(len(slowlogEntries(ctx))))
+	case subcmd == "reset" && len(args) == 0:
+		slowlogReset(ctx)
+		resp.ReplySimpleString(ctx.Out, OK)
+	default:
+		resp.ReplyError(ctx.Out, fmt.Sprintf("ERR Unknown subcommand or wrong number of arguments for '%s'. Try SLOWLOG HELP.", ctx.Args[0]))
+	}
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/distributedio/titan/context"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLog(t *testing.T) {
+	call := func(namespace string, args ...string) string {
+		ctx := ContextTest(args[0], args[1:]...)
+		ctx.Client.Namespace = namespace
+		ctx.Client.RemoteAddr = "127.0.0.1:6379"
+		ctx.TraceID = "trace-" + args[0]
+		ctx.Server.SetOptions(context.Options{SlowlogMaxLen: 3})
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+	// the slow log is read without being logged
+	slowlog := func(namespace string, args ...string) string {
+		ctx := ContextTest("slowlog", args...)
+		ctx.Client.Namespace = namespace
+		ctx.Server.SetOptions(context.Options{SlowlogLogSlowerThan: -1})
+		Call(ctx)
+		return ctxString(ctx.Out)
+	}
+	assert.Equal(t, "+OK\r\n", slowlog(sysAdminNamespace, "reset"))
+
+	call("slowlog-ns", "set", "slowlog-key", strings.Repeat("v", 130))
+	assert.Equal(t, ":1\r\n", slowlog("slowlog-ns", "len"))
+	assert.Equal(t, ":0\r\n", slowlog("slowlog-other", "len"))
+
+	out := slowlog("slowlog-ns", "get")
+	assert.True(t, strings.HasPrefix(out, "*1\r\n*9\r\n:"), out)
+	assert.Contains(t, out, "*3\r\n$3\r\nset\r\n$11\r\nslowlog-key\r\n$"+fmt.Sprint(128+18)+"\r\n"+strings.Repeat("v", 128)+"... (2 more bytes)\r\n")
+	assert.Contains(t, out, "$14\r\n127.0.0.1:6379\r\n$0\r\n\r\n$10\r\nslowlog-ns\r\n$9\r\ntrace-set\r\n*8\r\n$5\r\nbegin\r\n:")
+	assert.Contains(t, out, "$7\r\nexecute\r\n:")
+	assert.Contains(t, out, "$6\r\ncommit\r\n:")
+	assert.Contains(t, out, "$5\r\nreply\r\n:")
+
+	// the arguments are truncated and only the latest entries are kept
+	args := []string{"del"}
+	for i := 0; i < 40; i++ {
+		args = append(args, fmt.Sprintf("slowlog-%d", i))
+	}
+	call("slowlog-ns", args...)
+	out = slowlog("slowlog-ns", "get", "1")
+	assert.Contains(t, out, "*32\r\n$3\r\ndel\r\n")
+	assert.Contains(t, out, "$10\r\nslowlog-29\r\n$23\r\n... (10 more arguments)\r\n")
+	call("slowlog-ns", "ping")
+	call("slowlog-ns", "ping")
+	assert.Equal(t, ":3\r\n", slowlog("slowlog-ns", "len"))
+	assert.True(t, strings.HasPrefix(slowlog("slowlog-ns", "get", "-1"), "*3\r\n"))
+	assert.True(t, strings.HasPrefix(slowlog("slowlog-ns", "get", "2"), "*2\r\n"))
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", slowlog("slowlog-ns", "get", "x"))
+	assert.Contains(t, slowlog("slowlog-ns", "len", "1"), "Unknown subcommand")
+
+	// a namespace only resets its own entries
+	call("slowlog-other", "ping")
+	assert.Equal(t, "+OK\r\n", slowlog("slowlog-ns", "reset"))
+	assert.Equal(t, ":0\r\n", slowlog("slowlog-ns", "len"))
+	assert.Equal(t, ":1\r\n", slowlog("slowlog-other", "len"))
+	assert.Equal(t, ":1\r\n", slowlog(sysAdminNamespace, "len"))
+	assert.Equal(t, "+OK\r\n", slowlog(sysAdminNamespace, "reset"))
+	assert.Equal(t, ":0\r\n", slowlog("slowlog-other", "len"))
+
+	// the secrets are redacted
+	call("slowlog-ns", "auth", "secret")
+	call("slowlog-ns", "hello", "3", "AUTH", "default", "secret", "setname", "cli")
+	out = slowlog("slowlog-ns", "get")
+	assert.Contains(t, out, "*2\r\n$4\r\nauth\r\n$10\r\n(redacted)\r\n")
+	assert.Contains(t, out, "*7\r\n$5\r\nhello\r\n$1\r\n3\r\n$4\r\nAUTH\r\n$10\r\n(redacted)\r\n$10\r\n(redacted)\r\n$7\r\nsetname\r\n$3\r\ncli\r\n")
+	assert.NotContains(t, out, "secret")
+
+	// exec is logged
+	cli := ContextTest("multi").Client
+	cli.Namespace = "slowlog-ns"
+	for _, name := range []string{"multi", "ping", "exec"} {
+		ctx := ContextTest(name)
+		ctx.Context = context.New(cli, ctx.Server)
+		ctx.Server.SetOptions(context.Options{SlowlogMaxLen: 3})
+		Call(ctx)
+	}
+	assert.Contains(t, slowlog("slowlog-ns", "get", "1"), "*1\r\n$4\r\nexec\r\n")
+}
@@ -0,0 +1,347 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/distributedio/titan/db"
+)
+
+// sortOptions are the options of SORT
+type sortOptions struct {
+	by     string
+	nosort bool
+	gets   []string
+	offset int64
+	count  int64
+	desc   bool
+	alpha  bool
+	store  []byte
+}
+
+// sortItem is an element to sort and its weight
+type sortItem struct {
+	elem   []byte
+	weight []byte
+	score  float64
+}
+
+// Sort returns or stores the elements contained in the list, set or sorted set at key
+func Sort(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return sortGeneric(ctx, txn, true)
+}
+
+// SortRO is the read only variant of sort
+func SortRO(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return sortGeneric(ctx, txn, false)
+}
+
+// parseSortOptions parses the options of SORT, store is true if the STORE option is allowed
+func parseSortOptions(args []string, store bool) (*sortOptions, error) {
+	opts := &sortOptions{count: -1}
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "ASC":
+			opts.desc = false
+		case opt == "DESC":
+			opts.desc = true
+		case opt == "ALPHA":
+			opts.alpha = true
+		case opt == "LIMIT" && remain >= 2:
+			offset, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			count, err := strconv.ParseInt(args[i+2], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			opts.offset, opts.count = offset, count
+			i += 2
+		case opt == "BY" && remain >= 1:
+			// a pattern without * means the elements are not sorted
+			opts.by = args[i+1]
+			opts.nosort = !strings.Contains(opts.by, "*")
+			i++
+		case opt == "GET" && remain >= 1:
+			opts.gets = append(opts.gets, args[i+1])
+			i++
+		case opt == "STORE" && store && remain >= 1:
+			opts.store = []byte(args[i+1])
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+func sortGeneric(ctx *Context, txn *db.Transaction, store bool) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	opts, err := parseSortOptions(ctx.Args[1:], store)
+	if err != nil {
+		return nil, err
+	}
+
+	elems, err := sortElements(ctx, txn, key)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*sortItem, len(elems))
+	for i := range elems {
+		items[i] = &sortItem{elem: elems[i]}
+	}
+	if !opts.nosort {
+		if err := sortItems(txn, items, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// apply the limit to the sorted items
+	start, end := opts.offset, opts.count
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || start+end > int64(len(items)) {
+		end = int64(len(items))
+	} else {
+		end += start
+	}
+	if start > end {
+		start = end
+	}
+	items = items[start:end]
+
+	var result [][]byte
+	if len(opts.gets) == 0 {
+		result = make([][]byte, len(items))
+		for i := range items {
+			result[i] = items[i].elem
+		}
+	} else {
+		elems = make([][]byte, len(items))
+		for i := range items {
+			elems[i] = items[i].elem
+		}
+		result = make([][]byte, len(items)*len(opts.gets))
+		for j, pattern := range opts.gets {
+			vals, err := sortLookup(txn, pattern, elems)
+			if err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+			for i := range vals {
+				result[i*len(opts.gets)+j] = vals[i]
+			}
+		}
+	}
+
+	if opts.store == nil {
+		return BytesArray(ctx.Out, result), nil
+	}
+	return sortStore(ctx, txn, opts.store, result)
+}
+
+// sortElements returns the elements of the list, set or sorted set, it fails if there are more
+// elements than the server allows to sort
+func sortElements(ctx *Context, txn *db.Transaction, key []byte) ([][]byte, error) {
+	obj, err := txn.Object(key)
+	if err != nil {
+		if err == db.ErrKeyNotFound {
+			return nil, nil
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	limit := int64(ctx.Server.Options().SortMaxElements)
+	var elems [][]byte
+	switch obj.Type {
+	case db.ObjectList:
+		var lst db.List
+		if lst, err = txn.List(key); err == nil {
+			if limit > 0 && lst.Length() > limit {
+				return nil, ErrSortTooLarge
+			}
+			elems, err = lst.Range(0, -1)
+		}
+	case db.ObjectSet:
+		var set *db.Set
+		var n int64
+		if set, err = txn.Set(key); err == nil {
+			if n, err = set.SCard(); err == nil && limit > 0 && n > limit {
+				return nil, ErrSortTooLarge
+			}
+		}
+		if err == nil {
+			elems, err = set.SMembers()
+		}
+	case db.ObjectZSet:
+		var zset *db.ZSet
+		if zset, err = txn.ZSet(key); err == nil {
+			if limit > 0 && zset.ZCard() > limit {
+				return nil, ErrSortTooLarge
+			}
+			elems, err = zset.ZAnyOrderRange(0, -1, false, true)
+		}
+	default:
+		return nil, ErrTypeMismatch
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return elems, nil
+}
+
+// sortItems sorts the items by their weights
+func sortItems(txn *db.Transaction, items []*sortItem, opts *sortOptions) error {
+	if opts.by != "" {
+		elems := make([][]byte, len(items))
+		for i := range items {
+			elems[i] = items[i].elem
+		}
+		weights, err := sortLookup(txn, opts.by, elems)
+		if err != nil {
+			return errors.New("ERR " + err.Error())
+		}
+		for i := range items {
+			items[i].weight = weights[i]
+		}
+	} else {
+		for i := range items {
+			items[i].weight = items[i].elem
+		}
+	}
+
+	if !opts.alpha {
+		for _, item := range items {
+			// a missing weight is 0
+			if item.weight == nil {
+				continue
+			}
+			score, err := strconv.ParseFloat(strings.TrimSpace(string(item.weight)), 64)
+			if err != nil {
+				return ErrSortScore
+			}
+			item.score = score
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		var cmp int
+		a, b := items[i], items[j]
+		if opts.alpha {
+			// a missing weight is smaller than any others
+			switch {
+			case a.weight == nil && b.weight != nil:
+				cmp = -1
+			case a.weight != nil && b.weight == nil:
+				cmp = 1
+			default:
+				cmp = bytes.Compare(a.weight, b.weight)
+			}
+		} else {
+			switch {
+			case a.score < b.score:
+				cmp = -1
+			case a.score > b.score:
+				cmp = 1
+			default:
+				// the elements with the same score are compared lexicographically to make the result deterministic
+				cmp = bytes.Compare(a.elem, b.elem)
+			}
+		}
+		if opts.desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	return nil
+}
+
+// sortLookup returns the values the pattern refers to for each element, the first * in the pattern
+// is replaced by the element, and "key->field" refers to a field of a hash.
+// "#" refers to the element itself, and nil is returned for a missing value
+func sortLookup(txn *db.Transaction, pattern string, elems [][]byte) ([][]byte, error) {
+	vals := make([][]byte, len(elems))
+	if pattern == "#" {
+		copy(vals, elems)
+		return vals, nil
+	}
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return vals, nil
+	}
+	suffix, field := pattern[star+1:], ""
+	if arrow := strings.Index(suffix, "->"); arrow >= 0 && arrow+2 < len(suffix) {
+		suffix, field = suffix[:arrow], suffix[arrow+2:]
+	}
+	keys := make([][]byte, len(elems))
+	for i := range elems {
+		keys[i] = []byte(pattern[:star] + string(elems[i]) + suffix)
+	}
+
+	if field == "" {
+		strs, err := txn.Strings(keys)
+		if err != nil {
+			return nil, err
+		}
+		for i, str := range strs {
+			if str == nil || !str.Exist() {
+				continue
+			}
+			if vals[i], err = str.Get(); err != nil {
+				return nil, err
+			}
+		}
+		return vals, nil
+	}
+
+	for i := range keys {
+		hash, err := txn.Hash(keys[i])
+		if err != nil {
+			// the keys of other types are treated as missing
+			if err == db.ErrTypeMismatch {
+				continue
+			}
+			return nil, err
+		}
+		if vals[i], err = hash.HGet([]byte(field)); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+// sortStore overwrites the destination with a list of the values, the destination is deleted if there is no value
+func sortStore(ctx *Context, txn *db.Transaction, dest []byte, vals [][]byte) (OnCommit, error) {
+	if _, err := txn.Kv().Delete([][]byte{dest}); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if len(vals) == 0 {
+		return Integer(ctx.Out, 0), nil
+	}
+	// a missing value is stored as an empty string, which only a ziplist is able to hold
+	zip := len(vals) > ctx.Server.Options().ListZipThreshold
+	for i := range vals {
+		if len(vals[i]) == 0 {
+			vals[i] = []byte{}
+			zip = true
+		}
+	}
+	var opts []db.ListOption
+	if zip {
+		opts = append(opts, db.UseZip())
+	}
+	lst, err := txn.List(dest, opts...)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if err := lst.RPush(vals...); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return signal(ctx, Integer(ctx.Out, int64(len(vals))), dest), nil
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSort(t *testing.T) {
+	CallTest("rpush", "sort-list", "3", "1", "10", "2")
+	assert.Equal(t, "*4\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$2\r\n10\r\n", ctxString(CallTest("sort", "sort-list")))
+	assert.Equal(t, "*4\r\n$2\r\n10\r\n$1\r\n3\r\n$1\r\n2\r\n$1\r\n1\r\n", ctxString(CallTest("sort", "sort-list", "desc")))
+	assert.Equal(t, "*4\r\n$1\r\n1\r\n$2\r\n10\r\n$1\r\n2\r\n$1\r\n3\r\n", ctxString(CallTest("sort", "sort-list", "alpha")))
+	assert.Equal(t, "*2\r\n$1\r\n2\r\n$1\r\n3\r\n", ctxString(CallTest("sort", "sort-list", "limit", "1", "2")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("sort", "sort-list", "limit", "10", "2")))
+	assert.Equal(t, "*3\r\n$1\r\n1\r\n$2\r\n10\r\n$1\r\n2\r\n", ctxString(CallTest("sort", "sort-list", "by", "nosort", "limit", "1", "-1")))
+
+	CallTest("sadd", "sort-set", "b", "a", "c")
+	assert.Equal(t, "-"+ErrSortScore.Error()+"\r\n", ctxString(CallTest("sort", "sort-set")))
+	assert.Equal(t, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n", ctxString(CallTest("sort", "sort-set", "alpha", "desc")))
+
+	// weights and values in strings and hashes
+	CallTest("mset", "sort-w-a", "3", "sort-w-b", "1")
+	CallTest("hmset", "sort-h-a", "name", "x")
+	CallTest("hmset", "sort-h-c", "name", "z")
+	assert.Equal(t, "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n", ctxString(CallTest("sort", "sort-set", "by", "sort-w-*")))
+	assert.Equal(t, "*6\r\n$1\r\nc\r\n$1\r\nz\r\n$1\r\nb\r\n$-1\r\n$1\r\na\r\n$1\r\nx\r\n",
+		ctxString(CallTest("sort", "sort-set", "by", "sort-w-*", "get", "#", "get", "sort-h-*->name")))
+	assert.Equal(t, "*3\r\n$1\r\nb\r\n$1\r\na\r\n$1\r\nc\r\n", ctxString(CallTest("sort", "sort-set", "by", "sort-h-*->name", "alpha")))
+
+	CallTest("zadd", "sort-zset", "1", "b", "2", "a")
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\na\r\n", ctxString(CallTest("sort", "sort-zset", "by", "nosort")))
+
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("sort", "sort-set", "by", "sort-w-*", "limit", "0", "2", "get", "sort-h-*->name", "store", "sort-dest")))
+	assert.Equal(t, "*2\r\n$1\r\nz\r\n$0\r\n\r\n", ctxString(CallTest("lrange", "sort-dest", "0", "-1")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("sort", "sort-none", "store", "sort-dest")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "sort-dest")))
+
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("sort_ro", "sort-none")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("sort_ro", "sort-list", "store", "sort-dest")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("sort", "sort-list", "limit", "1")))
+	CallTest("set", "sort-string", "value")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("sort", "sort-string")))
+
+	ctx := ContextTest("sort", "sort-list")
+	opts := ctx.Server.Options()
+	opts.SortMaxElements = 3
+	ctx.Server.SetOptions(opts)
+	Call(ctx)
+	assert.Equal(t, "-"+ErrSortTooLarge.Error()+"\r\n", ctxString(ctx.Out))
+}
@@ -1,7 +1,134 @@
 package command
 
-// Statistic for the redis command
+import (
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorStatsMax limits the number of the kinds of errors recorded, the errors of
+// new kinds are dropped once it is reached
+const errorStatsMax = 128
+
+// Statistic for the redis command, it is updated atomically
 type Statistic struct {
-	Microseconds int64
-	Calls        int64
+	Microseconds  int64
+	Calls         int64
+	RejectedCalls int64 // the calls rejected before being executed
+	FailedCalls   int64 // the calls executed but replied with an error
+}
+
+// txnStats are the statistics of exec and discard which are not in the command table
+var txnStats = map[string]*Statistic{
+	"exec":    {},
+	"discard": {},
+}
+
+// errorStats counts the errors replied by their kinds, which are the first words of the errors
+var errorStats struct {
+	sync.Mutex
+	total  int64 // including the errors dropped
+	counts map[string]int64
+}
+
+// record records a call of the command, executed is false if the call is rejected
+func (s *Statistic) record(cost time.Duration, executed, failed bool) {
+	if !executed {
+		if failed {
+			atomic.AddInt64(&s.RejectedCalls, 1)
+		}
+		return
+	}
+	atomic.AddInt64(&s.Calls, 1)
+	atomic.AddInt64(&s.Microseconds, cost.Nanoseconds()/int64(1000))
+	if failed {
+		atomic.AddInt64(&s.FailedCalls, 1)
+	}
+}
+
+// load returns a copy of the statistic
+func (s *Statistic) load() Statistic {
+	return Statistic{
+		Microseconds:  atomic.LoadInt64(&s.Microseconds),
+		Calls:         atomic.LoadInt64(&s.Calls),
+		RejectedCalls: atomic.LoadInt64(&s.RejectedCalls),
+		FailedCalls:   atomic.LoadInt64(&s.FailedCalls),
+	}
+}
+
+// recordError counts an error by its kind
+func recordError(kind string) {
+	errorStats.Lock()
+	defer errorStats.Unlock()
+	errorStats.total++
+	if errorStats.counts == nil {
+		errorStats.counts = make(map[string]int64)
+	}
+	if _, ok := errorStats.counts[kind]; !ok && len(errorStats.counts) >= errorStatsMax {
+		return
+	}
+	errorStats.counts[kind]++
+}
+
+// loadErrorStats returns the total number of the errors and a copy of the counts by kinds
+func loadErrorStats() (int64, map[string]int64) {
+	errorStats.Lock()
+	defer errorStats.Unlock()
+	counts := make(map[string]int64, len(errorStats.counts))
+	for kind, count := range errorStats.counts {
+		counts[kind] = count
+	}
+	return errorStats.total, counts
+}
+
+// loadCommandStats returns copies of the statistics of the commands which have been called
+func loadCommandStats() map[string]Statistic {
+	stats := make(map[string]Statistic)
+	for name, stat := range txnStats {
+		if s := stat.load(); s.Calls > 0 || s.RejectedCalls > 0 {
+			stats[name] = s
+		}
+	}
+	for name, desc := range commands {
+		if s := desc.Stat.load(); s.Calls > 0 || s.RejectedCalls > 0 {
+			stats[name] = s
+		}
+	}
+	return stats
+}
+
+// replyRecorder records the kind of the error if a command replies one, the writer may be held
+// by subscriptions and written by other goroutines, so it is sealed once the command returns
+type replyRecorder struct {
+	io.Writer
+	mu      sync.Mutex
+	written bool
+	kind    string
+}
+
+// Write implements io.Writer, only the first write is checked, which is the type of the reply
+func (r *replyRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	if !r.written && len(p) > 0 {
+		r.written = true
+		if p[0] == '-' {
+			kind := p[1:]
+			if idx := bytes.IndexAny(kind, " \r"); idx >= 0 {
+				kind = kind[:idx]
+			}
+			r.kind = string(kind)
+		}
+	}
+	r.mu.Unlock()
+	return r.Writer.Write(p)
+}
+
+// seal stops recording and returns the kind of the error replied, it is empty if there is no error
+func (r *replyRecorder) seal() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written = true
+	return r.kind
 }
@@ -0,0 +1,1100 @@
+package command
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
+)
+
+var (
+	// ErrStreamID the id is not a valid stream id
+	ErrStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+	// ErrStreamIDSmall the id of xadd is not greater than the top item
+	ErrStreamIDSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+
+	// ErrStreamIDZero the id of xadd is 0-0
+	ErrStreamIDZero = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+
+	// ErrStreamExhausted the stream can not generate a bigger id
+	ErrStreamExhausted = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+
+	// ErrStreamMaxLen the maxlen is negative
+	ErrStreamMaxLen = errors.New("ERR The MAXLEN argument must be >= 0.")
+
+	// ErrStreamTrimLimit limit is used without ~
+	ErrStreamTrimLimit = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+
+	// ErrStreamTrimStrategy both maxlen and minid are specified
+	ErrStreamTrimStrategy = errors.New("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+
+	// ErrStreamTimeout the timeout of block is not an integer
+	ErrStreamTimeout = errors.New("ERR timeout is not an integer or out of range")
+)
+
+// streamDefaultTrimLimit is the max entries trimmed once in an approximate trimming
+// if limit is not specified, it is the same as redis
+const streamDefaultTrimLimit = 100 * 100
+
+// parseStreamID parses the id in format {ms}-{seq} or {ms}, missingSeq is used if seq is not given,
+// "-" and "+" stands for the min and max id
+func parseStreamID(s string, missingSeq uint64) (db.StreamID, error) {
+	switch s {
+	case "-":
+		return db.MinStreamID, nil
+	case "+":
+		return db.MaxStreamID, nil
+	}
+	var id db.StreamID
+	var err error
+	parts := strings.SplitN(s, "-", 2)
+	if id.Ms, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return id, ErrStreamID
+	}
+	if len(parts) == 1 {
+		id.Seq = missingSeq
+		return id, nil
+	}
+	if id.Seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return id, ErrStreamID
+	}
+	return id, nil
+}
+
+// parseRangeID parses the start or end of a range, an id prefixed by '(' is exclusive
+func parseRangeID(s string, start bool) (db.StreamID, error) {
+	missingSeq := uint64(0)
+	if !start {
+		missingSeq = math.MaxUint64
+	}
+	if !strings.HasPrefix(s, "(") {
+		return parseStreamID(s, missingSeq)
+	}
+	id, err := parseStreamID(s[1:], missingSeq)
+	if err != nil || s == "(-" || s == "(+" {
+		return id, ErrStreamID
+	}
+	var ok bool
+	if start {
+		if id, ok = id.Next(); !ok {
+			return id, errors.New("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.Prev(); !ok {
+		return id, errors.New("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// streamTrim is the trimming strategy of xadd and xtrim
+type streamTrim struct {
+	maxLen int64
+	minID  *db.StreamID
+	limit  int64
+}
+
+// parseStreamTrim parses MAXLEN|MINID [=|~] threshold [LIMIT count] at args[i],
+// it returns the number of arguments consumed
+func parseStreamTrim(args []string, i int, trim *streamTrim) (int, error) {
+	strategy := strings.ToLower(args[i])
+	if trim.maxLen >= 0 || trim.minID != nil {
+		return 0, ErrStreamTrimStrategy
+	}
+	n := 1
+	approx := false
+	if i+n < len(args) && (args[i+n] == "=" || args[i+n] == "~") {
+		approx = args[i+n] == "~"
+		n++
+	}
+	if i+n >= len(args) {
+		return 0, ErrSyntax
+	}
+	threshold := args[i+n]
+	n++
+	if strategy == "maxlen" {
+		maxLen, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return 0, ErrInteger
+		}
+		if maxLen < 0 {
+			return 0, ErrStreamMaxLen
+		}
+		trim.maxLen = maxLen
+	} else {
+		minID, err := parseStreamID(threshold, 0)
+		if err != nil {
+			return 0, err
+		}
+		trim.minID = &minID
+	}
+
+	if approx {
+		trim.limit = streamDefaultTrimLimit
+	}
+	if i+n+1 < len(args) && strings.ToLower(args[i+n]) == "limit" {
+		if !approx {
+			return 0, ErrStreamTrimLimit
+		}
+		limit, err := strconv.ParseInt(args[i+n+1], 10, 64)
+		if err != nil || limit < 0 {
+			return 0, ErrInteger
+		}
+		trim.limit = limit
+		n += 2
+	}
+	return n, nil
+}
+
+// do trims the stream, 0 limit means no limit
+func (trim *streamTrim) do(s *db.Stream) (int64, error) {
+	if trim.minID != nil {
+		return s.TrimMinID(*trim.minID, trim.limit)
+	}
+	if trim.maxLen >= 0 {
+		return s.TrimMaxLen(trim.maxLen, trim.limit)
+	}
+	return 0, nil
+}
+
+// replyStreamEntries replies the entries, every entry is an array of its id and field value pairs
+func replyStreamEntries(w io.Writer, entries []*db.StreamEntry) {
+	resp.ReplyArray(w, len(entries))
+	for _, entry := range entries {
+		resp.ReplyArray(w, 2)
+		resp.ReplyBulkString(w, entry.ID.String())
+		if entry.Fields == nil {
+			// the entry pending for a consumer has been deleted
+			resp.ReplyNullArray(w)
+			continue
+		}
+		resp.ReplyArray(w, len(entry.Fields))
+		for _, field := range entry.Fields {
+			resp.ReplyBulkString(w, string(field))
+		}
+	}
+}
+
+func getStream(txn *db.Transaction, key []byte) (*db.Stream, error) {
+	s, err := txn.Stream(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return s, nil
+}
+
+// nextStreamID generates the id of the entry to be added, spec is * or {ms}-* or {ms}-{seq}
+func nextStreamID(spec string, last db.StreamID) (db.StreamID, error) {
+	if spec == "*" {
+		ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		if ms > last.Ms {
+			return db.StreamID{Ms: ms}, nil
+		}
+		id, ok := last.Next()
+		if !ok {
+			return id, ErrStreamExhausted
+		}
+		return id, nil
+	}
+
+	if strings.HasSuffix(spec, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(spec, "-*"), 10, 64)
+		if err != nil {
+			return db.StreamID{}, ErrStreamID
+		}
+		switch {
+		case ms > last.Ms:
+			return db.StreamID{Ms: ms}, nil
+		case ms < last.Ms || last.Seq == math.MaxUint64:
+			return db.StreamID{}, ErrStreamIDSmall
+		}
+		return db.StreamID{Ms: ms, Seq: last.Seq + 1}, nil
+	}
+
+	id, err := parseStreamID(spec, 0)
+	if err != nil {
+		return id, err
+	}
+	if id == db.MinStreamID {
+		return id, ErrStreamIDZero
+	}
+	if id.Compare(last) <= 0 {
+		return id, ErrStreamIDSmall
+	}
+	return id, nil
+}
+
+// XAdd appends an entry to the stream
+// XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func XAdd(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	args := ctx.Args
+	nomkstream := false
+	trim := &streamTrim{maxLen: -1}
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "nomkstream":
+			nomkstream = true
+			continue
+		case "maxlen", "minid":
+			n, err := parseStreamTrim(args, i, trim)
+			if err != nil {
+				return nil, err
+			}
+			i += n - 1
+			continue
+		}
+		break
+	}
+	if i >= len(args) {
+		return nil, ErrSyntax
+	}
+	spec := args[i]
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return nil, ErrWrongArgs(ctx.Name)
+	}
+
+	s, err := getStream(txn, key)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Exists() && nomkstream {
+		return Null(ctx), nil
+	}
+	id, err := nextStreamID(spec, s.LastID())
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(fields))
+	for i := range fields {
+		values[i] = []byte(fields[i])
+	}
+	if err := s.Add(id, values); err != nil {
+		if err == db.ErrStreamID {
+			return nil, ErrStreamIDSmall
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if _, err := trim.do(s); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return signal(ctx, BulkString(ctx.Out, id.String()), key), nil
+}
+
+// XLen returns the number of entries of the stream
+func XLen(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	s, err := getStream(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return Integer(ctx.Out, s.Len()), nil
+}
+
+// XRange returns the entries with ids in the range
+// XRANGE key start end [COUNT count]
+func XRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return xrange(ctx, txn, ctx.Args[1], ctx.Args[2], false)
+}
+
+// XRevRange returns the entries with ids in the range in reverse order
+// XREVRANGE key end start [COUNT count]
+func XRevRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return xrange(ctx, txn, ctx.Args[2], ctx.Args[1], true)
+}
+
+func xrange(ctx *Context, txn *db.Transaction, startArg, endArg string, reverse bool) (OnCommit, error) {
+	start, err := parseRangeID(startArg, true)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseRangeID(endArg, false)
+	if err != nil {
+		return nil, err
+	}
+	count := int64(-1)
+	args := ctx.Args[3:]
+	if len(args) != 0 {
+		if len(args) != 2 || strings.ToLower(args[0]) != "count" {
+			return nil, ErrSyntax
+		}
+		if count, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			return nil, ErrInteger
+		}
+		if count < 0 {
+			count = 0
+		}
+	}
+	if count == 0 {
+		return func() { resp.ReplyArray(ctx.Out, 0) }, nil
+	}
+
+	s, err := getStream(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.Range(start, end, count, reverse)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return func() { replyStreamEntries(ctx.Out, entries) }, nil
+}
+
+// XDel removes the entries of the ids from the stream
+// XDEL key id [id ...]
+func XDel(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	ids := make([]db.StreamID, len(ctx.Args)-1)
+	for i, arg := range ctx.Args[1:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	s, err := getStream(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.Delete(ids)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, deleted), nil
+}
+
+// XTrim trims the stream by evicting older entries
+// XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func XTrim(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	trim := &streamTrim{maxLen: -1}
+	switch strings.ToLower(ctx.Args[1]) {
+	case "maxlen", "minid":
+	default:
+		return nil, ErrSyntax
+	}
+	n, err := parseStreamTrim(ctx.Args, 1, trim)
+	if err != nil {
+		return nil, err
+	}
+	if 1+n != len(ctx.Args) {
+		return nil, ErrSyntax
+	}
+	s, err := getStream(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	trimmed, err := trim.do(s)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, trimmed), nil
+}
+
+// xreadArgs is the parsed arguments of xread and xreadgroup
+type xreadArgs struct {
+	group    string
+	consumer string
+	noack    bool
+	count    int64
+	block    bool
+	timeout  time.Duration
+	keys     []string
+	ids      []string
+	idsAt    int // the index of the first id in the arguments
+}
+
+// parseXRead parses [GROUP group consumer] [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...],
+// GROUP and NOACK are only valid for xreadgroup
+func parseXRead(name string, args []string) (*xreadArgs, error) {
+	readgroup := name == "xreadgroup"
+	xargs := &xreadArgs{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "group":
+			if !readgroup {
+				return nil, errors.New("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+			}
+			if i+2 >= len(args) {
+				return nil, ErrSyntax
+			}
+			xargs.group, xargs.consumer = args[i+1], args[i+2]
+			i += 2
+		case "noack":
+			if !readgroup {
+				return nil, ErrSyntax
+			}
+			xargs.noack = true
+		case "count":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			count, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			if count < 0 {
+				count = 0
+			}
+			xargs.count = count
+			i++
+		case "block":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, ErrStreamTimeout
+			}
+			if ms < 0 {
+				return nil, ErrTimeoutNegative
+			}
+			xargs.block = true
+			xargs.timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "streams":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return nil, errors.New("ERR Unbalanced '" + name + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			if readgroup && xargs.group == "" {
+				return nil, errors.New("ERR Missing GROUP option for XREADGROUP")
+			}
+			xargs.keys = streams[:len(streams)/2]
+			xargs.ids = streams[len(streams)/2:]
+			xargs.idsAt = i + 1 + len(streams)/2
+			return xargs, nil
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	return nil, ErrSyntax
+}
+
+// xreadKeys returns the keys xread or xreadgroup blocks on
+func xreadKeys(name string) BlockingKeys {
+	return func(args []string) []string {
+		xargs, err := parseXRead(name, args)
+		if err != nil {
+			return nil
+		}
+		return xargs.keys
+	}
+}
+
+// xreadTimeout returns the timeout of xread or xreadgroup, xreadgroup does not block
+// when it reads the history of the consumer
+func xreadTimeout(name string) BlockingTimeout {
+	return func(args []string) (time.Duration, bool, error) {
+		xargs, err := parseXRead(name, args)
+		if err != nil {
+			return 0, false, err
+		}
+		for _, id := range xargs.ids {
+			if xargs.group != "" && id != ">" {
+				return 0, false, nil
+			}
+		}
+		return xargs.timeout, xargs.block, nil
+	}
+}
+
+// XRead reads entries with ids greater than the specified ones from the streams, '$' stands for
+// the last id of the stream when the command is called
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+func XRead(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	xargs, err := parseXRead(ctx.Name, ctx.Args)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]*db.Stream, len(xargs.keys))
+	starts := make([]db.StreamID, len(xargs.keys))
+	for i, key := range xargs.keys {
+		if streams[i], err = getStream(txn, []byte(key)); err != nil {
+			return nil, err
+		}
+		if xargs.ids[i] == ">" {
+			return nil, errors.New("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		}
+		if xargs.ids[i] == "$" {
+			// resolve it once so that retries of a blocked client read the entries added since it blocks
+			ctx.Args[xargs.idsAt+i] = streams[i].LastID().String()
+			starts[i] = streams[i].LastID()
+		} else if starts[i], err = parseStreamID(xargs.ids[i], 0); err != nil {
+			return nil, err
+		}
+	}
+
+	var keys []string
+	var results [][]*db.StreamEntry
+	for i, s := range streams {
+		start, ok := starts[i].Next()
+		if !ok {
+			continue
+		}
+		entries, err := s.Range(start, db.MaxStreamID, xargs.count, false)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		keys = append(keys, xargs.keys[i])
+		results = append(results, entries)
+	}
+	if len(keys) == 0 {
+		return nil, errWouldBlock
+	}
+	return func() { replyStreams(ctx.Out, keys, results) }, nil
+}
+
+// replyStreams replies the entries read from every stream
+func replyStreams(w io.Writer, keys []string, results [][]*db.StreamEntry) {
+	resp.ReplyArray(w, len(keys))
+	for i := range keys {
+		resp.ReplyArray(w, 2)
+		resp.ReplyBulkString(w, keys[i])
+		replyStreamEntries(w, results[i])
+	}
+}
+
+// ErrStreamNoKey the key of xgroup does not exist
+var ErrStreamNoKey = errors.New("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+
+// errNoGroup returns the error that the group of the key does not exist
+func errNoGroup(key, group string) error {
+	return errors.New("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+// getStreamGroup returns the stream with its group, error is returned if the group does not exist
+func getStreamGroup(txn *db.Transaction, key, name string) (*db.Stream, *db.StreamGroup, error) {
+	s, err := getStream(txn, []byte(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := s.Group([]byte(name))
+	if err != nil {
+		return nil, nil, errors.New("ERR " + err.Error())
+	}
+	if group == nil {
+		return nil, nil, errNoGroup(key, name)
+	}
+	return s, group, nil
+}
+
+// parseGroupID parses the id of a group, '$' stands for the last id of the stream
+func parseGroupID(s *db.Stream, id string) (db.StreamID, error) {
+	if id == "$" {
+		return s.LastID(), nil
+	}
+	return parseStreamID(id, 0)
+}
+
+// XGroup manages the consumer groups
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+// XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+// XGROUP DESTROY key group
+// XGROUP CREATECONSUMER key group consumer
+// XGROUP DELCONSUMER key group consumer
+func XGroup(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	subcommand := strings.ToLower(ctx.Args[0])
+	args := ctx.Args[1:]
+	arity := map[string]int{"create": 3, "setid": 3, "destroy": 2, "createconsumer": 3, "delconsumer": 3}
+	n, ok := arity[subcommand]
+	if !ok {
+		return nil, errors.New("ERR Unknown subcommand or wrong number of arguments for '" + ctx.Args[0] + "'. Try XGROUP HELP.")
+	}
+	if len(args) < n {
+		return nil, ErrWrongArgs("xgroup|" + subcommand)
+	}
+	key, name := args[0], args[1]
+
+	mkstream := false
+	for i := n; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "mkstream":
+			if subcommand != "create" {
+				return nil, ErrSyntax
+			}
+			mkstream = true
+		case "entriesread":
+			// entries read is only used to compute the lag which is not supported
+			if (subcommand != "create" && subcommand != "setid") || i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if _, err := strconv.ParseInt(args[i+1], 10, 64); err != nil {
+				return nil, ErrInteger
+			}
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	s, err := getStream(txn, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if !s.Exists() && !mkstream {
+		return nil, ErrStreamNoKey
+	}
+	if subcommand == "create" {
+		id, err := parseGroupID(s, args[2])
+		if err != nil {
+			return nil, err
+		}
+		created, err := s.CreateGroup([]byte(name), id)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if !created {
+			return nil, errors.New("BUSYGROUP Consumer Group name already exists")
+		}
+		return SimpleString(ctx.Out, OK), nil
+	}
+	if subcommand == "destroy" {
+		destroyed, err := s.DestroyGroup([]byte(name))
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if destroyed {
+			return Integer(ctx.Out, 1), nil
+		}
+		return Integer(ctx.Out, 0), nil
+	}
+
+	group, err := s.Group([]byte(name))
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if group == nil {
+		return nil, errors.New("NOGROUP No such consumer group '" + name + "' for key name '" + key + "'")
+	}
+	switch subcommand {
+	case "setid":
+		id, err := parseGroupID(s, args[2])
+		if err != nil {
+			return nil, err
+		}
+		if err := group.SetLastID(id); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return SimpleString(ctx.Out, OK), nil
+	case "createconsumer":
+		created, err := group.CreateConsumer([]byte(args[2]))
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if created {
+			return Integer(ctx.Out, 1), nil
+		}
+		return Integer(ctx.Out, 0), nil
+	default:
+		pending, err := group.DeleteConsumer([]byte(args[2]))
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return Integer(ctx.Out, pending), nil
+	}
+}
+
+// XReadGroup reads entries from the streams as a consumer of the group, '>' reads the entries never
+// delivered to any consumer of the group, other ids read the history pending for the consumer
+// XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+func XReadGroup(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	xargs, err := parseXRead(ctx.Name, ctx.Args)
+	if err != nil {
+		return nil, err
+	}
+	consumer := []byte(xargs.consumer)
+	var keys []string
+	var results [][]*db.StreamEntry
+	var remained [][]byte
+	for i, key := range xargs.keys {
+		if xargs.ids[i] == "$" {
+			return nil, errors.New("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set.")
+		}
+		s, err := getStream(txn, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		group, err := s.Group([]byte(xargs.group))
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if group == nil {
+			return nil, errors.New("NOGROUP No such key '" + key + "' or consumer group '" + xargs.group + "' in XREADGROUP with GROUP option")
+		}
+
+		if xargs.ids[i] == ">" {
+			entries, err := group.Deliver(consumer, xargs.count, xargs.noack)
+			if err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+			if len(entries) == 0 {
+				continue
+			}
+			if group.LastID.Compare(s.LastID()) < 0 {
+				// pass the rest entries to the next consumer blocked on the key
+				remained = append(remained, []byte(key))
+			}
+			keys = append(keys, key)
+			results = append(results, entries)
+			continue
+		}
+
+		after, err := parseStreamID(xargs.ids[i], 0)
+		if err != nil {
+			return nil, err
+		}
+		ids, history, err := group.History(consumer, after, xargs.count)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		entries := make([]*db.StreamEntry, len(ids))
+		for j := range ids {
+			entries[j] = history[j]
+			if entries[j] == nil {
+				entries[j] = &db.StreamEntry{ID: ids[j]}
+			}
+		}
+		keys = append(keys, key)
+		results = append(results, entries)
+	}
+	if len(keys) == 0 {
+		return nil, errWouldBlock
+	}
+	return signal(ctx, func() { replyStreams(ctx.Out, keys, results) }, remained...), nil
+}
+
+// parseStreamIDs parses all the args as ids
+func parseStreamIDs(args []string) ([]db.StreamID, error) {
+	ids := make([]db.StreamID, len(args))
+	for i, arg := range args {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// XAck removes the entries from the pending entry list of the group
+// XACK key group id [id ...]
+func XAck(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	ids, err := parseStreamIDs(ctx.Args[2:])
+	if err != nil {
+		return nil, err
+	}
+	s, err := getStream(txn, []byte(ctx.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	group, err := s.Group([]byte(ctx.Args[1]))
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if group == nil {
+		return Integer(ctx.Out, 0), nil
+	}
+	acked, err := group.Ack(ids)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return Integer(ctx.Out, acked), nil
+}
+
+// XPending inspects the pending entries of the group
+// XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func XPending(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key, name := ctx.Args[0], ctx.Args[1]
+	args := ctx.Args[2:]
+	var minIdle int64
+	if len(args) > 0 && strings.ToLower(args[0]) == "idle" {
+		if len(args) < 2 {
+			return nil, ErrSyntax
+		}
+		idle, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, ErrInteger
+		}
+		minIdle = idle
+		args = args[2:]
+		if len(args) == 0 {
+			return nil, ErrSyntax
+		}
+	}
+	if len(args) != 0 && len(args) != 3 && len(args) != 4 {
+		return nil, ErrSyntax
+	}
+
+	var start, end db.StreamID
+	var count int64
+	var consumer []byte
+	var err error
+	if len(args) != 0 {
+		if start, err = parseRangeID(args[0], true); err != nil {
+			return nil, err
+		}
+		if end, err = parseRangeID(args[1], false); err != nil {
+			return nil, err
+		}
+		if count, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return nil, ErrInteger
+		}
+		if len(args) == 4 {
+			consumer = []byte(args[3])
+		}
+	}
+
+	_, group, err := getStreamGroup(txn, key, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) != 0 {
+		var pendings []*db.StreamPending
+		if count > 0 {
+			if pendings, err = group.PendingRange(start, end, count, consumer, minIdle); err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+		}
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		return func() {
+			resp.ReplyArray(ctx.Out, len(pendings))
+			for _, p := range pendings {
+				resp.ReplyArray(ctx.Out, 4)
+				resp.ReplyBulkString(ctx.Out, p.ID.String())
+				resp.ReplyBulkString(ctx.Out, string(p.Consumer))
+				resp.ReplyInteger(ctx.Out, now-p.DeliveryTime)
+				resp.ReplyInteger(ctx.Out, p.DeliveryCount)
+			}
+		}, nil
+	}
+
+	// the summary of the pending entries
+	first, last, err := group.PendingBounds()
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	consumers, err := group.Consumers()
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	var pendingConsumers []*db.StreamConsumer
+	for _, c := range consumers {
+		if c.Pending > 0 {
+			pendingConsumers = append(pendingConsumers, c)
+		}
+	}
+	pending := group.Pending
+	return func() {
+		resp.ReplyArray(ctx.Out, 4)
+		resp.ReplyInteger(ctx.Out, pending)
+		if pending == 0 {
+			encoder(ctx).NullBulkString()
+			encoder(ctx).NullBulkString()
+			encoder(ctx).NullArray()
+			return
+		}
+		resp.ReplyBulkString(ctx.Out, first.String())
+		resp.ReplyBulkString(ctx.Out, last.String())
+		resp.ReplyArray(ctx.Out, len(pendingConsumers))
+		for _, c := range pendingConsumers {
+			resp.ReplyArray(ctx.Out, 2)
+			resp.ReplyBulkString(ctx.Out, string(c.Name))
+			resp.ReplyBulkString(ctx.Out, strconv.FormatInt(c.Pending, 10))
+		}
+	}, nil
+}
+
+// replyClaimed replies the claimed entries, or only their ids if justID
+func replyClaimed(w io.Writer, s *db.Stream, pendings []*db.StreamPending, justID bool) (OnCommit, error) {
+	ids := make([]db.StreamID, len(pendings))
+	for i, p := range pendings {
+		ids[i] = p.ID
+	}
+	if justID {
+		return func() {
+			resp.ReplyArray(w, len(ids))
+			for _, id := range ids {
+				resp.ReplyBulkString(w, id.String())
+			}
+		}, nil
+	}
+	entries, err := s.Get(ids)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return func() { replyStreamEntries(w, entries) }, nil
+}
+
+// XClaim changes the ownership of the pending entries to the consumer
+// XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func XClaim(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key, name, consumer := ctx.Args[0], ctx.Args[1], ctx.Args[2]
+	minIdle, err := strconv.ParseInt(ctx.Args[3], 10, 64)
+	if err != nil {
+		return nil, errors.New("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+
+	args := ctx.Args[4:]
+	var ids []db.StreamID
+	for ; len(args) > 0; args = args[1:] {
+		id, err := parseStreamID(args[0], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, ErrStreamID
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	opts := &db.StreamClaim{MinIdle: minIdle, RetryCount: -1}
+	var lastID *db.StreamID
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(args[i])
+		switch option {
+		case "force":
+			opts.Force = true
+			continue
+		case "justid":
+			opts.JustID = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, errors.New("ERR Unrecognized XCLAIM option '" + args[i] + "'")
+		}
+		switch option {
+		case "idle", "time", "retrycount":
+			v, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return nil, errors.New("ERR Invalid " + strings.ToUpper(option) + " option argument for XCLAIM")
+			}
+			switch option {
+			case "idle":
+				opts.Time = now - v
+			case "time":
+				opts.Time = v
+			default:
+				opts.RetryCount = v
+			}
+		case "lastid":
+			id, err := parseStreamID(args[i+1], 0)
+			if err != nil {
+				return nil, err
+			}
+			lastID = &id
+		default:
+			return nil, errors.New("ERR Unrecognized XCLAIM option '" + args[i] + "'")
+		}
+		i++
+	}
+	if opts.Time > now {
+		opts.Time = now
+	}
+
+	s, group, err := getStreamGroup(txn, key, name)
+	if err != nil {
+		return nil, err
+	}
+	if lastID != nil && lastID.Compare(group.LastID) > 0 {
+		if err := group.SetLastID(*lastID); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	claimed, _, err := group.Claim([]byte(consumer), ids, opts)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return replyClaimed(ctx.Out, s, claimed, opts.JustID)
+}
+
+// XAutoClaim claims the pending entries idle for at least min-idle-time from start,
+// it replies the cursor for the next call, the claimed entries and the ids of the deleted entries
+// XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+func XAutoClaim(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key, name, consumer := ctx.Args[0], ctx.Args[1], ctx.Args[2]
+	minIdle, err := strconv.ParseInt(ctx.Args[3], 10, 64)
+	if err != nil {
+		return nil, errors.New("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+	start, err := parseRangeID(ctx.Args[4], true)
+	if err != nil {
+		return nil, err
+	}
+	count := int64(100)
+	justID := false
+	args := ctx.Args[5:]
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "count":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			if count, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+				return nil, ErrInteger
+			}
+			if count <= 0 {
+				return nil, errors.New("ERR COUNT must be > 0")
+			}
+			i++
+		case "justid":
+			justID = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	s, group, err := getStreamGroup(txn, key, name)
+	if err != nil {
+		return nil, err
+	}
+	pendings, err := group.PendingRange(start, db.MaxStreamID, count, nil, minIdle)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	next := db.MinStreamID
+	if int64(len(pendings)) == count {
+		if id, ok := pendings[len(pendings)-1].ID.Next(); ok {
+			next = id
+		}
+	}
+	ids := make([]db.StreamID, len(pendings))
+	for i, p := range pendings {
+		ids[i] = p.ID
+	}
+	claimed, deleted, err := group.Claim([]byte(consumer), ids, &db.StreamClaim{MinIdle: minIdle, RetryCount: -1, JustID: justID})
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	reply, err := replyClaimed(ctx.Out, s, claimed, justID)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		resp.ReplyArray(ctx.Out, 3)
+		resp.ReplyBulkString(ctx.Out, next.String())
+		reply()
+		resp.ReplyArray(ctx.Out, len(deleted))
+		for _, id := range deleted {
+			resp.ReplyBulkString(ctx.Out, id.String())
+		}
+	}, nil
+}
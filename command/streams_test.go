@@ -0,0 +1,167 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXAdd(t *testing.T) {
+	key := "stream-xadd"
+	assert.Equal(t, "$3\r\n1-1\r\n", ctxString(CallTest("xadd", key, "1-1", "f", "v")))
+	assert.Equal(t, "$3\r\n1-2\r\n", ctxString(CallTest("xadd", key, "1-*", "f", "v")))
+	assert.Equal(t, "$3\r\n2-0\r\n", ctxString(CallTest("xadd", key, "2", "f", "v")))
+	assert.Equal(t, "-"+ErrStreamIDSmall.Error()+"\r\n", ctxString(CallTest("xadd", key, "2-0", "f", "v")))
+	assert.Equal(t, "-"+ErrStreamIDSmall.Error()+"\r\n", ctxString(CallTest("xadd", key, "1-*", "f", "v")))
+	assert.Equal(t, "-"+ErrStreamID.Error()+"\r\n", ctxString(CallTest("xadd", key, "a-1", "f", "v")))
+	assert.Equal(t, "-"+ErrWrongArgs("xadd").Error()+"\r\n", ctxString(CallTest("xadd", key, "*", "f")))
+	assert.Equal(t, "-"+ErrStreamIDZero.Error()+"\r\n", ctxString(CallTest("xadd", "stream-xadd-zero", "0-0", "f", "v")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("xlen", key)))
+
+	// auto generated id is greater than the last one
+	out := ctxString(CallTest("xadd", key, "*", "f", "v"))
+	assert.NotEqual(t, "-", out[:1])
+
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("xadd", "stream-xadd-none", "nomkstream", "*", "f", "v")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "stream-xadd-none")))
+
+	assert.Equal(t, "$3\r\n3-0\r\n", ctxString(CallTest("xadd", "stream-xadd-trim", "3-0", "f", "v")))
+	assert.Equal(t, "$3\r\n4-0\r\n", ctxString(CallTest("xadd", "stream-xadd-trim", "maxlen", "=", "1", "4-0", "f", "v")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xlen", "stream-xadd-trim")))
+	assert.Equal(t, "-"+ErrStreamTrimLimit.Error()+"\r\n", ctxString(CallTest("xadd", "stream-xadd-trim", "maxlen", "1", "limit", "1", "*", "f", "v")))
+	assert.Equal(t, "-"+ErrStreamTrimStrategy.Error()+"\r\n", ctxString(CallTest("xadd", "stream-xadd-trim", "maxlen", "1", "minid", "1", "*", "f", "v")))
+	assert.Equal(t, "+stream\r\n", ctxString(CallTest("type", "stream-xadd-trim")))
+
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "stream-xadd-string", "v")))
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("xadd", "stream-xadd-string", "*", "f", "v")))
+}
+
+func TestXRange(t *testing.T) {
+	key := "stream-xrange"
+	for _, id := range []string{"1-0", "2-0", "2-1", "3-0"} {
+		CallTest("xadd", key, id, "f", id)
+	}
+	entry := func(id string) string {
+		return "*2\r\n$3\r\n" + id + "\r\n*2\r\n$1\r\nf\r\n$3\r\n" + id + "\r\n"
+	}
+	assert.Equal(t, "*4\r\n"+entry("1-0")+entry("2-0")+entry("2-1")+entry("3-0"), ctxString(CallTest("xrange", key, "-", "+")))
+	assert.Equal(t, "*2\r\n"+entry("2-0")+entry("2-1"), ctxString(CallTest("xrange", key, "2", "2")))
+	assert.Equal(t, "*1\r\n"+entry("2-1"), ctxString(CallTest("xrange", key, "(2-0", "(3-0")))
+	assert.Equal(t, "*2\r\n"+entry("1-0")+entry("2-0"), ctxString(CallTest("xrange", key, "-", "+", "count", "2")))
+	assert.Equal(t, "*2\r\n"+entry("3-0")+entry("2-1"), ctxString(CallTest("xrevrange", key, "+", "-", "count", "2")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("xrange", key, "3", "1")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("xrange", "stream-xrange-none", "-", "+")))
+	assert.Equal(t, "-"+ErrStreamID.Error()+"\r\n", ctxString(CallTest("xrange", key, "(-", "+")))
+
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("xdel", key, "2-0", "3-0", "4-0")))
+	assert.Equal(t, "*2\r\n"+entry("1-0")+entry("2-1"), ctxString(CallTest("xrange", key, "-", "+")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xtrim", key, "minid", "2")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xtrim", key, "maxlen", "~", "1")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xtrim", key, "maxlen", "0")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xlen", key)))
+	// the stream exists even if it is empty
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("exists", key)))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("xtrim", key, "size", "0")))
+}
+
+func TestXRead(t *testing.T) {
+	key := "stream-xread"
+	CallTest("xadd", key, "1-0", "f", "v")
+	CallTest("xadd", key, "2-0", "f", "v")
+	entry := func(id string) string {
+		return "*2\r\n$3\r\n" + id + "\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	}
+	assert.Equal(t, "*1\r\n*2\r\n$12\r\nstream-xread\r\n*1\r\n"+entry("2-0"),
+		ctxString(CallTest("xread", "count", "1", "streams", key, "stream-xread-none", "1", "0")))
+	assert.Equal(t, "*-1\r\n", ctxString(CallTest("xread", "streams", key, "$")))
+	assert.Equal(t, "*-1\r\n", ctxString(CallTest("xread", "block", "100", "streams", key, "2-0")))
+	assert.Equal(t, "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n",
+		ctxString(CallTest("xread", "streams", key, "stream-xread-none", "$")))
+	assert.Equal(t, "-"+ErrStreamTimeout.Error()+"\r\n", ctxString(CallTest("xread", "block", "a", "streams", key, "$")))
+
+	// a blocked client is served by the entry added later
+	done := blockingTest(1031, "xread", "block", "0", "streams", key, "$")
+	waitBlocked(t, 1)
+	CallTest("xadd", key, "3-0", "f", "v")
+	assert.Equal(t, "*1\r\n*2\r\n$12\r\nstream-xread\r\n*1\r\n"+entry("3-0"), blockingReply(t, done))
+	waitBlocked(t, 0)
+}
+
+func TestXGroup(t *testing.T) {
+	key := "stream-xgroup"
+	assert.Equal(t, "-"+ErrStreamNoKey.Error()+"\r\n", ctxString(CallTest("xgroup", "create", key, "g", "$")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("xgroup", "create", key, "g", "$", "mkstream")))
+	assert.Equal(t, "-BUSYGROUP Consumer Group name already exists\r\n", ctxString(CallTest("xgroup", "create", key, "g", "$")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xgroup", "createconsumer", key, "g", "alice")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xgroup", "createconsumer", key, "g", "alice")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("xgroup", "setid", key, "g", "0")))
+	assert.Equal(t, "-NOGROUP No such consumer group 'none' for key name 'stream-xgroup'\r\n",
+		ctxString(CallTest("xgroup", "setid", key, "none", "0")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xgroup", "delconsumer", key, "g", "alice")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xgroup", "destroy", key, "g")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xgroup", "destroy", key, "g")))
+	assert.Equal(t, "-ERR Unknown subcommand or wrong number of arguments for 'unknown'. Try XGROUP HELP.\r\n",
+		ctxString(CallTest("xgroup", "unknown", key, "g")))
+}
+
+func TestXReadGroup(t *testing.T) {
+	key := "stream-xreadgroup"
+	entry := func(id string) string {
+		return "*2\r\n$3\r\n" + id + "\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	}
+	reply := func(entries ...string) string {
+		out := "*1\r\n*2\r\n$17\r\nstream-xreadgroup\r\n*" + string(rune('0'+len(entries))) + "\r\n"
+		for _, e := range entries {
+			out += e
+		}
+		return out
+	}
+	CallTest("xadd", key, "1-0", "f", "v")
+	CallTest("xadd", key, "2-0", "f", "v")
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("xgroup", "create", key, "g", "0")))
+
+	assert.Equal(t, reply(entry("1-0")), ctxString(CallTest("xreadgroup", "group", "g", "alice", "count", "1", "streams", key, ">")))
+	assert.Equal(t, reply(entry("2-0")), ctxString(CallTest("xreadgroup", "group", "g", "bob", "streams", key, ">")))
+	assert.Equal(t, "*-1\r\n", ctxString(CallTest("xreadgroup", "group", "g", "bob", "streams", key, ">")))
+
+	// the history of the consumer
+	assert.Equal(t, reply(entry("1-0")), ctxString(CallTest("xreadgroup", "group", "g", "alice", "streams", key, "0")))
+	assert.Equal(t, reply(), ctxString(CallTest("xreadgroup", "group", "g", "alice", "streams", key, "1")))
+
+	assert.Equal(t, "-NOGROUP No such key 'stream-xreadgroup' or consumer group 'none' in XREADGROUP with GROUP option\r\n",
+		ctxString(CallTest("xreadgroup", "group", "none", "alice", "streams", key, ">")))
+	assert.Equal(t, "-ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.\r\n",
+		ctxString(CallTest("xread", "group", "g", "alice", "streams", key, ">")))
+
+	// the summary of pending entries
+	assert.Equal(t, "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		ctxString(CallTest("xpending", key, "g")))
+	out := ctxLines(CallTest("xpending", key, "g", "-", "+", "10", "alice"))
+	assert.Equal(t, []string{"*1", "*4", "$3", "1-0", "$5", "alice"}, out[:6])
+	assert.Equal(t, ":2", out[7])
+
+	// a blocked consumer is served by the entry added later
+	done := blockingTest(1041, "xreadgroup", "group", "g", "carol", "block", "0", "streams", key, ">")
+	waitBlocked(t, 1)
+	CallTest("xadd", key, "3-0", "f", "v")
+	assert.Equal(t, reply(entry("3-0")), blockingReply(t, done))
+	waitBlocked(t, 0)
+
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("xack", key, "g", "1-0", "9-0")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("xack", key, "none", "1-0")))
+
+	// claim the entry of bob
+	assert.Equal(t, "*1\r\n"+entry("2-0"), ctxString(CallTest("xclaim", key, "g", "alice", "0", "2-0")))
+	assert.Equal(t, "*1\r\n$3\r\n2-0\r\n", ctxString(CallTest("xclaim", key, "g", "alice", "0", "2-0", "justid")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("xclaim", key, "g", "alice", "3600000", "2-0")))
+	assert.Equal(t, "*1\r\n"+entry("1-0"), ctxString(CallTest("xclaim", key, "g", "alice", "0", "1-0", "force")))
+
+	// entries deleted from the stream are removed from the pending entry list
+	CallTest("xdel", key, "3-0")
+	assert.Equal(t, "*3\r\n$3\r\n2-1\r\n*1\r\n"+entry("2-0")+"*0\r\n",
+		ctxString(CallTest("xautoclaim", key, "g", "bob", "0", "2-0", "count", "1")))
+	assert.Equal(t, "*3\r\n$3\r\n0-0\r\n*0\r\n*1\r\n$3\r\n3-0\r\n",
+		ctxString(CallTest("xautoclaim", key, "g", "bob", "0", "2-1")))
+	assert.Equal(t, "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		ctxString(CallTest("xpending", key, "g")))
+}
@@ -2,11 +2,13 @@ package command
 
 import (
 	"errors"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
 )
 
 var (
@@ -27,7 +29,7 @@ func Get(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	val, err := str.Get()
 	if err != nil {
 		if err == db.ErrKeyNotFound {
-			return NullBulkString(ctx.Out), nil
+			return Null(ctx), nil
 		}
 		return nil, errors.New("ERR " + err.Error())
 	}
@@ -40,78 +42,115 @@ func Set(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	value := []byte(ctx.Args[1])
 	args := ctx.Args
 
-	var next bool
-	var flag int      // flag int // 0 -- null 1---nx  2---xx
-	var unit int64    // time ms
-	var expire string //expire = expire *unit
+	var nx, xx, get, keepTTL bool
+	var at int64 // the unix time in nanoseconds the key expires at
+	var hasExpire bool
 	for i := 2; i < len(args); i++ {
-		if i+1 < len(args) {
-			next = true
-		}
-		if (args[i][0] == 'n' || args[i][0] == 'N') &&
-			(args[i][1] == 'x' || args[i][1] == 'X') &&
-			len(args[i]) == 2 {
-			flag = 1
-		} else if (args[i][0] == 'x' || args[i][0] == 'X') &&
-			(args[i][1] == 'x' || args[i][1] == 'X') &&
-			len(args[i]) == 2 {
-			flag = 2
-		} else if (args[i][0] == 'p' || args[i][0] == 'P') &&
-			(args[i][1] == 'x' || args[i][1] == 'X') &&
-			len(args[i]) == 2 && next {
-			expire = args[i+1]
-			i = i + 1
-			unit = int64(time.Millisecond)
-		} else if (args[i][0] == 'e' || args[i][0] == 'E') &&
-			(args[i][1] == 'x' || args[i][1] == 'X') &&
-			len(args[i]) == 2 && next {
-			expire = args[i+1]
-			i = i + 1
-			unit = int64(time.Second)
-		} else {
+		opt := strings.ToUpper(args[i])
+		switch {
+		case opt == "NX" && !xx:
+			nx = true
+		case opt == "XX" && !nx:
+			xx = true
+		case opt == "GET":
+			get = true
+		case opt == "KEEPTTL" && !hasExpire:
+			keepTTL = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") &&
+			!hasExpire && !keepTTL && i+1 < len(args):
+			var err error
+			if at, err = parseExpireAt(opt, args[i+1], ErrExpire); err != nil {
+				return nil, err
+			}
+			hasExpire = true
+			i++
+		default:
 			return nil, ErrSyntax
 		}
 	}
 
-	//ex|px
-	if expire != "" {
-		ui, err := strconv.ParseInt(expire, 10, 64)
+	obj, err := txn.Object(key)
+	if err != nil {
+		if err != db.ErrKeyNotFound {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		obj = nil
+	}
+
+	// the old value is returned instead of OK with the GET option
+	var old []byte
+	if get && obj != nil {
+		if obj.Type != db.ObjectString {
+			return nil, ErrTypeMismatch
+		}
+		str, err := txn.String(key)
 		if err != nil {
-			return nil, ErrInteger
+			return nil, errors.New("ERR " + err.Error())
 		}
-		if ui <= 0 {
-			return nil, ErrExpire
+		if old, err = str.Get(); err != nil {
+			return nil, errors.New("ERR " + err.Error())
 		}
-		unit = ui * unit
 	}
-
-	obj, err := txn.Object(key)
-	if err != nil && err != db.ErrKeyNotFound {
-		return nil, errors.New("ERR " + err.Error())
+	reply := func() OnCommit {
+		if !get {
+			return SimpleString(ctx.Out, OK)
+		}
+		if old == nil {
+			return Null(ctx)
+		}
+		return BulkString(ctx.Out, string(old))
 	}
 
-	//xx
-	if flag == 2 {
-		if err == db.ErrKeyNotFound {
-			return NullBulkString(ctx.Out), nil
+	if (nx && obj != nil) || (xx && obj == nil) {
+		if get {
+			return reply(), nil
 		}
+		return Null(ctx), nil
 	}
-	//nx
-	if flag == 1 {
-		if err != db.ErrKeyNotFound {
-			return NullBulkString(ctx.Out), nil
+
+	if obj != nil {
+		if keepTTL {
+			at = obj.ExpireAt
+		}
+		if err := txn.Destory(obj, key); err != nil {
+			return nil, errors.New("ERR " + err.Error())
 		}
 	}
 
-	if err != db.ErrKeyNotFound {
-		txn.Destory(obj, key)
+	// the key expired already is deleted only
+	if at > 0 && at <= db.Now() {
+		return reply(), nil
 	}
 
 	s := db.NewString(txn, key)
-	if err := s.Set(value, unit); err != nil {
+	if err := s.SetAt(value, at); err != nil {
 		return nil, errors.New("ERR " + err.Error())
 	}
-	return SimpleString(ctx.Out, OK), nil
+	return reply(), nil
+}
+
+// parseExpireAt parses the value of the EX, PX, EXAT or PXAT option, it returns the unix time
+// in nanoseconds the key expires at, errExpire is returned if the value is not positive
+func parseExpireAt(opt, arg string, errExpire error) (int64, error) {
+	v, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, ErrInteger
+	}
+	unit := int64(time.Second)
+	if opt == "PX" || opt == "PXAT" {
+		unit = int64(time.Millisecond)
+	}
+	if v <= 0 || v > math.MaxInt64/unit {
+		return 0, errExpire
+	}
+	at := v * unit
+	if opt == "EX" || opt == "PX" {
+		if at > math.MaxInt64-db.Now() {
+			return 0, errExpire
+		}
+		at += db.Now()
+	}
+	return at, nil
 }
 
 // MGet returns the values of all specified key
@@ -227,7 +266,7 @@ func GetSet(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if !str.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 
 	value, err := str.GetSet(v)
@@ -237,6 +276,82 @@ func GetSet(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return BulkString(ctx.Out, string(value)), nil
 }
 
+// GetEx gets the value of key and optionally sets its expiration
+func GetEx(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	var at int64
+	var persist, hasExpire bool
+	for i := 1; i < len(ctx.Args); i++ {
+		opt := strings.ToUpper(ctx.Args[i])
+		switch {
+		case opt == "PERSIST" && !hasExpire:
+			persist = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") &&
+			!hasExpire && !persist && i+1 < len(ctx.Args):
+			var err error
+			if at, err = parseExpireAt(opt, ctx.Args[i+1], ErrExpireGetEx); err != nil {
+				return nil, err
+			}
+			hasExpire = true
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+
+	str, err := txn.String(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !str.Exist() {
+		return Null(ctx), nil
+	}
+	val, err := str.Get()
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	kv := txn.Kv()
+	switch {
+	case hasExpire && at <= db.Now():
+		_, err = kv.Delete([][]byte{key})
+	case hasExpire:
+		err = kv.ExpireAt(key, at)
+	case persist && str.Meta.ExpireAt > 0:
+		err = kv.ExpireAt(key, 0)
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return BulkString(ctx.Out, string(val)), nil
+}
+
+// GetDel gets the value of key and deletes the key
+func GetDel(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	str, err := txn.String(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !str.Exist() {
+		return Null(ctx), nil
+	}
+	val, err := str.Get()
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if _, err := txn.Kv().Delete([][]byte{key}); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return BulkString(ctx.Out, string(val)), nil
+}
+
 // GetRange increments the integer value of a keys by the given amount
 func GetRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	key := ctx.Args[0]
@@ -258,12 +373,15 @@ func GetRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	}
 
 	if !str.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 
-	value := str.GetRange(start, end)
+	value, err := str.GetRange(start, end)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
 	if len(value) == 0 {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 
 	return BulkString(ctx.Out, string(value)), nil
@@ -366,11 +484,11 @@ func SetRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	}
 
 	// If the offset is larger than the current length of the string at key, the string is padded with zero-bytes to make offset fit.
-	val, err := str.SetRange(int64(offset), []byte(ctx.Args[2]))
+	vlen, err := str.SetRange(int64(offset), []byte(ctx.Args[2]))
 	if err != nil {
 		return nil, errors.New("ERR " + err.Error())
 	}
-	return Integer(ctx.Out, int64(len(val))), nil
+	return Integer(ctx.Out, int64(vlen)), nil
 
 }
 
@@ -571,7 +689,8 @@ func BitCount(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		}
 	case 1:
 		begin = 0
-		end = len(str.Meta.Value) - 1
+		vlen, _ := str.Len()
+		end = vlen - 1
 	default:
 		return nil, ErrSyntax
 	}
@@ -626,10 +745,12 @@ func BitPos(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		if err != nil {
 			return nil, ErrInteger
 		}
-		end = len(str.Meta.Value) - 1
+		vlen, _ := str.Len()
+		end = vlen - 1
 	case 2:
 		begin = 0
-		end = len(str.Meta.Value) - 1
+		vlen, _ := str.Len()
+		end = vlen - 1
 	default:
 		return nil, ErrSyntax
 	}
@@ -643,22 +764,209 @@ func BitPos(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 
 // BitOp performs bitwise operations between strings
 func BitOp(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	//TODO
-	if strings.EqualFold(ctx.Args[0], "and") {
-	} else if strings.EqualFold(ctx.Args[0], "or") {
-	} else if strings.EqualFold(ctx.Args[0], "xor") {
-	} else if strings.EqualFold(ctx.Args[0], "not") {
+	var op db.BitOperation
+	switch strings.ToUpper(ctx.Args[0]) {
+	case "AND":
+		op = db.BitOpAnd
+	case "OR":
+		op = db.BitOpOr
+	case "XOR":
+		op = db.BitOpXor
+	case "NOT":
 		if len(ctx.Args) != 3 {
 			return nil, ErrBitOp
 		}
-	} else {
+		op = db.BitOpNot
+	default:
 		return nil, ErrSyntax
 	}
-	return Integer(ctx.Out, int64(0)), nil
+
+	dest := []byte(ctx.Args[1])
+	values := make([][]byte, 0, len(ctx.Args)-2)
+	for _, key := range ctx.Args[2:] {
+		str, err := txn.String([]byte(key))
+		if err != nil {
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		var val []byte
+		if str.Exist() {
+			if val, err = str.Get(); err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+		}
+		values = append(values, val)
+	}
+	res := db.BitOp(op, values...)
+
+	// the destination is overwritten, or deleted if the result is empty
+	obj, err := txn.Object(dest)
+	if err != nil && err != db.ErrKeyNotFound {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if err != db.ErrKeyNotFound {
+		if err := txn.Destory(obj, dest); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	if len(res) > 0 {
+		if err := db.NewString(txn, dest).Set(res); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	return Integer(ctx.Out, int64(len(res))), nil
+}
+
+// bitFieldOp is a subcommand of BITFIELD
+type bitFieldOp struct {
+	cmd      string
+	offset   int64
+	width    uint
+	signed   bool
+	value    int64
+	overflow db.BitFieldOverflow
+}
+
+// parseBitFieldType parses the type like i16 or u8
+func parseBitFieldType(t string) (uint, bool, error) {
+	if len(t) > 1 && (t[0] == 'i' || t[0] == 'I' || t[0] == 'u' || t[0] == 'U') {
+		signed := t[0] == 'i' || t[0] == 'I'
+		width, err := strconv.ParseUint(t[1:], 10, 8)
+		if err == nil && width > 0 && (signed && width <= 64 || !signed && width <= 63) {
+			return uint(width), signed, nil
+		}
+	}
+	return 0, false, ErrBitFieldType
+}
+
+// parseBitFieldOffset parses the bit offset, the offset like #N is multiplied by the width
+func parseBitFieldOffset(offset string, width uint) (int64, error) {
+	mul := false
+	if len(offset) > 0 && offset[0] == '#' {
+		mul = true
+		offset = offset[1:]
+	}
+	v, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil || v < 0 {
+		return 0, ErrBitOffset
+	}
+	if mul {
+		v *= int64(width)
+	}
+	if (v+int64(width)-1)>>3 > int64(MaxRangeInteger) {
+		return 0, ErrBitOffset
+	}
+	return v, nil
 }
 
 // BitField performs arbitrary bitfield integer operations on strings
 func BitField(ctx *Context, txn *db.Transaction) (OnCommit, error) {
-	//TODO
-	return Integer(ctx.Out, int64(0)), nil
+	return bitField(ctx, txn, false)
+}
+
+// BitFieldRO is the read-only variant of BITFIELD which only accepts GET
+func BitFieldRO(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return bitField(ctx, txn, true)
+}
+
+func bitField(ctx *Context, txn *db.Transaction, readonly bool) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	var ops []bitFieldOp
+	overflow := db.BitFieldWrap
+	args := ctx.Args[1:]
+	for i := 0; i < len(args); i++ {
+		cmd := strings.ToUpper(args[i])
+		remain := len(args) - i - 1
+		switch {
+		case cmd == "OVERFLOW" && remain >= 1:
+			switch strings.ToUpper(args[i+1]) {
+			case "WRAP":
+				overflow = db.BitFieldWrap
+			case "SAT":
+				overflow = db.BitFieldSat
+			case "FAIL":
+				overflow = db.BitFieldFail
+			default:
+				return nil, ErrBitFieldOverflow
+			}
+			i++
+			continue
+		case cmd == "GET" && remain >= 2:
+		case (cmd == "SET" || cmd == "INCRBY") && remain >= 3:
+			if readonly {
+				return nil, ErrBitFieldRO
+			}
+		default:
+			return nil, ErrSyntax
+		}
+
+		op := bitFieldOp{cmd: cmd, overflow: overflow}
+		var err error
+		if op.width, op.signed, err = parseBitFieldType(args[i+1]); err != nil {
+			return nil, err
+		}
+		if op.offset, err = parseBitFieldOffset(args[i+2], op.width); err != nil {
+			return nil, err
+		}
+		i += 2
+		if cmd != "GET" {
+			if op.value, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+				return nil, ErrInteger
+			}
+			i++
+		}
+		ops = append(ops, op)
+	}
+
+	str, err := txn.String(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	// nil stands for the operations failed with OVERFLOW FAIL
+	results := make([]*int64, len(ops))
+	for i, op := range ops {
+		old, err := str.GetBitField(op.offset, op.width, op.signed)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		var v int64
+		var ok bool
+		switch op.cmd {
+		case "GET":
+			results[i] = &old
+			continue
+		case "SET":
+			v, ok = db.BitFieldLimit(op.value, 0, op.width, op.signed, op.overflow)
+		case "INCRBY":
+			v, ok = db.BitFieldLimit(old, op.value, op.width, op.signed, op.overflow)
+		}
+		if !ok {
+			continue
+		}
+		if err := str.SetBitField(op.offset, op.width, v); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if op.cmd == "SET" {
+			results[i] = &old
+		} else {
+			results[i] = &v
+		}
+	}
+
+	return func() {
+		resp.ReplyArray(ctx.Out, len(results))
+		for _, v := range results {
+			if v == nil {
+				encoder(ctx).NullBulkString()
+				continue
+			}
+			resp.ReplyInteger(ctx.Out, *v)
+		}
+	}, nil
 }
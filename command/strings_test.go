@@ -2,7 +2,9 @@ package command
 
 import (
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -686,3 +688,131 @@ func TestStringBitPos(t *testing.T) {
 		})
 	}
 }
+
+func TestStringBitOp(t *testing.T) {
+	CallTest("set", "bitop-a", "foobar")
+	CallTest("set", "bitop-b", "abcdef")
+	assert.Equal(t, ":6\r\n", ctxString(CallTest("bitop", "AND", "bitop-dest", "bitop-a", "bitop-b")))
+	assert.Equal(t, "$6\r\n`bc`ab\r\n", ctxString(CallTest("get", "bitop-dest")))
+	assert.Equal(t, ":6\r\n", ctxString(CallTest("bitop", "or", "bitop-dest", "bitop-a", "bitop-b")))
+	assert.Equal(t, "$6\r\ngoofev\r\n", ctxString(CallTest("get", "bitop-dest")))
+
+	// the missing keys are zeros
+	CallTest("set", "bitop-c", "\xff\xff")
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("bitop", "XOR", "bitop-dest", "bitop-c", "bitop-none")))
+	assert.Equal(t, "$2\r\n\xff\xff\r\n", ctxString(CallTest("get", "bitop-dest")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("bitop", "NOT", "bitop-dest", "bitop-c")))
+	assert.Equal(t, "$2\r\n\x00\x00\r\n", ctxString(CallTest("get", "bitop-dest")))
+
+	// the destination is deleted if the result is empty
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("bitop", "AND", "bitop-dest", "bitop-none")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "bitop-dest")))
+
+	// the destination of another type is overwritten
+	CallTest("sadd", "bitop-dest", "a")
+	assert.Equal(t, ":6\r\n", ctxString(CallTest("bitop", "AND", "bitop-dest", "bitop-a")))
+	assert.Equal(t, "+string\r\n", ctxString(CallTest("type", "bitop-dest")))
+
+	assert.Equal(t, "-"+ErrBitOp.Error()+"\r\n", ctxString(CallTest("bitop", "NOT", "bitop-dest", "bitop-a", "bitop-b")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("bitop", "NAND", "bitop-dest", "bitop-a")))
+	CallTest("sadd", "bitop-set", "a")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("bitop", "AND", "bitop-dest", "bitop-a", "bitop-set")))
+}
+
+func TestStringBitField(t *testing.T) {
+	key := "bitfield"
+	assert.Equal(t, "*2\r\n:1\r\n:0\r\n", ctxString(CallTest("bitfield", key, "INCRBY", "i5", "100", "1", "GET", "u4", "0")))
+	assert.Equal(t, "*1\r\n:1\r\n", ctxString(CallTest("bitfield", key, "GET", "i5", "100")))
+
+	// overflows
+	assert.Equal(t, "*1\r\n:0\r\n", ctxString(CallTest("bitfield", key, "SET", "u8", "#1", "255")))
+	assert.Equal(t, "*3\r\n:9\r\n:255\r\n$-1\r\n", ctxString(CallTest("bitfield", key,
+		"INCRBY", "u8", "#1", "10", "OVERFLOW", "SAT", "INCRBY", "u8", "#1", "300", "OVERFLOW", "FAIL", "INCRBY", "u8", "#1", "1")))
+	assert.Equal(t, "*1\r\n:255\r\n", ctxString(CallTest("bitfield_ro", key, "GET", "u8", "8")))
+
+	// the missing key is all zeros
+	assert.Equal(t, "*1\r\n:0\r\n", ctxString(CallTest("bitfield", "bitfield-none", "GET", "i64", "0")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "bitfield-none")))
+
+	assert.Equal(t, "-"+ErrBitFieldType.Error()+"\r\n", ctxString(CallTest("bitfield", key, "GET", "u64", "0")))
+	assert.Equal(t, "-"+ErrBitOffset.Error()+"\r\n", ctxString(CallTest("bitfield", key, "GET", "u8", "-1")))
+	assert.Equal(t, "-"+ErrBitFieldOverflow.Error()+"\r\n", ctxString(CallTest("bitfield", key, "OVERFLOW", "MAX")))
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", ctxString(CallTest("bitfield", key, "SET", "u8", "0", "a")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("bitfield", key, "SET", "u8", "0")))
+	assert.Equal(t, "-"+ErrBitFieldRO.Error()+"\r\n", ctxString(CallTest("bitfield_ro", key, "SET", "u8", "0", "1")))
+}
+
+func TestStringLarge(t *testing.T) {
+	// the value is longer than a chunk
+	large := strings.Repeat("0123456789", 10000)
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "large", large)))
+	assert.Equal(t, ":100000\r\n", ctxString(CallTest("strlen", "large")))
+	assert.Equal(t, "$10\r\n5678901234\r\n", ctxString(CallTest("getrange", "large", "65535", "65544")))
+	assert.Equal(t, "+raw\r\n", ctxString(CallTest("object", "encoding", "large")))
+
+	assert.Equal(t, ":100003\r\n", ctxString(CallTest("append", "large", "abc")))
+	assert.Equal(t, ":100003\r\n", ctxString(CallTest("setrange", "large", "65534", "xyz")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("setbit", "large", "800024", "1")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("getbit", "large", "800024")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("bitcount", "large", "100003", "-1")))
+
+	want := []byte(large[:65534] + "xyz" + large[65537:] + "abc")
+	want = append(want, 0x80)
+	assert.Equal(t, "$"+strconv.Itoa(len(want))+"\r\n"+string(want)+"\r\n", ctxString(CallTest("get", "large")))
+
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "large", "small")))
+	assert.Equal(t, "$5\r\nsmall\r\n", ctxString(CallTest("get", "large")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("del", "large")))
+}
+
+func TestStringSetOptions(t *testing.T) {
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("set", "set-opt", "v1", "GET")))
+	assert.Equal(t, "$2\r\nv1\r\n", ctxString(CallTest("set", "set-opt", "v2", "get", "ex", "100")))
+	assert.Equal(t, "$2\r\nv2\r\n", ctxString(CallTest("set", "set-opt", "v3", "nx", "get")))
+	assert.Equal(t, "$2\r\nv2\r\n", ctxString(CallTest("get", "set-opt")))
+
+	// KEEPTTL retains the ttl, and a plain SET discards it
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "set-opt", "v3", "xx", "keepttl")))
+	assert.NotEqual(t, ":-1\r\n", ctxString(CallTest("ttl", "set-opt")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "set-opt", "v4")))
+	assert.Equal(t, ":-1\r\n", ctxString(CallTest("ttl", "set-opt")))
+
+	at := time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "set-opt", "v5", "exat", strconv.FormatInt(at, 10))))
+	assert.NotEqual(t, ":-1\r\n", ctxString(CallTest("ttl", "set-opt")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "set-opt", "v6", "pxat", "1000")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", "set-opt")))
+
+	CallTest("rpush", "set-opt-list", "a")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("set", "set-opt-list", "v", "get")))
+	assert.Equal(t, "+OK\r\n", ctxString(CallTest("set", "set-opt-list", "v")))
+
+	for _, args := range [][]string{
+		{"nx", "xx"},
+		{"ex", "10", "px", "10"},
+		{"ex", "10", "keepttl"},
+		{"exat"},
+	} {
+		args = append([]string{"set-opt", "v"}, args...)
+		assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("set", args...)))
+	}
+	assert.Equal(t, "-"+ErrExpire.Error()+"\r\n", ctxString(CallTest("set", "set-opt", "v", "pxat", "0")))
+}
+
+func TestStringGetExDel(t *testing.T) {
+	CallTest("set", "getex", "value")
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("getex", "getex", "ex", "100")))
+	assert.NotEqual(t, ":-1\r\n", ctxString(CallTest("ttl", "getex")))
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("getex", "getex", "persist")))
+	assert.Equal(t, ":-1\r\n", ctxString(CallTest("ttl", "getex")))
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("getex", "getex", "pxat", "1000")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("getex", "getex")))
+	assert.Equal(t, "-"+ErrExpireGetEx.Error()+"\r\n", ctxString(CallTest("getex", "getex", "ex", "0")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("getex", "getex", "ex", "10", "persist")))
+
+	CallTest("set", "getdel", "value")
+	assert.Equal(t, "$5\r\nvalue\r\n", ctxString(CallTest("getdel", "getdel")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("getdel", "getdel")))
+	CallTest("rpush", "getdel-list", "a")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("getdel", "getdel-list")))
+}
@@ -9,12 +9,14 @@ import (
 	"github.com/distributedio/titan/conf"
 	"github.com/distributedio/titan/context"
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/pubsub"
 
 	"go.etcd.io/etcd/integration"
 )
 
 var Cfg = &conf.MockConf().TiKV
 var mockdb *db.RedisStore
+var mockhub = pubsub.NewHub()
 
 func init() {
 	t := &testing.T{}
@@ -28,10 +30,14 @@ func ContextTest(name string, args ...string) *Context {
 		DB: mockdb.DB("defalut", 1),
 	}
 	servCtx := &context.ServerContext{
-		RequirePass:      "",
-		ListZipThreshold: 100,
-		Store:            mockdb,
+		RequirePass: "",
+		Store:       mockdb,
+		PubSub:      mockhub,
 	}
+	servCtx.SetOptions(context.Options{
+		ListZipThreshold: 100,
+		SortMaxElements:  100000,
+	})
 	rootCtx, _ := context.WithCancel(context.New(cliCtx, servCtx))
 	return &Context{
 		Name:    name,
@@ -1,8 +1,11 @@
 package command
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,29 +17,61 @@ import (
 func ZAdd(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	key := []byte(ctx.Args[0])
 
+	var nx, xx, gt, lt, ch, incr bool
 	kvs := ctx.Args[1:]
-	if len(kvs)%2 != 0 {
-		return nil, errors.New("ERR syntax error")
+	for ; len(kvs) > 0; kvs = kvs[1:] {
+		switch strings.ToUpper(kvs[0]) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "GT":
+			gt = true
+			continue
+		case "LT":
+			lt = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		case "INCR":
+			incr = true
+			continue
+		}
+		break
+	}
+	if len(kvs) == 0 || len(kvs)%2 != 0 {
+		return nil, ErrSyntax
+	}
+	if nx && xx {
+		return nil, ErrNXAndXX
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return nil, ErrGTLTAndNX
+	}
+	if incr && len(kvs) > 2 {
+		return nil, ErrZAddIncr
 	}
 
-	uniqueMembers := make(map[string]bool)
 	count := len(kvs) / 2
 	members := make([][]byte, 0, count)
 	scores := make([]float64, 0, count)
+	uniqueMembers := make(map[string]bool)
 	for i := 0; i < len(kvs)-1; i += 2 {
-		member := kvs[i+1]
-		if _, ok := uniqueMembers[member]; ok {
-			continue
-		}
-
-		members = append(members, []byte(member))
 		score, err := strconv.ParseFloat(kvs[i], 64)
 		if err != nil || math.IsNaN(score) {
 			return nil, ErrFloat
 		}
-		scores = append(scores, score)
-
+		// the first one wins if a member is specified more than once
+		member := kvs[i+1]
+		if uniqueMembers[member] {
+			continue
+		}
 		uniqueMembers[member] = true
+		members = append(members, []byte(member))
+		scores = append(scores, score)
 	}
 
 	zset, err := txn.ZSet(key)
@@ -46,13 +81,64 @@ func ZAdd(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		}
 		return nil, errors.New("ERR " + err.Error())
 	}
+	olds := make([][]byte, len(members))
+	if zset.Exist() {
+		if olds, err = zset.MGet(members); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
 
-	added, err := zset.ZAdd(members, scores)
-	if err != nil {
-		return nil, errors.New("ERR " + err.Error())
+	var updates [][]byte
+	var updateScores []float64
+	var added, changed int64
+	for i := range members {
+		exists := olds[i] != nil
+		var old float64
+		if exists {
+			old = db.DecodeFloat64(olds[i])
+		}
+
+		score := scores[i]
+		if incr && exists {
+			score += old
+			if math.IsNaN(score) {
+				return nil, errors.New("ERR " + db.ErrScoreNaN.Error())
+			}
+		}
+		if (nx && exists) || (xx && !exists) ||
+			(exists && gt && score <= old) || (exists && lt && score >= old) {
+			if incr {
+				return Null(ctx), nil
+			}
+			continue
+		}
+		if !exists {
+			added++
+		} else if score != old {
+			changed++
+		}
+		updates = append(updates, members[i])
+		updateScores = append(updateScores, score)
+	}
+	if len(updates) > 0 {
+		if _, err := zset.ZAdd(updates, updateScores); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
 	}
 
-	return Integer(ctx.Out, added), nil
+	var onCommit OnCommit
+	switch {
+	case incr:
+		onCommit = BulkString(ctx.Out, strconv.FormatFloat(updateScores[0], 'f', -1, 64))
+	case ch:
+		onCommit = Integer(ctx.Out, added+changed)
+	default:
+		onCommit = Integer(ctx.Out, added)
+	}
+	if len(updates) == 0 {
+		return onCommit, nil
+	}
+	return signal(ctx, onCommit, key), nil
 }
 
 func ZRange(ctx *Context, txn *db.Transaction) (OnCommit, error) {
@@ -334,6 +420,76 @@ func ZRemRangeByLex(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return Integer(ctx.Out, deleted), nil
 }
 
+// zsetRangeRemover removes a range of members from the sorted set
+type zsetRangeRemover func(zset *db.ZSet) (int64, error)
+
+func zremRangeByScore(args []string) (zsetRangeRemover, error) {
+	startScore, startInclude, err := getFloatAndInclude(args[1])
+	if err != nil {
+		return nil, ErrMinOrMaxNotFloat
+	}
+	stopScore, stopInclude, err := getFloatAndInclude(args[2])
+	if err != nil {
+		return nil, ErrMinOrMaxNotFloat
+	}
+	return func(zset *db.ZSet) (int64, error) {
+		return zset.ZRemRangeByScore(startScore, startInclude, stopScore, stopInclude)
+	}, nil
+}
+
+func zremRangeByRank(args []string) (zsetRangeRemover, error) {
+	start, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, ErrInteger
+	}
+	stop, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, ErrInteger
+	}
+	return func(zset *db.ZSet) (int64, error) {
+		return zset.ZRemRangeByRank(start, stop)
+	}, nil
+}
+
+// zremRange removes the range in the transaction, the range too large for a transaction is not removed
+func zremRange(parse func(args []string) (zsetRangeRemover, error)) TxnCommand {
+	return func(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+		remove, err := parse(ctx.Args)
+		if err != nil {
+			return nil, err
+		}
+		zset, err := txn.ZSet([]byte(ctx.Args[0]))
+		if err != nil {
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if !zset.Exist() {
+			return Integer(ctx.Out, 0), nil
+		}
+
+		deleted, err := remove(zset)
+		if err != nil {
+			if err == db.ErrRemoveTooMany {
+				return nil, ErrRemoveTooMany
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return Integer(ctx.Out, deleted), nil
+	}
+}
+
+// ZRemRangeByScore removes the members of the sorted set whose scores are in the range
+func ZRemRangeByScore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zremRange(zremRangeByScore)(ctx, txn)
+}
+
+// ZRemRangeByRank removes the members of the sorted set whose ranks are in the range
+func ZRemRangeByRank(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zremRange(zremRangeByRank)(ctx, txn)
+}
+
 func ZCard(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	key := []byte(ctx.Args[0])
 
@@ -363,7 +519,7 @@ func ZScore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if !zset.Exist() {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
 	}
 
 	score, err := zset.ZScore(member)
@@ -371,10 +527,136 @@ func ZScore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 		return nil, errors.New("ERR " + err.Error())
 	}
 	if score == nil {
-		return NullBulkString(ctx.Out), nil
+		return Null(ctx), nil
+	}
+	fscore, err := strconv.ParseFloat(string(score), 64)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	return Double(ctx, fscore), nil
+}
+
+// ZIncrBy increments the score of member in the sorted set by increment
+func ZIncrBy(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	member := []byte(ctx.Args[2])
+	delta, err := strconv.ParseFloat(ctx.Args[1], 64)
+	if err != nil || math.IsNaN(delta) {
+		return nil, ErrFloat
+	}
+
+	zset, err := txn.ZSet(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	score, err := zset.ZIncrBy(member, delta)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
 	}
+	return signal(ctx, Double(ctx, score), key), nil
+}
 
-	return BulkString(ctx.Out, string(score)), nil
+// ZRank returns the rank of member in the sorted set, with the scores ordered from low to high
+func ZRank(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zAnyOrderRank(ctx, txn, true)
+}
+
+// ZRevRank returns the rank of member in the sorted set, with the scores ordered from high to low
+func ZRevRank(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zAnyOrderRank(ctx, txn, false)
+}
+
+func zAnyOrderRank(ctx *Context, txn *db.Transaction, positiveOrder bool) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	member := []byte(ctx.Args[1])
+	withScore := false
+	if len(ctx.Args) > 3 {
+		return nil, ErrSyntax
+	}
+	if len(ctx.Args) == 3 {
+		if strings.ToUpper(ctx.Args[2]) != "WITHSCORE" {
+			return nil, ErrSyntax
+		}
+		withScore = true
+	}
+
+	nullReply := Null(ctx)
+	if withScore {
+		nullReply = func() { encoder(ctx).NullArray() }
+	}
+	zset, err := txn.ZSet(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if !zset.Exist() {
+		return nullReply, nil
+	}
+
+	var rank int64
+	if positiveOrder {
+		rank, err = zset.ZRank(member)
+	} else {
+		rank, err = zset.ZRevRank(member)
+	}
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if rank < 0 {
+		return nullReply, nil
+	}
+	if !withScore {
+		return Integer(ctx.Out, rank), nil
+	}
+
+	score, err := zset.ZScore(member)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	return func() {
+		resp.ReplyArray(ctx.Out, 2)
+		resp.ReplyInteger(ctx.Out, rank)
+		resp.ReplyBulkString(ctx.Out, string(score))
+	}, nil
+}
+
+// ZMScore returns the scores associated with the specified members in the sorted set
+func ZMScore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	members := make([][]byte, len(ctx.Args)-1)
+	for i, member := range ctx.Args[1:] {
+		members[i] = []byte(member)
+	}
+
+	zset, err := txn.ZSet(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	scores := make([][]byte, len(members))
+	if !zset.Exist() {
+		return BytesArray(ctx.Out, scores), nil
+	}
+
+	vals, err := zset.MGet(members)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	for i := range vals {
+		if vals[i] != nil {
+			scores[i] = []byte(strconv.FormatFloat(db.DecodeFloat64(vals[i]), 'f', -1, 64))
+		}
+	}
+	return BytesArray(ctx.Out, scores), nil
 }
 
 func ZScan(ctx *Context, txn *db.Transaction) (OnCommit, error) {
@@ -464,3 +746,434 @@ func ZScan(ctx *Context, txn *db.Transaction) (OnCommit, error) {
 	return result, nil
 
 }
+
+// zsetStoreBatch is the number of the members added to the destination at a time
+const zsetStoreBatch = 256
+
+// zsetStore overwrites the destination with the members, the destination is deleted if there is no member
+func zsetStore(txn *db.Transaction, dest []byte, members [][]byte, scores []float64) (int64, error) {
+	zset := txn.NewZSet(dest)
+	added, err := zset.ZAdd(members, scores)
+	if err != nil {
+		return 0, errors.New("ERR " + err.Error())
+	}
+	if err := zset.Replace(); err != nil {
+		return 0, errors.New("ERR " + err.Error())
+	}
+	return added, nil
+}
+
+// zsetReply replies the members sorted by the scores
+func zsetReply(ctx *Context, members [][]byte, scores []float64, withScores bool) OnCommit {
+	idx := make([]int, len(members))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		if scores[idx[i]] != scores[idx[j]] {
+			return scores[idx[i]] < scores[idx[j]]
+		}
+		return bytes.Compare(members[idx[i]], members[idx[j]]) < 0
+	})
+	items := make([][]byte, 0, len(members)*2)
+	for _, i := range idx {
+		items = append(items, members[i])
+		if withScores {
+			items = append(items, []byte(strconv.FormatFloat(scores[i], 'f', -1, 64)))
+		}
+	}
+	return BytesArray(ctx.Out, items)
+}
+
+// zsetOpArgs is parsed from "numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]"
+type zsetOpArgs struct {
+	keys       [][]byte
+	weights    []float64
+	aggregate  db.Aggregate
+	withScores bool
+}
+
+func parseZSetOpArgs(cmd string, args []string, op db.ZSetOp, store bool) (*zsetOpArgs, error) {
+	numkeys, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, ErrInteger
+	}
+	if numkeys < 1 {
+		return nil, fmt.Errorf("ERR at least 1 input key is needed for '%s' command", cmd)
+	}
+	args = args[1:]
+	if numkeys > int64(len(args)) {
+		return nil, ErrSyntax
+	}
+	opts := &zsetOpArgs{}
+	for _, key := range args[:numkeys] {
+		opts.keys = append(opts.keys, []byte(key))
+	}
+	args = args[numkeys:]
+	for i := 0; i < len(args); i++ {
+		remain := len(args) - i - 1
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "WEIGHTS" && op != db.ZSetDiff && int64(remain) >= numkeys:
+			opts.weights = make([]float64, numkeys)
+			for j := range opts.weights {
+				w, err := strconv.ParseFloat(args[i+1+j], 64)
+				if err != nil || math.IsNaN(w) {
+					return nil, errors.New("ERR weight value is not a float")
+				}
+				opts.weights[j] = w
+			}
+			i += int(numkeys)
+		case opt == "AGGREGATE" && op != db.ZSetDiff && remain >= 1:
+			switch strings.ToUpper(args[i+1]) {
+			case "SUM":
+				opts.aggregate = db.AggregateSum
+			case "MIN":
+				opts.aggregate = db.AggregateMin
+			case "MAX":
+				opts.aggregate = db.AggregateMax
+			default:
+				return nil, ErrSyntax
+			}
+			i++
+		case opt == "WITHSCORES" && !store:
+			opts.withScores = true
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+// zsetMemberIters returns the iterators of the sorted sets or sets, it is nil if the key does not exist
+func zsetMemberIters(txn *db.Transaction, keys [][]byte) ([]*db.ZSetMemberIter, error) {
+	iters := make([]*db.ZSetMemberIter, len(keys))
+	for i, key := range keys {
+		iter, err := zsetMemberIter(txn, key)
+		if err != nil {
+			closeZSetMemberIters(iters)
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		iters[i] = iter
+	}
+	return iters, nil
+}
+
+func zsetMemberIter(txn *db.Transaction, key []byte) (*db.ZSetMemberIter, error) {
+	zset, err := txn.ZSet(key)
+	if err == nil {
+		if !zset.Exist() {
+			return nil, nil
+		}
+		return zset.MemberIter()
+	}
+	if err != db.ErrTypeMismatch {
+		return nil, err
+	}
+	// sets are accepted as sorted sets whose scores are 1
+	set, err := txn.Set(key)
+	if err != nil {
+		return nil, err
+	}
+	if !set.Exists() {
+		return nil, nil
+	}
+	return set.ZSetMemberIter()
+}
+
+func closeZSetMemberIters(iters []*db.ZSetMemberIter) {
+	for _, iter := range iters {
+		if iter != nil {
+			iter.Close()
+		}
+	}
+}
+
+// zsetCombine computes the union, intersection or difference of the sorted sets,
+// the result is stored to the destination which is the first argument if store is true
+func zsetCombine(ctx *Context, txn *db.Transaction, op db.ZSetOp, store bool) (OnCommit, error) {
+	args := ctx.Args
+	if store {
+		args = args[1:]
+	}
+	opts, err := parseZSetOpArgs(ctx.Name, args, op, store)
+	if err != nil {
+		return nil, err
+	}
+
+	iters, err := zsetMemberIters(txn, opts.keys)
+	if err != nil {
+		return nil, err
+	}
+	defer closeZSetMemberIters(iters)
+
+	var members [][]byte
+	var scores []float64
+	if !store {
+		if err := db.ZSetCombine(op, iters, opts.weights, opts.aggregate, func(member []byte, score float64) error {
+			members = append(members, member)
+			scores = append(scores, score)
+			return nil
+		}); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		return zsetReply(ctx, members, scores, opts.withScores), nil
+	}
+
+	// the members are added to a new sorted set as they are merged, which replaces the destination at last
+	dest := []byte(ctx.Args[0])
+	zset := txn.NewZSet(dest)
+	var count int64
+	flush := func() error {
+		added, err := zset.ZAdd(members, scores)
+		count += added
+		members, scores = members[:0], scores[:0]
+		return err
+	}
+	if err := db.ZSetCombine(op, iters, opts.weights, opts.aggregate, func(member []byte, score float64) error {
+		members = append(members, member)
+		scores = append(scores, score)
+		if len(members) < zsetStoreBatch {
+			return nil
+		}
+		return flush()
+	}); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if len(members) > 0 {
+		if err := flush(); err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+	}
+	if err := zset.Replace(); err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	if count == 0 {
+		return Integer(ctx.Out, 0), nil
+	}
+	return signal(ctx, Integer(ctx.Out, count), dest), nil
+}
+
+// ZUnion returns the union of the sorted sets
+func ZUnion(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetUnion, false)
+}
+
+// ZInter returns the intersection of the sorted sets
+func ZInter(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetInter, false)
+}
+
+// ZDiff returns the difference between the first and all successive sorted sets
+func ZDiff(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetDiff, false)
+}
+
+// ZUnionStore stores the union of the sorted sets in destination
+func ZUnionStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetUnion, true)
+}
+
+// ZInterStore stores the intersection of the sorted sets in destination
+func ZInterStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetInter, true)
+}
+
+// ZDiffStore stores the difference between the first and all successive sorted sets in destination
+func ZDiffStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zsetCombine(ctx, txn, db.ZSetDiff, true)
+}
+
+// ZRangeStore stores the specified range of the source sorted set in destination
+func ZRangeStore(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	dest := []byte(ctx.Args[0])
+	src := []byte(ctx.Args[1])
+	var by string
+	var rev, limit bool
+	offset, count := int64(0), int64(math.MaxInt64)
+	for i := 4; i < len(ctx.Args); i++ {
+		switch opt := strings.ToUpper(ctx.Args[i]); opt {
+		case "BYSCORE", "BYLEX":
+			by = opt
+		case "REV":
+			rev = true
+		case "LIMIT":
+			var err error
+			if offset, count, err = getLimitParameters(ctx.Args[i+1:]); err != nil {
+				return nil, err
+			}
+			limit = true
+			i += 2
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	if limit && by == "" {
+		return nil, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+
+	zset, err := txn.ZSet(src)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+
+	var members [][]byte
+	var scores []float64
+	if zset.Exist() {
+		var items [][]byte
+		var rangeErr error
+		switch by {
+		case "BYSCORE":
+			start, startInclude, err := getFloatAndInclude(ctx.Args[2])
+			if err != nil {
+				return nil, ErrMinOrMaxNotFloat
+			}
+			stop, stopInclude, err := getFloatAndInclude(ctx.Args[3])
+			if err != nil {
+				return nil, ErrMinOrMaxNotFloat
+			}
+			items, rangeErr = zset.ZAnyOrderRangeByScore(start, startInclude, stop, stopInclude, true, offset, count, !rev)
+		case "BYLEX":
+			start, startInclude := getLexKeyAndInclude([]byte(ctx.Args[2]))
+			stop, stopInclude := getLexKeyAndInclude([]byte(ctx.Args[3]))
+			if rev {
+				start, startInclude, stop, stopInclude = stop, stopInclude, start, startInclude
+			}
+			if members, rangeErr = zset.ZOrderRangeByLex(start, stop, startInclude, stopInclude, offset, count, !rev); rangeErr != nil {
+				break
+			}
+			var vals [][]byte
+			if vals, rangeErr = zset.MGet(members); rangeErr != nil {
+				break
+			}
+			for i := range vals {
+				items = append(items, members[i], []byte(strconv.FormatFloat(db.DecodeFloat64(vals[i]), 'f', -1, 64)))
+			}
+			members = nil
+		default:
+			start, err := strconv.ParseInt(ctx.Args[2], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			stop, err := strconv.ParseInt(ctx.Args[3], 10, 64)
+			if err != nil {
+				return nil, ErrInteger
+			}
+			items, rangeErr = zset.ZAnyOrderRange(start, stop, true, !rev)
+		}
+		if rangeErr != nil {
+			return nil, errors.New("ERR " + rangeErr.Error())
+		}
+		for i := 0; i+1 < len(items); i += 2 {
+			score, err := strconv.ParseFloat(string(items[i+1]), 64)
+			if err != nil {
+				return nil, errors.New("ERR " + err.Error())
+			}
+			members = append(members, items[i])
+			scores = append(scores, score)
+		}
+	}
+
+	added, err := zsetStore(txn, dest, members, scores)
+	if err != nil {
+		return nil, err
+	}
+	if added == 0 {
+		return Integer(ctx.Out, 0), nil
+	}
+	return signal(ctx, Integer(ctx.Out, added), dest), nil
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores in the sorted set
+func ZPopMin(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zpop(ctx, txn, true)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores in the sorted set
+func ZPopMax(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return zpop(ctx, txn, false)
+}
+
+func zpop(ctx *Context, txn *db.Transaction, min bool) (OnCommit, error) {
+	key := []byte(ctx.Args[0])
+	count := int64(1)
+	if len(ctx.Args) > 2 {
+		return nil, ErrSyntax
+	}
+	if len(ctx.Args) == 2 {
+		var err error
+		if count, err = strconv.ParseInt(ctx.Args[1], 10, 64); err != nil {
+			return nil, ErrInteger
+		}
+		if count < 0 {
+			return nil, ErrPositive
+		}
+	}
+
+	zset, err := txn.ZSet(key)
+	if err != nil {
+		if err == db.ErrTypeMismatch {
+			return nil, ErrTypeMismatch
+		}
+		return nil, errors.New("ERR " + err.Error())
+	}
+	members, scores, err := zset.ZPop(count, min)
+	if err != nil {
+		return nil, errors.New("ERR " + err.Error())
+	}
+	items := make([][]byte, 0, len(members)*2)
+	for i := range members {
+		items = append(items, members[i], []byte(strconv.FormatFloat(scores[i], 'f', -1, 64)))
+	}
+	return BytesArray(ctx.Out, items), nil
+}
+
+// BZPopMin removes and returns the member with the lowest score from the first non-empty sorted set,
+// or blocks until one is available
+func BZPopMin(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return bzpop(ctx, txn, true)
+}
+
+// BZPopMax removes and returns the member with the highest score from the first non-empty sorted set,
+// or blocks until one is available
+func BZPopMax(ctx *Context, txn *db.Transaction) (OnCommit, error) {
+	return bzpop(ctx, txn, false)
+}
+
+func bzpop(ctx *Context, txn *db.Transaction, min bool) (OnCommit, error) {
+	if _, err := parseTimeout(ctx.Args[len(ctx.Args)-1]); err != nil {
+		return nil, err
+	}
+	for _, key := range ctx.Args[:len(ctx.Args)-1] {
+		zset, err := txn.ZSet([]byte(key))
+		if err != nil {
+			if err == db.ErrTypeMismatch {
+				return nil, ErrTypeMismatch
+			}
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if !zset.Exist() {
+			continue
+		}
+
+		members, scores, err := zset.ZPop(1, min)
+		if err != nil {
+			return nil, errors.New("ERR " + err.Error())
+		}
+		if len(members) == 0 {
+			continue
+		}
+		onCommit := BytesArray(ctx.Out, [][]byte{[]byte(key), members[0], []byte(strconv.FormatFloat(scores[0], 'f', -1, 64))})
+		// wake up the next client blocked on the key if there are members left
+		if zset.ZCard() > 0 {
+			onCommit = signal(ctx, onCommit, []byte(key))
+		}
+		return onCommit, nil
+	}
+	return nil, errWouldBlock
+}
@@ -0,0 +1,286 @@
+package command
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZIncrBy(t *testing.T) {
+	key := "zset-zincrby"
+	assert.Equal(t, "$3\r\n2.5\r\n", ctxString(CallTest("zincrby", key, "2.5", "a")))
+	assert.Equal(t, "$2\r\n-1\r\n", ctxString(CallTest("zincrby", key, "-3.5", "a")))
+	assert.Equal(t, "$2\r\n-1\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zcard", key)))
+
+	assert.Equal(t, "$4\r\n+Inf\r\n", ctxString(CallTest("zincrby", key, "+inf", "b")))
+	assert.Equal(t, "-ERR resulting score is not a number (NaN)\r\n", ctxString(CallTest("zincrby", key, "-inf", "b")))
+	assert.Equal(t, "-"+ErrFloat.Error()+"\r\n", ctxString(CallTest("zincrby", key, "a", "b")))
+}
+
+func TestZRank(t *testing.T) {
+	key := "zset-zrank"
+	CallTest("zadd", key, "1", "one", "2", "two", "3", "three", "2", "deux")
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zrank", key, "one")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zrank", key, "deux")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zrank", key, "two")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zrank", key, "three")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zrevrank", key, "three")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zrevrank", key, "one")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zrank", key, "four")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zrevrank", "zset-zrank-none", "one")))
+
+	assert.Equal(t, "*2\r\n:2\r\n$1\r\n2\r\n", ctxString(CallTest("zrank", key, "two", "WITHSCORE")))
+	assert.Equal(t, "*2\r\n:1\r\n$1\r\n2\r\n", ctxString(CallTest("zrevrank", key, "two", "withscore")))
+	assert.Equal(t, "*-1\r\n", ctxString(CallTest("zrank", key, "four", "WITHSCORE")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zrank", key, "one", "WITHSCORES")))
+
+	// the rank changes with the score
+	assert.Equal(t, "$1\r\n4\r\n", ctxString(CallTest("zincrby", key, "3", "one")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zrank", key, "one")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zrem", key, "deux")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zrank", key, "three")))
+}
+
+func TestZMScore(t *testing.T) {
+	key := "zset-zmscore"
+	CallTest("zadd", key, "1", "one", "2.5", "two")
+	assert.Equal(t, "*3\r\n$1\r\n1\r\n$3\r\n2.5\r\n$-1\r\n", ctxString(CallTest("zmscore", key, "one", "two", "none")))
+	assert.Equal(t, "*2\r\n$-1\r\n$-1\r\n", ctxString(CallTest("zmscore", "zset-zmscore-none", "one", "two")))
+}
+
+func TestZUnionStore(t *testing.T) {
+	CallTest("zadd", "zset-zunion-1", "1", "a", "2", "b", "3", "c")
+	CallTest("zadd", "zset-zunion-2", "10", "b", "20", "c", "30", "d")
+	dest := "zset-zunion-dest"
+
+	assert.Equal(t, ":4\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2")))
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$2\r\n12\r\n$1\r\nc\r\n$2\r\n23\r\n$1\r\nd\r\n$2\r\n30\r\n",
+		ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, ":4\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2", "WEIGHTS", "2", "0.5", "AGGREGATE", "MAX")))
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n2\r\n$1\r\nb\r\n$1\r\n5\r\n$1\r\nc\r\n$2\r\n10\r\n$1\r\nd\r\n$2\r\n15\r\n",
+		ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, "*8\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$2\r\n30\r\n",
+		ctxString(CallTest("zunion", "3", "zset-zunion-1", "zset-zunion-2", "zset-zunion-none", "AGGREGATE", "min", "WITHSCORES")))
+
+	// the destination could be one of the sources
+	assert.Equal(t, ":4\r\n", ctxString(CallTest("zunionstore", dest, "2", dest, "zset-zunion-1")))
+	assert.Equal(t, "$1\r\n7\r\n", ctxString(CallTest("zscore", dest, "b")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zrank", dest, "d")))
+
+	// the result is stored in batches while the sources are merged
+	args := []string{"zadd", "zset-zunion-large"}
+	for i := 0; i < zsetStoreBatch*2+1; i++ {
+		args = append(args, strconv.Itoa(i), "m"+strconv.Itoa(i))
+	}
+	CallTest(args[0], args[1:]...)
+	total := strconv.Itoa(zsetStoreBatch*2 + 5)
+	assert.Equal(t, ":"+total+"\r\n", ctxString(CallTest("zunionstore", dest, "2", dest, "zset-zunion-large")))
+	assert.Equal(t, ":"+total+"\r\n", ctxString(CallTest("zcard", dest)))
+	assert.Equal(t, "$3\r\n512\r\n", ctxString(CallTest("zscore", dest, "m512")))
+
+	// sets are accepted with the scores of 1
+	CallTest("sadd", "zset-zunion-set", "a", "e")
+	assert.Equal(t, "*10\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\ne\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$2\r\n30\r\n",
+		ctxString(CallTest("zunion", "3", "zset-zunion-1", "zset-zunion-2", "zset-zunion-set", "AGGREGATE", "min", "WITHSCORES")))
+
+	assert.Equal(t, "-ERR at least 1 input key is needed for 'zunionstore' command\r\n", ctxString(CallTest("zunionstore", dest, "0", "a")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zunionstore", dest, "3", "zset-zunion-1", "zset-zunion-2")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2", "WEIGHTS", "1")))
+	assert.Equal(t, "-ERR weight value is not a float\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2", "WEIGHTS", "1", "a")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2", "AGGREGATE", "avg")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zunionstore", dest, "2", "zset-zunion-1", "zset-zunion-2", "WITHSCORES")))
+	CallTest("set", "zset-zunion-string", "a")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("zunion", "2", "zset-zunion-1", "zset-zunion-string")))
+}
+
+func TestZInterStore(t *testing.T) {
+	CallTest("zadd", "zset-zinter-1", "1", "a", "2", "b", "3", "c")
+	CallTest("zadd", "zset-zinter-2", "10", "b", "20", "c", "30", "d")
+	dest := "zset-zinter-dest"
+
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zinterstore", dest, "2", "zset-zinter-1", "zset-zinter-2", "WEIGHTS", "1", "-1")))
+	assert.Equal(t, "*4\r\n$1\r\nc\r\n$3\r\n-17\r\n$1\r\nb\r\n$2\r\n-8\r\n",
+		ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", ctxString(CallTest("zinter", "2", "zset-zinter-1", "zset-zinter-2")))
+
+	// the destination is deleted if the result is empty
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zinterstore", dest, "2", "zset-zinter-1", "zset-zinter-none")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", dest)))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("zinter", "2", "zset-zinter-none", "zset-zinter-1")))
+}
+
+func TestZDiffStore(t *testing.T) {
+	CallTest("zadd", "zset-zdiff-1", "1", "a", "2", "b", "3", "c")
+	CallTest("zadd", "zset-zdiff-2", "10", "b")
+	CallTest("zadd", "zset-zdiff-3", "10", "c", "20", "d")
+	dest := "zset-zdiff-dest"
+
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zdiffstore", dest, "3", "zset-zdiff-1", "zset-zdiff-2", "zset-zdiff-3")))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\n1\r\n", ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nc\r\n$1\r\n3\r\n",
+		ctxString(CallTest("zdiff", "3", "zset-zdiff-1", "zset-zdiff-none", "zset-zdiff-2", "WITHSCORES")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("zdiff", "1", "zset-zdiff-none")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zdiff", "2", "zset-zdiff-1", "zset-zdiff-2", "WEIGHTS", "1", "1")))
+}
+
+func TestZRangeStore(t *testing.T) {
+	src := "zset-zrangestore"
+	dest := "zset-zrangestore-dest"
+	CallTest("zadd", src, "1", "a", "2", "b", "3", "c", "4", "d")
+
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zrangestore", dest, src, "1", "2")))
+	assert.Equal(t, "*4\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n", ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zrangestore", dest, src, "0", "0", "REV")))
+	assert.Equal(t, "*2\r\n$1\r\nd\r\n$1\r\n4\r\n", ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zrangestore", dest, src, "(1", "+inf", "BYSCORE", "LIMIT", "1", "2")))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", ctxString(CallTest("zrange", dest, "0", "-1")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zrangestore", dest, src, "3", "-inf", "BYSCORE", "REV", "LIMIT", "0", "2")))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", ctxString(CallTest("zrange", dest, "0", "-1")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zrangestore", dest, src, "[b", "+", "BYLEX")))
+	assert.Equal(t, "*6\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$1\r\n3\r\n$1\r\nd\r\n$1\r\n4\r\n", ctxString(CallTest("zrange", dest, "0", "-1", "WITHSCORES")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zrangestore", dest, src, "(c", "-", "BYLEX", "REV")))
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", ctxString(CallTest("zrange", dest, "0", "-1")))
+
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zrangestore", dest, src, "10", "20")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", dest)))
+	assert.Equal(t, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n",
+		ctxString(CallTest("zrangestore", dest, src, "0", "1", "LIMIT", "0", "1")))
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", ctxString(CallTest("zrangestore", dest, src, "a", "1")))
+}
+
+func TestZAddOptions(t *testing.T) {
+	key := "zset-zadd-options"
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zadd", key, "1", "a", "2", "b")))
+	// the first one wins
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zadd", key, "3", "c", "4", "c")))
+	assert.Equal(t, "$1\r\n3\r\n", ctxString(CallTest("zscore", key, "c")))
+
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zadd", key, "XX", "10", "a", "10", "d")))
+	assert.Equal(t, "$2\r\n10\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zscore", key, "d")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zadd", key, "NX", "20", "a", "20", "d")))
+	assert.Equal(t, "$2\r\n10\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zadd", key, "CH", "11", "a", "20", "d", "30", "e")))
+
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zadd", key, "GT", "CH", "5", "a", "30", "d")))
+	assert.Equal(t, "$2\r\n11\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, "$2\r\n30\r\n", ctxString(CallTest("zscore", key, "d")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zadd", key, "LT", "CH", "5", "a", "40", "d", "1", "f")))
+	assert.Equal(t, "$1\r\n5\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, "$2\r\n30\r\n", ctxString(CallTest("zscore", key, "d")))
+
+	assert.Equal(t, "$1\r\n7\r\n", ctxString(CallTest("zadd", key, "INCR", "2", "a")))
+	assert.Equal(t, "$1\r\n2\r\n", ctxString(CallTest("zadd", key, "incr", "2", "g")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zadd", key, "NX", "INCR", "2", "a")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zadd", key, "XX", "INCR", "2", "h")))
+	assert.Equal(t, "$-1\r\n", ctxString(CallTest("zadd", key, "GT", "INCR", "-2", "a")))
+	assert.Equal(t, "$1\r\n7\r\n", ctxString(CallTest("zscore", key, "a")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zrank", key, "f")))
+
+	assert.Equal(t, "-"+ErrNXAndXX.Error()+"\r\n", ctxString(CallTest("zadd", key, "NX", "XX", "1", "a")))
+	assert.Equal(t, "-"+ErrGTLTAndNX.Error()+"\r\n", ctxString(CallTest("zadd", key, "GT", "LT", "1", "a")))
+	assert.Equal(t, "-"+ErrGTLTAndNX.Error()+"\r\n", ctxString(CallTest("zadd", key, "NX", "GT", "1", "a")))
+	assert.Equal(t, "-"+ErrZAddIncr.Error()+"\r\n", ctxString(CallTest("zadd", key, "INCR", "1", "a", "2", "b")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zadd", key, "1", "a", "2")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zadd", key, "CH", "NX")))
+	assert.Equal(t, "-"+ErrFloat.Error()+"\r\n", ctxString(CallTest("zadd", key, "a", "a")))
+	assert.Equal(t, "-"+ErrFloat.Error()+"\r\n", ctxString(CallTest("zadd", key, "nan", "a")))
+}
+
+func TestZPop(t *testing.T) {
+	key := "zset-zpop"
+	CallTest("zadd", key, "1", "a", "2", "b", "3", "c", "4", "d")
+	assert.Equal(t, "*2\r\n$1\r\na\r\n$1\r\n1\r\n", ctxString(CallTest("zpopmin", key)))
+	assert.Equal(t, "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n", ctxString(CallTest("zpopmax", key, "2")))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("zpopmax", key, "0")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zcard", key)))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zrank", key, "b")))
+	assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\n2\r\n", ctxString(CallTest("zpopmin", key, "10")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", key)))
+	assert.Equal(t, "*0\r\n", ctxString(CallTest("zpopmin", key)))
+
+	assert.Equal(t, "-"+ErrPositive.Error()+"\r\n", ctxString(CallTest("zpopmin", key, "-1")))
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", ctxString(CallTest("zpopmin", key, "a")))
+	assert.Equal(t, "-"+ErrSyntax.Error()+"\r\n", ctxString(CallTest("zpopmin", key, "1", "2")))
+}
+
+func TestBZPop(t *testing.T) {
+	key := "zset-bzpop"
+	CallTest("zadd", key, "1", "a", "2", "b")
+
+	// served immediately
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\na\r\n$1\r\n1\r\n", ctxString(CallTest("bzpopmin", "zset-bzpop-none", key, "0")))
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\nb\r\n$1\r\n2\r\n", ctxString(CallTest("bzpopmax", key, "0")))
+
+	// times out
+	assert.Equal(t, "*-1\r\n", ctxString(CallTest("bzpopmin", key, "0.1")))
+	assert.Equal(t, "-"+ErrTimeoutNegative.Error()+"\r\n", ctxString(CallTest("bzpopmin", key, "-1")))
+
+	// woken up by the writes
+	first := blockingTest(1051, "bzpopmin", key, "5")
+	waitBlocked(t, 1)
+	second := blockingTest(1052, "bzpopmax", key, "5")
+	waitBlocked(t, 2)
+	CallTest("zadd", key, "3", "c", "4", "d")
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\nc\r\n$1\r\n3\r\n", blockingReply(t, first))
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\nd\r\n$1\r\n4\r\n", blockingReply(t, second))
+	waitBlocked(t, 0)
+
+	first = blockingTest(1053, "bzpopmax", key, "5")
+	waitBlocked(t, 1)
+	CallTest("zincrby", key, "5", "e")
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\ne\r\n$1\r\n5\r\n", blockingReply(t, first))
+	waitBlocked(t, 0)
+
+	first = blockingTest(1054, "bzpopmin", key, "5")
+	waitBlocked(t, 1)
+	CallTest("zadd", "zset-bzpop-src", "6", "f")
+	CallTest("zunionstore", key, "1", "zset-bzpop-src")
+	assert.Equal(t, "*3\r\n$10\r\nzset-bzpop\r\n$1\r\nf\r\n$1\r\n6\r\n", blockingReply(t, first))
+	waitBlocked(t, 0)
+
+	// it does not block in a transaction
+	ctx := ContextTest("multi")
+	Call(ctx)
+	ctx.Name = "bzpopmin"
+	ctx.Args = []string{key, "0"}
+	Call(ctx)
+	ctx.Name = "exec"
+	ctx.Args = []string{}
+	Call(ctx)
+	lines := ctxLines(ctx.Out)
+	assert.Equal(t, "*-1", lines[len(lines)-2])
+}
+
+func TestZRemRangeByScore(t *testing.T) {
+	key := "zset-zremrangebyscore"
+	CallTest("zadd", key, "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zremrangebyscore", key, "(1", "3")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zremrangebyscore", key, "10", "20")))
+	assert.Equal(t, "*3\r\n$1\r\na\r\n$1\r\nd\r\n$1\r\ne\r\n", ctxString(CallTest("zrange", key, "0", "-1")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zrank", key, "d")))
+	assert.Equal(t, ":3\r\n", ctxString(CallTest("zremrangebyscore", key, "-inf", "+inf")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", key)))
+
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zremrangebyscore", key, "1", "2")))
+	assert.Equal(t, "-"+ErrMinOrMaxNotFloat.Error()+"\r\n", ctxString(CallTest("zremrangebyscore", key, "a", "2")))
+}
+
+func TestZRemRangeByRank(t *testing.T) {
+	key := "zset-zremrangebyrank"
+	CallTest("zadd", key, "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zremrangebyrank", key, "0", "1")))
+	assert.Equal(t, ":1\r\n", ctxString(CallTest("zremrangebyrank", key, "-1", "100")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("zremrangebyrank", key, "2", "1")))
+	assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nd\r\n", ctxString(CallTest("zrange", key, "0", "-1")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zcard", key)))
+
+	assert.Equal(t, "-"+ErrInteger.Error()+"\r\n", ctxString(CallTest("zremrangebyrank", key, "a", "1")))
+	assert.Equal(t, ":2\r\n", ctxString(CallTest("zremrangebyrank", key, "-100", "-1")))
+	assert.Equal(t, ":0\r\n", ctxString(CallTest("exists", key)))
+
+	CallTest("set", key, "v")
+	assert.Equal(t, "-"+ErrTypeMismatch.Error()+"\r\n", ctxString(CallTest("zremrangebyrank", key, "0", "1")))
+}
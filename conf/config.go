@@ -17,8 +17,14 @@ type Server struct {
 	Listen           string `cfg:"listen; 0.0.0.0:7369; netaddr; address to listen"`
 	SSLCertFile      string `cfg:"ssl-cert-file;;;server SSL certificate file (enables SSL support)"`
 	SSLKeyFile       string `cfg:"ssl-key-file;;;server SSL key file"`
-	MaxConnection    int64  `cfg:"max-connection;1000;numeric;client connection count"`
+	MaxConnection    int64  `cfg:"max-connection;1000;numeric;client connection count, 0 is unlimited"`
 	ListZipThreshold int    `cfg:"list-zip-threshold;100;numeric;the max limit length of elements in list"`
+	SortMaxElements  int    `cfg:"sort-max-elements;100000;numeric;the max number of elements SORT loads in memory, 0 is unlimited"`
+
+	SlowlogLogSlowerThan time.Duration `cfg:"slowlog-log-slower-than;10ms;;the commands slower than it are logged, 0 logs all commands and a negative one disables the slow log"`
+	SlowlogMaxLen        int           `cfg:"slowlog-max-len;128;numeric;the max number of commands kept by the slow log"`
+
+	LuaTimeLimit time.Duration `cfg:"lua-time-limit;5s;;the scripts running longer than it are stopped and their writes are discarded, 0 is unlimited"`
 }
 
 // TiKV config is the config of tikv sdk
@@ -29,6 +35,7 @@ type TiKV struct {
 	Expire    Expire     `cfg:"expire"`
 	ZT        ZT         `cfg:"zt"`
 	TiKVGC    TiKVGC     `cfg:"tikv-gc"`
+	KeyCount  KeyCount   `cfg:"key-count"`
 	Logger    TiKVLogger `cfg:"logger"`
 }
 
@@ -66,6 +73,13 @@ type ZT struct {
 	Interval   time.Duration `cfg:"interval;1000ms; ;Queue fill interval in milsecond"`
 }
 
+// KeyCount config is the config of building the key counters of the dbs
+type KeyCount struct {
+	Disable   bool          `cfg:"disable; false; boolean; false is used to disable building the key counters"`
+	Interval  time.Duration `cfg:"interval;1m;;the interval to look for the dbs whose key counters are not built"`
+	LeaderTTL int           `cfg:"leader-ttl;15;;leader ttl seconds"`
+}
+
 // Logger config is the config of default zap log
 type Logger struct {
 	Name       string `cfg:"name; titan; ; the default logger name"`
@@ -33,6 +33,11 @@ func MockConf() *Titan {
 				SafePointLifeTime: 10 * time.Minute,
 				Concurrency:       2,
 			},
+			KeyCount: KeyCount{
+				Disable:   false,
+				Interval:  time.Minute,
+				LeaderTTL: 15,
+			},
 		},
 	}
 }
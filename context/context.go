@@ -2,11 +2,17 @@ package context
 
 import (
 	"context"
+	"io"
 	"net"
 	"sync"
 	"time"
 
+	"go.uber.org/zap"
+
+	"github.com/distributedio/titan/conf"
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/encoding/resp"
+	"github.com/distributedio/titan/pubsub"
 )
 
 const (
@@ -39,11 +45,13 @@ type ClientContext struct {
 	RemoteAddr    string // Client remote address
 	ID            int64  // Client uniq ID
 	Name          string // Name is set by client setname
+	Protocol      int    // Version of RESP negotiated by hello, RESP2 if it is not set
 	Created       time.Time
 	Updated       time.Time
 	LastCmd       string
 	SkipN         int // Skip N following commands, (-1 for skipping all commands)
 	Close         func() error
+	Writer        io.Writer // Writer writes to the connection regardless of CLIENT REPLY
 
 	// When client is in multi...exec block, the Txn is assigned and Multi is set to be true
 	// Before exec, all command called will be queued in Commands
@@ -51,6 +59,9 @@ type ClientContext struct {
 	Multi    bool
 	Commands []*Command
 
+	// Subscription is set when the client subscribes to channels or patterns
+	Subscription *pubsub.Subscription
+
 	Done chan struct{}
 }
 
@@ -62,6 +73,7 @@ func NewClientContext(id int64, conn net.Conn) *ClientContext {
 		Created:       now,
 		Updated:       now,
 		Namespace:     DefaultNamespace,
+		Protocol:      resp.RESP2,
 		RemoteAddr:    conn.RemoteAddr().String(),
 		Authenticated: false,
 		Multi:         false,
@@ -71,15 +83,72 @@ func NewClientContext(id int64, conn net.Conn) *ClientContext {
 	return cli
 }
 
+// Subscribed returns true if the client is in the subscribe mode, only the
+// subscribe-family commands are allowed in this mode
+func (c *ClientContext) Subscribed() bool {
+	return c.Subscription != nil && c.Subscription.Count() > 0
+}
+
 // ServerContext is the runtime context of the server
 type ServerContext struct {
-	RequirePass      string
-	Store            *db.RedisStore
-	Monitors         sync.Map
-	Clients          sync.Map
-	Pause            time.Duration // elapse to pause all clients
-	StartAt          time.Time
+	RequirePass string
+	Store       *db.RedisStore
+	PubSub      *pubsub.Hub
+	Monitors    sync.Map
+	Clients     sync.Map
+	Pause       time.Duration // elapse to pause all clients
+	StartAt     time.Time
+
+	// opts are read by every client and may be changed by CONFIG SET
+	optsMu sync.RWMutex
+	opts   Options
+
+	// ConnectionsReceived and RejectedConnections are updated atomically
+	ConnectionsReceived int64
+	RejectedConnections int64
+
+	// Config is loaded from ConfigFile, it is changed by CONFIG SET and persisted by CONFIG REWRITE
+	Config     *conf.Titan
+	ConfigFile string
+	LogLevel   *zap.AtomicLevel
+}
+
+// Options are the options of the server able to be changed at runtime
+type Options struct {
 	ListZipThreshold int
+	SortMaxElements  int
+	MaxConnection    int64 // 0 is unlimited
+
+	SlowlogLogSlowerThan time.Duration
+	SlowlogMaxLen        int
+
+	LuaTimeLimit time.Duration // 0 is unlimited
+}
+
+// ServerOptions returns the options in the server config
+func ServerOptions(c *conf.Server) Options {
+	return Options{
+		ListZipThreshold:     c.ListZipThreshold,
+		SortMaxElements:      c.SortMaxElements,
+		MaxConnection:        c.MaxConnection,
+		SlowlogLogSlowerThan: c.SlowlogLogSlowerThan,
+		SlowlogMaxLen:        c.SlowlogMaxLen,
+		LuaTimeLimit:         c.LuaTimeLimit,
+	}
+}
+
+// Options returns the options the server is working with
+func (s *ServerContext) Options() Options {
+	s.optsMu.RLock()
+	defer s.optsMu.RUnlock()
+	return s.opts
+}
+
+// SetOptions changes the options at runtime
+func (s *ServerContext) SetOptions(opts Options) {
+	s.optsMu.Lock()
+	s.opts = opts
+	s.optsMu.Unlock()
 }
 
 // Context combines the client and server context
@@ -94,6 +163,9 @@ func New(c *ClientContext, s *ServerContext) *Context {
 	return &Context{Context: context.Background(), Client: c, Server: s}
 }
 
+// DeadlineExceeded is the error returned by Context.Err when the deadline passes
+var DeadlineExceeded = context.DeadlineExceeded
+
 // CancelFunc tells an operation to abandon its work
 type CancelFunc context.CancelFunc
 
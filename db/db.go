@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"go.uber.org/zap"
 
@@ -41,6 +42,15 @@ var (
 	//ErrSetNilValue means the value corresponding to key is a non-zero value
 	ErrSetNilValue = errors.New("The value corresponding to key is a non-zero value")
 
+	// ErrExpireCondition the condition of ExpireAt is not met
+	ErrExpireCondition = errors.New("the condition of expire is not met")
+
+	// ErrCopyTooLarge the object has too many data keys to be copied in a transaction
+	ErrCopyTooLarge = errors.New("too many data keys to copy in a transaction")
+
+	// ErrRemoveTooMany the range of a sorted set is too large to be removed in a transaction
+	ErrRemoveTooMany = errors.New("too many members to remove in a transaction")
+
 	// IsErrNotFound returns true if the key is not found, otherwise return false
 	IsErrNotFound = store.IsErrNotFound
 
@@ -106,7 +116,9 @@ type DB struct {
 // RedisStore wraps store.Storage
 type RedisStore struct {
 	store.Storage
-	conf *conf.TiKV
+	mu    sync.RWMutex
+	conf  *conf.TiKV
+	tasks []*Task
 }
 
 // Open a storage instance
@@ -115,7 +127,9 @@ func Open(conf *conf.TiKV) (*RedisStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	rds := &RedisStore{Storage: s, conf: conf}
+	// the store keeps its own copy which is replaced by SetConf
+	c := *conf
+	rds := &RedisStore{Storage: s, conf: &c}
 	sysdb := rds.DB(sysNamespace, sysDatabaseID)
 
 	// omit background task if working on a mock tikv
@@ -132,6 +146,21 @@ func (rds *RedisStore) DB(namesapce string, id int) *DB {
 	return &DB{Namespace: namesapce, ID: DBID(id), kv: rds}
 }
 
+// Conf returns the config the background tasks are working with
+func (rds *RedisStore) Conf() conf.TiKV {
+	rds.mu.RLock()
+	defer rds.mu.RUnlock()
+	return *rds.conf
+}
+
+// SetConf changes the config at runtime, the intervals and batch limits of
+// the background tasks take effect on their next tick
+func (rds *RedisStore) SetConf(conf conf.TiKV) {
+	rds.mu.Lock()
+	rds.conf = &conf
+	rds.mu.Unlock()
+}
+
 // Close the storage instance
 func (rds *RedisStore) Close() error {
 	return rds.Storage.Close()
@@ -139,9 +168,14 @@ func (rds *RedisStore) Close() error {
 
 // Transaction supplies transaction for data structures
 type Transaction struct {
-	t   store.Transaction
-	db  *DB
-	ctx context.Context
+	t     store.Transaction
+	db    *DB
+	ctx   context.Context
+	dbmap []byte
+	metas map[string]*metaChange
+
+	// zranks is the pending changes of the rank counters of the sorted sets, keyed by the data keys
+	zranks map[string]*zsetRankBatch
 }
 
 // Begin a transaction
@@ -153,7 +187,23 @@ func (db *DB) Begin() (*Transaction, error) {
 	store.SetOption(txn, store.Enable1PC, true)
 	store.SetOption(txn, store.EnableAsyncCommit, true)
 	store.SetOption(txn, store.GuaranteeExternalConsistency, true)
-	return &Transaction{t: txn, db: db, ctx: context.Background()}, nil
+	metas := make(map[string]*metaChange)
+	t := &Transaction{t: &metaTxn{Transaction: txn, metas: metas}, db: db, ctx: context.Background(), metas: metas,
+		zranks: make(map[string]*zsetRankBatch)}
+	if db.Namespace == sysNamespace {
+		return t, nil
+	}
+
+	// the transaction works on the physical db the logical one is mapped to, the map is read
+	// in the snapshot of the transaction so the swaps are seen by the reads atomically
+	if t.dbmap, err = loadDBMap(t, db.Namespace); err != nil {
+		txn.Rollback()
+		return nil, err
+	}
+	if id := t.physical(db.ID); id != db.ID {
+		t.db = db.kv.DB(db.Namespace, int(id))
+	}
+	return t, nil
 }
 
 // Prefix returns the prefix of a DB object
@@ -161,8 +211,26 @@ func (db *DB) Prefix() []byte {
 	return dbPrefix(db.Namespace, db.ID.Bytes())
 }
 
-// Commit a transaction
+// in returns the transaction on the db of id in the same namespace
+func (txn *Transaction) in(id DBID) *Transaction {
+	return &Transaction{
+		t:      txn.t,
+		db:     txn.db.kv.DB(txn.db.Namespace, int(txn.physical(id))),
+		ctx:    txn.ctx,
+		dbmap:  txn.dbmap,
+		metas:  txn.metas,
+		zranks: txn.zranks,
+	}
+}
+
+// Commit a transaction, the key counters of the dbs are updated before committing
 func (txn *Transaction) Commit(ctx context.Context) error {
+	if err := txn.flushRanks(); err != nil {
+		return err
+	}
+	if err := txn.countKeys(); err != nil {
+		return err
+	}
 	return txn.t.Commit(ctx)
 }
 
@@ -236,11 +304,32 @@ func (txn *Transaction) Set(key []byte) (*Set, error) {
 	return GetSet(txn, key)
 }
 
+// NewSet returns an empty set to replace the value stored at key, the members are added to the
+// new object while the old value is kept at the key until Replace is called
+func (txn *Transaction) NewSet(key []byte) *Set {
+	set := newSet(txn, key)
+	set.detached = true
+	return set
+}
+
 // ZSet returns a zset object
 func (txn *Transaction) ZSet(key []byte) (*ZSet, error) {
 	return GetZSet(txn, key)
 }
 
+// NewZSet returns an empty sorted set to replace the value stored at key, the members are added to
+// the new object while the old value is kept at the key until Replace is called
+func (txn *Transaction) NewZSet(key []byte) *ZSet {
+	zset := newZSet(txn, key)
+	zset.detached = true
+	return zset
+}
+
+// Stream returns a stream object
+func (txn *Transaction) Stream(key []byte) (*Stream, error) {
+	return GetStream(txn, key)
+}
+
 // LockKeys tries to lock the entries with the keys in KV store.
 func (txn *Transaction) LockKeys(keys ...[]byte) error {
 	return store.LockKeys(txn.t, keys)
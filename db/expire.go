@@ -99,7 +99,7 @@ func unExpireAt(txn store.Transaction, mkey []byte, expireAt int64) error {
 func StartExpire(task *Task) {
 	conf := task.conf.(conf.Expire)
 	ticker := time.NewTicker(conf.Interval)
-	defer ticker.Stop()
+	defer func() { ticker.Stop() }()
 	for {
 		select {
 		case <-task.session.Done():
@@ -111,6 +111,14 @@ func StartExpire(task *Task) {
 			return
 		case <-ticker.C:
 		}
+
+		// the interval and batch limit may be changed by CONFIG SET
+		interval := conf.Interval
+		conf = task.db.kv.Conf().Expire
+		if conf.Interval != interval {
+			ticker.Stop()
+			ticker = time.NewTicker(conf.Interval)
+		}
 		runExpire(task.db, conf.BatchLimit)
 	}
 }
@@ -257,7 +265,7 @@ func doExpire(txn *Transaction, mkey, id []byte) error {
 	if logEnv := zap.L().Check(zap.DebugLevel, "[Expire] delete metakey"); logEnv != nil {
 		logEnv.Write(zap.ByteString("mkey", mkey))
 	}
-	if obj.Type == ObjectString {
+	if obj.Type == ObjectString && obj.Encoding != ObjectEncodingChunked {
 		return nil
 	}
 	return gcDataKey(txn, namespace, dbid, key, id)
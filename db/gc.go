@@ -153,7 +153,7 @@ func doGC(db *DB, limit int) error {
 func StartGC(task *Task) {
 	conf := task.conf.(conf.GC)
 	ticker := time.NewTicker(conf.Interval)
-	defer ticker.Stop()
+	defer func() { ticker.Stop() }()
 	for {
 		select {
 		case <-task.session.Done():
@@ -166,6 +166,14 @@ func StartGC(task *Task) {
 		case <-ticker.C:
 		}
 
+		// the interval and batch limit may be changed by CONFIG SET
+		interval := conf.Interval
+		conf = task.db.kv.Conf().GC
+		if conf.Interval != interval {
+			ticker.Stop()
+			ticker = time.NewTicker(conf.Interval)
+		}
+
 		if err := doGC(task.db, conf.BatchLimit); err != nil {
 			zap.L().Error("[GC] do GC failed",
 				zap.ByteString("leader", task.key),
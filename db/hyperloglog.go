@@ -0,0 +1,338 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// The HyperLogLog is stored as a string in the same format as redis, so the
+// value can be dumped from titan and consumed by redis directly.
+//
+// +------+----------+---------+------------------+-----------+
+// | HYLL | encoding | unused  | card             | registers |
+// +------+----------+---------+------------------+-----------+
+// 4 bytes  1 byte     3 bytes   8 bytes(LE)
+//
+// The MSB of the last byte of card is set if the cached cardinality is invalid.
+// The registers are 16384 6-bit integers packed from the LSB in dense encoding,
+// or a run length encoding with the opcodes below in sparse encoding:
+//
+// ZERO:  00xxxxxx          - xxxxxx+1 (1~64) registers set to 0
+// XZERO: 01xxxxxx yyyyyyyy - xxxxxxyyyyyyyy+1 (1~16384) registers set to 0
+// VAL:   1vvvvvxx          - xx+1 (1~4) registers set to vvvvv+1 (1~32)
+
+const (
+	hllP           = 14
+	hllQ           = 64 - hllP
+	hllRegisters   = 1 << hllP
+	hllPMask       = hllRegisters - 1
+	hllBits        = 6
+	hllRegisterMax = (1 << hllBits) - 1
+	hllHeaderSize  = 16
+	hllDenseSize   = hllHeaderSize + (hllRegisters*hllBits+7)/8
+	hllAlphaInf    = 0.721347520444481703680
+
+	hllDense  = 0
+	hllSparse = 1
+
+	hllSparseValMax   = 32
+	hllSparseValLen   = 4
+	hllSparseZeroLen  = 64
+	hllSparseXZeroLen = 16384
+
+	hllHashSeed = 0xadc83b19
+)
+
+var hllMagic = []byte("HYLL")
+
+var (
+	// ErrHLLInvalid is returned when a string is not a HyperLogLog
+	ErrHLLInvalid = errors.New("not a valid HyperLogLog string value")
+
+	// ErrHLLCorrupted is returned when the registers of a HyperLogLog are corrupted
+	ErrHLLCorrupted = errors.New("corrupted HyperLogLog object")
+)
+
+// HLLSparseMaxBytes is the max bytes of a sparse HyperLogLog, it is converted to dense when exceeded
+var HLLSparseMaxBytes = 3000
+
+// HyperLogLog estimates the cardinality of a set
+type HyperLogLog struct {
+	registers [hllRegisters]uint8
+	sparse    bool
+
+	// card is the cached cardinality which is valid if cardValid is true
+	card      uint64
+	cardValid bool
+}
+
+// NewHyperLogLog creates an empty HyperLogLog in sparse encoding
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{sparse: true, cardValid: true}
+}
+
+// DecodeHyperLogLog decodes a HyperLogLog from the value of a string
+func DecodeHyperLogLog(b []byte) (*HyperLogLog, error) {
+	if len(b) < hllHeaderSize || string(b[:4]) != string(hllMagic) {
+		return nil, ErrHLLInvalid
+	}
+	h := &HyperLogLog{}
+	switch b[4] {
+	case hllDense:
+		if len(b) != hllDenseSize {
+			return nil, ErrHLLInvalid
+		}
+		for i := range h.registers {
+			h.registers[i] = denseGet(b[hllHeaderSize:], i)
+		}
+	case hllSparse:
+		h.sparse = true
+		if err := h.decodeSparse(b[hllHeaderSize:]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrHLLInvalid
+	}
+	if b[15]&(1<<7) == 0 {
+		h.card = binary.LittleEndian.Uint64(b[8:16])
+		h.cardValid = true
+	}
+	return h, nil
+}
+
+func (h *HyperLogLog) decodeSparse(p []byte) error {
+	idx := 0
+	for i := 0; i < len(p); i++ {
+		var runlen int
+		var val uint8
+		switch {
+		case p[i]&0xc0 == 0x00: // ZERO
+			runlen = int(p[i]&0x3f) + 1
+		case p[i]&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return ErrHLLCorrupted
+			}
+			runlen = (int(p[i]&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default: // VAL
+			runlen = int(p[i]&0x3) + 1
+			val = (p[i]>>2)&0x1f + 1
+		}
+		if idx+runlen > hllRegisters {
+			return ErrHLLCorrupted
+		}
+		for j := 0; j < runlen; j++ {
+			h.registers[idx+j] = val
+		}
+		idx += runlen
+	}
+	if idx != hllRegisters {
+		return ErrHLLCorrupted
+	}
+	return nil
+}
+
+// denseGet returns the register at index i of the dense registers p
+func denseGet(p []byte, i int) uint8 {
+	pos := i * hllBits
+	b, fb := pos/8, uint(pos&7)
+	v := p[b] >> fb
+	if b+1 < len(p) {
+		v |= p[b+1] << (8 - fb)
+	}
+	return v & hllRegisterMax
+}
+
+// denseSet sets the register at index i of the dense registers p
+func denseSet(p []byte, i int, val uint8) {
+	pos := i * hllBits
+	b, fb := pos/8, uint(pos&7)
+	p[b] &^= hllRegisterMax << fb
+	p[b] |= val << fb
+	if b+1 < len(p) {
+		p[b+1] &^= hllRegisterMax >> (8 - fb)
+		p[b+1] |= val >> (8 - fb)
+	}
+}
+
+// Add adds an element and returns true if any register is changed
+func (h *HyperLogLog) Add(element []byte) bool {
+	hash := murmurHash64A(element, hllHashSeed)
+	index := hash & hllPMask
+	// the count of the trailing zeros plus one, a bit is set at position Q
+	// to make sure the loop terminates
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	if h.registers[index] >= count {
+		return false
+	}
+	h.registers[index] = count
+	h.cardValid = false
+	return true
+}
+
+// Merge merges other into h, h turns to be dense if other is dense
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i := range h.registers {
+		if other.registers[i] > h.registers[i] {
+			h.registers[i] = other.registers[i]
+			h.cardValid = false
+		}
+	}
+	if !other.sparse {
+		h.sparse = false
+	}
+}
+
+// Count returns the estimated cardinality with the estimator used by redis,
+// see "New cardinality estimation algorithms for HyperLogLog sketches" by Otmar Ertl
+func (h *HyperLogLog) Count() uint64 {
+	if h.cardValid {
+		return h.card
+	}
+	var histogram [hllQ + 2]int
+	for _, v := range h.registers {
+		histogram[v]++
+	}
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histogram[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	h.card = uint64(math.Round(hllAlphaInf * m * m / z))
+	h.cardValid = true
+	return h.card
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// Encode encodes the HyperLogLog, the sparse encoding is kept until a register
+// exceeds the max value of the sparse encoding or the size exceeds HLLSparseMaxBytes
+func (h *HyperLogLog) Encode() []byte {
+	if h.sparse {
+		if b, ok := h.encodeSparse(); ok && len(b) <= HLLSparseMaxBytes {
+			return b
+		}
+		h.sparse = false
+	}
+	b := h.header(hllDense, hllDenseSize)
+	for i, v := range h.registers {
+		denseSet(b[hllHeaderSize:], i, v)
+	}
+	return b
+}
+
+func (h *HyperLogLog) header(encoding byte, size int) []byte {
+	b := make([]byte, hllHeaderSize, size)
+	copy(b, hllMagic)
+	b[4] = encoding
+	if h.cardValid {
+		binary.LittleEndian.PutUint64(b[8:16], h.card)
+	} else {
+		b[15] |= 1 << 7
+	}
+	return b[:size]
+}
+
+func (h *HyperLogLog) encodeSparse() ([]byte, bool) {
+	b := h.header(hllSparse, hllHeaderSize)
+	for i := 0; i < hllRegisters; {
+		v := h.registers[i]
+		if v > hllSparseValMax {
+			return nil, false
+		}
+		runlen := 1
+		for i+runlen < hllRegisters && h.registers[i+runlen] == v {
+			runlen++
+		}
+		i += runlen
+
+		for runlen > 0 {
+			n := runlen
+			switch {
+			case v != 0:
+				if n > hllSparseValLen {
+					n = hllSparseValLen
+				}
+				b = append(b, 0x80|(v-1)<<2|byte(n-1))
+			case n > hllSparseZeroLen:
+				if n > hllSparseXZeroLen {
+					n = hllSparseXZeroLen
+				}
+				b = append(b, 0x40|byte((n-1)>>8), byte(n-1))
+			default:
+				b = append(b, byte(n-1))
+			}
+			runlen -= n
+		}
+	}
+	return b, true
+}
+
+// murmurHash64A is the 64 bits murmur hash used by redis, it reads the data
+// in little endian regardless of the endianness of the machine
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(data)) * m)
+
+	n := len(data) - len(data)&7
+	for i := 0; i < n; i += 8 {
+		k := binary.LittleEndian.Uint64(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+
+	tail := data[n:]
+	if len(tail) > 0 {
+		for i := len(tail) - 1; i >= 0; i-- {
+			h ^= uint64(tail[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLogEncoding(t *testing.T) {
+	h := NewHyperLogLog()
+	b := h.Encode()
+	// an empty HyperLogLog is a single XZERO covering all the registers
+	assert.Equal(t, append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xff), b)
+	assert.Equal(t, uint64(0), h.Count())
+
+	assert.True(t, h.Add([]byte("a")))
+	assert.False(t, h.Add([]byte("a")))
+	b = h.Encode()
+	assert.Equal(t, byte(1<<7), b[15]&(1<<7))
+	decoded, err := DecodeHyperLogLog(b)
+	assert.NoError(t, err)
+	assert.True(t, decoded.sparse)
+	assert.Equal(t, h.registers, decoded.registers)
+	assert.Equal(t, uint64(1), decoded.Count())
+
+	// it turns to be dense when the sparse encoding is too large
+	for i := 0; i < 5000; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+	b = h.Encode()
+	assert.Len(t, b, hllDenseSize)
+	assert.Equal(t, byte(hllDense), b[4])
+	decoded, err = DecodeHyperLogLog(b)
+	assert.NoError(t, err)
+	assert.False(t, decoded.sparse)
+	assert.Equal(t, h.registers, decoded.registers)
+
+	// the cached cardinality is encoded once counted
+	count := h.Count()
+	decoded, err = DecodeHyperLogLog(h.Encode())
+	assert.NoError(t, err)
+	assert.True(t, decoded.cardValid)
+	assert.Equal(t, count, decoded.card)
+
+	_, err = DecodeHyperLogLog([]byte("HYLL"))
+	assert.Equal(t, ErrHLLInvalid, err)
+	_, err = DecodeHyperLogLog(b[:hllDenseSize-1])
+	assert.Equal(t, ErrHLLInvalid, err)
+	_, err = DecodeHyperLogLog(append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f))
+	assert.Equal(t, ErrHLLCorrupted, err)
+	_, err = DecodeHyperLogLog(append([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), 0x7f, 0xfe))
+	assert.Equal(t, ErrHLLCorrupted, err)
+}
+
+func TestHyperLogLogCount(t *testing.T) {
+	h := NewHyperLogLog()
+	other := NewHyperLogLog()
+	for i := 1; i <= 100000; i++ {
+		h.Add([]byte(strconv.Itoa(i)))
+		if i%2 == 0 {
+			other.Add([]byte(strconv.Itoa(-i)))
+		}
+		if i == 10 {
+			assert.Equal(t, uint64(10), h.Count())
+		}
+	}
+	assert.InDelta(t, 100000, float64(h.Count()), 100000*0.02)
+
+	h.Merge(other)
+	assert.False(t, h.cardValid)
+	assert.InDelta(t, 150000, float64(h.Count()), 150000*0.02)
+}
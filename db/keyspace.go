@@ -0,0 +1,544 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"time"
+
+	sdk_kv "github.com/pingcap/tidb/kv"
+	"go.uber.org/zap"
+
+	"github.com/distributedio/titan/conf"
+	"github.com/distributedio/titan/db/store"
+)
+
+var (
+	// $sys:0:DBM:{namespace}
+	// the logical dbs of a namespace are mapped to the physical ones which prefix the keys,
+	// so swapping two dbs only rewrites the map. The ids are the same if the map does not exist.
+	// $sys:0:DBM:{namespace}[shard] are the copies of the map, a write transaction locks one of
+	// them so it conflicts with the swaps made after it began
+	dbMapKeyPrefix = []byte("$sys:0:DBM:")
+
+	// $sys:0:KC:{namespace}:{db}:[shard]
+	// the counters of the keys of a physical db, the one without shard is the base built by
+	// the background task scanning the db, and the shards accumulate the changes of transactions
+	keyCountPrefix = []byte("$sys:0:KC:")
+
+	sysKeyCountLeader = []byte("$sys:0:KCL:KCLeader")
+)
+
+const (
+	// keyCountShards spreads the changes of the counters so concurrent transactions rarely conflict
+	keyCountShards = 32
+
+	// dbMapShards spreads the locks of the write transactions on the copies of the db map
+	dbMapShards = 32
+)
+
+// DBStat is the number of keys of a db
+type DBStat struct {
+	ID      DBID
+	Keys    int64
+	Expires int64
+}
+
+func dbMapKey(namespace string) []byte {
+	return append(append([]byte{}, dbMapKeyPrefix...), namespace...)
+}
+
+func dbMapShardKey(namespace string, shard int) []byte {
+	return append(dbMapKey(namespace), byte(shard))
+}
+
+// toKeyCountKey returns the key of the counters of a db by its prefix
+func toKeyCountKey(prefix []byte) []byte {
+	return append(append([]byte{}, keyCountPrefix...), prefix...)
+}
+
+// loadDBMap returns the map of the logical dbs to the physical ones of the namespace,
+// nil is returned if the dbs have never been swapped
+func loadDBMap(txn *Transaction, namespace string) ([]byte, error) {
+	val, err := txn.t.Get(txn.ctx, dbMapKey(namespace))
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(val) != 256 {
+		return nil, ErrInvalidLength
+	}
+	return val, nil
+}
+
+// physical returns the id of the physical db which stores the logical db of id
+func (txn *Transaction) physical(id DBID) DBID {
+	if txn.dbmap == nil {
+		return id
+	}
+	return DBID(txn.dbmap[id])
+}
+
+// logical returns the id of the logical db which is stored in the physical db of id
+func (txn *Transaction) logical(id DBID) DBID {
+	if txn.dbmap == nil {
+		return id
+	}
+	return DBID(bytes.IndexByte(txn.dbmap, byte(id)))
+}
+
+// SwapDB swaps the logical dbs a and b of the namespace, the transaction keeps working on
+// the db it began with
+func (kv *Kv) SwapDB(a, b DBID) error {
+	m := make([]byte, 256)
+	for i := range m {
+		m[i] = byte(kv.txn.physical(DBID(i)))
+	}
+	m[a], m[b] = m[b], m[a]
+	kv.txn.dbmap = m
+
+	identity := true
+	for i := range m {
+		if m[i] != byte(i) {
+			identity = false
+			break
+		}
+	}
+	keys := [][]byte{dbMapKey(kv.txn.db.Namespace)}
+	for i := 0; i < dbMapShards; i++ {
+		keys = append(keys, dbMapShardKey(kv.txn.db.Namespace, i))
+	}
+	for _, key := range keys {
+		var err error
+		if identity {
+			err = kv.txn.t.Delete(key)
+		} else {
+			err = kv.txn.t.Set(key, m)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DBSize returns the number of keys and the number of keys with a timeout in the db, the
+// expired keys not deleted yet are included like redis does. The metas are counted until
+// the base of the counters is built by the background task
+func (kv *Kv) DBSize() (int64, int64, error) {
+	keys, expires, built, err := readKeyCount(kv.txn.t, toKeyCountKey(kv.txn.db.Prefix()))
+	if err != nil || built {
+		return keys, expires, err
+	}
+	return countMetas(kv.txn.t, MetaKey(kv.txn.db, nil))
+}
+
+// DBStats returns the number of keys of the dbs of the namespace which have keys
+func (kv *Kv) DBStats() ([]DBStat, error) {
+	prefix := toKeyCountKey(dbPrefix(kv.txn.db.Namespace, nil))
+	iter, err := kv.txn.t.Iter(prefix, sdk_kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	// collect the physical dbs which have counters
+	var ids []DBID
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		id := iter.Key()[len(prefix):]
+		if len(id) >= 4 && id[3] == ':' {
+			if phy := toDBID(id[:3]); len(ids) == 0 || ids[len(ids)-1] != phy {
+				ids = append(ids, phy)
+			}
+		}
+		if err := iter.Next(); err != nil {
+			return nil, err
+		}
+	}
+
+	var stats []DBStat
+	for _, phy := range ids {
+		// the kv on the logical db stored in the physical one
+		dbkv := kv.txn.in(kv.txn.logical(phy)).Kv()
+		keys, expires, err := dbkv.DBSize()
+		if err != nil {
+			return nil, err
+		}
+		if keys > 0 {
+			stats = append(stats, DBStat{ID: kv.txn.logical(phy), Keys: keys, Expires: expires})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats, nil
+}
+
+// readKeyCount sums up the counters of a db, built is false if the base does not exist
+func readKeyCount(txn store.Transaction, prefix []byte) (keys int64, expires int64, built bool, err error) {
+	iter, err := txn.Iter(prefix, sdk_kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer iter.Close()
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		// the counters of other namespaces may share the prefix
+		switch len(iter.Key()) - len(prefix) {
+		case 0:
+			built = true
+			fallthrough
+		case 1:
+			k, e := decodeKeyCount(iter.Value())
+			keys, expires = keys+k, expires+e
+		}
+		if err := iter.Next(); err != nil {
+			return 0, 0, false, err
+		}
+	}
+	return keys, expires, built, nil
+}
+
+// countMetas counts the metas with the prefix and the ones with a timeout
+func countMetas(txn store.Transaction, prefix []byte) (int64, int64, error) {
+	iter, err := txn.Iter(prefix, sdk_kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer iter.Close()
+
+	var keys, expires int64
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		keys++
+		if hasExpire(iter.Value()) {
+			expires++
+		}
+		if err := iter.Next(); err != nil {
+			return 0, 0, err
+		}
+	}
+	return keys, expires, nil
+}
+
+// StartKeyCount builds the base of the key counters of the dbs in background
+func StartKeyCount(task *Task) {
+	conf := task.conf.(conf.KeyCount)
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-task.session.Done():
+			if logEnv := zap.L().Check(zap.DebugLevel, "[KeyCount] current is not key count leader"); logEnv != nil {
+				logEnv.Write(zap.ByteString("key", task.key),
+					zap.ByteString("uuid", task.id),
+					zap.String("label", task.label))
+			}
+			return
+		case <-ticker.C:
+		}
+		if err := buildKeyCounts(task.db); err != nil {
+			zap.L().Error("[KeyCount] build key counters failed", zap.Error(err))
+		}
+	}
+}
+
+// buildKeyCounts builds the base of the counters of the dbs which have keys but no base, they are
+// the dbs flushed or created before the counters
+func buildKeyCounts(db *DB) error {
+	txn, err := db.kv.Begin()
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+	store.SetOption(txn, store.Priority, store.PriorityLow)
+
+	var start []byte
+	for {
+		prefix, err := nextDBPrefix(txn, start)
+		if err != nil || prefix == nil {
+			return err
+		}
+		start = sdk_kv.Key(prefix).PrefixNext()
+		if _, err := txn.Get(context.Background(), toKeyCountKey(prefix)); !IsErrNotFound(err) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := buildKeyCount(db, prefix); err != nil {
+			return err
+		}
+	}
+}
+
+// buildKeyCount scans the metas of the db to build the base of the counters, the changes in
+// the shards have been counted by the scan so they are subtracted from the base
+func buildKeyCount(db *DB, prefix []byte) error {
+	txn, err := db.kv.Begin()
+	if err != nil {
+		return err
+	}
+	store.SetOption(txn, store.Priority, store.PriorityLow)
+	kcKey := toKeyCountKey(prefix)
+	shardKeys, shardExpires, built, err := readKeyCount(txn, kcKey)
+	if err != nil || built {
+		txn.Rollback()
+		return err
+	}
+	keys, expires, err := countMetas(txn, append(append([]byte{}, prefix...), 'M', ':'))
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+	if err := txn.Set(kcKey, encodeKeyCount(keys-shardKeys, expires-shardExpires)); err != nil {
+		txn.Rollback()
+		return err
+	}
+	if err := txn.Commit(context.Background()); err != nil {
+		return err
+	}
+	zap.L().Info("[KeyCount] key counters built", zap.ByteString("db", prefix),
+		zap.Int64("keys", keys), zap.Int64("expires", expires))
+	return nil
+}
+
+// nextDBPrefix returns the prefix {namespace}:{db}: of the first db having keys from start on, the
+// dbs are found by seeking from one to the next so the keys in them are not scanned
+func nextDBPrefix(txn store.Transaction, start []byte) ([]byte, error) {
+	for {
+		iter, err := txn.Iter(start, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !iter.Valid() {
+			iter.Close()
+			return nil, nil
+		}
+		key := append([]byte{}, iter.Key()...)
+		iter.Close()
+
+		idx := bytes.IndexByte(key, ':')
+		switch {
+		case idx < 0:
+			start = sdk_kv.Key(key).Next()
+		case string(key[:idx]) == sysNamespace || !isDBPrefix(key[idx:]):
+			// skip the namespace
+			start = sdk_kv.Key(key[:idx+1]).PrefixNext()
+		default:
+			return key[:idx+5], nil
+		}
+	}
+}
+
+// metaTxn records the metas read and written through a transaction, so the changes of the
+// key counters are known at commit without reading the metas again
+type metaTxn struct {
+	store.Transaction
+	metas map[string]*metaChange
+}
+
+// metaChange is a meta written by a transaction, old is unknown if it is written without being
+// read through the transaction
+type metaChange struct {
+	old     []byte
+	known   bool
+	written bool
+	exists  bool
+	expires bool
+}
+
+// Get reads a key and records the meta
+func (t *metaTxn) Get(ctx context.Context, k sdk_kv.Key) ([]byte, error) {
+	val, err := t.Transaction.Get(ctx, k)
+	if err == nil || IsErrNotFound(err) {
+		t.read(k, val)
+	}
+	return val, err
+}
+
+// BatchGet reads the keys and records the metas
+func (t *metaTxn) BatchGet(ctx context.Context, keys []sdk_kv.Key) (map[string][]byte, error) {
+	vals, err := t.Transaction.BatchGet(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		t.read(k, vals[string(k)])
+	}
+	return vals, nil
+}
+
+// Set writes a key and records the meta
+func (t *metaTxn) Set(k sdk_kv.Key, v []byte) error {
+	if err := t.Transaction.Set(k, v); err != nil {
+		return err
+	}
+	t.write(k, v)
+	return nil
+}
+
+// Delete removes a key and records the meta
+func (t *metaTxn) Delete(k sdk_kv.Key) error {
+	if err := t.Transaction.Delete(k); err != nil {
+		return err
+	}
+	t.write(k, nil)
+	return nil
+}
+
+// read records the meta before the transaction changes it
+func (t *metaTxn) read(k sdk_kv.Key, val []byte) {
+	if !isMetaKey(k) {
+		return
+	}
+	if _, ok := t.metas[string(k)]; !ok {
+		t.metas[string(k)] = &metaChange{old: val, known: true}
+	}
+}
+
+func (t *metaTxn) write(k sdk_kv.Key, val []byte) {
+	if !isMetaKey(k) {
+		return
+	}
+	c, ok := t.metas[string(k)]
+	if !ok {
+		c = &metaChange{}
+		t.metas[string(k)] = c
+	}
+	c.written = true
+	c.exists = len(val) > 0
+	c.expires = c.exists && hasExpire(val)
+}
+
+// countKeys updates the counters of the dbs whose keys are created or deleted by the transaction,
+// and locks a copy of the db map so the transaction conflicts with the swaps committed after it began
+func (txn *Transaction) countKeys() error {
+	if txn.t.IsReadOnly() {
+		return nil
+	}
+	if txn.db.Namespace != sysNamespace {
+		if err := txn.LockKeys(dbMapShardKey(txn.db.Namespace, rand.Intn(dbMapShards))); err != nil {
+			return err
+		}
+	}
+
+	// the metas written without being read are read in the snapshot, a change of them made
+	// after the transaction began conflicts with the write
+	var unknown []sdk_kv.Key
+	for mkey, m := range txn.metas {
+		if m.written && !m.known {
+			unknown = append(unknown, sdk_kv.Key(mkey))
+		}
+	}
+	var olds map[string][]byte
+	if len(unknown) > 0 {
+		var err error
+		if olds, err = txn.t.GetSnapshot().BatchGet(txn.ctx, unknown); err != nil {
+			return err
+		}
+	}
+
+	// the changes are grouped by the db
+	type change struct {
+		keys    int64
+		expires int64
+	}
+	changes := make(map[string]*change)
+	for mkey, m := range txn.metas {
+		if !m.written {
+			continue
+		}
+		ns, id, _ := splitMetaKey([]byte(mkey))
+		prefix := string(dbPrefix(string(ns), id.Bytes()))
+		c := changes[prefix]
+		if c == nil {
+			c = &change{}
+			changes[prefix] = c
+		}
+		old := m.old
+		if !m.known {
+			old = olds[mkey]
+		}
+		if len(old) > 0 {
+			c.keys--
+			if hasExpire(old) {
+				c.expires--
+			}
+		}
+		if m.exists {
+			c.keys++
+			if m.expires {
+				c.expires++
+			}
+		}
+	}
+
+	// only the dbs whose keys are created or deleted write a shard of their counters, so the
+	// transactions updating the keys never touch the counters
+	var keys []sdk_kv.Key
+	var deltas []*change
+	for prefix, c := range changes {
+		if c.keys == 0 && c.expires == 0 {
+			continue
+		}
+		keys = append(keys, append(toKeyCountKey([]byte(prefix)), byte(rand.Intn(keyCountShards))))
+		deltas = append(deltas, c)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	vals, err := txn.t.GetSnapshot().BatchGet(txn.ctx, keys)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		n, e := decodeKeyCount(vals[string(key)])
+		if err := txn.t.Set(key, encodeKeyCount(n+deltas[i].keys, e+deltas[i].expires)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMetaKey checks if the key looks like {namespace}:{db}:M:{key}
+func isMetaKey(key []byte) bool {
+	idx := bytes.IndexByte(key, ':')
+	if idx < 0 || !isDBPrefix(key[idx:]) || len(key) < idx+7 {
+		return false
+	}
+	return bytes.Equal(key[idx+4:idx+7], []byte(":M:"))
+}
+
+// isDBPrefix checks if the key after the namespace starts with :{db}:
+func isDBPrefix(key []byte) bool {
+	if len(key) < 5 || key[0] != ':' || key[4] != ':' {
+		return false
+	}
+	for _, c := range key[1:4] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasExpire checks if a raw meta has a timeout
+func hasExpire(meta []byte) bool {
+	obj, err := DecodeObject(meta)
+	return err == nil && obj.ExpireAt > 0
+}
+
+func encodeKeyCount(keys, expires int64) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, uint64(keys))
+	binary.BigEndian.PutUint64(b[8:], uint64(expires))
+	return b
+}
+
+func decodeKeyCount(b []byte) (int64, int64) {
+	if len(b) != 16 {
+		return 0, 0
+	}
+	return int64(binary.BigEndian.Uint64(b)), int64(binary.BigEndian.Uint64(b[8:]))
+}
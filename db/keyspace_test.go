@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBSize(t *testing.T) {
+	db := MockDB()
+	run := func(f func(txn *Transaction)) {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		f(txn)
+		assert.NoError(t, txn.Commit(context.Background()))
+	}
+	size := func() (int64, int64) {
+		var keys, expires int64
+		run(func(txn *Transaction) {
+			var err error
+			keys, expires, err = txn.Kv().DBSize()
+			assert.NoError(t, err)
+		})
+		return keys, expires
+	}
+
+	SetVal(t, db, []byte("keyspace-a"), []byte("val"))
+	SetVal(t, db, []byte("keyspace-b"), []byte("val"))
+	run(func(txn *Transaction) {
+		assert.NoError(t, txn.Kv().ExpireAt([]byte("keyspace-b"), time.Now().Add(time.Hour).UnixNano()))
+	})
+	keys, expires := size()
+	assert.Equal(t, int64(2), keys)
+	assert.Equal(t, int64(1), expires)
+
+	// overwriting a key does not write the counters
+	counters := func() map[string][]byte {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		defer txn.Rollback()
+		prefix := toKeyCountKey(db.Prefix())
+		iter, err := txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+		assert.NoError(t, err)
+		defer iter.Close()
+		vals := make(map[string][]byte)
+		for ; iter.Valid() && iter.Key().HasPrefix(prefix); assert.NoError(t, iter.Next()) {
+			vals[string(iter.Key())] = iter.Value()
+		}
+		return vals
+	}
+	before := counters()
+	SetVal(t, db, []byte("keyspace-a"), []byte("new"))
+	assert.Equal(t, before, counters())
+	SetVal(t, db, []byte("keyspace-c"), []byte("val"))
+	run(func(txn *Transaction) {
+		n, err := txn.Kv().Delete([][]byte{[]byte("keyspace-b")})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+	})
+	keys, expires = size()
+	assert.Equal(t, int64(2), keys)
+	assert.Equal(t, int64(0), expires)
+
+	// the metas written without being read are read at commit
+	run(func(txn *Transaction) {
+		assert.NoError(t, txn.t.Delete(MetaKey(txn.db, []byte("keyspace-c"))))
+	})
+	keys, _ = size()
+	assert.Equal(t, int64(1), keys)
+	SetVal(t, db, []byte("keyspace-c"), []byte("val"))
+
+	// the metas are counted until the base is built in background
+	run(func(txn *Transaction) {
+		assert.NoError(t, txn.t.Delete(toKeyCountKey(db.Prefix())))
+	})
+	SetVal(t, db, []byte("keyspace-d"), []byte("val"))
+	keys, expires = size()
+	assert.Equal(t, int64(3), keys)
+	assert.Equal(t, int64(0), expires)
+	assert.NoError(t, buildKeyCounts(db))
+	run(func(txn *Transaction) {
+		keys, _, built, err := readKeyCount(txn.t, toKeyCountKey(db.Prefix()))
+		assert.NoError(t, err)
+		assert.True(t, built)
+		assert.Equal(t, int64(3), keys)
+	})
+	SetVal(t, db, []byte("keyspace-e"), []byte("val"))
+	keys, _ = size()
+	assert.Equal(t, int64(4), keys)
+}
+
+func TestNextDBPrefix(t *testing.T) {
+	db := MockDB()
+	other := db.kv.DB("keyspace-next", 7)
+	SetVal(t, db, []byte("keyspace-next"), []byte("val"))
+	SetVal(t, other, []byte("keyspace-next"), []byte("val"))
+
+	txn, err := db.kv.Begin()
+	assert.NoError(t, err)
+	defer txn.Rollback()
+	var prefixes []string
+	var start []byte
+	for {
+		prefix, err := nextDBPrefix(txn, start)
+		assert.NoError(t, err)
+		if prefix == nil {
+			break
+		}
+		prefixes = append(prefixes, string(prefix))
+		start = kv.Key(prefix).PrefixNext()
+	}
+	// the keys of the sys namespace are skipped
+	assert.Contains(t, prefixes, string(db.Prefix()))
+	assert.Contains(t, prefixes, string(other.Prefix()))
+	for _, prefix := range prefixes {
+		assert.False(t, strings.HasPrefix(prefix, sysNamespace+":"), prefix)
+	}
+}
+
+func TestSwapDB(t *testing.T) {
+	db := MockDB()
+	other := db.kv.DB(db.Namespace, 2)
+	key := []byte("keyspace-swap")
+	SetVal(t, db, key, []byte("val"))
+
+	swap := func() {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, txn.Kv().SwapDB(db.ID, other.ID))
+		assert.NoError(t, txn.Commit(context.Background()))
+	}
+	exists := func(db *DB) bool {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		defer txn.Commit(context.Background())
+		_, err = txn.Object(key)
+		return err == nil
+	}
+	stats := func() []DBStat {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		stats, err := txn.Kv().DBStats()
+		assert.NoError(t, err)
+		assert.NoError(t, txn.Commit(context.Background()))
+		return stats
+	}
+
+	assert.Equal(t, []DBStat{{ID: db.ID, Keys: 1}}, stats())
+
+	swap()
+	assert.False(t, exists(db))
+	assert.True(t, exists(other))
+	assert.Equal(t, []DBStat{{ID: other.ID, Keys: 1}}, stats())
+
+	// the writes go to the physical db of the logical one
+	SetVal(t, db, []byte("keyspace-swap-new"), []byte("val"))
+	assert.Equal(t, []DBStat{{ID: db.ID, Keys: 1}, {ID: other.ID, Keys: 1}}, stats())
+
+	// the map is removed once the dbs are back in place
+	swap()
+	assert.True(t, exists(db))
+	txn, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = txn.t.Get(txn.ctx, dbMapKey(db.Namespace))
+	assert.True(t, IsErrNotFound(err))
+	_, err = txn.t.Get(txn.ctx, dbMapShardKey(db.Namespace, 0))
+	assert.True(t, IsErrNotFound(err))
+	assert.NoError(t, txn.Commit(context.Background()))
+}
+
+func TestSwapDBConflicts(t *testing.T) {
+	db := MockDB()
+	other := db.kv.DB(db.Namespace, 3)
+	swap := func(db *DB) {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		assert.NoError(t, txn.Kv().SwapDB(db.ID, other.ID))
+		assert.NoError(t, txn.Commit(context.Background()))
+	}
+	set := func(txn *Transaction) {
+		s, err := txn.String([]byte("keyspace-conflict"))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Set([]byte("val")))
+	}
+
+	// a writer in flight conflicts with the swap
+	txn, err := db.Begin()
+	assert.NoError(t, err)
+	set(txn)
+	swap(db)
+	err = txn.Commit(context.Background())
+	assert.True(t, IsRetryableError(err))
+
+	// the swap made by another instance is seen by the transactions begun after it
+	txn, err = db.Begin()
+	assert.NoError(t, err)
+	assert.Equal(t, other.ID, txn.db.ID)
+	assert.NoError(t, txn.Rollback())
+	remote := &DB{Namespace: db.Namespace, ID: db.ID, kv: &RedisStore{Storage: db.kv.Storage, conf: db.kv.conf}}
+	swap(remote)
+	txn, err = db.Begin()
+	assert.NoError(t, err)
+	assert.Equal(t, db.ID, txn.db.ID)
+	set(txn)
+	assert.NoError(t, txn.Commit(context.Background()))
+}
@@ -97,8 +97,23 @@ func (kv *Kv) Delete(keys [][]byte) (int64, error) {
 	return count, nil
 }
 
-// ExpireAt set a timeout on key
-func (kv *Kv) ExpireAt(key []byte, at int64) error {
+// ExpireFlag is a condition to set the timeout of a key
+type ExpireFlag int
+
+const (
+	// ExpireNX sets the timeout only if the key has no timeout
+	ExpireNX ExpireFlag = 1 << iota
+	// ExpireXX sets the timeout only if the key has a timeout
+	ExpireXX
+	// ExpireGT sets the timeout only if it is greater than the current one, a key without
+	// timeout is regarded as an infinite timeout
+	ExpireGT
+	// ExpireLT sets the timeout only if it is less than the current one
+	ExpireLT
+)
+
+// ExpireAt set a timeout on key, ErrExpireCondition is returned if any of the flags is not met
+func (kv *Kv) ExpireAt(key []byte, at int64, flags ...ExpireFlag) error {
 	mkey := MetaKey(kv.txn.db, key)
 	now := Now()
 
@@ -116,6 +131,14 @@ func (kv *Kv) ExpireAt(key []byte, at int64) error {
 	if IsExpired(obj, now) {
 		return ErrKeyNotFound
 	}
+	for _, flag := range flags {
+		if (flag&ExpireNX != 0 && obj.ExpireAt != 0) ||
+			(flag&ExpireXX != 0 && obj.ExpireAt == 0) ||
+			(flag&ExpireGT != 0 && (obj.ExpireAt == 0 || at <= obj.ExpireAt)) ||
+			(flag&ExpireLT != 0 && obj.ExpireAt != 0 && at >= obj.ExpireAt) {
+			return ErrExpireCondition
+		}
+	}
 	if at == 0 && obj.ExpireAt != 0 {
 		if err = unExpireAt(kv.txn.t, mkey, obj.ExpireAt); err != nil {
 			return err
@@ -244,7 +267,12 @@ func (kv *Kv) RandomKey() ([]byte, error) {
 
 // Touch alters the last access time of a key(s)
 func (kv *Kv) Touch(keys [][]byte) (int64, error) {
-	ts := Now()
+	return kv.TouchAt(keys, Now())
+}
+
+// TouchAt sets the last access time of a key(s) to ts
+func (kv *Kv) TouchAt(keys [][]byte, ts int64) (int64, error) {
+	now := Now()
 	count := int64(0)
 
 	mkeys := make([][]byte, len(keys))
@@ -265,7 +293,7 @@ func (kv *Kv) Touch(keys [][]byte) (int64, error) {
 		if err != nil {
 			return 0, err
 		}
-		if IsExpired(obj, ts) {
+		if IsExpired(obj, now) {
 			continue
 		}
 
@@ -279,6 +307,200 @@ func (kv *Kv) Touch(keys [][]byte) (int64, error) {
 	return count, nil
 }
 
+// Rename renames key to newkey, newkey is overwritten if it exists and nx is false, otherwise
+// false is returned. The object keeps its id so only the meta key and the expiration are
+// rewritten and the data is never touched.
+func (kv *Kv) Rename(key, newkey []byte, nx bool) (bool, error) {
+	obj, meta, err := kv.meta(key)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(key, newkey) {
+		return !nx, nil
+	}
+	if ok, err := kv.prepareTarget(kv.txn, newkey, !nx); !ok || err != nil {
+		return false, err
+	}
+
+	mkey := MetaKey(kv.txn.db, key)
+	newmkey := MetaKey(kv.txn.db, newkey)
+	if err := kv.txn.t.Delete(mkey); err != nil {
+		return false, err
+	}
+	if err := kv.txn.t.Set(newmkey, meta); err != nil {
+		return false, err
+	}
+	if obj.ExpireAt > 0 {
+		if err := unExpireAt(kv.txn.t, mkey, obj.ExpireAt); err != nil {
+			return false, err
+		}
+		if err := expireAt(kv.txn.t, newmkey, obj.ID, obj.Type, 0, obj.ExpireAt); err != nil {
+			return false, err
+		}
+	}
+	if err := kv.copyZT(mkey, newmkey, true); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Move moves key to the db of id, false is returned if the key exists in the target db.
+// The data keys are copied since they are scoped by the db.
+func (kv *Kv) Move(key []byte, id DBID) (bool, error) {
+	obj, meta, err := kv.meta(key)
+	if err != nil {
+		return false, err
+	}
+	target := kv.txn.in(id)
+	if ok, err := kv.prepareTarget(target, key, false); !ok || err != nil {
+		return false, err
+	}
+
+	if err := kv.copyData(target, obj.ID, obj.ID); err != nil {
+		return false, err
+	}
+	mkey := MetaKey(kv.txn.db, key)
+	newmkey := MetaKey(target.db, key)
+	if err := kv.txn.t.Set(newmkey, meta); err != nil {
+		return false, err
+	}
+	if obj.ExpireAt > 0 {
+		if err := expireAt(kv.txn.t, newmkey, obj.ID, obj.Type, 0, obj.ExpireAt); err != nil {
+			return false, err
+		}
+	}
+	if err := kv.copyZT(mkey, newmkey, true); err != nil {
+		return false, err
+	}
+	if err := kv.txn.Destory(obj, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Copy copies key to newkey in the db of id, newkey is overwritten if it exists and replace
+// is true, otherwise false is returned. The copy is a new object with all the data copied.
+func (kv *Kv) Copy(key, newkey []byte, id DBID, replace bool) (bool, error) {
+	obj, meta, err := kv.meta(key)
+	if err != nil {
+		return false, err
+	}
+	target := kv.txn.in(id)
+	if ok, err := kv.prepareTarget(target, newkey, replace); !ok || err != nil {
+		return false, err
+	}
+
+	now := Now()
+	cp := *obj
+	cp.ID = UUID()
+	cp.CreatedAt, cp.UpdatedAt = now, now
+	if err := kv.copyData(target, obj.ID, cp.ID); err != nil {
+		return false, err
+	}
+	mkey := MetaKey(kv.txn.db, key)
+	newmkey := MetaKey(target.db, newkey)
+	if err := kv.txn.t.Set(newmkey, append(EncodeObject(&cp), meta[ObjectEncodingLength:]...)); err != nil {
+		return false, err
+	}
+	if cp.ExpireAt > 0 {
+		if err := expireAt(kv.txn.t, newmkey, cp.ID, cp.Type, 0, cp.ExpireAt); err != nil {
+			return false, err
+		}
+	}
+	if err := kv.copyZT(mkey, newmkey, false); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// meta returns the object and the raw meta of key, ErrKeyNotFound is returned if the key
+// does not exist or is expired
+func (kv *Kv) meta(key []byte) (*Object, []byte, error) {
+	meta, err := kv.txn.t.Get(kv.txn.ctx, MetaKey(kv.txn.db, key))
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil, ErrKeyNotFound
+		}
+		return nil, nil, err
+	}
+	obj, err := DecodeObject(meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	if IsExpired(obj, Now()) {
+		return nil, nil, ErrKeyNotFound
+	}
+	return obj, meta, nil
+}
+
+// prepareTarget destroys key in the db of txn if it exists and replace is true,
+// false is returned if the key exists and can not be replaced
+func (kv *Kv) prepareTarget(txn *Transaction, key []byte, replace bool) (bool, error) {
+	obj, err := txn.Object(key)
+	if err == ErrKeyNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !replace {
+		return false, nil
+	}
+	return true, txn.Destory(obj, key)
+}
+
+// copyDataLimit is the max number of the data keys copied by MOVE or COPY, the data keys are
+// written in the transaction so a larger object is rejected rather than exceeding the size
+// limit of a transaction
+var copyDataLimit = 65536
+
+// copyData copies the data keys of the object id to the object newid in the db of target,
+// ErrCopyTooLarge is returned if the object has more than copyDataLimit data keys
+func (kv *Kv) copyData(target *Transaction, id, newid []byte) error {
+	prefix := DataKey(kv.txn.db, id)
+	iter, err := kv.txn.t.Iter(prefix, sdk_kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	// the data keys are collected before writing so the iterator is never invalidated
+	var keys, values [][]byte
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		if len(keys) >= copyDataLimit {
+			return ErrCopyTooLarge
+		}
+		keys = append(keys, append(DataKey(target.db, newid), iter.Key()[len(prefix):]...))
+		values = append(values, iter.Value())
+		if err := iter.Next(); err != nil {
+			return err
+		}
+	}
+	for i := range keys {
+		if err := kv.txn.t.Set(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyZT copies the ZT record of a ziplist from mkey to newmkey, the original record is removed if move is true
+func (kv *Kv) copyZT(mkey, newmkey []byte, move bool) error {
+	if _, err := kv.txn.t.Get(kv.txn.ctx, toZTKey(mkey)); err != nil {
+		if IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if err := PutZList(kv.txn, newmkey); err != nil {
+		return err
+	}
+	if move {
+		return RemoveZTKey(kv.txn, mkey)
+	}
+	return nil
+}
+
 //clear system range data(GC/ZT)
 func clearSysRangeData(ctx context.Context, db *DB, startKey, endKey []byte) error {
 	gcStart := toTiKVGCKey(startKey)
@@ -291,6 +513,16 @@ func clearSysRangeData(ctx context.Context, db *DB, startKey, endKey []byte) err
 		return err
 	}
 
+	kcStart := toKeyCountKey(startKey)
+	kcEnd := toKeyCountKey(endKey)
+	if err := unsafeDeleteRange(ctx, db, kcStart, kcEnd); err != nil {
+		zap.L().Error("[KeyCount] unsafe clear err",
+			zap.ByteString("start", kcStart),
+			zap.ByteString("end", kcEnd),
+			zap.Error(err))
+		return err
+	}
+
 	ztStart := toZTKey(startKey)
 	ztEnd := toZTKey(endKey)
 	if err := unsafeDeleteRange(ctx, db, ztStart, ztEnd); err != nil {
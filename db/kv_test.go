@@ -90,6 +90,33 @@ func TestExpireAt(t *testing.T) {
 
 }
 
+func TestExpireAtFlags(t *testing.T) {
+	db := MockDB()
+	key := []byte("key-ex-flags")
+	SetVal(t, db, key, []byte("val"))
+	now := Now()
+	at := now + int64(100*time.Second)
+
+	// expire sets the timeout and checks the result
+	expire := func(at int64, want error, flags ...ExpireFlag) {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		assert.Equal(t, want, txn.Kv().ExpireAt(key, at, flags...))
+		assert.NoError(t, txn.Commit(context.Background()))
+	}
+	expire(at, ErrExpireCondition, ExpireXX)
+	expire(at, ErrExpireCondition, ExpireGT)
+	expire(at, nil, ExpireLT)
+	EqualExpireAt(t, db, key, at)
+	expire(at+1, ErrExpireCondition, ExpireNX)
+	expire(at, ErrExpireCondition, ExpireGT)
+	expire(at+1, ErrExpireCondition, ExpireXX|ExpireLT)
+	expire(at+1, nil, ExpireXX|ExpireGT)
+	EqualExpireAt(t, db, key, at+1)
+	expire(at-1, nil, ExpireLT)
+	EqualExpireAt(t, db, key, at-1)
+}
+
 func TestKeys(t *testing.T) {
 	list := [][]byte{
 		[]byte("keys"),
@@ -151,3 +178,150 @@ func TestRandomKey(t *testing.T) {
 	}
 	// assert.NotEqual(t, 1, len(mapkey))
 }
+
+func TestRenameMoveCopy(t *testing.T) {
+	db := MockDB()
+	other := db.kv.DB(db.Namespace, 2)
+	key, newkey := []byte("kv-rename-key"), []byte("kv-rename-newkey")
+	at := time.Now().Add(time.Hour).UnixNano()
+
+	run := func(f func(txn *Transaction)) {
+		txn, err := db.Begin()
+		assert.NoError(t, err)
+		f(txn)
+		assert.NoError(t, txn.Commit(context.Background()))
+	}
+	fields := func(txn *Transaction, key []byte) [][]byte {
+		hash, err := GetHash(txn, key)
+		assert.NoError(t, err)
+		fields, _, err := hash.HGetAll()
+		assert.NoError(t, err)
+		return fields
+	}
+	expireID := func(txn *Transaction, db *DB, key []byte) []byte {
+		ekey, err := expireKey(MetaKey(db, key), at)
+		assert.NoError(t, err)
+		id, err := txn.t.Get(txn.ctx, ekey)
+		if IsErrNotFound(err) {
+			return nil
+		}
+		assert.NoError(t, err)
+		return id
+	}
+
+	var id []byte
+	run(func(txn *Transaction) {
+		hash, err := GetHash(txn, key)
+		assert.NoError(t, err)
+		_, err = hash.HSet([]byte("f1"), []byte("v1"))
+		assert.NoError(t, err)
+		assert.NoError(t, txn.Kv().ExpireAt(key, at))
+	})
+	SetVal(t, db, newkey, []byte("val"))
+
+	// the object keeps its id and data
+	run(func(txn *Transaction) {
+		obj, err := txn.Object(key)
+		assert.NoError(t, err)
+		id = obj.ID
+		ok, err := txn.Kv().Rename(key, newkey, true)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = txn.Kv().Rename(key, newkey, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+	run(func(txn *Transaction) {
+		_, err := txn.Object(key)
+		assert.Equal(t, ErrKeyNotFound, err)
+		obj, err := txn.Object(newkey)
+		assert.NoError(t, err)
+		assert.Equal(t, id, obj.ID)
+		assert.Equal(t, at, obj.ExpireAt)
+		assert.Equal(t, [][]byte{[]byte("f1")}, fields(txn, newkey))
+		assert.Nil(t, expireID(txn, db, key))
+		assert.Equal(t, id, expireID(txn, db, newkey))
+
+		_, err = txn.Kv().Rename(key, newkey, false)
+		assert.Equal(t, ErrKeyNotFound, err)
+	})
+
+	// the copy is a new object
+	run(func(txn *Transaction) {
+		ok, err := txn.Kv().Copy(newkey, key, db.ID, false)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = txn.Kv().Copy(newkey, key, db.ID, false)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+	run(func(txn *Transaction) {
+		obj, err := txn.Object(key)
+		assert.NoError(t, err)
+		assert.NotEqual(t, id, obj.ID)
+		assert.Equal(t, obj.ID, expireID(txn, db, key))
+		assert.Equal(t, [][]byte{[]byte("f1")}, fields(txn, key))
+		hash, err := GetHash(txn, key)
+		assert.NoError(t, err)
+		_, err = hash.HSet([]byte("f2"), []byte("v2"))
+		assert.NoError(t, err)
+		// the original is not changed
+		assert.Equal(t, [][]byte{[]byte("f1")}, fields(txn, newkey))
+	})
+
+	// the object is moved with its data to the other db
+	run(func(txn *Transaction) {
+		ok, err := txn.Kv().Move(newkey, other.ID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+	run(func(txn *Transaction) {
+		_, err := txn.Object(newkey)
+		assert.Equal(t, ErrKeyNotFound, err)
+		assert.Nil(t, expireID(txn, db, newkey))
+
+		txn = txn.in(other.ID)
+		obj, err := txn.Object(newkey)
+		assert.NoError(t, err)
+		assert.Equal(t, id, obj.ID)
+		assert.Equal(t, [][]byte{[]byte("f1")}, fields(txn, newkey))
+		assert.Equal(t, id, expireID(txn, other, newkey))
+
+		// move it back and copy a missing key
+		ok, err := txn.Kv().Move(newkey, db.ID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = txn.Kv().Copy(key, newkey, db.ID, false)
+		assert.Equal(t, ErrKeyNotFound, err)
+		assert.False(t, ok)
+	})
+	// the key exists in the target db
+	SetVal(t, other, newkey, []byte("val"))
+	run(func(txn *Transaction) {
+		ok, err := txn.Kv().Move(newkey, other.ID)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		ok, err = txn.Kv().Copy(key, newkey, other.ID, true)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+	run(func(txn *Transaction) {
+		txn = txn.in(other.ID)
+		obj, err := txn.Object(newkey)
+		assert.NoError(t, err)
+		assert.Equal(t, ObjectHash, obj.Type)
+		assert.Equal(t, [][]byte{[]byte("f1"), []byte("f2")}, fields(txn, newkey))
+	})
+	// the objects with too many data keys are neither moved nor copied
+	limit := copyDataLimit
+	copyDataLimit = 1
+	defer func() { copyDataLimit = limit }()
+	run(func(txn *Transaction) {
+		ok, err := txn.Kv().Copy(key, []byte("kv-rename-large"), db.ID, false)
+		assert.Equal(t, ErrCopyTooLarge, err)
+		assert.False(t, ok)
+		ok, err = txn.Kv().Move(key, 3)
+		assert.Equal(t, ErrCopyTooLarge, err)
+		assert.False(t, ok)
+	})
+}
@@ -246,6 +246,7 @@ func (l *LList) LPop() (data []byte, err error) {
 	}
 
 	if l.Len == 1 {
+		l.LListMeta.Len = 0
 		return val, l.txn.t.Delete(l.rawMetaKey)
 	}
 
@@ -289,6 +290,7 @@ func (l *LList) RPop() ([]byte, error) {
 	}
 
 	if l.Len == 1 {
+		l.LListMeta.Len = 0
 		return val, l.txn.t.Delete(l.rawMetaKey)
 	}
 
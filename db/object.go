@@ -26,12 +26,16 @@ const (
 	ObjectEncodingSkiplist
 	ObjectEncodingEmbstr
 	ObjectEncodingQuicklist
+	ObjectEncodingStream
+	// ObjectEncodingChunked is a string split into the data keys
+	ObjectEncodingChunked
 )
 
 // String representation of ObjectEncoding
 func (enc ObjectEncoding) String() string {
 	switch enc {
-	case ObjectEncodingRaw:
+	case ObjectEncodingRaw, ObjectEncodingChunked:
+		// a chunked string is still raw to the clients
 		return "raw"
 	case ObjectEncodingInt:
 		return "int"
@@ -51,6 +55,8 @@ func (enc ObjectEncoding) String() string {
 		return "embstr"
 	case ObjectEncodingQuicklist:
 		return "quicklist"
+	case ObjectEncodingStream:
+		return "stream"
 	default:
 		return "unknown"
 	}
@@ -72,6 +78,8 @@ func (t ObjectType) String() string {
 		return "zset"
 	case ObjectHash:
 		return "hash"
+	case ObjectStream:
+		return "stream"
 	}
 	return "none"
 }
@@ -83,6 +91,7 @@ const (
 	ObjectSet
 	ObjectZSet
 	ObjectHash
+	ObjectStream
 )
 
 // Object meta schema
@@ -130,7 +139,7 @@ func (txn *Transaction) Destory(obj *Object, key []byte) error {
 	if err := txn.t.Delete(mkey); err != nil {
 		return err
 	}
-	if obj.Type != ObjectString {
+	if obj.Type != ObjectString || obj.Encoding == ObjectEncodingChunked {
 		if err := gc(txn.t, dkey); err != nil {
 			return err
 		}
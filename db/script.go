@@ -0,0 +1,71 @@
+package db
+
+import (
+	"github.com/distributedio/titan/db/store"
+)
+
+var (
+	// $sys:0:LUA:{namespace}:{sha1}
+	scriptKeyPrefix = []byte("$sys:0:LUA:")
+)
+
+// scriptPrefix returns the prefix of the scripts of the namespace,
+// scripts are shared by all the databases of a namespace like redis does
+func scriptPrefix(namespace string) []byte {
+	var prefix []byte
+	prefix = append(prefix, scriptKeyPrefix...)
+	prefix = append(prefix, namespace...)
+	prefix = append(prefix, ':')
+	return prefix
+}
+
+func scriptKey(namespace string, sha string) []byte {
+	return append(scriptPrefix(namespace), sha...)
+}
+
+// Script returns the body of a cached script, nil is returned if the script does not exist
+func (txn *Transaction) Script(sha string) ([]byte, error) {
+	val, err := txn.t.Get(txn.ctx, scriptKey(txn.db.Namespace, sha))
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return val, nil
+}
+
+// ScriptsExist checks if the scripts are cached
+func (txn *Transaction) ScriptsExist(shas []string) ([]bool, error) {
+	keys := make([][]byte, len(shas))
+	for i := range shas {
+		keys[i] = scriptKey(txn.db.Namespace, shas[i])
+	}
+	vals, err := store.BatchGetValues(txn.ctx, txn.t, keys)
+	if err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(shas))
+	for i := range keys {
+		_, exists[i] = vals[string(keys[i])]
+	}
+	return exists, nil
+}
+
+// SetScript caches the script body with its sha1 digest, it writes nothing if the script
+// has been cached so that loading a script over and over again does not conflict
+func (txn *Transaction) SetScript(sha string, body []byte) error {
+	val, err := txn.Script(sha)
+	if err != nil {
+		return err
+	}
+	if val != nil {
+		return nil
+	}
+	return txn.t.Set(scriptKey(txn.db.Namespace, sha), body)
+}
+
+// FlushScripts removes all the cached scripts of the namespace
+func (txn *Transaction) FlushScripts() error {
+	return deletePrefix(txn, scriptPrefix(txn.db.Namespace))
+}
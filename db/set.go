@@ -3,6 +3,9 @@ package db
 import (
 	"bytes"
 	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
 
 	"github.com/pingcap/tidb/kv"
 )
@@ -22,6 +25,21 @@ type Set struct {
 	key    []byte
 	exists bool
 	txn    *Transaction
+
+	// detached is true if the set is not stored at the key until Replace is called
+	detached bool
+}
+
+// Replace stores the set at its key in place of the old value, the key is deleted if the set is empty
+func (set *Set) Replace() error {
+	if _, err := set.txn.Kv().Delete([][]byte{set.key}); err != nil {
+		return err
+	}
+	set.detached = false
+	if set.meta.Len == 0 {
+		return nil
+	}
+	return set.updateMeta()
 }
 
 // GetSet returns a set object, create new one if nonexists
@@ -86,7 +104,7 @@ func (siter *SetIter) Value() []byte {
 
 // Valid judgies whether the key directed by iter has the same prifix
 func (siter *SetIter) Valid() bool {
-	return siter.Iter.Key().HasPrefix(siter.Prefix)
+	return siter.Iter.Valid() && siter.Iter.Key().HasPrefix(siter.Prefix)
 }
 
 //newSet create new Set object
@@ -126,6 +144,9 @@ func setItemKey(key []byte, member []byte) []byte {
 }
 
 func (set *Set) updateMeta() error {
+	if set.detached {
+		return nil
+	}
 	meta := encodeSetMeta(set.meta)
 	err := set.txn.t.Set(MetaKey(set.txn.db, set.key), meta)
 	if err != nil {
@@ -347,3 +368,220 @@ func (set *Set) SMove(destination []byte, member []byte) (int64, error) {
 	}
 	return 1, nil
 }
+
+// SScan iterates the members from the cursor in order until f returns false
+func (set *Set) SScan(cursor []byte, f func(member []byte) bool) error {
+	if !set.Exists() {
+		return nil
+	}
+	dkey := DataKey(set.txn.db, set.meta.ID)
+	prefix := setItemKey(dkey, nil)
+	endPrefix := kv.Key(prefix).PrefixNext()
+	iter, err := set.txn.t.Iter(setItemKey(dkey, cursor), endPrefix)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		if !f(iter.Key()[len(prefix):]) {
+			break
+		}
+		if err := iter.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SMIsmember returns whether each member is a member of the set stored at key
+func (set *Set) SMIsmember(members [][]byte) ([]bool, error) {
+	exists := make([]bool, len(members))
+	if !set.Exists() {
+		return exists, nil
+	}
+	dkey := DataKey(set.txn.db, set.meta.ID)
+	ikeys := make([][]byte, len(members))
+	for i := range members {
+		ikeys[i] = setItemKey(dkey, members[i])
+	}
+	values, err := BatchGetValues(set.txn, ikeys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		exists[i] = values[i] != nil
+	}
+	return exists, nil
+}
+
+// setRandomSeekMin is the least size of the sets whose random members are picked by seeking random keys,
+// the members of smaller sets are picked by their random positions in a pass of the set
+const setRandomSeekMin = 1024
+
+// SRandMember returns count distinct random members, or -count members which may be repeated if
+// count is negative, count must not be math.MinInt64. A pass of the set is only made if the set is
+// small or about a third of it is picked, the members of larger sets are picked by seeking random
+// keys between the first and the last member, so they are not picked perfectly uniformly.
+func (set *Set) SRandMember(count int64) ([][]byte, error) {
+	if !set.Exists() || set.meta.Len == 0 || count == 0 {
+		return nil, nil
+	}
+	n := set.meta.Len
+	var members [][]byte
+	var err error
+	switch {
+	case count >= n:
+		return set.SMembers()
+	case count > 0 && n >= setRandomSeekMin && count <= n/3:
+		members, err = set.randomSeek(count, true)
+	case count > 0:
+		members, err = set.randomPass(distinctPositions(n, count), count)
+	case n >= setRandomSeekMin && -count <= n/3:
+		members, err = set.randomSeek(-count, false)
+	default:
+		members, err = set.randomPass(repeatedPositions(n, -count), -count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	return members, nil
+}
+
+// distinctPositions picks count distinct positions of n by Floyd's algorithm, they
+// are returned in ascending order
+func distinctPositions(n, count int64) func() int64 {
+	picked := make(map[int64]bool, count)
+	positions := make([]int64, 0, count)
+	for i := n - count; i < n; i++ {
+		pos := rand.Int63n(i + 1)
+		if picked[pos] {
+			pos = i
+		}
+		picked[pos] = true
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	return func() int64 {
+		pos := positions[0]
+		positions = positions[1:]
+		return pos
+	}
+}
+
+// repeatedPositions picks count positions of n with replacement in ascending order without storing them,
+// the next position is the minimum of the uniform variables left, which are above the current one
+func repeatedPositions(n, count int64) func() int64 {
+	cur := 0.0
+	return func() int64 {
+		cur = 1 - (1-cur)*math.Pow(rand.Float64(), 1/float64(count))
+		count--
+		if pos := int64(cur * float64(n)); pos < n {
+			return pos
+		}
+		return n - 1
+	}
+}
+
+// randomPass returns the members at the count positions returned by next in a pass of the set
+func (set *Set) randomPass(next func() int64, count int64) ([][]byte, error) {
+	iter, err := set.Iter()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Iter.Close()
+	members := make([][]byte, 0, count)
+	pos, target := int64(0), next()
+	for iter.Valid() {
+		for target == pos {
+			members = append(members, append([]byte{}, iter.Value()...))
+			if int64(len(members)) == count {
+				return members, nil
+			}
+			target = next()
+		}
+		if err := iter.Iter.Next(); err != nil {
+			return nil, err
+		}
+		pos++
+	}
+	return members, nil
+}
+
+// randomSeek picks count members by seeking random keys, it falls back to a pass of the
+// set if it fails to pick enough distinct members
+func (set *Set) randomSeek(count int64, distinct bool) ([][]byte, error) {
+	dkey := DataKey(set.txn.db, set.meta.ID)
+	prefix := setItemKey(dkey, nil)
+	end := kv.Key(prefix).PrefixNext()
+	seek := func(key []byte) ([]byte, error) {
+		iter, err := set.txn.t.Iter(key, end)
+		if err != nil {
+			return nil, err
+		}
+		defer iter.Close()
+		if !iter.Valid() || !iter.Key().HasPrefix(prefix) {
+			return nil, nil
+		}
+		return append([]byte{}, iter.Key()[len(prefix):]...), nil
+	}
+	first, err := seek(prefix)
+	if err != nil || first == nil {
+		return nil, err
+	}
+	iter, err := set.txn.t.IterReverse(end)
+	if err != nil {
+		return nil, err
+	}
+	if !iter.Valid() || !iter.Key().HasPrefix(prefix) {
+		iter.Close()
+		return nil, nil
+	}
+	last := append([]byte{}, iter.Key()[len(prefix):]...)
+	iter.Close()
+
+	members := make([][]byte, 0, count)
+	picked := make(map[string]bool)
+	for attempts := 3 * count; int64(len(members)) < count && attempts > 0; attempts-- {
+		member, err := seek(setItemKey(dkey, randomKeyBetween(first, last)))
+		if err != nil {
+			return nil, err
+		}
+		// the keys after the last member wrap around to the first
+		if member == nil {
+			member = first
+		}
+		if distinct {
+			if picked[string(member)] {
+				continue
+			}
+			picked[string(member)] = true
+		}
+		members = append(members, member)
+	}
+	if int64(len(members)) < count {
+		return set.randomPass(distinctPositions(set.meta.Len, count), count)
+	}
+	return members, nil
+}
+
+// randomKeyBetween returns a random key which shares the common prefix of lo and hi,
+// and the byte following the prefix is between those of lo and hi
+func randomKeyBetween(lo, hi []byte) []byte {
+	i := 0
+	for i < len(lo) && i < len(hi) && lo[i] == hi[i] {
+		i++
+	}
+	key := append([]byte{}, lo[:i]...)
+	low, high := 0, 255
+	if i < len(lo) {
+		low = int(lo[i])
+	}
+	if i < len(hi) {
+		high = int(hi[i])
+	}
+	key = append(key, byte(low+rand.Intn(high-low+1)))
+	tail := make([]byte, 8)
+	rand.Read(tail)
+	return append(key, tail...)
+}
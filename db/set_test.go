@@ -661,3 +661,140 @@ func TestSet_SMove(t *testing.T) {
 		})
 	}
 }
+
+func TestSet_SRandMember(t *testing.T) {
+	var testSRandMemberKey = []byte("SRandMemberKey")
+	testAddData(t, testSRandMemberKey, []byte("1"), []byte("2"), []byte("3"), []byte("4"), []byte("5"))
+	tests := []struct {
+		name      string
+		count     int64
+		wantCount int
+		distinct  bool
+	}{
+		{name: "TestSRandMemberDistinct", count: 3, wantCount: 3, distinct: true},
+		{name: "TestSRandMemberBigCount", count: 6, wantCount: 5, distinct: true},
+		{name: "TestSRandMemberRepeated", count: -8, wantCount: 8},
+		{name: "TestSRandMemberZero", count: 0, wantCount: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn, err := mockDB.Begin()
+			assert.NoError(t, err)
+			set, err := GetSet(txn, testSRandMemberKey)
+			assert.NoError(t, err)
+
+			members, err := set.SRandMember(tt.count)
+			assert.NoError(t, err)
+			assert.Len(t, members, tt.wantCount)
+			seen := make(map[string]bool)
+			for _, member := range members {
+				assert.Len(t, member, 1)
+				assert.True(t, member[0] >= '1' && member[0] <= '5')
+				if tt.distinct {
+					assert.False(t, seen[string(member)])
+				}
+				seen[string(member)] = true
+			}
+			// nothing is removed
+			assert.Equal(t, int64(5), set.meta.Len)
+			assert.NoError(t, txn.Commit(context.TODO()))
+		})
+	}
+}
+
+func TestSet_SRandMemberLarge(t *testing.T) {
+	var testSRandMemberKey = []byte("SRandMemberLargeKey")
+	var values [][]byte
+	for i := 0; i < 2*setRandomSeekMin; i++ {
+		values = append(values, []byte(fmt.Sprintf("member-%d", i)))
+	}
+	testAddData(t, testSRandMemberKey, values...)
+	tests := []struct {
+		name     string
+		count    int64
+		distinct bool
+	}{
+		{name: "TestSRandMemberSeekDistinct", count: 10, distinct: true},
+		{name: "TestSRandMemberSeekRepeated", count: -10},
+		{name: "TestSRandMemberPassDistinct", count: setRandomSeekMin, distinct: true},
+		{name: "TestSRandMemberPassRepeated", count: -5 * setRandomSeekMin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn, err := mockDB.Begin()
+			assert.NoError(t, err)
+			set, err := GetSet(txn, testSRandMemberKey)
+			assert.NoError(t, err)
+
+			members, err := set.SRandMember(tt.count)
+			assert.NoError(t, err)
+			want := tt.count
+			if want < 0 {
+				want = -want
+			}
+			assert.Len(t, members, int(want))
+			seen := make(map[string]bool)
+			for _, member := range members {
+				assert.True(t, bytes.HasPrefix(member, []byte("member-")))
+				if tt.distinct {
+					assert.False(t, seen[string(member)])
+				}
+				seen[string(member)] = true
+			}
+			assert.NoError(t, txn.Commit(context.TODO()))
+		})
+	}
+}
+
+func TestSet_SMIsmember(t *testing.T) {
+	var testSMIsmemberKey = []byte("SMIsmemberKey")
+	testAddData(t, testSMIsmemberKey, []byte("1"), []byte("2"))
+	txn, err := mockDB.Begin()
+	assert.NoError(t, err)
+	set, err := GetSet(txn, testSMIsmemberKey)
+	assert.NoError(t, err)
+	exists, err := set.SMIsmember([][]byte{[]byte("2"), []byte("3"), []byte("1")})
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, true}, exists)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestSetCombine(t *testing.T) {
+	testAddData(t, []byte("SetCombine1"), []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+	testAddData(t, []byte("SetCombine2"), []byte("b"), []byte("d"), []byte("e"))
+	testAddData(t, []byte("SetCombine3"), []byte("d"), []byte("e"), []byte("f"))
+	txn, err := mockDB.Begin()
+	assert.NoError(t, err)
+	defer txn.Commit(context.TODO())
+
+	combine := func(op SetOp, limit int, keys ...string) []string {
+		iters := make([]*SetIter, len(keys))
+		for i, key := range keys {
+			if key == "" {
+				continue
+			}
+			set, err := GetSet(txn, []byte(key))
+			assert.NoError(t, err)
+			iters[i], err = set.Iter()
+			assert.NoError(t, err)
+			defer iters[i].Iter.Close()
+		}
+		result := []string{}
+		assert.NoError(t, SetCombine(op, iters, func(member []byte) bool {
+			result = append(result, string(member))
+			return limit == 0 || len(result) < limit
+		}))
+		return result
+	}
+
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, combine(SetUnion, 0, "SetCombine1", "SetCombine2", "SetCombine3"))
+	assert.Equal(t, []string{"b", "d", "e", "f"}, combine(SetUnion, 0, "", "SetCombine2", "SetCombine3"))
+	assert.Equal(t, []string{"b", "d"}, combine(SetInter, 0, "SetCombine1", "SetCombine2"))
+	assert.Equal(t, []string{"d"}, combine(SetInter, 0, "SetCombine1", "SetCombine2", "SetCombine3"))
+	assert.Equal(t, []string{"b"}, combine(SetInter, 1, "SetCombine1", "SetCombine2"))
+	assert.Equal(t, []string{}, combine(SetInter, 0, "SetCombine1", ""))
+	assert.Equal(t, []string{"a", "c"}, combine(SetDiff, 0, "SetCombine1", "SetCombine2", ""))
+	assert.Equal(t, []string{"b"}, combine(SetDiff, 0, "SetCombine2", "SetCombine3"))
+	assert.Equal(t, []string{}, combine(SetDiff, 0, "", "SetCombine1"))
+	assert.Equal(t, []string{}, combine(SetUnion, 0))
+}
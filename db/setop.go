@@ -0,0 +1,99 @@
+package db
+
+import (
+	"bytes"
+	"container/heap"
+)
+
+// SetOp is the operation of the sets
+type SetOp int
+
+// SetOp values
+const (
+	SetUnion = SetOp(iota)
+	SetInter
+	SetDiff
+)
+
+// setIterItem is an iterator in the heap with its position in the arguments
+type setIterItem struct {
+	iter *SetIter
+	pos  int
+}
+
+// setIterHeap orders the iterators by their current members
+type setIterHeap []setIterItem
+
+func (h setIterHeap) Len() int { return len(h) }
+func (h setIterHeap) Less(i, j int) bool {
+	if c := bytes.Compare(h[i].iter.Value(), h[j].iter.Value()); c != 0 {
+		return c < 0
+	}
+	return h[i].pos < h[j].pos
+}
+func (h setIterHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *setIterHeap) Push(x interface{}) { *h = append(*h, x.(setIterItem)) }
+func (h *setIterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// SetCombine merges the members of the iterators with a k-way merge, the sets are read in
+// stream so they are never loaded into memory. A nil iterator is an empty set. f is called
+// for every member of the result in order until it returns false, the member is only valid
+// during the call. An intersection or a difference stops as soon as the result can not grow.
+func SetCombine(op SetOp, iters []*SetIter, f func(member []byte) bool) error {
+	h := make(setIterHeap, 0, len(iters))
+	for i, it := range iters {
+		if it == nil || !it.Valid() {
+			// the result is empty if any set is empty for an intersection, or the first one for a difference
+			if op == SetInter || (op == SetDiff && i == 0) {
+				return nil
+			}
+			continue
+		}
+		h = append(h, setIterItem{iter: it, pos: i})
+	}
+	heap.Init(&h)
+
+	matched := make([]setIterItem, 0, len(iters))
+	for len(h) > 0 {
+		// pop all the iterators at the smallest member
+		matched = append(matched[:0], heap.Pop(&h).(setIterItem))
+		member := append([]byte{}, matched[0].iter.Value()...)
+		for len(h) > 0 && bytes.Equal(h[0].iter.Value(), member) {
+			matched = append(matched, heap.Pop(&h).(setIterItem))
+		}
+
+		var emit bool
+		switch op {
+		case SetUnion:
+			emit = true
+		case SetInter:
+			emit = len(matched) == len(iters)
+		case SetDiff:
+			emit = matched[0].pos == 0 && len(matched) == 1
+		}
+		if emit && !f(member) {
+			return nil
+		}
+
+		for _, item := range matched {
+			if err := item.iter.Iter.Next(); err != nil {
+				return err
+			}
+			if item.iter.Valid() {
+				heap.Push(&h, item)
+				continue
+			}
+			// no more members could be in all the sets or left in the first set
+			if op == SetInter || (op == SetDiff && item.pos == 0) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
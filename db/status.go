@@ -0,0 +1,91 @@
+package db
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// the states of a background task
+const (
+	TaskDisabled = "disabled"
+	TaskLeader   = "leader"
+	TaskFollower = "follower"
+)
+
+// taskNames are the names of the background tasks by their labels
+var taskNames = []struct {
+	label string
+	name  string
+}{
+	{"GC", "gc"},
+	{"EX", "expire"},
+	{"ZT", "zt"},
+	{"TGC", "tikvgc"},
+	{"KC", "keycount"},
+}
+
+// TaskStatus is the state of a background task on this server
+type TaskStatus struct {
+	Name  string
+	State string
+}
+
+// Status is the status of the storage and its background tasks
+type Status struct {
+	PdAddrs       string
+	Tasks         []TaskStatus
+	LastSafePoint *time.Time // nil if tikv gc has never run
+
+	// GCBacklog is the number of objects waiting for gc, it is counted up to a limit
+	GCBacklog       int
+	GCBacklogCapped bool
+}
+
+// Status returns the status of the storage, the gc backlog is counted up to limit
+func (rds *RedisStore) Status(limit int) (*Status, error) {
+	status := &Status{PdAddrs: rds.Conf().PdAddrs}
+	for _, task := range taskNames {
+		state := TaskDisabled
+		for _, t := range rds.tasks {
+			if t.label != task.label {
+				continue
+			}
+			state = TaskFollower
+			if atomic.LoadInt32(&t.leader) == 1 {
+				state = TaskLeader
+			}
+		}
+		status.Tasks = append(status.Tasks, TaskStatus{Name: task.name, State: state})
+	}
+
+	sysdb := rds.DB(sysNamespace, sysDatabaseID)
+	var err error
+	if status.LastSafePoint, err = getLastSafePoint(sysdb); err != nil {
+		return nil, err
+	}
+
+	txn, err := sysdb.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Rollback()
+	prefix := toTiKVGCKey(nil)
+	iter, err := txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	for iter.Valid() && iter.Key().HasPrefix(prefix) {
+		if status.GCBacklog >= limit {
+			status.GCBacklogCapped = true
+			break
+		}
+		status.GCBacklog++
+		if err := iter.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	db := MockDB()
+	rds := db.kv
+
+	status, err := rds.Status(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "mocktikv://", status.PdAddrs)
+	assert.Nil(t, status.LastSafePoint)
+	assert.Equal(t, 0, status.GCBacklog)
+	assert.False(t, status.GCBacklogCapped)
+	for _, task := range status.Tasks {
+		assert.Equal(t, TaskDisabled, task.State)
+	}
+
+	txn, err := db.Begin()
+	assert.NoError(t, err)
+	assert.NoError(t, gc(txn.t, []byte("ns:001:D:a"), []byte("ns:001:D:b"), []byte("ns:001:D:c")))
+	assert.NoError(t, txn.Commit(context.Background()))
+	now := time.Now().Truncate(time.Second)
+	assert.NoError(t, saveLastSafePoint(rds.DB(sysNamespace, sysDatabaseID), &now))
+	rds.tasks = []*Task{{label: "GC", leader: 1}, {label: "EX"}}
+
+	status, err = rds.Status(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, status.GCBacklog)
+	assert.True(t, status.GCBacklogCapped)
+	assert.True(t, now.Equal(*status.LastSafePoint))
+	assert.Equal(t, []TaskStatus{{"gc", TaskLeader}, {"expire", TaskFollower}, {"zt", TaskDisabled}, {"tikvgc", TaskDisabled}, {"keycount", TaskDisabled}}, status.Tasks)
+
+	status, err = rds.Status(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, status.GCBacklog)
+	assert.False(t, status.GCBacklogCapped)
+}
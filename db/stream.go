@@ -0,0 +1,474 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	// ErrStreamID is returned when adding an entry whose ID is not greater than the last ID
+	ErrStreamID = errors.New("stream id is equal or smaller than the top item")
+
+	// streamEntryTag tags the data keys of stream entries
+	streamEntryTag = []byte("e")
+)
+
+// StreamID is the ID of a stream entry, it is made of a millisecond timestamp and a sequence number
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinStreamID is the smallest possible stream ID
+	MinStreamID = StreamID{0, 0}
+	// MaxStreamID is the biggest possible stream ID
+	MaxStreamID = StreamID{math.MaxUint64, math.MaxUint64}
+)
+
+// String representation of stream ID, in format {ms}-{seq}
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Bytes encodes the id in 16 bytes, the encoded ids sort the same as the ids
+func (id StreamID) Bytes() []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, id.Ms)
+	binary.BigEndian.PutUint64(b[8:], id.Seq)
+	return b
+}
+
+// Compare returns -1, 0 or 1 if the id is less than, equal to or greater than other
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Next returns the id right after this one, false is returned if the id is the max one
+func (id StreamID) Next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// Prev returns the id right before this one, false is returned if the id is the min one
+func (id StreamID) Prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// DecodeStreamID decodes the id encoded by StreamID.Bytes
+func DecodeStreamID(b []byte) (StreamID, error) {
+	if len(b) != 16 {
+		return StreamID{}, ErrInvalidLength
+	}
+	return StreamID{binary.BigEndian.Uint64(b), binary.BigEndian.Uint64(b[8:])}, nil
+}
+
+// StreamEntry is an entry of the stream
+type StreamEntry struct {
+	ID     StreamID
+	Fields [][]byte // field value pairs
+}
+
+// StreamMeta is the meta data of the stream
+type StreamMeta struct {
+	Object
+	Len     int64
+	FirstID StreamID
+	LastID  StreamID // it is kept even if the last entry is deleted
+}
+
+// Stream implements the stream data structure
+//   Layout {DataKey}:e:{ID}
+//   ID     16 bytes big endian of ms and seq
+type Stream struct {
+	meta   StreamMeta
+	key    []byte
+	exists bool
+	txn    *Transaction
+}
+
+func newStream(txn *Transaction, key []byte) *Stream {
+	now := Now()
+	return &Stream{
+		txn: txn,
+		key: key,
+		meta: StreamMeta{
+			Object: Object{
+				ID:        UUID(),
+				CreatedAt: now,
+				UpdatedAt: now,
+				ExpireAt:  0,
+				Type:      ObjectStream,
+				Encoding:  ObjectEncodingStream,
+			},
+		},
+	}
+}
+
+// GetStream returns a stream object, create new one if nonexists
+func GetStream(txn *Transaction, key []byte) (*Stream, error) {
+	s := newStream(txn, key)
+	mkey := MetaKey(txn.db, key)
+	meta, err := txn.t.Get(txn.ctx, mkey)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	obj, err := DecodeObject(meta)
+	if err != nil {
+		return nil, err
+	}
+	if IsExpired(obj, Now()) {
+		return s, nil
+	}
+	if obj.Type != ObjectStream {
+		return nil, ErrTypeMismatch
+	}
+
+	m := meta[ObjectEncodingLength:]
+	if len(m) != 40 {
+		return nil, ErrInvalidLength
+	}
+	s.meta.Object = *obj
+	s.meta.Len = int64(binary.BigEndian.Uint64(m))
+	if s.meta.FirstID, err = DecodeStreamID(m[8:24]); err != nil {
+		return nil, err
+	}
+	if s.meta.LastID, err = DecodeStreamID(m[24:40]); err != nil {
+		return nil, err
+	}
+	s.exists = true
+	return s, nil
+}
+
+func encodeStreamMeta(meta *StreamMeta) []byte {
+	b := EncodeObject(&meta.Object)
+	m := make([]byte, 8)
+	binary.BigEndian.PutUint64(m, uint64(meta.Len))
+	b = append(b, m...)
+	b = append(b, meta.FirstID.Bytes()...)
+	return append(b, meta.LastID.Bytes()...)
+}
+
+func (s *Stream) updateMeta() error {
+	s.meta.UpdatedAt = Now()
+	if err := s.txn.t.Set(MetaKey(s.txn.db, s.key), encodeStreamMeta(&s.meta)); err != nil {
+		return err
+	}
+	s.exists = true
+	return nil
+}
+
+// Exists returns true if the stream exists, a stream exists even if it has no entries
+func (s *Stream) Exists() bool {
+	return s.exists
+}
+
+// Len returns the number of entries in the stream
+func (s *Stream) Len() int64 {
+	return s.meta.Len
+}
+
+// FirstID returns the ID of the first entry
+func (s *Stream) FirstID() StreamID {
+	return s.meta.FirstID
+}
+
+// LastID returns the biggest ID ever added to the stream
+func (s *Stream) LastID() StreamID {
+	return s.meta.LastID
+}
+
+// entryPrefix returns the prefix of all the entries
+func (s *Stream) entryPrefix() []byte {
+	dkey := DataKey(s.txn.db, s.meta.ID)
+	dkey = append(dkey, ':')
+	dkey = append(dkey, streamEntryTag...)
+	return append(dkey, ':')
+}
+
+func (s *Stream) entryKey(id StreamID) []byte {
+	return append(s.entryPrefix(), id.Bytes()...)
+}
+
+// encodeStreamFields encodes field value pairs, every one is prefixed by its length in uvarint
+func encodeStreamFields(fields [][]byte) []byte {
+	var b []byte
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(len(fields)))
+	b = append(b, buf[:n]...)
+	for _, f := range fields {
+		n = binary.PutUvarint(buf, uint64(len(f)))
+		b = append(b, buf[:n]...)
+		b = append(b, f...)
+	}
+	return b
+}
+
+func decodeStreamFields(b []byte) ([][]byte, error) {
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, ErrInvalidLength
+	}
+	b = b[n:]
+	fields := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < size {
+			return nil, ErrInvalidLength
+		}
+		fields = append(fields, b[n:n+int(size)])
+		b = b[n+int(size):]
+	}
+	return fields, nil
+}
+
+// Add appends an entry with field value pairs to the stream, id must be greater than the last ID
+func (s *Stream) Add(id StreamID, fields [][]byte) error {
+	if s.exists && id.Compare(s.meta.LastID) <= 0 {
+		return ErrStreamID
+	}
+	if err := s.txn.t.Set(s.entryKey(id), encodeStreamFields(fields)); err != nil {
+		return err
+	}
+	if s.meta.Len == 0 {
+		s.meta.FirstID = id
+	}
+	s.meta.Len++
+	s.meta.LastID = id
+	return s.updateMeta()
+}
+
+// Create creates an empty stream if it does not exist
+func (s *Stream) Create() error {
+	if s.exists {
+		return nil
+	}
+	return s.updateMeta()
+}
+
+// SetLastID sets the last ID of the stream, it should not be smaller than the ID of any entry
+func (s *Stream) SetLastID(id StreamID) error {
+	s.meta.LastID = id
+	return s.updateMeta()
+}
+
+// Range returns the entries between start and end(both inclusive), at most count entries
+// are returned if count is positive
+func (s *Stream) Range(start, end StreamID, count int64, reverse bool) ([]*StreamEntry, error) {
+	if !s.exists || s.meta.Len == 0 || start.Compare(end) > 0 {
+		return nil, nil
+	}
+	prefix := s.entryPrefix()
+	lower := append(prefix, start.Bytes()...)
+	upper := kv.Key(append(s.entryPrefix(), end.Bytes()...)).Next()
+
+	var iter Iterator
+	var err error
+	if reverse {
+		iter, err = s.txn.t.IterReverse(upper)
+	} else {
+		iter, err = s.txn.t.Iter(lower, upper)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var entries []*StreamEntry
+	for ; iter.Valid() && (count <= 0 || int64(len(entries)) < count); err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+		key := iter.Key()
+		if !key.HasPrefix(prefix) || (reverse && key.Cmp(lower) < 0) {
+			break
+		}
+		id, err := DecodeStreamID(key[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		fields, err := decodeStreamFields(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &StreamEntry{ID: id, Fields: fields})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Get returns the entries of the ids, nil is returned for the id not in the stream
+func (s *Stream) Get(ids []StreamID) ([]*StreamEntry, error) {
+	entries := make([]*StreamEntry, len(ids))
+	if !s.exists || s.meta.Len == 0 {
+		return entries, nil
+	}
+	keys := make([][]byte, len(ids))
+	for i := range ids {
+		keys[i] = s.entryKey(ids[i])
+	}
+	values, err := BatchGetValues(s.txn, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		if values[i] == nil {
+			continue
+		}
+		fields, err := decodeStreamFields(values[i])
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = &StreamEntry{ID: ids[i], Fields: fields}
+	}
+	return entries, nil
+}
+
+// Delete removes the entries of the ids and returns the number of entries deleted
+func (s *Stream) Delete(ids []StreamID) (int64, error) {
+	entries, err := s.Get(ids)
+	if err != nil {
+		return 0, err
+	}
+	var deleted int64
+	for i := range entries {
+		if entries[i] == nil {
+			continue
+		}
+		if err := s.txn.t.Delete(s.entryKey(ids[i])); err != nil {
+			return 0, err
+		}
+		// the same id may be given more than once
+		entries[i] = nil
+		for j := i + 1; j < len(ids); j++ {
+			if ids[j] == ids[i] {
+				entries[j] = nil
+			}
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	s.meta.Len -= deleted
+	if err := s.resetFirstID(); err != nil {
+		return 0, err
+	}
+	return deleted, s.updateMeta()
+}
+
+// TrimMaxLen removes the oldest entries until the length is not greater than maxLen,
+// at most limit entries are removed if limit is positive
+func (s *Stream) TrimMaxLen(maxLen int64, limit int64) (int64, error) {
+	n := s.meta.Len - maxLen
+	if n <= 0 {
+		return 0, nil
+	}
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return s.trim(MaxStreamID, n)
+}
+
+// TrimMinID removes the entries whose ID are smaller than minID,
+// at most limit entries are removed if limit is positive
+func (s *Stream) TrimMinID(minID StreamID, limit int64) (int64, error) {
+	end, ok := minID.Prev()
+	if !ok {
+		return 0, nil
+	}
+	return s.trim(end, limit)
+}
+
+// trim removes at most count entries from the head of the stream whose ID are not greater than end
+func (s *Stream) trim(end StreamID, count int64) (int64, error) {
+	if !s.exists || s.meta.Len == 0 {
+		return 0, nil
+	}
+	prefix := s.entryPrefix()
+	upper := kv.Key(append(s.entryPrefix(), end.Bytes()...)).Next()
+	iter, err := s.txn.t.Iter(prefix, upper)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var deleted int64
+	for ; iter.Valid() && (count <= 0 || deleted < count); err = iter.Next() {
+		if err != nil {
+			return 0, err
+		}
+		if !iter.Key().HasPrefix(prefix) {
+			break
+		}
+		if err := s.txn.t.Delete(iter.Key()); err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+	if err != nil {
+		return 0, err
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	s.meta.Len -= deleted
+	if err := s.resetFirstID(); err != nil {
+		return 0, err
+	}
+	return deleted, s.updateMeta()
+}
+
+// resetFirstID seeks the first entry after entries are removed
+func (s *Stream) resetFirstID() error {
+	if s.meta.Len == 0 {
+		s.meta.FirstID = MinStreamID
+		return nil
+	}
+	prefix := s.entryPrefix()
+	iter, err := s.txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	if !iter.Valid() || !iter.Key().HasPrefix(prefix) {
+		s.meta.FirstID = MinStreamID
+		return nil
+	}
+	id, err := DecodeStreamID(iter.Key()[len(prefix):])
+	if err != nil {
+		return err
+	}
+	s.meta.FirstID = id
+	return nil
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getStream(t *testing.T, key []byte) (*Stream, *Transaction) {
+	txn, err := mockDB.Begin()
+	assert.NoError(t, err)
+	s, err := GetStream(txn, key)
+	assert.NoError(t, err)
+	assert.NotNil(t, s)
+	return s, txn
+}
+
+func entryIDs(entries []*StreamEntry) []StreamID {
+	var ids []StreamID
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestStreamID(t *testing.T) {
+	id := StreamID{1, 2}
+	assert.Equal(t, "1-2", id.String())
+	decoded, err := DecodeStreamID(id.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, id, decoded)
+
+	assert.Equal(t, -1, StreamID{1, 2}.Compare(StreamID{2, 0}))
+	assert.Equal(t, 1, StreamID{1, 2}.Compare(StreamID{1, 1}))
+	assert.Equal(t, 0, id.Compare(decoded))
+
+	next, ok := StreamID{1, MaxStreamID.Seq}.Next()
+	assert.True(t, ok)
+	assert.Equal(t, StreamID{2, 0}, next)
+	_, ok = MaxStreamID.Next()
+	assert.False(t, ok)
+	prev, ok := StreamID{2, 0}.Prev()
+	assert.True(t, ok)
+	assert.Equal(t, StreamID{1, MaxStreamID.Seq}, prev)
+	_, ok = MinStreamID.Prev()
+	assert.False(t, ok)
+}
+
+func TestStream(t *testing.T) {
+	key := []byte("TestStream")
+	s, txn := getStream(t, key)
+	assert.False(t, s.Exists())
+	for i := uint64(1); i <= 5; i++ {
+		assert.NoError(t, s.Add(StreamID{i, 0}, [][]byte{[]byte("f"), []byte("v")}))
+	}
+	assert.Equal(t, ErrStreamID, s.Add(StreamID{5, 0}, [][]byte{[]byte("f"), []byte("v")}))
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	s, txn = getStream(t, key)
+	assert.True(t, s.Exists())
+	assert.Equal(t, int64(5), s.Len())
+	assert.Equal(t, StreamID{1, 0}, s.FirstID())
+	assert.Equal(t, StreamID{5, 0}, s.LastID())
+
+	entries, err := s.Range(StreamID{2, 0}, StreamID{4, 0}, 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamID{{2, 0}, {3, 0}, {4, 0}}, entryIDs(entries))
+	assert.Equal(t, [][]byte{[]byte("f"), []byte("v")}, entries[0].Fields)
+
+	entries, err = s.Range(StreamID{2, 0}, StreamID{4, 0}, 2, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamID{{4, 0}, {3, 0}}, entryIDs(entries))
+
+	n, err := s.Delete([]StreamID{{1, 0}, {1, 0}, {9, 0}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Equal(t, StreamID{2, 0}, s.FirstID())
+
+	n, err = s.TrimMaxLen(2, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, StreamID{4, 0}, s.FirstID())
+
+	n, err = s.TrimMinID(StreamID{5, 0}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	// the last ID is kept when the stream is empty
+	s, txn = getStream(t, key)
+	n, err = s.Delete([]StreamID{{5, 0}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	s, txn = getStream(t, key)
+	assert.True(t, s.Exists())
+	assert.Equal(t, int64(0), s.Len())
+	assert.Equal(t, StreamID{5, 0}, s.LastID())
+	entries, err = s.Range(MinStreamID, MaxStreamID, 0, false)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestStreamGroup(t *testing.T) {
+	key := []byte("TestStreamGroup")
+	s, txn := getStream(t, key)
+	for i := uint64(1); i <= 3; i++ {
+		assert.NoError(t, s.Add(StreamID{i, 0}, [][]byte{[]byte("f"), []byte("v")}))
+	}
+	created, err := s.CreateGroup([]byte("g"), MinStreamID)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	created, err = s.CreateGroup([]byte("g"), MinStreamID)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	// the state of the group is persisted
+	s, txn = getStream(t, key)
+	g, err := s.Group([]byte("g"))
+	assert.NoError(t, err)
+	entries, err := g.Deliver([]byte("alice"), 2, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamID{{1, 0}, {2, 0}}, entryIDs(entries))
+	entries, err = g.Deliver([]byte("bob"), 0, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamID{{3, 0}}, entryIDs(entries))
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	s, txn = getStream(t, key)
+	g, err = s.Group([]byte("g"))
+	assert.NoError(t, err)
+	assert.Equal(t, StreamID{3, 0}, g.LastID)
+	assert.Equal(t, int64(3), g.Pending)
+
+	ids, history, err := g.History([]byte("alice"), MinStreamID, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []StreamID{{1, 0}, {2, 0}}, ids)
+	assert.Len(t, history, 2)
+
+	pendings, err := g.PendingRange(MinStreamID, MaxStreamID, 0, []byte("alice"), 0)
+	assert.NoError(t, err)
+	assert.Len(t, pendings, 2)
+	assert.Equal(t, int64(2), pendings[0].DeliveryCount)
+
+	claimed, deleted, err := g.Claim([]byte("bob"), []StreamID{{1, 0}, {9, 0}}, &StreamClaim{RetryCount: -1})
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, []byte("bob"), claimed[0].Consumer)
+	assert.Equal(t, int64(3), claimed[0].DeliveryCount)
+
+	acked, err := g.Ack([]StreamID{{2, 0}, {2, 0}, {5, 0}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), acked)
+
+	consumers, err := g.Consumers()
+	assert.NoError(t, err)
+	assert.Len(t, consumers, 2)
+	assert.Equal(t, []byte("alice"), consumers[0].Name)
+	assert.Equal(t, int64(0), consumers[0].Pending)
+	assert.Equal(t, int64(2), consumers[1].Pending)
+
+	first, last, err := g.PendingBounds()
+	assert.NoError(t, err)
+	assert.Equal(t, StreamID{1, 0}, first)
+	assert.Equal(t, StreamID{3, 0}, last)
+
+	n, err := g.DeleteConsumer([]byte("bob"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, int64(0), g.Pending)
+
+	destroyed, err := s.DestroyGroup([]byte("g"))
+	assert.NoError(t, err)
+	assert.True(t, destroyed)
+	g, err = s.Group([]byte("g"))
+	assert.NoError(t, err)
+	assert.Nil(t, g)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
@@ -0,0 +1,690 @@
+package db
+
+import (
+	"encoding/binary"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+var (
+	streamGroupTag       = []byte("g")
+	streamConsumerTag    = []byte("c")
+	streamPendingTag     = []byte("p")
+	streamConsumerPELTag = []byte("q")
+)
+
+const (
+	streamGroupValueLen    = 24
+	streamConsumerValueLen = 16
+	streamPendingValueLen  = 16
+)
+
+// StreamPending is an entry delivered to a consumer but not acknowledged yet
+type StreamPending struct {
+	ID            StreamID
+	Consumer      []byte
+	DeliveryTime  int64 // in milliseconds
+	DeliveryCount int64
+}
+
+// StreamConsumer is a consumer of a group
+type StreamConsumer struct {
+	Name     []byte
+	SeenTime int64 // in milliseconds
+	Pending  int64
+}
+
+// StreamGroup is a consumer group of the stream
+//   Group             {DataKey}:g:{group}                              -> {last delivered ID}{pending}
+//   Consumer          {DataKey}:c:{len(group)}{group}{consumer}        -> {seen time}{pending}
+//   Pending entry     {DataKey}:p:{len(group)}{group}{ID}              -> {delivery time}{delivery count}{consumer}
+//   Consumer pending  {DataKey}:q:{len(group)}{group}{len(consumer)}{consumer}{ID} -> nil
+type StreamGroup struct {
+	Name    []byte
+	LastID  StreamID
+	Pending int64
+	stream  *Stream
+}
+
+// nowMs returns the current time in milliseconds
+func nowMs() int64 {
+	return Now() / 1000000
+}
+
+// lengthPrefixed prefixes b with its length so that the following segments are not ambiguous
+func lengthPrefixed(b []byte) []byte {
+	l := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(l, uint32(len(b)))
+	return append(l, b...)
+}
+
+func (s *Stream) tagPrefix(tag []byte) []byte {
+	dkey := DataKey(s.txn.db, s.meta.ID)
+	dkey = append(dkey, ':')
+	dkey = append(dkey, tag...)
+	return append(dkey, ':')
+}
+
+func (s *Stream) groupKey(name []byte) []byte {
+	return append(s.tagPrefix(streamGroupTag), name...)
+}
+
+func (g *StreamGroup) consumerPrefix() []byte {
+	return append(g.stream.tagPrefix(streamConsumerTag), lengthPrefixed(g.Name)...)
+}
+
+func (g *StreamGroup) consumerKey(name []byte) []byte {
+	return append(g.consumerPrefix(), name...)
+}
+
+func (g *StreamGroup) pendingPrefix() []byte {
+	return append(g.stream.tagPrefix(streamPendingTag), lengthPrefixed(g.Name)...)
+}
+
+func (g *StreamGroup) pendingKey(id StreamID) []byte {
+	return append(g.pendingPrefix(), id.Bytes()...)
+}
+
+func (g *StreamGroup) consumerPELPrefix(consumer []byte) []byte {
+	prefix := append(g.stream.tagPrefix(streamConsumerPELTag), lengthPrefixed(g.Name)...)
+	return append(prefix, lengthPrefixed(consumer)...)
+}
+
+func (g *StreamGroup) consumerPELKey(consumer []byte, id StreamID) []byte {
+	return append(g.consumerPELPrefix(consumer), id.Bytes()...)
+}
+
+func encodeStreamPending(p *StreamPending) []byte {
+	b := make([]byte, streamPendingValueLen, streamPendingValueLen+len(p.Consumer))
+	binary.BigEndian.PutUint64(b, uint64(p.DeliveryTime))
+	binary.BigEndian.PutUint64(b[8:], uint64(p.DeliveryCount))
+	return append(b, p.Consumer...)
+}
+
+func decodeStreamPending(id StreamID, b []byte) (*StreamPending, error) {
+	if len(b) < streamPendingValueLen {
+		return nil, ErrInvalidLength
+	}
+	return &StreamPending{
+		ID:            id,
+		DeliveryTime:  int64(binary.BigEndian.Uint64(b)),
+		DeliveryCount: int64(binary.BigEndian.Uint64(b[8:])),
+		Consumer:      append([]byte{}, b[streamPendingValueLen:]...),
+	}, nil
+}
+
+func encodeStreamConsumer(c *StreamConsumer) []byte {
+	b := make([]byte, streamConsumerValueLen)
+	binary.BigEndian.PutUint64(b, uint64(c.SeenTime))
+	binary.BigEndian.PutUint64(b[8:], uint64(c.Pending))
+	return b
+}
+
+func decodeStreamConsumer(name []byte, b []byte) (*StreamConsumer, error) {
+	if len(b) != streamConsumerValueLen {
+		return nil, ErrInvalidLength
+	}
+	return &StreamConsumer{
+		Name:     name,
+		SeenTime: int64(binary.BigEndian.Uint64(b)),
+		Pending:  int64(binary.BigEndian.Uint64(b[8:])),
+	}, nil
+}
+
+// Group returns the consumer group of the name, nil is returned if the group does not exist
+func (s *Stream) Group(name []byte) (*StreamGroup, error) {
+	if !s.exists {
+		return nil, nil
+	}
+	val, err := s.txn.t.Get(s.txn.ctx, s.groupKey(name))
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(val) != streamGroupValueLen {
+		return nil, ErrInvalidLength
+	}
+	last, err := DecodeStreamID(val[:16])
+	if err != nil {
+		return nil, err
+	}
+	return &StreamGroup{
+		Name:    name,
+		LastID:  last,
+		Pending: int64(binary.BigEndian.Uint64(val[16:])),
+		stream:  s,
+	}, nil
+}
+
+// Groups returns all the consumer groups of the stream
+func (s *Stream) Groups() ([]*StreamGroup, error) {
+	if !s.exists {
+		return nil, nil
+	}
+	prefix := s.tagPrefix(streamGroupTag)
+	iter, err := s.txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var groups []*StreamGroup
+	for ; iter.Valid() && iter.Key().HasPrefix(prefix); err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+		group, err := s.Group(append([]byte{}, iter.Key()[len(prefix):]...))
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, err
+}
+
+// CreateGroup creates a consumer group which delivers entries after lastID,
+// false is returned if the group exists
+func (s *Stream) CreateGroup(name []byte, lastID StreamID) (bool, error) {
+	group, err := s.Group(name)
+	if err != nil {
+		return false, err
+	}
+	if group != nil {
+		return false, nil
+	}
+	if err := s.Create(); err != nil {
+		return false, err
+	}
+	group = &StreamGroup{Name: name, LastID: lastID, stream: s}
+	return true, group.updateMeta()
+}
+
+// DestroyGroup removes the consumer group with its consumers and pending entries
+func (s *Stream) DestroyGroup(name []byte) (bool, error) {
+	group, err := s.Group(name)
+	if err != nil || group == nil {
+		return false, err
+	}
+	// the name may be reused immediately, so the keys are not left to gc
+	for _, prefix := range [][]byte{
+		group.consumerPrefix(),
+		group.pendingPrefix(),
+		append(s.tagPrefix(streamConsumerPELTag), lengthPrefixed(name)...),
+	} {
+		if err := deletePrefix(s.txn, prefix); err != nil {
+			return false, err
+		}
+	}
+	return true, s.txn.t.Delete(s.groupKey(name))
+}
+
+// deletePrefix removes all the keys with the prefix
+func deletePrefix(txn *Transaction, prefix []byte) error {
+	iter, err := txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for ; iter.Valid() && iter.Key().HasPrefix(prefix); err = iter.Next() {
+		if err != nil {
+			return err
+		}
+		if err := txn.t.Delete(iter.Key()); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (g *StreamGroup) updateMeta() error {
+	val := make([]byte, streamGroupValueLen)
+	copy(val, g.LastID.Bytes())
+	binary.BigEndian.PutUint64(val[16:], uint64(g.Pending))
+	return g.stream.txn.t.Set(g.stream.groupKey(g.Name), val)
+}
+
+// SetLastID sets the last delivered ID of the group
+func (g *StreamGroup) SetLastID(id StreamID) error {
+	g.LastID = id
+	return g.updateMeta()
+}
+
+// Consumer returns the consumer of the name, nil is returned if the consumer does not exist
+func (g *StreamGroup) Consumer(name []byte) (*StreamConsumer, error) {
+	val, err := g.stream.txn.t.Get(g.stream.txn.ctx, g.consumerKey(name))
+	if err != nil {
+		if IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeStreamConsumer(name, val)
+}
+
+// Consumers returns all the consumers of the group
+func (g *StreamGroup) Consumers() ([]*StreamConsumer, error) {
+	prefix := g.consumerPrefix()
+	iter, err := g.stream.txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var consumers []*StreamConsumer
+	for ; iter.Valid() && iter.Key().HasPrefix(prefix); err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+		name := append([]byte{}, iter.Key()[len(prefix):]...)
+		c, err := decodeStreamConsumer(name, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, c)
+	}
+	return consumers, err
+}
+
+// CreateConsumer creates a consumer in the group, false is returned if the consumer exists
+func (g *StreamGroup) CreateConsumer(name []byte) (bool, error) {
+	c, err := g.Consumer(name)
+	if err != nil || c != nil {
+		return false, err
+	}
+	c = &StreamConsumer{Name: name, SeenTime: nowMs()}
+	return true, g.stream.txn.t.Set(g.consumerKey(name), encodeStreamConsumer(c))
+}
+
+// seen creates the consumer if it does not exist and updates its seen time
+func (g *StreamGroup) seen(name []byte) (*StreamConsumer, error) {
+	c, err := g.Consumer(name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = &StreamConsumer{Name: name}
+	}
+	c.SeenTime = nowMs()
+	return c, nil
+}
+
+func (g *StreamGroup) updateConsumer(c *StreamConsumer) error {
+	return g.stream.txn.t.Set(g.consumerKey(c.Name), encodeStreamConsumer(c))
+}
+
+// DeleteConsumer removes the consumer and its pending entries, the number of pending entries is returned
+func (g *StreamGroup) DeleteConsumer(name []byte) (int64, error) {
+	c, err := g.Consumer(name)
+	if err != nil || c == nil {
+		return 0, err
+	}
+	ids, err := g.consumerPendingIDs(name, MinStreamID, 0)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := g.stream.txn.t.Delete(g.pendingKey(id)); err != nil {
+			return 0, err
+		}
+		if err := g.stream.txn.t.Delete(g.consumerPELKey(name, id)); err != nil {
+			return 0, err
+		}
+	}
+	if err := g.stream.txn.t.Delete(g.consumerKey(name)); err != nil {
+		return 0, err
+	}
+	g.Pending -= int64(len(ids))
+	return int64(len(ids)), g.updateMeta()
+}
+
+// GetPending returns the pending entries of the ids, nil is returned for the id not pending
+func (g *StreamGroup) GetPending(ids []StreamID) ([]*StreamPending, error) {
+	keys := make([][]byte, len(ids))
+	for i := range ids {
+		keys[i] = g.pendingKey(ids[i])
+	}
+	values, err := BatchGetValues(g.stream.txn, keys)
+	if err != nil {
+		return nil, err
+	}
+	pendings := make([]*StreamPending, len(ids))
+	for i := range values {
+		if values[i] == nil {
+			continue
+		}
+		if pendings[i], err = decodeStreamPending(ids[i], values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return pendings, nil
+}
+
+// Deliver delivers the entries with ids greater than the last delivered ID to the consumer,
+// the entries are added to the pending entry list unless noack
+func (g *StreamGroup) Deliver(consumer []byte, count int64, noack bool) ([]*StreamEntry, error) {
+	c, err := g.seen(consumer)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*StreamEntry
+	if start, ok := g.LastID.Next(); ok {
+		if entries, err = g.stream.Range(start, MaxStreamID, count, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(entries) != 0 {
+		g.LastID = entries[len(entries)-1].ID
+		if !noack {
+			now := nowMs()
+			for _, entry := range entries {
+				p := &StreamPending{ID: entry.ID, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1}
+				if err := g.setPending(p, nil); err != nil {
+					return nil, err
+				}
+				c.Pending++
+				g.Pending++
+			}
+		}
+		if err := g.updateMeta(); err != nil {
+			return nil, err
+		}
+	}
+	return entries, g.updateConsumer(c)
+}
+
+// setPending saves the pending entry, old is the one replaced if it exists
+func (g *StreamGroup) setPending(p *StreamPending, old *StreamPending) error {
+	txn := g.stream.txn.t
+	if old != nil && string(old.Consumer) != string(p.Consumer) {
+		if err := txn.Delete(g.consumerPELKey(old.Consumer, old.ID)); err != nil {
+			return err
+		}
+	}
+	if err := txn.Set(g.pendingKey(p.ID), encodeStreamPending(p)); err != nil {
+		return err
+	}
+	return txn.Set(g.consumerPELKey(p.Consumer, p.ID), NilValue)
+}
+
+// consumerPendingIDs returns the ids pending for the consumer from start, at most count ids
+// are returned if count is positive
+func (g *StreamGroup) consumerPendingIDs(consumer []byte, start StreamID, count int64) ([]StreamID, error) {
+	prefix := g.consumerPELPrefix(consumer)
+	iter, err := g.stream.txn.t.Iter(append(g.consumerPELPrefix(consumer), start.Bytes()...), kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	var ids []StreamID
+	for ; iter.Valid() && iter.Key().HasPrefix(prefix) && (count <= 0 || int64(len(ids)) < count); err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+		id, err := DecodeStreamID(iter.Key()[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, err
+}
+
+// History returns the entries pending for the consumer with ids greater than after, the delivery
+// counts are increased. The entry is nil if it has been deleted from the stream
+func (g *StreamGroup) History(consumer []byte, after StreamID, count int64) ([]StreamID, []*StreamEntry, error) {
+	c, err := g.seen(consumer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := g.updateConsumer(c); err != nil {
+		return nil, nil, err
+	}
+	start, ok := after.Next()
+	if !ok {
+		return nil, nil, nil
+	}
+	ids, err := g.consumerPendingIDs(consumer, start, count)
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+	pendings, err := g.GetPending(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := nowMs()
+	for _, p := range pendings {
+		if p == nil {
+			continue
+		}
+		p.DeliveryTime = now
+		p.DeliveryCount++
+		if err := g.setPending(p, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+	entries, err := g.stream.Get(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ids, entries, nil
+}
+
+// Ack removes the ids from the pending entry list, the number of ids acknowledged is returned
+func (g *StreamGroup) Ack(ids []StreamID) (int64, error) {
+	pendings, err := g.GetPending(ids)
+	if err != nil {
+		return 0, err
+	}
+	consumers := make(map[string]*StreamConsumer)
+	var acked int64
+	for i, p := range pendings {
+		if p == nil {
+			continue
+		}
+		// the same id may be given more than once
+		for j := i + 1; j < len(ids); j++ {
+			if ids[j] == p.ID {
+				pendings[j] = nil
+			}
+		}
+		if err := g.removePending(p, consumers); err != nil {
+			return 0, err
+		}
+		acked++
+	}
+	if acked == 0 {
+		return 0, nil
+	}
+	for _, c := range consumers {
+		if err := g.updateConsumer(c); err != nil {
+			return 0, err
+		}
+	}
+	return acked, g.updateMeta()
+}
+
+// removePending removes the pending entry and decreases the counters, the consumers modified
+// are cached in consumers and should be saved by the caller
+func (g *StreamGroup) removePending(p *StreamPending, consumers map[string]*StreamConsumer) error {
+	txn := g.stream.txn.t
+	if err := txn.Delete(g.pendingKey(p.ID)); err != nil {
+		return err
+	}
+	if err := txn.Delete(g.consumerPELKey(p.Consumer, p.ID)); err != nil {
+		return err
+	}
+	g.Pending--
+	c, ok := consumers[string(p.Consumer)]
+	if !ok {
+		var err error
+		if c, err = g.Consumer(p.Consumer); err != nil {
+			return err
+		}
+		if c == nil {
+			return nil
+		}
+		consumers[string(p.Consumer)] = c
+	}
+	c.Pending--
+	return nil
+}
+
+// PendingRange returns the pending entries with ids between start and end(both inclusive), the ones
+// idle less than minIdle milliseconds or not owned by the consumer(if it is not empty) are skipped
+func (g *StreamGroup) PendingRange(start, end StreamID, count int64, consumer []byte, minIdle int64) ([]*StreamPending, error) {
+	if start.Compare(end) > 0 {
+		return nil, nil
+	}
+	prefix := g.pendingPrefix()
+	upper := kv.Key(append(g.pendingPrefix(), end.Bytes()...)).Next()
+	iter, err := g.stream.txn.t.Iter(append(g.pendingPrefix(), start.Bytes()...), upper)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	now := nowMs()
+	var pendings []*StreamPending
+	for ; iter.Valid() && iter.Key().HasPrefix(prefix) && (count <= 0 || int64(len(pendings)) < count); err = iter.Next() {
+		if err != nil {
+			return nil, err
+		}
+		id, err := DecodeStreamID(iter.Key()[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		p, err := decodeStreamPending(id, iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if len(consumer) != 0 && string(consumer) != string(p.Consumer) {
+			continue
+		}
+		if now-p.DeliveryTime < minIdle {
+			continue
+		}
+		pendings = append(pendings, p)
+	}
+	return pendings, err
+}
+
+// PendingBounds returns the smallest and the greatest id in the pending entry list
+func (g *StreamGroup) PendingBounds() (StreamID, StreamID, error) {
+	first, err := g.PendingRange(MinStreamID, MaxStreamID, 1, nil, 0)
+	if err != nil || len(first) == 0 {
+		return MinStreamID, MinStreamID, err
+	}
+	prefix := g.pendingPrefix()
+	iter, err := g.stream.txn.t.IterReverse(kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return MinStreamID, MinStreamID, err
+	}
+	defer iter.Close()
+	if !iter.Valid() || !iter.Key().HasPrefix(prefix) {
+		return first[0].ID, first[0].ID, nil
+	}
+	last, err := DecodeStreamID(iter.Key()[len(prefix):])
+	return first[0].ID, last, err
+}
+
+// StreamClaim is the options of claiming pending entries
+type StreamClaim struct {
+	MinIdle    int64 // in milliseconds
+	Time       int64 // the delivery time set, 0 means now
+	RetryCount int64 // the delivery count set, negative means unchanged
+	Force      bool  // create the pending entry if it is not pending but in the stream
+	JustID     bool  // do not increase the delivery count
+}
+
+// Claim changes the owner of the pending entries to the consumer, the claimed pending entries
+// are returned. The pending entries deleted from the stream are removed and returned as deleted
+func (g *StreamGroup) Claim(consumer []byte, ids []StreamID, opts *StreamClaim) ([]*StreamPending, []StreamID, error) {
+	c, err := g.seen(consumer)
+	if err != nil {
+		return nil, nil, err
+	}
+	pendings, err := g.GetPending(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := g.stream.Get(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := nowMs()
+	consumers := map[string]*StreamConsumer{string(consumer): c}
+	claimed := make(map[StreamID]bool)
+	var result []*StreamPending
+	var deleted []StreamID
+	for i, id := range ids {
+		if claimed[id] {
+			continue
+		}
+		p := pendings[i]
+		if entries[i] == nil {
+			// the entry has been deleted from the stream, it is useless to be pending
+			if p != nil {
+				if err := g.removePending(p, consumers); err != nil {
+					return nil, nil, err
+				}
+				deleted = append(deleted, id)
+				claimed[id] = true
+			}
+			continue
+		}
+		if p == nil {
+			if !opts.Force {
+				continue
+			}
+			p = &StreamPending{ID: id, Consumer: consumer}
+			g.Pending++
+		} else {
+			if opts.MinIdle > 0 && now-p.DeliveryTime < opts.MinIdle {
+				continue
+			}
+			if err := g.changeOwner(p, consumers); err != nil {
+				return nil, nil, err
+			}
+		}
+		old := *p
+		p.Consumer = consumer
+		p.DeliveryTime = now
+		if opts.Time > 0 {
+			p.DeliveryTime = opts.Time
+		}
+		if opts.RetryCount >= 0 {
+			p.DeliveryCount = opts.RetryCount
+		} else if !opts.JustID {
+			p.DeliveryCount++
+		}
+		c.Pending++
+		if err := g.setPending(p, &old); err != nil {
+			return nil, nil, err
+		}
+		claimed[id] = true
+		result = append(result, p)
+	}
+	for _, c := range consumers {
+		if err := g.updateConsumer(c); err != nil {
+			return nil, nil, err
+		}
+	}
+	return result, deleted, g.updateMeta()
+}
+
+// changeOwner decreases the pending count of the current owner
+func (g *StreamGroup) changeOwner(p *StreamPending, consumers map[string]*StreamConsumer) error {
+	c, ok := consumers[string(p.Consumer)]
+	if !ok {
+		var err error
+		if c, err = g.Consumer(p.Consumer); err != nil {
+			return err
+		}
+		if c == nil {
+			return nil
+		}
+		consumers[string(p.Consumer)] = c
+	}
+	c.Pending--
+	return nil
+}
@@ -1,15 +1,22 @@
 package db
 
 import (
+	"encoding/binary"
+	"math"
 	"strconv"
 
 	"go.uber.org/zap"
 )
 
+// stringChunkSize is the size of the chunks of a large string, the values longer than it are
+// split into the data keys of the string so a change only rewrites the affected chunks
+var stringChunkSize int64 = 64 * 1024
+
 //StringMeta string meta msg
 type StringMeta struct {
 	Object
 	Value []byte
+	Len   int64 // the length of a chunked value
 }
 
 // String object operate tikv
@@ -60,6 +67,9 @@ func (s *String) Get() ([]byte, error) {
 	if !s.Exist() {
 		return nil, ErrKeyNotFound
 	}
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		return s.readRange(0, s.Meta.Len)
+	}
 	return s.Meta.Value, nil
 }
 
@@ -67,11 +77,25 @@ func (s *String) Get() ([]byte, error) {
 // the num of expire slice is not zero and expire[0] is not zero ,the key add exprie queue
 // otherwise the delete expire queue
 func (s *String) Set(val []byte, expire ...int64) error {
-	timestamp := Now()
-	mkey := MetaKey(s.txn.db, s.key)
+	var at int64
 	if len(expire) != 0 && expire[0] > 0 {
+		at = Now() + expire[0]
+	}
+	return s.SetAt(val, at)
+}
+
+// SetAt sets the string value of a key which expires at the unix time in nanoseconds,
+// the key never expires if at is 0
+func (s *String) SetAt(val []byte, at int64) error {
+	mkey := MetaKey(s.txn.db, s.key)
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		if err := s.renew(); err != nil {
+			return err
+		}
+	}
+	if at > 0 {
 		old := s.Meta.ExpireAt
-		s.Meta.ExpireAt = timestamp + expire[0]
+		s.Meta.ExpireAt = at
 		if err := expireAt(s.txn.t, mkey, s.Meta.ID, s.Meta.Type, old, s.Meta.ExpireAt); err != nil {
 			return err
 		}
@@ -82,32 +106,57 @@ func (s *String) Set(val []byte, expire ...int64) error {
 		}
 		s.Meta.ExpireAt = 0
 	}
-	s.Meta.Value = val
-	return s.txn.t.Set(mkey, s.encode())
+	return s.setValue(val)
+}
+
+// Update overwrites the value and keeps the ttl of the key
+func (s *String) Update(val []byte) error {
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		if err := s.renew(); err != nil {
+			return err
+		}
+		// the expire queue refers to the object id
+		if s.Meta.ExpireAt > 0 {
+			mkey := MetaKey(s.txn.db, s.key)
+			if err := expireAt(s.txn.t, mkey, s.Meta.ID, s.Meta.Type, s.Meta.ExpireAt, s.Meta.ExpireAt); err != nil {
+				return err
+			}
+		}
+	}
+	return s.setValue(val)
 }
 
 // Len value len
 func (s *String) Len() (int, error) {
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		return int(s.Meta.Len), nil
+	}
 	return len(s.Meta.Value), nil
 }
 
 // Exist returns ture if key exist
 func (s *String) Exist() bool {
-	return s.Meta.Value != nil
+	return s.Meta.Value != nil || s.Meta.Encoding == ObjectEncodingChunked
 }
 
 // Append appends a value to key
 func (s *String) Append(value []byte) (int, error) {
-	s.Meta.Value = append(s.Meta.Value, value...)
-	if err := s.txn.t.Set(MetaKey(s.txn.db, s.key), s.encode()); err != nil {
+	vlen, _ := s.Len()
+	if err := s.writeRange(int64(vlen), value); err != nil {
 		return 0, err
 	}
-	return len(s.Meta.Value), nil
+	return s.Len()
 }
 
 // GetSet returns old value ,value replace old value
 func (s *String) GetSet(value []byte) ([]byte, error) {
-	v := s.Meta.Value
+	var v []byte
+	if s.Exist() {
+		var err error
+		if v, err = s.Get(); err != nil {
+			return nil, err
+		}
+	}
 	if err := s.Set(value); err != nil {
 		return nil, err
 	}
@@ -115,8 +164,8 @@ func (s *String) GetSet(value []byte) ([]byte, error) {
 }
 
 // GetRange returns string from the absolute of start to the absolute of end
-func (s *String) GetRange(start, end int) []byte {
-	vlen := len(s.Meta.Value)
+func (s *String) GetRange(start, end int) ([]byte, error) {
+	vlen, _ := s.Len()
 	if end < 0 {
 		end = vlen + end
 	}
@@ -124,35 +173,33 @@ func (s *String) GetRange(start, end int) []byte {
 		start = vlen + start
 	}
 	if start > end || start > vlen || end < 0 {
-		return nil
+		return nil, nil
 	}
-	if end > vlen {
+	if end >= vlen {
 		end = vlen - 1
 	}
 	if start < 0 {
 		start = 0
 	}
-	return s.Meta.Value[start : end+1]
+	return s.readRange(int64(start), int64(end)+1)
 }
 
 // SetRange overwrites part of the string stored at key, starting at the specified offset, for the entire length of value.
-func (s *String) SetRange(offset int64, value []byte) ([]byte, error) {
-	val := s.Meta.Value
-	if int64(len(val)) < offset+int64(len(value)) {
-		val = append(val, make([]byte, offset+int64(len(value))-int64(len(val)))...)
-	}
-	copy(val[offset:], value)
-	if err := s.Set(val); err != nil {
-		return nil, err
+// It returns the length of the string after it was modified.
+func (s *String) SetRange(offset int64, value []byte) (int, error) {
+	if err := s.writeRange(offset, value); err != nil {
+		return 0, err
 	}
-
-	return val, nil
+	return s.Len()
 }
 
 // Incr increments the integer value by the given amount
 // the old value  must be integer
 func (s *String) Incr(delta int64) (int64, error) {
 	value := s.Meta.Value
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		return 0, ErrInteger
+	}
 	if value != nil {
 		v, err := strconv.ParseInt(string(value), 10, 64)
 		if err != nil {
@@ -173,6 +220,9 @@ func (s *String) Incr(delta int64) (int64, error) {
 // the old value  must be float
 func (s *String) Incrf(delta float64) (float64, error) {
 	value := s.Meta.Value
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		return 0, ErrInteger
+	}
 	if value != nil {
 		v, err := strconv.ParseFloat(string(value), 64)
 		if err != nil {
@@ -191,23 +241,22 @@ func (s *String) Incrf(delta float64) (float64, error) {
 // SetBit key offset bitvalue
 // return the off postion of value
 func (s *String) SetBit(offset, on int) (int, error) {
-	val := s.Meta.Value
-	bitoff := offset >> 3
-	llen := int(bitoff) - len(val) + 1
-	if llen > 0 {
-		val = append(val, make([]byte, llen)...)
+	bitoff := int64(offset >> 3)
+	val, err := s.readRange(bitoff, bitoff+1)
+	if err != nil {
+		return 0, err
 	}
 
 	/* Get current values */
-	byteval := int(val[bitoff])
+	byteval := int(val[0])
 	bit := uint(7 - (offset & 0x7))
 	bitval := byteval & (1 << bit)
 
 	/* Update byte with new bit value and return original value */
 	byteval &= (^(1 << bit))
 	byteval = byteval | ((on & 0x1) << bit)
-	val[bitoff] = byte(byteval)
-	if err := s.Set(val); err != nil {
+	val[0] = byte(byteval)
+	if err := s.writeRange(bitoff, val); err != nil {
 		return 0, err
 	}
 	return bitval, nil
@@ -217,14 +266,14 @@ func (s *String) SetBit(offset, on int) (int, error) {
 // offset / 8 > the index of value
 // offset mod 8 +1
 func (s *String) GetBit(offset int) (int, error) {
-	val := s.Meta.Value
-	bitoff := offset >> 3
-	if int(bitoff) > len(val)-1 {
-		return 0, nil
+	bitoff := int64(offset >> 3)
+	val, err := s.readRange(bitoff, bitoff+1)
+	if err != nil {
+		return 0, err
 	}
 
 	/* Get current values */
-	byteval := int(val[bitoff])
+	byteval := int(val[0])
 	bit := uint(7 - (offset & 0x7))
 	bitval := byteval & (1 << bit)
 
@@ -233,39 +282,195 @@ func (s *String) GetBit(offset int) (int, error) {
 
 // BitCount counts the number of set bits (population counting) in a string.
 func (s *String) BitCount(begin, end int) (int, error) {
-	begin, end = initCursor(begin, end, len(s.Meta.Value))
+	vlen, _ := s.Len()
+	begin, end = initCursor(begin, end, vlen)
 	if begin > end {
 		return 0, nil
 	}
-	return redisPopcount(s.Meta.Value[begin : end+1]), nil
+	val, err := s.readRange(int64(begin), int64(end)+1)
+	if err != nil {
+		return 0, err
+	}
+	return redisPopcount(val), nil
 }
 
 // BitPos finds first bit set or clear in a string
 func (s *String) BitPos(bit, begin, end int) (int, error) {
-	begin, end = initCursor(begin, end, len(s.Meta.Value))
+	vlen, _ := s.Len()
+	begin, end = initCursor(begin, end, vlen)
 	// For empty ranges (start > end) we return -1 as an empty range does
 	// not contain a 0 nor a 1.
 	if begin > end {
 		return -1, nil
 	}
-	return redisBitpos(s.Meta.Value[begin:end+1], bit), nil
+	val, err := s.readRange(int64(begin), int64(end)+1)
+	if err != nil {
+		return 0, err
+	}
+	return redisBitpos(val, bit), nil
 }
 
-func (s *String) BitOpAnd() {
+// BitOperation is a bitwise operation between strings
+type BitOperation int
+
+// BitOperation values
+const (
+	BitOpAnd = BitOperation(iota)
+	BitOpOr
+	BitOpXor
+	BitOpNot
+)
+
+// BitOp performs the bitwise operation between the values and returns the result, the shorter
+// values are padded with zeros to the longest one. BitOpNot only uses the first value.
+func BitOp(op BitOperation, values ...[]byte) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+	if op == BitOpNot {
+		res := make([]byte, len(values[0]))
+		for i, b := range values[0] {
+			res[i] = ^b
+		}
+		return res
+	}
+
+	var size int
+	for _, val := range values {
+		if len(val) > size {
+			size = len(val)
+		}
+	}
+	res := make([]byte, size)
+	copy(res, values[0])
+	for _, val := range values[1:] {
+		for i := range res {
+			var b byte
+			if i < len(val) {
+				b = val[i]
+			}
+			switch op {
+			case BitOpAnd:
+				res[i] &= b
+			case BitOpOr:
+				res[i] |= b
+			case BitOpXor:
+				res[i] ^= b
+			}
+		}
+	}
+	return res
 }
 
-func (s *String) BitOpOr() {
+// GetBitField returns the integer of width bits at the bit offset, the bits beyond the value are zeros
+func (s *String) GetBitField(offset int64, width uint, signed bool) (int64, error) {
+	val, err := s.readRange(offset>>3, (offset+int64(width)+7)>>3)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := int64(0); i < int64(width); i++ {
+		pos := offset&0x7 + i
+		v = v<<1 | uint64(val[pos>>3]>>(7-uint(pos&0x7)))&1
+	}
+	// extend the sign
+	if signed && width < 64 && v&(1<<(width-1)) != 0 {
+		v |= ^uint64(0) << width
+	}
+	return int64(v), nil
 }
 
-func (s *String) BitOpXor() {
+// SetBitField sets the integer of width bits at the bit offset, the value grows if needed
+func (s *String) SetBitField(offset int64, width uint, v int64) error {
+	val, err := s.readRange(offset>>3, (offset+int64(width)+7)>>3)
+	if err != nil {
+		return err
+	}
+	for i := int64(0); i < int64(width); i++ {
+		pos := offset&0x7 + i
+		bit := uint(7 - pos&0x7)
+		if uint64(v)>>(int64(width)-1-i)&1 != 0 {
+			val[pos>>3] |= 1 << bit
+		} else {
+			val[pos>>3] &^= 1 << bit
+		}
+	}
+	return s.writeRange(offset>>3, val)
 }
 
-func (s *String) BitOpNot() {
+// BitFieldOverflow is the way to handle the overflows of the bit fields
+type BitFieldOverflow int
+
+// BitFieldOverflow values
+const (
+	BitFieldWrap = BitFieldOverflow(iota)
+	BitFieldSat
+	BitFieldFail
+)
+
+// BitFieldLimit returns value+incr as an integer of width bits, the overflows are wrapped around or
+// saturated to the limits, ok is false if it overflows with BitFieldFail. The unsigned integers are
+// at most 63 bits.
+func BitFieldLimit(value, incr int64, width uint, signed bool, overflow BitFieldOverflow) (v int64, ok bool) {
+	var flow int
+	var max, min int64
+	if signed {
+		max = math.MaxInt64
+		if width < 64 {
+			max = 1<<(width-1) - 1
+		}
+		min = -max - 1
+		maxincr, minincr := max-value, min-value
+		if value > max || (width != 64 && incr > maxincr) || (value >= 0 && incr > 0 && incr > maxincr) {
+			flow = 1
+		} else if value < min || (width != 64 && incr < minincr) || (value < 0 && incr < 0 && incr < minincr) {
+			flow = -1
+		}
+	} else {
+		max = 1<<width - 1
+		if uint64(value) > uint64(max) || (incr > 0 && uint64(incr) > uint64(max)-uint64(value)) {
+			flow = 1
+		} else if incr < 0 && uint64(-incr) > uint64(value) {
+			flow = -1
+		}
+	}
+	if flow == 0 {
+		return value + incr, true
+	}
+
+	switch overflow {
+	case BitFieldWrap:
+		c := uint64(value) + uint64(incr)
+		if !signed {
+			return int64(c & uint64(max)), true
+		}
+		if width < 64 {
+			mask := ^uint64(0) << width
+			if c&(1<<(width-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c), true
+	case BitFieldSat:
+		if flow > 0 {
+			return max, true
+		}
+		return min, true
+	}
+	return 0, false
 }
 
-// encode because of the value is small size , value and meta decode together
+// encode because of the value is small size , value and meta decode together,
+// a chunked value only keeps its length in the meta
 func (s *String) encode() []byte {
 	b := EncodeObject(&s.Meta.Object)
+	if s.Meta.Encoding == ObjectEncodingChunked {
+		m := make([]byte, 8)
+		binary.BigEndian.PutUint64(m, uint64(s.Meta.Len))
+		return append(b, m...)
+	}
 	b = append(b, s.Meta.Value...)
 	return b
 }
@@ -285,12 +490,183 @@ func (s *String) decode(b []byte) error {
 		return ErrTypeMismatch
 	}
 
-	if obj.Encoding != ObjectEncodingRaw {
+	switch obj.Encoding {
+	case ObjectEncodingRaw:
+		s.Meta.Object = *obj
+		if len(b) >= ObjectEncodingLength {
+			s.Meta.Value = b[ObjectEncodingLength:]
+		}
+	case ObjectEncodingChunked:
+		if len(b) < ObjectEncodingLength+8 {
+			return ErrInvalidLength
+		}
+		s.Meta.Object = *obj
+		s.Meta.Len = int64(binary.BigEndian.Uint64(b[ObjectEncodingLength:]))
+	default:
 		return ErrTypeMismatch
 	}
-	s.Meta.Object = *obj
-	if len(b) >= ObjectEncodingLength {
-		s.Meta.Value = b[ObjectEncodingLength:]
+	return nil
+}
+
+// setValue replaces the whole value and saves the meta, a value longer than
+// stringChunkSize is split into chunks
+func (s *String) setValue(val []byte) error {
+	s.Meta.Value, s.Meta.Len = nil, 0
+	if int64(len(val)) <= stringChunkSize {
+		s.Meta.Encoding = ObjectEncodingRaw
+		s.Meta.Value = val
+	} else {
+		s.Meta.Encoding = ObjectEncodingChunked
+		if err := s.writeChunks(0, val); err != nil {
+			return err
+		}
+	}
+	return s.txn.t.Set(MetaKey(s.txn.db, s.key), s.encode())
+}
+
+// renew moves a chunked string to a new object id, the chunks of the old id are left to gc.
+// It is used when the whole value is replaced so the old chunks are never read again.
+func (s *String) renew() error {
+	if err := gc(s.txn.t, DataKey(s.txn.db, s.Meta.ID)); err != nil {
+		return err
+	}
+	s.Meta.ID = UUID()
+	return nil
+}
+
+// chunkKey returns the data key of the idx-th chunk
+func (s *String) chunkKey(idx int64) []byte {
+	key := append(DataKey(s.txn.db, s.Meta.ID), ':')
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(idx))
+	return append(key, b[:]...)
+}
+
+// readRange returns the bytes in [start, end) of the value, only the chunks in
+// the range are read. The bytes beyond the value are zeros.
+func (s *String) readRange(start, end int64) ([]byte, error) {
+	if start >= end {
+		return nil, nil
+	}
+	val := make([]byte, end-start)
+	if s.Meta.Encoding != ObjectEncodingChunked {
+		if start < int64(len(s.Meta.Value)) {
+			copy(val, s.Meta.Value[start:])
+		}
+		return val, nil
+	}
+	if end > s.Meta.Len {
+		end = s.Meta.Len
+	}
+	if start >= end {
+		return val, nil
+	}
+
+	first, last := start/stringChunkSize, (end-1)/stringChunkSize
+	keys := make([][]byte, 0, last-first+1)
+	for idx := first; idx <= last; idx++ {
+		keys = append(keys, s.chunkKey(idx))
+	}
+	chunks, err := BatchGetValues(s.txn, keys)
+	if err != nil {
+		return nil, err
+	}
+	// a chunk is missing or shorter than stringChunkSize if its tail has never been written
+	for i, chunk := range chunks {
+		base := (first + int64(i)) * stringChunkSize
+		if base < start {
+			if start-base >= int64(len(chunk)) {
+				continue
+			}
+			chunk = chunk[start-base:]
+			base = start
+		}
+		copy(val[base-start:end-start], chunk)
+	}
+	return val, nil
+}
+
+// writeRange overwrites the value from offset with data and saves the meta, the value grows if
+// needed. Only the chunks in the range are written, a raw string turns chunked when it grows
+// longer than stringChunkSize.
+func (s *String) writeRange(offset int64, data []byte) error {
+	end := offset + int64(len(data))
+	if s.Meta.Encoding != ObjectEncodingChunked {
+		if end <= stringChunkSize {
+			// copy the value since it may refer to the buffer of the transaction
+			size := len(s.Meta.Value)
+			if int64(size) < end {
+				size = int(end)
+			}
+			val := make([]byte, size)
+			copy(val, s.Meta.Value)
+			copy(val[offset:], data)
+			s.Meta.Value = val
+			return s.txn.t.Set(MetaKey(s.txn.db, s.key), s.encode())
+		}
+
+		val := s.Meta.Value
+		s.Meta.Encoding = ObjectEncodingChunked
+		s.Meta.Value, s.Meta.Len = nil, 0
+		if err := s.writeChunks(0, val); err != nil {
+			return err
+		}
+	}
+	if err := s.writeChunks(offset, data); err != nil {
+		return err
+	}
+	return s.txn.t.Set(MetaKey(s.txn.db, s.key), s.encode())
+}
+
+// writeChunks writes data to the chunks from offset and updates the length of the value
+func (s *String) writeChunks(offset int64, data []byte) error {
+	end := offset + int64(len(data))
+	if len(data) == 0 {
+		return nil
+	}
+
+	first, last := offset/stringChunkSize, (end-1)/stringChunkSize
+	keys := make([][]byte, 0, last-first+1)
+	for idx := first; idx <= last; idx++ {
+		keys = append(keys, s.chunkKey(idx))
+	}
+	// only the chunks at both ends may be partly overwritten
+	ends := [][]byte{keys[0]}
+	if last != first {
+		ends = append(ends, keys[len(keys)-1])
+	}
+	olds, err := BatchGetValues(s.txn, ends)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		base := (first + int64(i)) * stringChunkSize
+		from, to := offset-base, end-base
+		if from < 0 {
+			from = 0
+		}
+		if to > stringChunkSize {
+			to = stringChunkSize
+		}
+		var old []byte
+		if i == 0 {
+			old = olds[0]
+		} else if i == len(keys)-1 {
+			old = olds[len(olds)-1]
+		}
+		size := int64(len(old))
+		if size < to {
+			size = to
+		}
+		chunk := make([]byte, size)
+		copy(chunk, old)
+		copy(chunk[from:to], data[base+from-offset:])
+		if err := s.txn.t.Set(key, chunk); err != nil {
+			return err
+		}
+	}
+	if end > s.Meta.Len {
+		s.Meta.Len = end
 	}
 	return nil
 }
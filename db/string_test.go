@@ -1,6 +1,7 @@
 package db
 
 import (
+	"math"
 	"testing"
 	"time"
 
@@ -213,6 +214,30 @@ func TestStringSet(t *testing.T) {
 	}
 }
 
+func TestStringSetAt(t *testing.T) {
+	key := []byte("StringSetAtKey")
+	at := Now() + int64(time.Hour)
+	MockTest(t, func(txn *Transaction) {
+		s, err := GetString(txn, key)
+		assert.NoError(t, err)
+		assert.NoError(t, s.SetAt(value, at))
+	})
+	MockTest(t, func(txn *Transaction) {
+		s, err := GetString(txn, key)
+		assert.NoError(t, err)
+		assert.Equal(t, at, s.Meta.ExpireAt)
+		assert.NoError(t, s.SetAt(value, 0))
+	})
+	MockTest(t, func(txn *Transaction) {
+		s, err := GetString(txn, key)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), s.Meta.ExpireAt)
+		val, err := s.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, value, val)
+	})
+}
+
 func TestStringLen(t *testing.T) {
 	setValue(t, TestExistKey, value)
 	tests := []struct {
@@ -441,7 +466,8 @@ func TestStringGetRange(t *testing.T) {
 				assert.NoError(t, err)
 				err = s.Set(value)
 				assert.NoError(t, err)
-				got := s.GetRange(tt.args.start, tt.args.end)
+				got, err := s.GetRange(tt.args.start, tt.args.end)
+				assert.NoError(t, err)
 				assert.Equal(t, tt.want, got)
 			}
 			MockTest(t, callFunc)
@@ -488,7 +514,10 @@ func TestStringSetRange(t *testing.T) {
 				assert.NoError(t, err)
 				got, err := s.SetRange(tt.args.offset, tt.args.value)
 				assert.NoError(t, err)
-				assert.Equal(t, tt.want, got)
+				assert.Equal(t, len(tt.want), got)
+				val, err := s.Get()
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, val)
 			}
 			MockTest(t, callFunc)
 		})
@@ -807,3 +836,208 @@ func TestStringBitPos(t *testing.T) {
 		})
 	}
 }
+
+func TestBitOp(t *testing.T) {
+	a := []byte{0xf0, 0x0f}
+	b := []byte{0xff}
+	tests := []struct {
+		name   string
+		op     BitOperation
+		values [][]byte
+		want   []byte
+	}{
+		{name: "and", op: BitOpAnd, values: [][]byte{a, b}, want: []byte{0xf0, 0x00}},
+		{name: "or", op: BitOpOr, values: [][]byte{a, b}, want: []byte{0xff, 0x0f}},
+		{name: "xor", op: BitOpXor, values: [][]byte{a, b}, want: []byte{0x0f, 0x0f}},
+		{name: "not", op: BitOpNot, values: [][]byte{a}, want: []byte{0x0f, 0xf0}},
+		{name: "missing", op: BitOpAnd, values: [][]byte{a, nil}, want: []byte{0x00, 0x00}},
+		{name: "empty", op: BitOpOr, values: [][]byte{nil, nil}, want: []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, BitOp(tt.op, tt.values...))
+		})
+	}
+	// the values are not changed
+	assert.Equal(t, []byte{0xf0, 0x0f}, a)
+}
+
+func TestStringBitField(t *testing.T) {
+	callFunc := func(txn *Transaction) {
+		s, err := GetString(txn, []byte("BitFieldKey"))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Set([]byte{0xff, 0x00}))
+		getBitField := func(offset int64, width uint, signed bool) int64 {
+			v, err := s.GetBitField(offset, width, signed)
+			assert.NoError(t, err)
+			return v
+		}
+		assert.Equal(t, int64(255), getBitField(0, 8, false))
+		assert.Equal(t, int64(-1), getBitField(0, 8, true))
+		assert.Equal(t, int64(240), getBitField(4, 8, false))
+		assert.Equal(t, int64(0), getBitField(12, 8, false))
+		assert.Equal(t, int64(-1), getBitField(0, 1, true))
+
+		assert.NoError(t, s.SetBitField(12, 8, 0xab))
+		assert.Equal(t, []byte{0xff, 0x0a, 0xb0}, s.Meta.Value)
+		assert.Equal(t, int64(0xab), getBitField(12, 8, false))
+		assert.NoError(t, s.SetBitField(0, 4, -8))
+		assert.Equal(t, int64(-8), getBitField(0, 4, true))
+		assert.Equal(t, []byte{0x8f, 0x0a, 0xb0}, s.Meta.Value)
+	}
+	MockTest(t, callFunc)
+}
+
+func TestBitFieldLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    int64
+		incr     int64
+		width    uint
+		signed   bool
+		overflow BitFieldOverflow
+		want     int64
+		ok       bool
+	}{
+		{name: "u8", value: 200, incr: 55, width: 8, overflow: BitFieldFail, want: 255, ok: true},
+		{name: "u8-wrap", value: 255, incr: 10, width: 8, overflow: BitFieldWrap, want: 9, ok: true},
+		{name: "u8-sat", value: 255, incr: 10, width: 8, overflow: BitFieldSat, want: 255, ok: true},
+		{name: "u8-fail", value: 255, incr: 10, width: 8, overflow: BitFieldFail},
+		{name: "u8-underflow-wrap", value: 5, incr: -10, width: 8, overflow: BitFieldWrap, want: 251, ok: true},
+		{name: "u8-underflow-sat", value: 5, incr: -10, width: 8, overflow: BitFieldSat, want: 0, ok: true},
+		{name: "u8-set-wrap", value: 256, width: 8, overflow: BitFieldWrap, want: 0, ok: true},
+		{name: "u8-set-negative", value: -1, width: 8, overflow: BitFieldSat, want: 255, ok: true},
+		{name: "i8-wrap", value: 127, incr: 1, width: 8, signed: true, overflow: BitFieldWrap, want: -128, ok: true},
+		{name: "i8-sat", value: 127, incr: 1, width: 8, signed: true, overflow: BitFieldSat, want: 127, ok: true},
+		{name: "i8-underflow-wrap", value: -128, incr: -1, width: 8, signed: true, overflow: BitFieldWrap, want: 127, ok: true},
+		{name: "i8-underflow-sat", value: -128, incr: -1, width: 8, signed: true, overflow: BitFieldSat, want: -128, ok: true},
+		{name: "i5-set-wrap", value: 100, width: 5, signed: true, overflow: BitFieldWrap, want: 4, ok: true},
+		{name: "i64-wrap", value: math.MaxInt64, incr: 1, width: 64, signed: true, overflow: BitFieldWrap, want: math.MinInt64, ok: true},
+		{name: "i64-sat", value: math.MaxInt64, incr: 1, width: 64, signed: true, overflow: BitFieldSat, want: math.MaxInt64, ok: true},
+		{name: "i64-underflow-fail", value: math.MinInt64, incr: -1, width: 64, signed: true, overflow: BitFieldFail},
+		{name: "i64", value: -5, incr: math.MaxInt64, width: 64, signed: true, overflow: BitFieldFail, want: math.MaxInt64 - 5, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := BitFieldLimit(tt.value, tt.incr, tt.width, tt.signed, tt.overflow)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStringChunked(t *testing.T) {
+	size := stringChunkSize
+	stringChunkSize = 4
+	defer func() { stringChunkSize = size }()
+	key := []byte("ChunkedStringKey")
+
+	getString := func(txn *Transaction) *String {
+		s, err := GetString(txn, key)
+		assert.NoError(t, err)
+		return s
+	}
+	chunks := func(txn *Transaction, s *String) [][]byte {
+		var vals [][]byte
+		for idx := int64(0); idx*stringChunkSize < s.Meta.Len; idx++ {
+			val, err := txn.t.Get(txn.ctx, s.chunkKey(idx))
+			if IsErrNotFound(err) {
+				vals = append(vals, nil)
+				continue
+			}
+			assert.NoError(t, err)
+			vals = append(vals, val)
+		}
+		return vals
+	}
+
+	var id []byte
+	MockTest(t, func(txn *Transaction) {
+		s := getString(txn)
+		assert.NoError(t, s.Set([]byte("abc")))
+		assert.Equal(t, ObjectEncodingRaw, s.Meta.Encoding)
+		// a raw string turns chunked when it grows
+		n, err := s.Append([]byte("defghij"))
+		assert.NoError(t, err)
+		assert.Equal(t, 10, n)
+		assert.Equal(t, ObjectEncodingChunked, s.Meta.Encoding)
+		id = s.Meta.ID
+	})
+	MockTest(t, func(txn *Transaction) {
+		s := getString(txn)
+		assert.Equal(t, ObjectEncodingChunked, s.Meta.Encoding)
+		assert.Equal(t, id, s.Meta.ID)
+		assert.True(t, s.Exist())
+		n, _ := s.Len()
+		assert.Equal(t, 10, n)
+		val, err := s.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abcdefghij"), val)
+		assert.Equal(t, [][]byte{[]byte("abcd"), []byte("efgh"), []byte("ij")}, chunks(txn, s))
+
+		val, err = s.GetRange(3, -3)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("defgh"), val)
+		val, err = s.GetRange(8, 100)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("ij"), val)
+
+		n, err = s.SetRange(3, []byte("XYZ"))
+		assert.NoError(t, err)
+		assert.Equal(t, 10, n)
+		// a write far beyond the value leaves the chunks in between unwritten
+		n, err = s.SetRange(17, []byte("kl"))
+		assert.NoError(t, err)
+		assert.Equal(t, 19, n)
+		assert.Equal(t, [][]byte{[]byte("abcX"), []byte("YZgh"), []byte("ij"), nil, {0, 'k', 'l'}}, chunks(txn, s))
+	})
+	MockTest(t, func(txn *Transaction) {
+		s := getString(txn)
+		val, err := s.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abcXYZghij\x00\x00\x00\x00\x00\x00\x00kl"), val)
+
+		bit, err := s.SetBit(8*13+1, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, bit)
+		bit, err = s.GetBit(8*13 + 1)
+		assert.NoError(t, err)
+		assert.NotEqual(t, 0, bit)
+		cnt, err := s.BitCount(10, 16)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, cnt)
+		assert.NoError(t, s.SetBitField(8*12, 16, 0x0102))
+		v, err := s.GetBitField(8*12+4, 8, false)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0x10), v)
+		assert.Equal(t, []byte{0x01, 0x02}, chunks(txn, s)[3])
+	})
+	MockTest(t, func(txn *Transaction) {
+		// a new value is kept under a new object id
+		s := getString(txn)
+		ttl := int64(time.Hour)
+		assert.NoError(t, s.Set([]byte("0123456789"), ttl))
+		assert.NotEqual(t, id, s.Meta.ID)
+		assert.Equal(t, ObjectEncodingChunked, s.Meta.Encoding)
+		_, err := txn.t.Get(txn.ctx, toTiKVGCKey(DataKey(txn.db, id)))
+		assert.NoError(t, err)
+		id = s.Meta.ID
+		assert.NoError(t, s.Update([]byte("abc")))
+		assert.NotEqual(t, id, s.Meta.ID)
+		assert.Equal(t, ObjectEncodingRaw, s.Meta.Encoding)
+		// the expiration refers to the new object id
+		ekey, err := expireKey(MetaKey(txn.db, key), s.Meta.ExpireAt)
+		assert.NoError(t, err)
+		eid, err := txn.t.Get(txn.ctx, ekey)
+		assert.NoError(t, err)
+		assert.Equal(t, s.Meta.ID, eid)
+	})
+	MockTest(t, func(txn *Transaction) {
+		s := getString(txn)
+		val, err := s.Get()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abc"), val)
+		assert.NotZero(t, s.Meta.ExpireAt)
+		assert.NoError(t, txn.Destory(&s.Meta.Object, key))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/url"
 	"strings"
+	"sync/atomic"
 
 	"github.com/distributedio/titan/conf"
 	"github.com/distributedio/titan/db/store"
@@ -38,6 +39,9 @@ func RegisterTask(db *DB, conf *conf.TiKV) error {
 	if !conf.ZT.Disable {
 		register_list = append(register_list, RegisterZT())
 	}
+	if !conf.KeyCount.Disable {
+		register_list = append(register_list, RegisterKeyCountTask())
+	}
 	if len(register_list) == 0 {
 		return nil
 	}
@@ -45,6 +49,7 @@ func RegisterTask(db *DB, conf *conf.TiKV) error {
 	if err = task_pool.Regist(register_list...); err != nil {
 		return err
 	}
+	db.kv.tasks = task_pool.list
 	task_pool.Start()
 	return nil
 }
@@ -124,6 +129,7 @@ func (tp *TaskPool) Start() {
 					continue
 				}
 				task.proc(task)
+				atomic.StoreInt32(&task.leader, 0)
 				metrics.GetMetrics().IsLeaderGaugeVec.WithLabelValues(task.label).Set(0)
 			}
 		}(task)
@@ -148,6 +154,12 @@ func RegisterTikvGCTask() TaskRegister {
 	}
 }
 
+func RegisterKeyCountTask() TaskRegister {
+	return func(db *DB, cli *clientv3.Client, conf *conf.TiKV) (*Task, error) {
+		return NewTask(db, cli, sysKeyCountLeader, conf.KeyCount.LeaderTTL, conf.KeyCount, StartKeyCount, "KC")
+	}
+}
+
 func RegisterGCTask() TaskRegister {
 	return func(db *DB, cli *clientv3.Client, conf *conf.TiKV) (*Task, error) {
 		return NewTask(db, cli, sysGCLeader, conf.GC.LeaderTTL, conf.GC, StartGC, "GC")
@@ -181,6 +193,7 @@ type Task struct {
 	conf    interface{}
 	proc    TaskProc
 	label   string
+	leader  int32 // 1 if the task is the leader
 }
 
 func (t *Task) Campaign() error {
@@ -202,6 +215,7 @@ func (t *Task) Campaign() error {
 	if logEnv := zap.L().Check(zap.DebugLevel, "Elect leader success"); logEnv != nil {
 		logEnv.Write(zap.ByteString("key", key), zap.ByteString("id", t.id), zap.String("label", t.label))
 	}
+	atomic.StoreInt32(&t.leader, 1)
 	metrics.GetMetrics().IsLeaderGaugeVec.WithLabelValues(t.label).Set(1)
 	return nil
 }
@@ -113,6 +113,7 @@ func getLastSafePoint(db *DB) (*time.Time, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer txn.Rollback()
 	val, err := txn.t.Get(txn.ctx, sysTiKVGCLastSafePoint)
 	if err != nil {
 		if IsErrNotFound(err) {
@@ -21,6 +21,11 @@ type ZSet struct {
 	meta ZSetMeta
 	key  []byte
 	txn  *Transaction
+
+	// detached is true if the sorted set is not stored at the key until Replace is called
+	detached bool
+	// rank tells if the rank counters are maintained for the sorted set
+	rank zsetRankState
 }
 
 type MemberScore struct {
@@ -46,6 +51,7 @@ func newZSet(txn *Transaction, key []byte) *ZSet {
 			},
 			Len: 0,
 		},
+		rank: zsetRankNew,
 	}
 }
 
@@ -81,6 +87,7 @@ func GetZSet(txn *Transaction, key []byte) (*ZSet, error) {
 	}
 	zset.meta.Object = *obj
 	zset.meta.Len = int64(binary.BigEndian.Uint64(m[:8]))
+	zset.rank = zsetRankUnknown
 
 	return zset, nil
 }
@@ -100,6 +107,7 @@ func (zset *ZSet) ZAdd(members [][]byte, scores []float64) (int64, error) {
 	}
 
 	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	rank := make(zsetRankDelta)
 	var found bool
 	var start time.Time
 	costDel, costSetMem, costSetScore := int64(0), int64(0), int64(0)
@@ -118,6 +126,7 @@ func (zset *ZSet) ZAdd(members [][]byte, scores []float64) (int64, error) {
 			if err != nil {
 				return added, err
 			}
+			rank.add(dkey, oldValues[i], members[i], -1)
 		}
 		memberKey := zsetMemberKey(dkey, members[i])
 		bytesScore, err := EncodeFloat64(scores[i])
@@ -138,6 +147,7 @@ func (zset *ZSet) ZAdd(members [][]byte, scores []float64) (int64, error) {
 		if err != nil {
 			return added, err
 		}
+		rank.add(dkey, bytesScore, members[i], 1)
 
 		if !found {
 			added += 1
@@ -147,6 +157,7 @@ func (zset *ZSet) ZAdd(members [][]byte, scores []float64) (int64, error) {
 		zap.Int64("set memberKey", costSetMem/1000),
 		zap.Int64("set scoreKey", costSetScore/1000))
 
+	zset.updateRank(rank)
 	zset.meta.Len += added
 	start = time.Now()
 	if err = zset.updateMeta(); err != nil {
@@ -167,7 +178,22 @@ func (zset *ZSet) MGet(members [][]byte) ([][]byte, error) {
 	return BatchGetValues(zset.txn, ikeys)
 }
 
+// Replace stores the sorted set at its key in place of the old value, the key is deleted if the sorted set is empty
+func (zset *ZSet) Replace() error {
+	if _, err := zset.txn.Kv().Delete([][]byte{zset.key}); err != nil {
+		return err
+	}
+	zset.detached = false
+	if zset.meta.Len == 0 {
+		return nil
+	}
+	return zset.updateMeta()
+}
+
 func (zset *ZSet) updateMeta() error {
+	if zset.detached {
+		return nil
+	}
 	meta := zset.encodeMeta(zset.meta)
 	return zset.txn.t.Set(MetaKey(zset.txn.db, zset.key), meta)
 }
@@ -405,6 +431,7 @@ func (zset *ZSet) ZRem(members [][]byte) (int64, error) {
 	}
 
 	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	rank := make(zsetRankDelta)
 	costDelMem, costDelScore := int64(0), int64(0)
 	for i := range members {
 		if scores[i] == nil {
@@ -426,11 +453,13 @@ func (zset *ZSet) ZRem(members [][]byte) (int64, error) {
 		if err != nil {
 			return deleted, err
 		}
+		rank.add(dkey, scores[i], members[i], -1)
 
 		deleted += 1
 	}
 	zap.L().Debug("zrem cost(us)", zap.Int64("del memberKey", costDelMem/1000),
 		zap.Int64("del scoreKey", costDelScore/1000))
+	zset.updateRank(rank)
 	zset.meta.Len -= deleted
 
 	if zset.meta.Len == 0 {
@@ -498,7 +527,8 @@ func (zset *ZSet) ZRemRangeByLex(start, stop []byte, startInclude, stopInclude b
 		deleted   int64  = 0
 		dkey      []byte = DataKey(zset.txn.db, zset.meta.ID)
 		memPrefix []byte = zsetMemberKey(dkey, []byte{})
-		err       error
+		rank             = make(zsetRankDelta)
+		delErr    error
 	)
 
 	f := func(key, val []byte) bool {
@@ -512,33 +542,299 @@ func (zset *ZSet) ZRemRangeByLex(start, stop []byte, startInclude, stopInclude b
 			return true
 		}
 		scoreKey := zsetScoreKey(dkey, val, member)
-		if err = zset.txn.t.Delete(scoreKey); err != nil {
+		if delErr = zset.txn.t.Delete(scoreKey); delErr != nil {
 			return false
 		}
-		if err = zset.txn.t.Delete(key); err != nil {
+		if delErr = zset.txn.t.Delete(key); delErr != nil {
 			return false
 		}
+		rank.add(dkey, val, member, -1)
 		deleted++
 		return true
 	}
 
-	if err = zset.ZAnyOrderRangeByLex(start, stop, stopInclude, true, f); err != nil {
+	if err := zset.ZAnyOrderRangeByLex(start, stop, stopInclude, true, f); err != nil {
 		return deleted, err
 	}
-	if zset.meta.Len == deleted {
-		mkey := MetaKey(zset.txn.db, zset.key)
-		err = zset.txn.t.Delete(mkey)
+	if delErr != nil {
+		return deleted, delErr
+	}
+	zset.updateRank(rank)
+	return deleted, zset.shrink(deleted)
+}
+
+// ZRemRangeByScore removes the members whose scores are in the range, it returns the number of the
+// removed members. ErrRemoveTooMany is returned if the range is too large for a transaction
+func (zset *ZSet) ZRemRangeByScore(start float64, startInclude bool, stop float64, stopInclude bool) (int64, error) {
+	if !zset.Exist() || start > stop || (start == stop && (!startInclude || !stopInclude)) {
+		return 0, nil
+	}
+	byteStart, err := EncodeFloat64(start)
+	if err != nil {
+		return 0, err
+	}
+	byteStop, err := EncodeFloat64(stop)
+	if err != nil {
+		return 0, err
+	}
+	// the ranks of the first and the last members in the range
+	first, err := zset.countBelow(byteStart, !startInclude)
+	if err != nil {
+		return 0, err
+	}
+	end, err := zset.countBelow(byteStop, stopInclude)
+	if err != nil {
+		return 0, err
+	}
+	return zset.removeRange(first, end-1)
+}
+
+// ZRemRangeByRank removes the members whose ranks are in [start, stop], the negative ranks count from
+// the end. It returns the number of the removed members, ErrRemoveTooMany is returned if the range
+// is too large for a transaction
+func (zset *ZSet) ZRemRangeByRank(start, stop int64) (int64, error) {
+	if start < 0 {
+		if start = zset.meta.Len + start; start < 0 {
+			start = 0
+		}
+	}
+	if stop < 0 {
+		stop = zset.meta.Len + stop
+	} else if stop >= zset.meta.Len {
+		stop = zset.meta.Len - 1
+	}
+	return zset.removeRange(start, stop)
+}
+
+// zsetRemoveKeyLimit is the max number of the keys written by removing a range in a transaction, the
+// rank counters of the members are counted as well. When deleting the range writes more keys, the rest
+// of the sorted set is copied to a new data key and the old one is left to gc if copying writes fewer.
+// Otherwise the removal is rejected rather than split into transactions which are not atomic
+var zsetRemoveKeyLimit int64 = 65536
+
+// removeRange removes the members whose ranks are in [start, stop]
+func (zset *ZSet) removeRange(start, stop int64) (int64, error) {
+	if start < 0 || stop < start || start >= zset.meta.Len {
+		return 0, nil
+	}
+	count := stop - start + 1
+	if count == zset.meta.Len {
+		// remove the whole sorted set in background
+		return count, zset.txn.Destory(&zset.meta.Object, zset.key)
+	}
+	ranked, err := zset.hasRank()
+	if err != nil {
+		return 0, err
+	}
+	// a member and its score, and the counters along its path which are at most one per level
+	keys := int64(2 + byteScoreLen + zsetRankMemberLen)
+	if count*keys <= zsetRemoveKeyLimit || (!ranked && count*2 <= zsetRemoveKeyLimit) {
+		return zset.deleteRange(start, stop)
+	}
+	// the copied members are always counted
+	if (zset.meta.Len-count)*keys <= zsetRemoveKeyLimit {
+		return count, zset.rebuild(start, stop)
+	}
+	return 0, ErrRemoveTooMany
+}
+
+// deleteRange deletes the members whose ranks are in [start, stop] one by one
+func (zset *ZSet) deleteRange(start, stop int64) (int64, error) {
+	count := stop - start + 1
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	scorePrefix := ZSetScorePrefix(dkey)
+	upperBoundKey := kv.Key(scorePrefix).PrefixNext()
+	// seek from the nearer end of the score index
+	var iter Iterator
+	var err error
+	skip := start
+	reverse := zset.meta.Len-1-stop < start
+	if reverse {
+		skip = zset.meta.Len - 1 - stop
+		iter, err = zset.txn.t.IterReverse(upperBoundKey)
+	} else {
+		iter, err = zset.txn.t.Iter(scorePrefix, upperBoundKey)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var i, deleted int64
+	rank := make(zsetRankDelta)
+	for ; deleted < count && iter.Valid() && iter.Key().HasPrefix(scorePrefix); err = iter.Next() {
 		if err != nil {
-			return deleted, err
+			return 0, err
 		}
-		if zset.meta.Object.ExpireAt > 0 {
-			if err = unExpireAt(zset.txn.t, mkey, zset.meta.Object.ExpireAt); err != nil {
-				return deleted, err
+		if i++; i <= skip {
+			continue
+		}
+		key := iter.Key()
+		if len(key) <= len(scorePrefix)+byteScoreLen+len(":") {
+			zap.L().Error("score&member's length isn't enough to be decoded",
+				zap.ByteString("meta key", zset.key), zap.ByteString("data key", key))
+			continue
+		}
+		score := key[len(scorePrefix) : len(scorePrefix)+byteScoreLen]
+		member := key[len(scorePrefix)+byteScoreLen+len(":"):]
+		rank.add(dkey, score, member, -1)
+		if err := zset.txn.t.Delete(zsetMemberKey(dkey, member)); err != nil {
+			return 0, err
+		}
+		if err := zset.txn.t.Delete(key); err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	zset.updateRank(rank)
+	return deleted, zset.shrink(deleted)
+}
+
+// rebuild copies the members whose ranks are not in [start, stop] to a new data key, and
+// leaves the old one to gc. The members before the range and after it are read from the
+// two ends of the score index, the range itself is not read
+func (zset *ZSet) rebuild(start, stop int64) error {
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	scorePrefix := ZSetScorePrefix(dkey)
+	upperBoundKey := kv.Key(scorePrefix).PrefixNext()
+
+	id := UUID()
+	newKey := DataKey(zset.txn.db, id)
+	rank := make(zsetRankDelta)
+	var kept int64
+	// copyN copies the first n members of the iterator
+	copyN := func(iter Iterator, n int64) error {
+		defer iter.Close()
+		var err error
+		for i := int64(0); i < n && iter.Valid() && iter.Key().HasPrefix(scorePrefix); i, err = i+1, iter.Next() {
+			if err != nil {
+				return err
+			}
+			key := iter.Key()
+			if len(key) <= len(scorePrefix)+byteScoreLen+len(":") {
+				zap.L().Error("score&member's length isn't enough to be decoded",
+					zap.ByteString("meta key", zset.key), zap.ByteString("data key", key))
+				continue
 			}
+			score := key[len(scorePrefix) : len(scorePrefix)+byteScoreLen]
+			member := key[len(scorePrefix)+byteScoreLen+len(":"):]
+			if err := zset.txn.t.Set(zsetMemberKey(newKey, member), score); err != nil {
+				return err
+			}
+			if err := zset.txn.t.Set(zsetScoreKey(newKey, score, member), NilValue); err != nil {
+				return err
+			}
+			rank.add(newKey, score, member, 1)
+			kept++
 		}
+		return err
 	}
 
-	return deleted, nil
+	iter, err := zset.txn.t.Iter(scorePrefix, upperBoundKey)
+	if err != nil {
+		return err
+	}
+	if err := copyN(iter, start); err != nil {
+		return err
+	}
+	iter, err = zset.txn.t.IterReverse(upperBoundKey)
+	if err != nil {
+		return err
+	}
+	if err := copyN(iter, zset.meta.Len-1-stop); err != nil {
+		return err
+	}
+	if err := gc(zset.txn.t, dkey); err != nil {
+		return err
+	}
+
+	zset.meta.ID = id
+	// the pending changes of the old counters are left to gc as well
+	delete(zset.txn.zranks, string(dkey))
+	zset.meta.Len = kept
+	zset.rank = zsetRankNew
+	zset.updateRank(rank)
+	return zset.updateMeta()
+}
+
+// ZPop removes and returns up to count members with the lowest scores from the head of the
+// score index, or the members with the highest scores from the tail if min is false
+func (zset *ZSet) ZPop(count int64, min bool) ([][]byte, []float64, error) {
+	if !zset.Exist() || count <= 0 {
+		return nil, nil, nil
+	}
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	scorePrefix := ZSetScorePrefix(dkey)
+	upperBoundKey := kv.Key(scorePrefix).PrefixNext()
+	var iter Iterator
+	var err error
+	if min {
+		iter, err = zset.txn.t.Iter(scorePrefix, upperBoundKey)
+	} else {
+		iter, err = zset.txn.t.IterReverse(upperBoundKey)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+
+	var members [][]byte
+	var scores []float64
+	rank := make(zsetRankDelta)
+	for ; int64(len(members)) < count && iter.Valid() && iter.Key().HasPrefix(scorePrefix); err = iter.Next() {
+		if err != nil {
+			return nil, nil, err
+		}
+		key := iter.Key()
+		if len(key) <= len(scorePrefix)+byteScoreLen+len(":") {
+			zap.L().Error("score&member's length isn't enough to be decoded",
+				zap.ByteString("meta key", zset.key), zap.ByteString("data key", key))
+			continue
+		}
+		score := key[len(scorePrefix) : len(scorePrefix)+byteScoreLen]
+		member := append([]byte{}, key[len(scorePrefix)+byteScoreLen+len(":"):]...)
+		if err := zset.txn.t.Delete(key); err != nil {
+			return nil, nil, err
+		}
+		if err := zset.txn.t.Delete(zsetMemberKey(dkey, member)); err != nil {
+			return nil, nil, err
+		}
+		rank.add(dkey, score, member, -1)
+		members = append(members, member)
+		scores = append(scores, DecodeFloat64(score))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zset.updateRank(rank)
+	if err := zset.shrink(int64(len(members))); err != nil {
+		return nil, nil, err
+	}
+	return members, scores, nil
+}
+
+// shrink updates the length after the members are removed, the sorted set is removed if it turns to be empty
+func (zset *ZSet) shrink(deleted int64) error {
+	if deleted == 0 {
+		return nil
+	}
+	zset.meta.Len -= deleted
+	if zset.meta.Len > 0 {
+		return zset.updateMeta()
+	}
+	mkey := MetaKey(zset.txn.db, zset.key)
+	if err := zset.txn.t.Delete(mkey); err != nil {
+		return err
+	}
+	if zset.meta.Object.ExpireAt > 0 {
+		return unExpireAt(zset.txn.t, mkey, zset.meta.Object.ExpireAt)
+	}
+	return nil
 }
 
 func (zset *ZSet) ZCard() int64 {
@@ -2,13 +2,15 @@ package db
 
 import (
 	"context"
+	"math"
 	"strconv"
 	"testing"
 
+	"github.com/pingcap/tidb/kv"
 	"github.com/stretchr/testify/assert"
 )
 
-func getZSet(t *testing.T, key []byte) (*ZSet, *Transaction, error) {
+func getZSet(t testing.TB, key []byte) (*ZSet, *Transaction, error) {
 	txn, err := mockDB.Begin()
 	assert.NotNil(t, txn)
 	assert.NoError(t, err)
@@ -528,3 +530,369 @@ func TestZSet_ZScan(t *testing.T) {
 		})
 	}
 }
+
+func TestZSetZRank(t *testing.T) {
+	key := []byte("TestZSetZRank")
+	members := make([][]byte, 0, 300)
+	scores := make([]float64, 0, 300)
+	for i := 0; i < 300; i++ {
+		members = append(members, []byte("m"+strconv.Itoa(i)))
+		// negative, fractional and equal scores
+		scores = append(scores, float64(i%100-50)*1.5)
+	}
+	// the members with the same score are ordered by the names, including the names
+	// which are the prefixes of the others and the ones sharing more bytes than the counters hold
+	members = append(members, []byte("m"))
+	scores = append(scores, 0)
+	for i := 0; i < 20; i++ {
+		members = append(members, []byte("a-long-shared-prefix-"+strconv.Itoa(i)))
+		scores = append(scores, 0)
+	}
+
+	// assertRanks checks the ranks against the order of the score index
+	assertRanks := func(zset *ZSet) {
+		items, err := zset.ZAnyOrderRange(0, -1, false, true)
+		assert.NoError(t, err)
+		assert.Equal(t, int(zset.ZCard()), len(items))
+		for i, member := range items {
+			rank, err := zset.ZRank(member)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(i), rank, string(member))
+			rank, err = zset.ZRevRank(member)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(items)-1-i), rank, string(member))
+		}
+	}
+
+	zset, txn, err := getZSet(t, key)
+	assert.NoError(t, err)
+	ranked, err := zset.hasRank()
+	assert.NoError(t, err)
+	assert.True(t, ranked)
+	_, err = zset.ZAdd(members, scores)
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, key)
+	assert.NoError(t, err)
+	assertRanks(zset)
+	ranked, err = zset.hasRank()
+	assert.NoError(t, err)
+	assert.True(t, ranked)
+	assert.Equal(t, ObjectEncodingHT, zset.meta.Encoding)
+	rank, err := zset.ZRank([]byte("none"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), rank)
+
+	// the counters follow the updates and the removals
+	_, err = zset.ZAdd([][]byte{[]byte("m0"), []byte("m1"), []byte("new")}, []float64{1000, -1000, 0})
+	assert.NoError(t, err)
+	_, err = zset.ZRem([][]byte{[]byte("m2"), []byte("m3")})
+	assert.NoError(t, err)
+	_, err = zset.ZRemRangeByLex([]byte("m5"), []byte("m6"), true, false)
+	assert.NoError(t, err)
+	score, err := zset.ZIncrBy([]byte("m4"), 2.5)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(-66.5), score)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, key)
+	assert.NoError(t, err)
+	assertRanks(zset)
+	rank, err = zset.ZRank([]byte("m1"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rank)
+	rank, err = zset.ZRevRank([]byte("m0"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rank)
+
+	// the counters are removed with the members
+	items, err := zset.ZAnyOrderRange(0, -1, false, true)
+	assert.NoError(t, err)
+	_, err = zset.ZRem(items)
+	assert.NoError(t, err)
+	assert.NoError(t, txn.flushRanks())
+	dkey := DataKey(txn.db, zset.meta.ID)
+	start := zsetRankLevelKey(dkey, 1, nil)
+	n, err := zset.countKeys(start, kv.Key(zsetRankPrefix(dkey)).PrefixNext())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestZSetZRankBatch(t *testing.T) {
+	key := []byte("TestZSetZRankBatch")
+	zset, txn, err := getZSet(t, key)
+	assert.NoError(t, err)
+	_, err = zset.ZAdd([][]byte{[]byte("a"), []byte("b")}, []float64{1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	// a member change writes no more counters than the levels, the changes cancelling
+	// each other are not written
+	zset, txn, err = getZSet(t, key)
+	assert.NoError(t, err)
+	_, err = zset.ZAdd([][]byte{[]byte("a-long-member")}, []float64{3})
+	assert.NoError(t, err)
+	dkey := string(DataKey(txn.db, zset.meta.ID))
+	assert.Len(t, txn.zranks[dkey].delta, byteScoreLen+zsetRankMemberLen)
+	_, err = zset.ZRem([][]byte{[]byte("a-long-member")})
+	assert.NoError(t, err)
+	for _, delta := range txn.zranks[dkey].delta {
+		assert.Equal(t, int64(0), delta)
+	}
+	_, err = zset.ZIncrBy([]byte("a"), 5)
+	assert.NoError(t, err)
+	rank, err := zset.ZRank([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rank)
+	assert.Empty(t, txn.zranks)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, key)
+	assert.NoError(t, err)
+	rank, err = zset.ZRank([]byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), rank)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestZSetZRankWithoutCounters(t *testing.T) {
+	zset, txn, err := getZSet(t, []byte("TestZSetZRankWithoutCounters"))
+	assert.NoError(t, err)
+	// the sorted sets created before the counters
+	zset.rank = zsetUnranked
+	_, err = zset.ZAdd([][]byte{[]byte("a"), []byte("b"), []byte("c")}, []float64{3, 1, 2})
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, []byte("TestZSetZRankWithoutCounters"))
+	assert.NoError(t, err)
+	ranked, err := zset.hasRank()
+	assert.NoError(t, err)
+	assert.False(t, ranked)
+	rank, err := zset.ZRank([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rank)
+	rank, err = zset.ZRevRank([]byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rank)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestZSetZRemRange(t *testing.T) {
+	zset, txn, err := getZSet(t, []byte("TestZSetZRemRange"))
+	assert.NoError(t, err)
+	var members [][]byte
+	var scores []float64
+	for i := 0; i < 10; i++ {
+		members = append(members, []byte{byte('a' + i)})
+		scores = append(scores, float64(i+1))
+	}
+	_, err = zset.ZAdd(members, scores)
+	assert.NoError(t, err)
+
+	// b, c
+	deleted, err := zset.ZRemRangeByScore(2, true, 4, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Equal(t, int64(8), zset.ZCard())
+	rank, err := zset.ZRank([]byte("d"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rank)
+
+	// i, j
+	deleted, err = zset.ZRemRangeByRank(-2, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	items, err := zset.ZAnyOrderRange(0, -1, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("d"), []byte("e"), []byte("f"), []byte("g"), []byte("h")}, items)
+
+	// the rest are moved to a new data key when too many are removed
+	limit := zsetRemoveKeyLimit
+	zsetRemoveKeyLimit = 2 * (2 + byteScoreLen + zsetRankMemberLen)
+	defer func() { zsetRemoveKeyLimit = limit }()
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	deleted, err = zset.ZRemRangeByRank(0, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	assert.NotEqual(t, dkey, DataKey(zset.txn.db, zset.meta.ID))
+	_, err = txn.t.Get(txn.ctx, toTiKVGCKey(dkey))
+	assert.NoError(t, err)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, []byte("TestZSetZRemRange"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), zset.ZCard())
+	rank, err = zset.ZRank([]byte("h"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rank)
+	score, err := zset.ZScore([]byte("g"))
+	assert.NoError(t, err)
+	assert.Equal(t, "7", string(score))
+
+	deleted, err = zset.ZRemRangeByScore(math.Inf(-1), true, math.Inf(1), true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.NoError(t, txn.Commit(context.TODO()))
+
+	zset, txn, err = getZSet(t, []byte("TestZSetZRemRange"))
+	assert.NoError(t, err)
+	assert.False(t, zset.Exist())
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestZSetZRemRangeTooMany(t *testing.T) {
+	zset, txn, err := getZSet(t, []byte("TestZSetZRemRangeTooMany"))
+	assert.NoError(t, err)
+	var members [][]byte
+	var scores []float64
+	for i := 0; i < 10; i++ {
+		members = append(members, []byte{byte('a' + i)})
+		scores = append(scores, float64(i+1))
+	}
+	_, err = zset.ZAdd(members, scores)
+	assert.NoError(t, err)
+
+	limit := zsetRemoveKeyLimit
+	zsetRemoveKeyLimit = 2 * (2 + byteScoreLen + zsetRankMemberLen)
+	defer func() { zsetRemoveKeyLimit = limit }()
+
+	// the counters are counted, so neither the range nor the rest fits in the limit
+	_, err = zset.ZRemRangeByRank(2, 6)
+	assert.Equal(t, ErrRemoveTooMany, err)
+	_, err = zset.ZRemRangeByScore(2, true, 8, true)
+	assert.Equal(t, ErrRemoveTooMany, err)
+	assert.Equal(t, int64(10), zset.ZCard())
+
+	deleted, err := zset.ZRemRangeByRank(2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	items, err := zset.ZAnyOrderRange(0, -1, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("e"), []byte("f"), []byte("g"), []byte("h"), []byte("i"), []byte("j")}, items)
+	assert.NoError(t, txn.Commit(context.TODO()))
+}
+
+func TestZSetZRemRangeWithoutCounters(t *testing.T) {
+	zset, txn, err := getZSet(t, []byte("TestZSetZRemRangeWithoutCounters"))
+	assert.NoError(t, err)
+	zset.rank = zsetUnranked
+	_, err = zset.ZAdd([][]byte{[]byte("a"), []byte("b"), []byte("c")}, []float64{3, 1, 2})
+	assert.NoError(t, err)
+
+	deleted, err := zset.ZRemRangeByScore(1, false, 3, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	items, err := zset.ZAnyOrderRange(0, -1, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b")}, items)
+	assert.NoError(t, txn.Rollback())
+}
+
+func TestZSetCombine(t *testing.T) {
+	zset1, txn, err := getZSet(t, []byte("TestZSetCombine1"))
+	assert.NoError(t, err)
+	_, err = zset1.ZAdd([][]byte{[]byte("a"), []byte("b"), []byte("c")}, []float64{1, 2, math.Inf(1)})
+	assert.NoError(t, err)
+	zset2, err := GetZSet(txn, []byte("TestZSetCombine2"))
+	assert.NoError(t, err)
+	_, err = zset2.ZAdd([][]byte{[]byte("b"), []byte("c"), []byte("d")}, []float64{3, math.Inf(-1), 5})
+	assert.NoError(t, err)
+
+	combine := func(op ZSetOp, weights []float64, agg Aggregate, withEmpty bool) map[string]float64 {
+		iter1, err := zset1.MemberIter()
+		assert.NoError(t, err)
+		defer iter1.Close()
+		iter2, err := zset2.MemberIter()
+		assert.NoError(t, err)
+		defer iter2.Close()
+		iters := []*ZSetMemberIter{iter1, iter2}
+		if withEmpty {
+			iters = append(iters, nil)
+		}
+
+		result := make(map[string]float64)
+		var last []byte
+		assert.NoError(t, ZSetCombine(op, iters, weights, agg, func(member []byte, score float64) error {
+			// the members are in order
+			assert.True(t, string(last) < string(member))
+			last = member
+			result[string(member)] = score
+			return nil
+		}))
+		return result
+	}
+
+	assert.Equal(t, map[string]float64{"a": 1, "b": 5, "c": 0, "d": 5}, combine(ZSetUnion, nil, AggregateSum, false))
+	assert.Equal(t, map[string]float64{"a": 2, "b": 4, "c": math.Inf(1), "d": 0}, combine(ZSetUnion, []float64{2, 0}, AggregateMax, false))
+	assert.Equal(t, map[string]float64{"b": 2, "c": math.Inf(-1)}, combine(ZSetInter, nil, AggregateMin, false))
+	assert.Equal(t, map[string]float64{}, combine(ZSetInter, nil, AggregateSum, true))
+	assert.Equal(t, map[string]float64{"a": 1}, combine(ZSetDiff, []float64{2, 2}, AggregateSum, true))
+
+	// the first set is empty
+	iter, err := zset2.MemberIter()
+	assert.NoError(t, err)
+	defer iter.Close()
+	var members []string
+	assert.NoError(t, ZSetCombine(ZSetUnion, []*ZSetMemberIter{nil, iter}, nil, AggregateSum, func(member []byte, score float64) error {
+		members = append(members, string(member))
+		return nil
+	}))
+	assert.Equal(t, []string{"b", "c", "d"}, members)
+	assert.NoError(t, txn.Rollback())
+}
+
+// BenchmarkZSetZAdd adds a member to a sorted set of 10000 members per transaction, keys/op
+// is the number of the keys written by a transaction including the counters
+func BenchmarkZSetZAdd(b *testing.B) {
+	key := []byte("BenchmarkZSetZAdd")
+	zset, txn, _ := getZSet(b, key)
+	for i := 0; i < 10000; i += 1000 {
+		var members [][]byte
+		var scores []float64
+		for j := i; j < i+1000; j++ {
+			members = append(members, []byte("member-"+strconv.Itoa(j)))
+			scores = append(scores, float64(j))
+		}
+		_, err := zset.ZAdd(members, scores)
+		assert.NoError(b, err)
+	}
+	assert.NoError(b, txn.Commit(context.TODO()))
+
+	b.ResetTimer()
+	var keys int
+	for i := 0; i < b.N; i++ {
+		zset, txn, _ := getZSet(b, key)
+		_, err := zset.ZAdd([][]byte{[]byte("bench-" + strconv.Itoa(i))}, []float64{float64(i % 10000)})
+		assert.NoError(b, err)
+		assert.NoError(b, txn.flushRanks())
+		keys += txn.t.Len()
+		assert.NoError(b, txn.Commit(context.TODO()))
+	}
+	b.ReportMetric(float64(keys)/float64(b.N), "keys/op")
+}
+
+// BenchmarkZSetZRank looks up the ranks in a sorted set of 10000 members
+func BenchmarkZSetZRank(b *testing.B) {
+	key := []byte("BenchmarkZSetZRank")
+	zset, txn, _ := getZSet(b, key)
+	var members [][]byte
+	var scores []float64
+	for i := 0; i < 10000; i++ {
+		members = append(members, []byte("member-"+strconv.Itoa(i)))
+		scores = append(scores, float64(i))
+	}
+	_, err := zset.ZAdd(members, scores)
+	assert.NoError(b, err)
+	assert.NoError(b, txn.Commit(context.TODO()))
+
+	zset, txn, _ = getZSet(b, key)
+	defer txn.Rollback()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := zset.ZRank(members[i%len(members)])
+		assert.NoError(b, err)
+	}
+}
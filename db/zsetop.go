@@ -0,0 +1,192 @@
+package db
+
+import (
+	"bytes"
+	"math"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// Aggregate is the way to aggregate the scores of a member in the sorted sets
+type Aggregate int
+
+// Aggregate values
+const (
+	AggregateSum = Aggregate(iota)
+	AggregateMin
+	AggregateMax
+)
+
+// ZSetOp is the operation of the sorted sets
+type ZSetOp int
+
+// ZSetOp values
+const (
+	ZSetUnion = ZSetOp(iota)
+	ZSetInter
+	ZSetDiff
+)
+
+// ZSetMemberIter iterates the members of a sorted set or a set in the order of
+// the members, the scores of the members of a set are 1
+type ZSetMemberIter struct {
+	iter   Iterator
+	prefix []byte
+	set    bool
+}
+
+// MemberIter returns an iterator of the members
+func (zset *ZSet) MemberIter() (*ZSetMemberIter, error) {
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	prefix := zsetMemberKey(dkey, nil)
+	iter, err := zset.txn.t.Iter(prefix, kv.Key(prefix).PrefixNext())
+	if err != nil {
+		return nil, err
+	}
+	return &ZSetMemberIter{iter: iter, prefix: prefix}, nil
+}
+
+// ZSetMemberIter returns an iterator of the members whose scores are 1
+func (set *Set) ZSetMemberIter() (*ZSetMemberIter, error) {
+	iter, err := set.Iter()
+	if err != nil {
+		return nil, err
+	}
+	return &ZSetMemberIter{iter: iter.Iter, prefix: iter.Prefix, set: true}, nil
+}
+
+// Valid returns true if the iterator points to a member
+func (it *ZSetMemberIter) Valid() bool {
+	return it.iter.Valid() && it.iter.Key().HasPrefix(it.prefix)
+}
+
+// Member returns the current member
+func (it *ZSetMemberIter) Member() []byte {
+	return it.iter.Key()[len(it.prefix):]
+}
+
+// Score returns the score of the current member
+func (it *ZSetMemberIter) Score() float64 {
+	if it.set {
+		return 1
+	}
+	return DecodeFloat64(it.iter.Value())
+}
+
+// Next moves to the next member
+func (it *ZSetMemberIter) Next() error {
+	return it.iter.Next()
+}
+
+// Close closes the iterator
+func (it *ZSetMemberIter) Close() {
+	it.iter.Close()
+}
+
+func (agg Aggregate) apply(a, b float64) float64 {
+	switch agg {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
+	}
+	score := a + b
+	// +inf + -inf
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// ZSetCombine merges the members of the iterators which are ordered by the members, the
+// iterators are read in stream, so the sets are never loaded into memory. A nil iterator
+// is an empty set. The scores are multiplied by the weights which could be nil, and
+// aggregated with agg, the weights and agg are ignored by ZSetDiff which keeps the scores
+// of the first set. f is called for every member of the result in the order of the members.
+func ZSetCombine(op ZSetOp, iters []*ZSetMemberIter, weights []float64, agg Aggregate,
+	f func(member []byte, score float64) error) error {
+	if len(iters) == 0 || (op != ZSetUnion && iters[0] == nil) {
+		return nil
+	}
+	if op == ZSetInter {
+		for _, it := range iters {
+			if it == nil {
+				return nil
+			}
+		}
+	}
+	weight := func(i int) float64 {
+		if weights == nil || op == ZSetDiff {
+			return 1
+		}
+		return weights[i]
+	}
+	score := func(i int) float64 {
+		s := iters[i].Score() * weight(i)
+		// 0 * inf
+		if math.IsNaN(s) {
+			return 0
+		}
+		return s
+	}
+
+	matched := make([]int, 0, len(iters))
+	for {
+		// find the smallest member
+		var member []byte
+		matched = matched[:0]
+		for i, it := range iters {
+			if it == nil || !it.Valid() {
+				continue
+			}
+			switch c := bytes.Compare(it.Member(), member); {
+			case member == nil || c < 0:
+				member = it.Member()
+				matched = append(matched[:0], i)
+			case c == 0:
+				matched = append(matched, i)
+			}
+		}
+		if member == nil {
+			return nil
+		}
+		// the member of the iterator is overwritten by Next
+		member = append([]byte{}, member...)
+
+		var emit bool
+		switch op {
+		case ZSetUnion:
+			emit = true
+		case ZSetInter:
+			emit = len(matched) == len(iters)
+		case ZSetDiff:
+			emit = matched[0] == 0 && len(matched) == 1
+		}
+		if emit {
+			s := score(matched[0])
+			for _, i := range matched[1:] {
+				s = agg.apply(s, score(i))
+			}
+			if err := f(member, s); err != nil {
+				return err
+			}
+		}
+
+		for _, i := range matched {
+			if err := iters[i].Next(); err != nil {
+				return err
+			}
+		}
+		// the rest are useless once the first set is exhausted
+		if op != ZSetUnion && !iters[0].Valid() {
+			return nil
+		}
+		if op == ZSetInter {
+			for _, it := range iters {
+				if !it.Valid() {
+					return nil
+				}
+			}
+		}
+	}
+}
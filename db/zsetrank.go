@@ -0,0 +1,384 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/pingcap/tidb/kv"
+)
+
+// The rank of a member is counted with a trie of counters over the 8 bytes of
+// the encoded score followed by the first zsetRankMemberLen bytes of the member.
+// The counter at level l with prefix p holds the number of the members whose
+// score and name start with p. The rank of a member is the sum of the counters of
+// the smaller siblings along its path, plus the members whose names end before the
+// path does. Only the members sharing the score and the first zsetRankMemberLen
+// bytes of the name are counted by scanning the score index, so a lookup reads at
+// most 256 counters per level however large the sorted set is.
+//
+// There is no counter for all the members as it is the length in the meta, a member
+// change writes at most byteScoreLen+zsetRankMemberLen counters, and the changes of
+// a transaction are merged and written once at commit. The key at level 0 only marks
+// that the counters are maintained, it is written once when the sorted set is created
+// or rebuilt, so writers of different members only conflict on the meta.
+//
+// Counter schema
+//   Layout: {DataKey}:C:{level}{prefix} -> count(int64)
+//
+// Sorted sets created before the counters have no key at level 0, the ranks of
+// them are counted by scanning the score index.
+
+// ErrScoreNaN is returned when the score turns to be NaN
+var ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// zsetRankMemberLen is the max number of the bytes of a member counted by the counters
+const zsetRankMemberLen = 2
+
+// zsetRankState tells if the counters are maintained for a sorted set
+type zsetRankState byte
+
+const (
+	// zsetRankUnknown is not known until the key at level 0 is read
+	zsetRankUnknown = zsetRankState(iota)
+	zsetRanked
+	zsetUnranked
+	// zsetRankNew is the sorted set created or rebuilt by the transaction, the key
+	// at level 0 is written along with the counters
+	zsetRankNew
+)
+
+// zsetRankDelta is the changes of the counters in a transaction
+type zsetRankDelta map[string]int64
+
+// zsetRankBatch is the pending changes of the counters of a sorted set
+type zsetRankBatch struct {
+	state zsetRankState
+	delta zsetRankDelta
+}
+
+func zsetRankPrefix(dkey []byte) []byte {
+	var prefix []byte
+	prefix = append(prefix, dkey...)
+	prefix = append(prefix, ':', 'C', ':')
+	return prefix
+}
+
+// zsetRankKey returns the key of the counter whose level is the length of prefix
+func zsetRankKey(dkey []byte, prefix []byte) []byte {
+	return zsetRankLevelKey(dkey, len(prefix), prefix)
+}
+
+func zsetRankLevelKey(dkey []byte, level int, prefix []byte) []byte {
+	key := zsetRankPrefix(dkey)
+	key = append(key, byte(level))
+	key = append(key, prefix...)
+	return key
+}
+
+// zsetRankPath returns the path of a member in the trie
+func zsetRankPath(score, member []byte) []byte {
+	if len(member) > zsetRankMemberLen {
+		member = member[:zsetRankMemberLen]
+	}
+	path := make([]byte, 0, byteScoreLen+len(member))
+	path = append(path, score...)
+	return append(path, member...)
+}
+
+// add counts a member with the score for all the levels
+func (d zsetRankDelta) add(dkey []byte, score, member []byte, delta int64) {
+	path := zsetRankPath(score, member)
+	for l := 1; l <= len(path); l++ {
+		d[string(zsetRankKey(dkey, path[:l]))] += delta
+	}
+}
+
+// hasRank returns true if the counters are maintained for the sorted set, the pending
+// changes of the counters are written before so they can be read
+func (zset *ZSet) hasRank() (bool, error) {
+	if err := zset.txn.flushRanks(); err != nil {
+		return false, err
+	}
+	if zset.rank == zsetRankUnknown {
+		dkey := DataKey(zset.txn.db, zset.meta.ID)
+		_, err := zset.txn.t.Get(zset.txn.ctx, zsetRankKey(dkey, nil))
+		if err != nil && !IsErrNotFound(err) {
+			return false, err
+		}
+		zset.rank = zsetRanked
+		if err != nil {
+			zset.rank = zsetUnranked
+		}
+	}
+	return zset.rank != zsetUnranked, nil
+}
+
+// updateRank merges the changes into the pending ones of the transaction
+func (zset *ZSet) updateRank(d zsetRankDelta) {
+	if zset.rank == zsetUnranked || (len(d) == 0 && zset.rank != zsetRankNew) {
+		return
+	}
+	dkey := string(DataKey(zset.txn.db, zset.meta.ID))
+	b, ok := zset.txn.zranks[dkey]
+	if !ok {
+		b = &zsetRankBatch{state: zset.rank, delta: make(zsetRankDelta)}
+		zset.txn.zranks[dkey] = b
+	}
+	if b.state == zsetRankUnknown {
+		b.state = zset.rank
+	}
+	for key, delta := range d {
+		b.delta[key] += delta
+	}
+}
+
+// flushRanks writes the pending changes of the counters, the counters and the keys at
+// level 0 of the sorted sets not known to be ranked are read in one batch
+func (txn *Transaction) flushRanks() error {
+	if len(txn.zranks) == 0 {
+		return nil
+	}
+	var keys [][]byte
+	for dkey, b := range txn.zranks {
+		if b.state == zsetRankUnknown {
+			keys = append(keys, zsetRankKey([]byte(dkey), nil))
+		}
+		for key, delta := range b.delta {
+			if delta != 0 {
+				keys = append(keys, []byte(key))
+			}
+		}
+	}
+	vals, err := BatchGetValues(txn, keys)
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]byte, len(keys))
+	for i, key := range keys {
+		if vals[i] != nil {
+			values[string(key)] = vals[i]
+		}
+	}
+
+	for dkey, b := range txn.zranks {
+		root := zsetRankKey([]byte(dkey), nil)
+		switch b.state {
+		case zsetRankUnknown:
+			if _, ok := values[string(root)]; !ok {
+				continue
+			}
+		case zsetRankNew:
+			if err := txn.t.Set(root, NilValue); err != nil {
+				return err
+			}
+		}
+		for key, count := range b.delta {
+			if count == 0 {
+				continue
+			}
+			if val, ok := values[key]; ok {
+				count += int64(binary.BigEndian.Uint64(val))
+			}
+			if count <= 0 {
+				if err := txn.t.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			val := make([]byte, 8)
+			binary.BigEndian.PutUint64(val, uint64(count))
+			if err := txn.t.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+	}
+	// the map is shared by the transactions on the other dbs, see in
+	for dkey := range txn.zranks {
+		delete(txn.zranks, dkey)
+	}
+	return nil
+}
+
+// ZRank returns the rank of the member in ascending order, it is -1 if the member does not exist
+func (zset *ZSet) ZRank(member []byte) (int64, error) {
+	if !zset.Exist() {
+		return -1, nil
+	}
+	score, err := zset.zScoreBytes(member)
+	if err != nil {
+		if IsErrNotFound(err) {
+			return -1, nil
+		}
+		return 0, err
+	}
+
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	ranked, err := zset.hasRank()
+	if err != nil {
+		return 0, err
+	}
+	if !ranked {
+		return zset.countKeys(ZSetScorePrefix(dkey), zsetScoreKey(dkey, score, member))
+	}
+
+	var rank, parent int64
+	path := zsetRankPath(score, member)
+	for l := 1; l <= len(path); l++ {
+		below, own, total, err := zset.childCounters(dkey, path[:l-1], path[l-1])
+		if err != nil {
+			return 0, err
+		}
+		rank += below
+		// the members with the same score whose names are the prefix of the member
+		if l > byteScoreLen {
+			rank += parent - total
+		}
+		parent = own
+	}
+	if len(member) > zsetRankMemberLen {
+		// the members sharing the path are ordered by the names
+		n, err := zset.countKeys(zsetScoreKey(dkey, score, member[:zsetRankMemberLen]), zsetScoreKey(dkey, score, member))
+		if err != nil {
+			return 0, err
+		}
+		rank += n
+	}
+	return rank, nil
+}
+
+// childCounters sums the counters of the children of prefix, below is the sum of the children
+// smaller than b, own is the counter of the child b and total is the sum of all of them
+func (zset *ZSet) childCounters(dkey, prefix []byte, b byte) (below, own, total int64, err error) {
+	start := zsetRankLevelKey(dkey, len(prefix)+1, prefix)
+	end := kv.Key(start).PrefixNext()
+	iter, err := zset.txn.t.Iter(start, end)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer iter.Close()
+
+	for iter.Valid() && iter.Key().Cmp(end) < 0 {
+		key := iter.Key()
+		if len(key) == len(start)+1 && len(iter.Value()) == 8 {
+			n := int64(binary.BigEndian.Uint64(iter.Value()))
+			switch c := key[len(start)]; {
+			case c < b:
+				below += n
+			case c == b:
+				own = n
+			}
+			total += n
+		}
+		if err := iter.Next(); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return below, own, total, nil
+}
+
+// countBelow counts the members whose scores are less than the encoded score, the
+// members with the same score are counted as well if include is true
+func (zset *ZSet) countBelow(score []byte, include bool) (int64, error) {
+	dkey := DataKey(zset.txn.db, zset.meta.ID)
+	ranked, err := zset.hasRank()
+	if err != nil {
+		return 0, err
+	}
+	if !ranked {
+		end := zsetScoreKey(dkey, score, nil)
+		if include {
+			end = kv.Key(end).PrefixNext()
+		}
+		return zset.countKeys(ZSetScorePrefix(dkey), end)
+	}
+
+	var count int64
+	for l := 1; l <= byteScoreLen; l++ {
+		// the siblings smaller than the prefix of the score at this level
+		start := zsetRankLevelKey(dkey, l, score[:l-1])
+		end := zsetRankKey(dkey, score[:l])
+		n, err := zset.sumCounters(start, end)
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	if include {
+		key := zsetRankKey(dkey, score)
+		n, err := zset.sumCounters(key, kv.Key(key).PrefixNext())
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, nil
+}
+
+// ZRevRank returns the rank of the member in descending order, it is -1 if the member does not exist
+func (zset *ZSet) ZRevRank(member []byte) (int64, error) {
+	rank, err := zset.ZRank(member)
+	if err != nil || rank < 0 {
+		return rank, err
+	}
+	return zset.meta.Len - 1 - rank, nil
+}
+
+// sumCounters sums the counters in [start, end)
+func (zset *ZSet) sumCounters(start, end []byte) (int64, error) {
+	iter, err := zset.txn.t.Iter(start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var sum int64
+	for iter.Valid() && iter.Key().Cmp(end) < 0 {
+		if len(iter.Value()) == 8 {
+			sum += int64(binary.BigEndian.Uint64(iter.Value()))
+		}
+		if err := iter.Next(); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// countKeys counts the keys in [start, end)
+func (zset *ZSet) countKeys(start, end []byte) (int64, error) {
+	iter, err := zset.txn.t.Iter(start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Close()
+
+	var count int64
+	for iter.Valid() && iter.Key().Cmp(end) < 0 {
+		count++
+		if err := iter.Next(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// ZIncrBy increments the score of the member, the member is added if it does not exist
+func (zset *ZSet) ZIncrBy(member []byte, delta float64) (float64, error) {
+	score := delta
+	if zset.Exist() {
+		old, err := zset.zScoreBytes(member)
+		if err != nil && !IsErrNotFound(err) {
+			return 0, err
+		}
+		if old != nil {
+			score += DecodeFloat64(old)
+		}
+	}
+	if math.IsNaN(score) {
+		return 0, ErrScoreNaN
+	}
+	if _, err := zset.ZAdd([][]byte{member}, []float64{score}); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
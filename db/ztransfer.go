@@ -104,7 +104,7 @@ func doZListTransfer(txn *Transaction, metakey []byte) (int, error) {
 	return int(llist.Len), nil
 }
 
-func ztWorker(db *DB, batch int, interval time.Duration) {
+func ztWorker(db *DB) {
 	var txn *Transaction
 	var err error
 	var n int
@@ -133,6 +133,8 @@ func ztWorker(db *DB, batch int, interval time.Duration) {
 
 	// create zlist and transfer to llist, after that, delete zt key
 	for {
+		// the batch and interval may be changed by CONFIG SET
+		conf := db.kv.Conf().ZT
 		select {
 		case metakey := <-ztQueue:
 			if !txnstart {
@@ -152,14 +154,14 @@ func ztWorker(db *DB, batch int, interval time.Duration) {
 			}
 			sum += n
 			batchCount++
-			if batchCount >= batch {
+			if batchCount >= conf.BatchCount {
 				commit(txn)
 			}
 		default:
 			if batchCount > 0 {
 				commit(txn)
 			} else {
-				time.Sleep(interval)
+				time.Sleep(conf.Interval)
 				txnstart = false
 			}
 		}
@@ -204,14 +206,14 @@ func StartZT(task *Task) {
 	conf := task.conf.(conf.ZT)
 	ztQueue = make(chan []byte, conf.QueueDepth)
 	for i := 0; i < conf.Workers; i++ {
-		go ztWorker(task.db, conf.BatchCount, conf.Interval)
+		go ztWorker(task.db)
 	}
 
 	// check leader and fill the channel
 	var err error
 	prefix := toZTKey(nil)
 	ticker := time.NewTicker(conf.Interval)
-	defer ticker.Stop()
+	defer func() { ticker.Stop() }()
 	for {
 		select {
 		case <-task.session.Done():
@@ -224,6 +226,13 @@ func StartZT(task *Task) {
 		case <-ticker.C:
 		}
 
+		interval := conf.Interval
+		conf = task.db.kv.Conf().ZT
+		if conf.Interval != interval {
+			ticker.Stop()
+			ticker = time.NewTicker(conf.Interval)
+		}
+
 		if prefix, err = runZT(task.db, prefix, ticker.C); err != nil {
 			zap.L().Error("[ZT] error in run ZT",
 				zap.Int64("dbid", int64(task.db.ID)),
@@ -0,0 +1,14 @@
+package rdb
+
+import "hash/crc64"
+
+// jones is the reflected Jones polynomial used by redis
+const jones = 0x95ac9329ac4bc9b5
+
+var crcTable = crc64.MakeTable(jones)
+
+// Checksum returns the crc64 of b as redis computes it, which starts from zero and
+// does not invert the result like the standard crc64 of Go
+func Checksum(b []byte) uint64 {
+	return ^crc64.Update(^uint64(0), crcTable, b)
+}
@@ -0,0 +1,52 @@
+package rdb
+
+// lzfDecompress decompresses the LZF compressed data in, size is the length of the original data
+func lzfDecompress(in []byte, size int) ([]byte, error) {
+	// a back reference of 3 bytes expands to 264 bytes at most
+	if size > len(in)*88 {
+		return nil, ErrFormat
+	}
+	out := make([]byte, 0, size)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// a literal run of ctrl+1 bytes
+		if ctrl < 1<<5 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > size {
+				return nil, ErrFormat
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// a back reference, the higher 3 bits are the length and the others are the offset
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, ErrFormat
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > size {
+			return nil, ErrFormat
+		}
+		// the reference may overlap the output so it is copied byte by byte
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != size {
+		return nil, ErrFormat
+	}
+	return out, nil
+}
@@ -0,0 +1,195 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// the compact encodings redis uses for small values, the integers are returned as strings
+
+// ziplistEntries decodes the entries of a ziplist
+//
+//	<zlbytes:4> <zltail:4> <zllen:2> <entry>... <0xff>
+//	entry: <prevlen:1|5> <encoding> <data>
+func ziplistEntries(b []byte) ([][]byte, error) {
+	var entries [][]byte
+	pos := 10
+	for {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		if b[pos] == 0xff {
+			return entries, nil
+		}
+		if b[pos] < 0xfe {
+			pos++
+		} else {
+			pos += 5
+		}
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+
+		enc := b[pos]
+		var n, size int
+		switch enc >> 6 {
+		case 0:
+			n, size = int(enc&0x3f), 1
+		case 1:
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			n, size = int(enc&0x3f)<<8|int(b[pos+1]), 2
+		case 2:
+			if pos+5 > len(b) {
+				return nil, ErrFormat
+			}
+			n, size = int(binary.BigEndian.Uint32(b[pos+1:])), 5
+		default:
+			var v int64
+			switch {
+			case enc == 0xc0:
+				n = 2
+			case enc == 0xd0:
+				n = 4
+			case enc == 0xe0:
+				n = 8
+			case enc == 0xf0:
+				n = 3
+			case enc == 0xfe:
+				n = 1
+			case enc > 0xf0 && enc < 0xfe:
+				// an immediate integer between 0 and 12
+				v = int64(enc&0x0f) - 1
+			default:
+				return nil, ErrFormat
+			}
+			if pos+1+n > len(b) {
+				return nil, ErrFormat
+			}
+			if n > 0 {
+				v = littleEndianInt(b[pos+1 : pos+1+n])
+			}
+			entries = append(entries, []byte(strconv.FormatInt(v, 10)))
+			pos += 1 + n
+			continue
+		}
+		if pos+size+n > len(b) {
+			return nil, ErrFormat
+		}
+		entries = append(entries, b[pos+size:pos+size+n])
+		pos += size + n
+	}
+}
+
+// listpackEntries decodes the entries of a listpack
+//
+//	<total-bytes:4> <num-elements:2> <entry>... <0xff>
+//	entry: <encoding> <data> <backlen>
+func listpackEntries(b []byte) ([][]byte, error) {
+	var entries [][]byte
+	pos := 6
+	for {
+		if pos >= len(b) {
+			return nil, ErrFormat
+		}
+		enc := b[pos]
+		if enc == 0xff {
+			return entries, nil
+		}
+
+		// hdr is the bytes of the encoding, n is the bytes of the data
+		var v int64
+		var str bool
+		hdr, n := 1, 0
+		switch {
+		case enc&0x80 == 0:
+			v = int64(enc & 0x7f)
+		case enc&0xc0 == 0x80:
+			n, str = int(enc&0x3f), true
+		case enc&0xe0 == 0xc0:
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			// a 13 bits signed integer
+			v = int64(enc&0x1f)<<8 | int64(b[pos+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+			hdr = 2
+		case enc&0xf0 == 0xe0:
+			if pos+2 > len(b) {
+				return nil, ErrFormat
+			}
+			hdr, n, str = 2, int(enc&0x0f)<<8|int(b[pos+1]), true
+		case enc == 0xf0:
+			if pos+5 > len(b) {
+				return nil, ErrFormat
+			}
+			hdr, n, str = 5, int(binary.LittleEndian.Uint32(b[pos+1:])), true
+		case enc >= 0xf1 && enc <= 0xf4:
+			n = [...]int{2, 3, 4, 8}[enc-0xf1]
+		default:
+			return nil, ErrFormat
+		}
+		if pos+hdr+n > len(b) {
+			return nil, ErrFormat
+		}
+		data := b[pos+hdr : pos+hdr+n]
+		if str {
+			entries = append(entries, data)
+		} else {
+			if n > 0 {
+				v = littleEndianInt(data)
+			}
+			entries = append(entries, []byte(strconv.FormatInt(v, 10)))
+		}
+		pos += hdr + n + backlenSize(hdr+n)
+	}
+}
+
+// backlenSize returns the bytes of the backlen of a listpack entry
+func backlenSize(size int) int {
+	switch {
+	case size <= 127:
+		return 1
+	case size < 16383:
+		return 2
+	case size < 2097151:
+		return 3
+	case size < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// intsetEntries decodes the integers of an intset
+//
+//	<encoding:4> <length:4> <contents>
+func intsetEntries(b []byte) ([][]byte, error) {
+	if len(b) < 8 {
+		return nil, ErrFormat
+	}
+	width := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(b) != 8+width*n {
+		return nil, ErrFormat
+	}
+	entries := make([][]byte, n)
+	for i := range entries {
+		v := littleEndianInt(b[8+i*width : 8+(i+1)*width])
+		entries[i] = []byte(strconv.FormatInt(v, 10))
+	}
+	return entries, nil
+}
+
+// littleEndianInt decodes a signed integer of 1 to 8 bytes in little endian
+func littleEndianInt(b []byte) int64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	// extend the sign
+	shift := uint(64 - 8*len(b))
+	return int64(v<<shift) >> shift
+}
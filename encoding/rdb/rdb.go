@@ -0,0 +1,473 @@
+// Package rdb encodes and decodes the values of keys in the RDB format of redis, which is
+// the payload of DUMP and RESTORE:
+//
+//	<type:1> <value> <rdb version:2> <crc64:8>
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+)
+
+const (
+	// Version is the rdb version of the dumped payloads, they can be restored by redis 5.0 and later
+	Version = 9
+	// MaxVersion is the latest rdb version that can be restored, which is used by redis 7.4
+	MaxVersion = 12
+)
+
+// the types of the values in rdb
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+)
+
+// the containers of the nodes of typeListQuicklist2
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// the encodings of the lengths, the higher 2 bits of the first byte tell the type
+const (
+	len6Bit   = 0
+	len14Bit  = 1
+	len32Bit  = 0x80
+	len64Bit  = 0x81
+	lenSpec   = 3
+	encInt8   = 0
+	encInt16  = 1
+	encInt32  = 2
+	encLZF    = 3
+	footerLen = 10
+)
+
+var (
+	// ErrChecksum is returned if the version or the checksum of the payload is wrong
+	ErrChecksum = errors.New("DUMP payload version or checksum are wrong")
+	// ErrFormat is returned if the payload is malformed or of an unsupported type
+	ErrFormat = errors.New("Bad data format")
+)
+
+// Kind is the data type of a value
+type Kind int
+
+// Kind values
+const (
+	String = Kind(iota)
+	List
+	Set
+	ZSet
+	Hash
+)
+
+// Value is the value of a key
+type Value struct {
+	Kind Kind
+	// String is the value of a string
+	String []byte
+	// Members are the elements of a list or a set, the members of a zset or the fields of a hash
+	Members [][]byte
+	// Values are the values of the fields of a hash
+	Values [][]byte
+	// Scores are the scores of the members of a zset
+	Scores []float64
+}
+
+// Dump encodes the value into a payload with the version and the checksum, the values are
+// saved in the plain encodings which every version of redis is able to load
+func Dump(v *Value) []byte {
+	var b []byte
+	switch v.Kind {
+	case String:
+		b = append(b, typeString)
+		b = appendString(b, v.String)
+	case List, Set:
+		if v.Kind == List {
+			b = append(b, typeList)
+		} else {
+			b = append(b, typeSet)
+		}
+		b = appendLength(b, uint64(len(v.Members)))
+		for _, member := range v.Members {
+			b = appendString(b, member)
+		}
+	case ZSet:
+		b = append(b, typeZSet2)
+		b = appendLength(b, uint64(len(v.Members)))
+		for i, member := range v.Members {
+			b = appendString(b, member)
+			var score [8]byte
+			binary.LittleEndian.PutUint64(score[:], math.Float64bits(v.Scores[i]))
+			b = append(b, score[:]...)
+		}
+	case Hash:
+		b = append(b, typeHash)
+		b = appendLength(b, uint64(len(v.Members)))
+		for i, field := range v.Members {
+			b = appendString(b, field)
+			b = appendString(b, v.Values[i])
+		}
+	}
+
+	var footer [footerLen]byte
+	binary.LittleEndian.PutUint16(footer[:], Version)
+	b = append(b, footer[:2]...)
+	binary.LittleEndian.PutUint64(footer[2:], Checksum(b))
+	return append(b, footer[2:]...)
+}
+
+// Load decodes the value from a payload after the version and the checksum are verified
+func Load(payload []byte) (*Value, error) {
+	if len(payload) < footerLen+1 {
+		return nil, ErrChecksum
+	}
+	footer := payload[len(payload)-footerLen:]
+	if binary.LittleEndian.Uint16(footer) > MaxVersion ||
+		binary.LittleEndian.Uint64(footer[2:]) != Checksum(payload[:len(payload)-8]) {
+		return nil, ErrChecksum
+	}
+
+	r := &reader{b: payload[:len(payload)-footerLen]}
+	v, err := r.readValue()
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.b) {
+		return nil, ErrFormat
+	}
+	// there are no empty keys
+	if v.Kind != String && len(v.Members) == 0 {
+		return nil, ErrFormat
+	}
+	return v, nil
+}
+
+func appendLength(b []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(b, byte(n))
+	case n < 1<<14:
+		return append(b, byte(n>>8)|len14Bit<<6, byte(n))
+	case n <= math.MaxUint32:
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(n))
+		return append(append(b, len32Bit), buf[:]...)
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	return append(append(b, len64Bit), buf[:]...)
+}
+
+func appendString(b []byte, s []byte) []byte {
+	return append(appendLength(b, uint64(len(s))), s...)
+}
+
+// reader reads the values from an rdb payload
+type reader struct {
+	b   []byte
+	pos int
+}
+
+func (r *reader) read(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.b) {
+		return nil, ErrFormat
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// readLength reads a length, special is true if it is the encoding of a special string
+func (r *reader) readLength() (n uint64, special bool, err error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, false, err
+	}
+	switch {
+	case b[0]>>6 == len6Bit:
+		return uint64(b[0] & 0x3f), false, nil
+	case b[0]>>6 == len14Bit:
+		next, err := r.read(1)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b[0]&0x3f)<<8 | uint64(next[0]), false, nil
+	case b[0] == len32Bit:
+		buf, err := r.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case b[0] == len64Bit:
+		buf, err := r.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	case b[0]>>6 == lenSpec:
+		return uint64(b[0] & 0x3f), true, nil
+	}
+	return 0, false, ErrFormat
+}
+
+// readCount reads the number of the elements in a collection
+func (r *reader) readCount() (int, error) {
+	n, special, err := r.readLength()
+	if err != nil {
+		return 0, err
+	}
+	// every element takes one byte at least
+	if special || n > uint64(len(r.b)-r.pos) {
+		return 0, ErrFormat
+	}
+	return int(n), nil
+}
+
+func (r *reader) readString() ([]byte, error) {
+	n, special, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		if n > uint64(len(r.b)-r.pos) {
+			return nil, ErrFormat
+		}
+		return r.read(int(n))
+	}
+
+	switch n {
+	case encInt8, encInt16, encInt32:
+		buf, err := r.read(1 << n)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.FormatInt(littleEndianInt(buf), 10)), nil
+	case encLZF:
+		clen, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		size, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		if clen > uint64(len(r.b)-r.pos) || size > math.MaxInt32 {
+			return nil, ErrFormat
+		}
+		compressed, err := r.read(int(clen))
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(size))
+	}
+	return nil, ErrFormat
+}
+
+func (r *reader) readStrings(n int) ([][]byte, error) {
+	strs := make([][]byte, n)
+	for i := range strs {
+		var err error
+		if strs[i], err = r.readString(); err != nil {
+			return nil, err
+		}
+	}
+	return strs, nil
+}
+
+// readScore reads a score of typeZSet, which is a string of one byte length or a special value
+func (r *reader) readScore() (float64, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf, err := r.read(int(b[0]))
+	if err != nil {
+		return 0, err
+	}
+	return parseScore(buf)
+}
+
+func (r *reader) readValue() (*Value, error) {
+	t, err := r.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Value{}
+	switch t[0] {
+	case typeString:
+		v.Kind = String
+		v.String, err = r.readString()
+		return v, err
+	case typeList, typeSet:
+		v.Kind = List
+		if t[0] == typeSet {
+			v.Kind = Set
+		}
+		n, err := r.readCount()
+		if err != nil {
+			return nil, err
+		}
+		v.Members, err = r.readStrings(n)
+		return v, err
+	case typeZSet, typeZSet2:
+		v.Kind = ZSet
+		n, err := r.readCount()
+		if err != nil {
+			return nil, err
+		}
+		v.Members, v.Scores = make([][]byte, n), make([]float64, n)
+		for i := 0; i < n; i++ {
+			if v.Members[i], err = r.readString(); err != nil {
+				return nil, err
+			}
+			if t[0] == typeZSet {
+				if v.Scores[i], err = r.readScore(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			buf, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			v.Scores[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+		}
+		return v, nil
+	case typeHash:
+		v.Kind = Hash
+		n, err := r.readCount()
+		if err != nil {
+			return nil, err
+		}
+		v.Members, v.Values = make([][]byte, n), make([][]byte, n)
+		for i := 0; i < n; i++ {
+			if v.Members[i], err = r.readString(); err != nil {
+				return nil, err
+			}
+			if v.Values[i], err = r.readString(); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case typeListQuicklist, typeListQuicklist2:
+		v.Kind = List
+		n, err := r.readCount()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			container := uint64(quicklistNodePacked)
+			if t[0] == typeListQuicklist2 {
+				if container, _, err = r.readLength(); err != nil {
+					return nil, err
+				}
+			}
+			node, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			var entries [][]byte
+			switch {
+			case container == quicklistNodePlain:
+				entries = [][]byte{node}
+			case container != quicklistNodePacked:
+				return nil, ErrFormat
+			case t[0] == typeListQuicklist:
+				entries, err = ziplistEntries(node)
+			default:
+				entries, err = listpackEntries(node)
+			}
+			if err != nil {
+				return nil, err
+			}
+			v.Members = append(v.Members, entries...)
+		}
+		return v, nil
+	}
+
+	// the rest are encoded in a single string
+	kinds := map[byte]Kind{
+		typeListZiplist: List,
+		typeSetIntset:   Set,
+		typeSetListpack: Set,
+		typeZSetZiplist: ZSet, typeZSetListpack: ZSet,
+		typeHashZiplist: Hash, typeHashListpack: Hash,
+	}
+	kind, ok := kinds[t[0]]
+	if !ok {
+		return nil, ErrFormat
+	}
+	v.Kind = kind
+	b, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	var entries [][]byte
+	switch t[0] {
+	case typeSetIntset:
+		entries, err = intsetEntries(b)
+	case typeListZiplist, typeZSetZiplist, typeHashZiplist:
+		entries, err = ziplistEntries(b)
+	default:
+		entries, err = listpackEntries(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if kind == List || kind == Set {
+		v.Members = entries
+		return v, nil
+	}
+
+	// the members and the scores or the values are in pairs
+	if len(entries)%2 != 0 {
+		return nil, ErrFormat
+	}
+	for i := 0; i < len(entries); i += 2 {
+		v.Members = append(v.Members, entries[i])
+		if kind == Hash {
+			v.Values = append(v.Values, entries[i+1])
+			continue
+		}
+		score, err := parseScore(entries[i+1])
+		if err != nil {
+			return nil, err
+		}
+		v.Scores = append(v.Scores, score)
+	}
+	return v, nil
+}
+
+// parseScore parses the score saved as a string, which may be inf or -inf
+func parseScore(b []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, ErrFormat
+	}
+	return score, nil
+}
@@ -0,0 +1,153 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// payload appends the footer of version 9 to the value
+func payload(value ...byte) []byte {
+	b := append(value, Version, 0)
+	var crc [8]byte
+	binary.LittleEndian.PutUint64(crc[:], Checksum(b))
+	return append(b, crc[:]...)
+}
+
+func strs(ss ...string) [][]byte {
+	b := make([][]byte, len(ss))
+	for i := range ss {
+		b[i] = []byte(ss[i])
+	}
+	return b
+}
+
+func TestChecksum(t *testing.T) {
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), Checksum([]byte("123456789")))
+}
+
+func TestLoadRedisPayload(t *testing.T) {
+	// the payloads dumped by redis for the integer 10 in version 6 and 9
+	for _, p := range []string{
+		"\x00\xc0\n\x06\x00\xf8r?\xc5\xfb\xfb_(",
+		"\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n",
+	} {
+		v, err := Load([]byte(p))
+		assert.NoError(t, err)
+		assert.Equal(t, &Value{Kind: String, String: []byte("10")}, v)
+	}
+}
+
+func TestDumpLoad(t *testing.T) {
+	values := []*Value{
+		{Kind: String, String: []byte("hello")},
+		{Kind: String, String: []byte(strings.Repeat("a", 20000))},
+		{Kind: List, Members: strs("a", "b", "a")},
+		{Kind: Set, Members: strs("a", "b", "c")},
+		{Kind: ZSet, Members: strs("a", "b", "c"), Scores: []float64{-1.5, 0, math.Inf(1)}},
+		{Kind: Hash, Members: strs("f1", "f2"), Values: strs("v1", "")},
+	}
+	for _, v := range values {
+		p := Dump(v)
+		assert.Equal(t, uint16(Version), binary.LittleEndian.Uint16(p[len(p)-10:]))
+		got, err := Load(p)
+		assert.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+	assert.Equal(t, payload(0, 5, 'h', 'e', 'l', 'l', 'o'), Dump(values[0]))
+}
+
+func TestLoadEncodings(t *testing.T) {
+	ziplist := []byte{0, 0, 0, 0, 0, 0, 0, 0, 4, 0,
+		0, 0x01, 'a', // a string of 1 byte
+		3, 0xf6, // the immediate integer 5
+		2, 0xc0, 0x2c, 0x01, // 300 in int16
+		4, 0xfe, 0xfe, // -2 in int8
+		0xff}
+	hashListpack := []byte{0, 0, 0, 0, 4, 0,
+		0x82, 'f', '1', 3, // a string of 2 bytes
+		0x64, 1, // the 7 bits integer 100
+		0xdf, 0xfb, 2, // -5 in the 13 bits integer
+		0x81, 'v', 2,
+		0xff}
+	zsetListpack := []byte{0, 0, 0, 0, 4, 0,
+		0x81, 'm', 2,
+		0x83, '1', '.', '5', 4,
+		0x81, 'n', 2,
+		0x03, 1,
+		0xff}
+	intset := []byte{2, 0, 0, 0, 3, 0, 0, 0, 0xfe, 0xff, 0x01, 0x00, 0x2c, 0x01}
+	listpack := []byte{0, 0, 0, 0, 1, 0, 0x81, 'x', 2, 0xff}
+
+	// str encodes a short string after the prefix
+	str := func(prefix []byte, b []byte) []byte {
+		return append(append(prefix, byte(len(b))), b...)
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+		want    *Value
+	}{
+		{"lzf", payload(0, 0xc3, 5, 24, 0, 'a', 0xe0, 0x0e, 0),
+			&Value{Kind: String, String: []byte(strings.Repeat("a", 24))}},
+		{"int16", payload(0, 0xc1, 0x18, 0xfc), &Value{Kind: String, String: []byte("-1000")}},
+		{"list ziplist", payload(str([]byte{typeListZiplist}, ziplist)...),
+			&Value{Kind: List, Members: strs("a", "5", "300", "-2")}},
+		{"quicklist", payload(str([]byte{typeListQuicklist, 1}, ziplist)...),
+			&Value{Kind: List, Members: strs("a", "5", "300", "-2")}},
+		{"quicklist2", payload(str([]byte{typeListQuicklist2, 2, quicklistNodePlain, 3, 'b', 'i', 'g', quicklistNodePacked}, listpack)...),
+			&Value{Kind: List, Members: strs("big", "x")}},
+		{"intset", payload(str([]byte{typeSetIntset}, intset)...),
+			&Value{Kind: Set, Members: strs("-2", "1", "300")}},
+		{"set listpack", payload(str([]byte{typeSetListpack}, listpack)...),
+			&Value{Kind: Set, Members: strs("x")}},
+		{"hash ziplist", payload(str([]byte{typeHashZiplist}, ziplist)...),
+			&Value{Kind: Hash, Members: strs("a", "300"), Values: strs("5", "-2")}},
+		{"hash listpack", payload(str([]byte{typeHashListpack}, hashListpack)...),
+			&Value{Kind: Hash, Members: strs("f1", "-5"), Values: strs("100", "v")}},
+		{"zset listpack", payload(str([]byte{typeZSetListpack}, zsetListpack)...),
+			&Value{Kind: ZSet, Members: strs("m", "n"), Scores: []float64{1.5, 3}}},
+		{"zset", payload(typeZSet, 2, 1, 'm', 3, '2', '.', '5', 1, 'n', 254),
+			&Value{Kind: ZSet, Members: strs("m", "n"), Scores: []float64{2.5, math.Inf(1)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Load(tt.payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v)
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	p := Dump(&Value{Kind: String, String: []byte("hello")})
+	wrong := append([]byte{}, p...)
+	wrong[len(wrong)-1]++
+	_, err := Load(wrong)
+	assert.Equal(t, ErrChecksum, err)
+
+	// the version is newer than supported
+	newer := append([]byte{}, p[:len(p)-10]...)
+	newer = append(newer, MaxVersion+1, 0)
+	var crc [8]byte
+	binary.LittleEndian.PutUint64(crc[:], Checksum(newer))
+	_, err = Load(append(newer, crc[:]...))
+	assert.Equal(t, ErrChecksum, err)
+
+	_, err = Load(p[:5])
+	assert.Equal(t, ErrChecksum, err)
+
+	for _, value := range [][]byte{
+		{0, 6, 'h', 'e', 'l', 'l', 'o'}, // truncated
+		{0, 4, 'h', 'e', 'l', 'l', 'o'}, // trailing bytes
+		{typeList, 0},                   // empty
+		{15, 0},                         // stream
+		{0, 0xc3, 2, 24, 0, 'a'},        // bad lzf
+	} {
+		_, err := Load(payload(value...))
+		assert.Equal(t, ErrFormat, err)
+	}
+}
@@ -3,9 +3,16 @@ package resp
 import (
 	"errors"
 	"io"
+	"math"
 	"strconv"
 )
 
+// the versions of the protocol
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
 var (
 	//ErrInvalidProtocol indicates a wrong protocol format
 	ErrInvalidProtocol = errors.New("invalid protocol")
@@ -45,6 +52,11 @@ func ReplyArray(w io.Writer, size int) (*Encoder, error) {
 	return r, nil
 }
 
+// ReplyNullArray replies a null array
+func ReplyNullArray(w io.Writer) error {
+	return NewEncoder(w).NullArray()
+}
+
 // ReadError reads an error
 func ReadError(r io.Reader) (string, error) {
 	return NewDecoder(r).Error()
@@ -72,12 +84,22 @@ func ReadArray(r io.Reader) (int, error) {
 
 // Encoder implements the Encoder interface
 type Encoder struct {
-	w io.Writer
+	w       io.Writer
+	version int
 }
 
 // NewEncoder creates a RESP encoder
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w}
+	return &Encoder{w: w, version: RESP2}
+}
+
+// NewEncoderVersion creates an encoder of the version of RESP, the types added by RESP3
+// are encoded in their RESP2 forms like redis does unless the version is RESP3
+func NewEncoderVersion(w io.Writer, version int) *Encoder {
+	if version != RESP3 {
+		version = RESP2
+	}
+	return &Encoder{w: w, version: version}
 }
 
 //Error builds a RESP error
@@ -99,8 +121,11 @@ func (r *Encoder) BulkString(s string) error {
 	return err
 }
 
-// NullBulkString builds a RESP null bulkstring
+// NullBulkString builds a RESP null bulkstring, it is a null in RESP3
 func (r *Encoder) NullBulkString() error {
+	if r.version == RESP3 {
+		return r.Null()
+	}
 	_, err := r.w.Write([]byte("$-1\r\n"))
 	return err
 }
@@ -119,6 +144,105 @@ func (r *Encoder) Array(size int) error {
 	return err
 }
 
+// NullArray builds a RESP null array, it is a null in RESP3
+func (r *Encoder) NullArray() error {
+	if r.version == RESP3 {
+		return r.Null()
+	}
+	_, err := r.w.Write([]byte("*-1\r\n"))
+	return err
+}
+
+// Map builds a RESP3 map of size pairs, it is an array of the keys and values in RESP2
+func (r *Encoder) Map(size int) error {
+	if r.version != RESP3 {
+		return r.Array(size * 2)
+	}
+	_, err := r.w.Write([]byte("%" + strconv.Itoa(size) + "\r\n"))
+	return err
+}
+
+// Set builds a RESP3 set, it is an array in RESP2
+func (r *Encoder) Set(size int) error {
+	if r.version != RESP3 {
+		return r.Array(size)
+	}
+	_, err := r.w.Write([]byte("~" + strconv.Itoa(size) + "\r\n"))
+	return err
+}
+
+// Push builds a RESP3 push message, it is an array in RESP2
+func (r *Encoder) Push(size int) error {
+	if r.version != RESP3 {
+		return r.Array(size)
+	}
+	_, err := r.w.Write([]byte(">" + strconv.Itoa(size) + "\r\n"))
+	return err
+}
+
+// Null builds a RESP3 null, it is a null bulkstring in RESP2
+func (r *Encoder) Null() error {
+	if r.version != RESP3 {
+		return r.NullBulkString()
+	}
+	_, err := r.w.Write([]byte("_\r\n"))
+	return err
+}
+
+// Double builds a RESP3 double, it is a bulkstring in RESP2
+func (r *Encoder) Double(v float64) error {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if r.version != RESP3 {
+		return r.BulkString(s)
+	}
+	switch {
+	case math.IsInf(v, 1):
+		s = "inf"
+	case math.IsInf(v, -1):
+		s = "-inf"
+	case math.IsNaN(v):
+		s = "nan"
+	}
+	_, err := r.w.Write([]byte("," + s + "\r\n"))
+	return err
+}
+
+// Boolean builds a RESP3 boolean, it is an integer of 1 or 0 in RESP2
+func (r *Encoder) Boolean(v bool) error {
+	if r.version != RESP3 {
+		if v {
+			return r.Integer(1)
+		}
+		return r.Integer(0)
+	}
+	s := "#f\r\n"
+	if v {
+		s = "#t\r\n"
+	}
+	_, err := r.w.Write([]byte(s))
+	return err
+}
+
+// BigNumber builds a RESP3 big number from its decimal digits, it is a bulkstring in RESP2
+func (r *Encoder) BigNumber(s string) error {
+	if r.version != RESP3 {
+		return r.BulkString(s)
+	}
+	_, err := r.w.Write([]byte("(" + s + "\r\n"))
+	return err
+}
+
+// VerbatimString builds a RESP3 verbatim string of the format like "txt" or "mkd",
+// it is a bulkstring in RESP2
+func (r *Encoder) VerbatimString(format, s string) error {
+	if r.version != RESP3 {
+		return r.BulkString(s)
+	}
+	length := strconv.Itoa(len(format) + 1 + len(s))
+	_, err := r.w.Write([]byte("=" + length + "\r\n" + format + ":" + s + "\r\n"))
+	return err
+}
+
 // Decoder implements the decoder interface
 type Decoder struct {
 	r *Reader
@@ -2,6 +2,7 @@ package resp
 
 import (
 	"bytes"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -156,3 +157,46 @@ func TestNullBulkString_Encode(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("$-1\r\n", out.String())
 }
+
+func TestNullArray_Encode(t *testing.T) {
+	assert := assert.New(t)
+	out := bytes.NewBuffer(nil)
+	e := NewEncoder(out)
+	err := e.NullArray()
+	assert.NoError(err)
+	assert.Equal("*-1\r\n", out.String())
+}
+
+func TestRESP3_Encode(t *testing.T) {
+	assert := assert.New(t)
+	out := bytes.NewBuffer(nil)
+	e := NewEncoderVersion(out, RESP3)
+	assert.NoError(e.Map(2))
+	assert.NoError(e.Set(3))
+	assert.NoError(e.Push(1))
+	assert.NoError(e.Null())
+	assert.NoError(e.NullBulkString())
+	assert.NoError(e.NullArray())
+	assert.NoError(e.Double(1.5))
+	assert.NoError(e.Double(math.Inf(-1)))
+	assert.NoError(e.Boolean(true))
+	assert.NoError(e.Boolean(false))
+	assert.NoError(e.BigNumber("3492890328409238509324850943850943825024385"))
+	assert.NoError(e.VerbatimString("txt", "Some string"))
+	assert.Equal("%2\r\n~3\r\n>1\r\n_\r\n_\r\n_\r\n,1.5\r\n,-inf\r\n#t\r\n#f\r\n"+
+		"(3492890328409238509324850943850943825024385\r\n=15\r\ntxt:Some string\r\n", out.String())
+
+	// the types are encoded in their RESP2 forms
+	out.Reset()
+	e = NewEncoderVersion(out, RESP2)
+	assert.NoError(e.Map(2))
+	assert.NoError(e.Set(3))
+	assert.NoError(e.Push(1))
+	assert.NoError(e.Null())
+	assert.NoError(e.NullArray())
+	assert.NoError(e.Double(1.5))
+	assert.NoError(e.Boolean(true))
+	assert.NoError(e.BigNumber("12"))
+	assert.NoError(e.VerbatimString("txt", "ok"))
+	assert.Equal("*4\r\n*3\r\n*1\r\n$-1\r\n*-1\r\n$3\r\n1.5\r\n:1\r\n$2\r\n12\r\n$2\r\nok\r\n", out.String())
+}
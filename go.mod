@@ -19,6 +19,7 @@ require (
 	github.com/sirupsen/logrus v1.6.0
 	github.com/stretchr/testify v1.6.1
 	github.com/twinj/uuid v1.0.0
+	github.com/yuin/gopher-lua v1.1.1
 	go.etcd.io/etcd v0.5.0-alpha.5.0.20200824191128-ae9734ed278b
 	go.uber.org/zap v1.16.0
 	gopkg.in/stretchr/testify.v1 v1.2.2 // indirect
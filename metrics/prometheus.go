@@ -57,6 +57,9 @@ type Metrics struct {
 	//tikvGC
 	TiKVGCTotal *prometheus.CounterVec
 
+	//pubsub
+	PubSubDroppedCounterVec *prometheus.CounterVec
+
 	//command biz
 	CommandCallHistogramVec     *prometheus.HistogramVec
 	TxnBeginHistogramVec        *prometheus.HistogramVec
@@ -213,6 +216,14 @@ func init() {
 		}, tikvGCLabel)
 	prometheus.MustRegister(gm.TiKVGCTotal)
 
+	gm.PubSubDroppedCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pubsub_dropped_messages_total",
+			Help:      "the number of messages dropped for the slow subscribers",
+		}, bizLabel)
+	prometheus.MustRegister(gm.PubSubDroppedCounterVec)
+
 	gm.IsLeaderGaugeVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
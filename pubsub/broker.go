@@ -0,0 +1,341 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/distributedio/titan/conf"
+	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/db/store"
+	"go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+	"go.uber.org/zap"
+)
+
+var (
+	// messages are exchanged by titan instances through etcd keys with the layout:
+	// /titan:pubsub2:{len(namespace)}:{namespace}:{channel} -> message
+	// the length is prefixed as namespaces may contain ':'
+	etcdPubSubPrefix = "/titan:pubsub2:"
+
+	// the keys having clients blocked on them are registered by every titan instance with the layout:
+	// /titan:blocked:{len(key)}:{key}:{lease} -> ""
+	etcdBlockedPrefix = "/titan:blocked:"
+
+	// message keys are attached to a lease so they are cleaned up after
+	// the publisher is gone, every message is kept for at least ttl seconds
+	etcdMessageTTL = 10
+)
+
+// Broker transports messages between titan instances
+type Broker interface {
+	Publish(namespace, channel string, message []byte) error
+
+	// Block registers that the instance has clients blocked on the key, and Unblock
+	// removes the registration. Blocked reports whether any instance registers the key
+	Block(key string) error
+	Unblock(key string) error
+	Blocked(key string) bool
+
+	Close() error
+}
+
+// localBroker delivers messages inside the instance, it is used when titan runs on a mock tikv
+type localBroker struct {
+	hub *Hub
+}
+
+func (b *localBroker) Publish(namespace, channel string, message []byte) error {
+	b.hub.dispatch(namespace, channel, message)
+	return nil
+}
+
+// the waiters of the only instance are known by the notifier
+func (b *localBroker) Block(key string) error   { return nil }
+func (b *localBroker) Unblock(key string) error { return nil }
+func (b *localBroker) Blocked(key string) bool  { return false }
+
+func (b *localBroker) Close() error { return nil }
+
+// etcdBroker fans out messages to every titan instance watching the same etcd cluster
+type etcdBroker struct {
+	hub    *Hub
+	cli    *clientv3.Client
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	session *concurrency.Session
+	owned   map[string]clientv3.LeaseID // the keys registered by this instance
+
+	// blocked counts the registrations of the keys by all the instances
+	bmu     sync.RWMutex
+	blocked map[string]int
+}
+
+// Open creates a hub for the tikv cluster, messages are broadcasted to all the titan
+// instances through the etcd embedded in pd, or the etcd-addrs if configured
+func Open(conf *conf.TiKV) (*Hub, error) {
+	h := NewHub()
+	if strings.HasPrefix(conf.PdAddrs, store.MockAddr) {
+		return h, nil
+	}
+	addrs := conf.EtcdAddrs
+	if len(addrs) == 0 {
+		addrs = db.PdAddrsToEtcd(conf.PdAddrs)
+	}
+	cli, err := db.NewEtcdClient(addrs)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.UseEtcd(cli); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// UseEtcd switches the hub to broadcast messages through etcd
+func (h *Hub) UseEtcd(cli *clientv3.Client) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &etcdBroker{hub: h, cli: cli, cancel: cancel,
+		owned: make(map[string]clientv3.LeaseID), blocked: make(map[string]int)}
+	if _, err := b.lease(); err != nil {
+		cancel()
+		return err
+	}
+	// watch from the current revision so that no message published after
+	// this call returns could be missed
+	resp, err := cli.Get(ctx, etcdPubSubPrefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		cancel()
+		return err
+	}
+	go b.watch(ctx, resp.Header.Revision+1)
+
+	// load the keys registered by the instances and follow the changes
+	resp, err = cli.Get(ctx, etcdBlockedPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		cancel()
+		return err
+	}
+	for _, kv := range resp.Kvs {
+		if key, ok := splitBlockedKey(string(kv.Key)); ok {
+			b.blocked[key]++
+		}
+	}
+	go b.watchBlocked(ctx, resp.Header.Revision+1)
+
+	h.mu.Lock()
+	h.broker = b
+	h.mu.Unlock()
+	return nil
+}
+
+// lease returns the lease attached to messages, a new one is granted if the old one has expired
+func (b *etcdBroker) lease() (clientv3.LeaseID, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil {
+		select {
+		case <-b.session.Done():
+		default:
+			return b.session.Lease(), nil
+		}
+	}
+	session, err := concurrency.NewSession(b.cli, concurrency.WithTTL(etcdMessageTTL))
+	if err != nil {
+		zap.L().Error("[PubSub] create etcd session failed", zap.Error(err))
+		return clientv3.NoLease, err
+	}
+	b.session = session
+	return session.Lease(), nil
+}
+
+func (b *etcdBroker) Publish(namespace, channel string, message []byte) error {
+	lease, err := b.lease()
+	if err != nil {
+		return err
+	}
+	key := messageKey(namespace, channel)
+	_, err = b.cli.Put(context.Background(), key, string(message), clientv3.WithLease(lease))
+	return err
+}
+
+// Block registers the key with the lease of the instance, the key is registered again if the lease
+// has changed since the registrations attached to the old one are gone
+func (b *etcdBroker) Block(key string) error {
+	lease, err := b.lease()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	owned, ok := b.owned[key]
+	b.mu.Unlock()
+	if ok && owned == lease {
+		return nil
+	}
+	if _, err := b.cli.Put(context.Background(), blockedKey(key, lease), "", clientv3.WithLease(lease)); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.owned[key] = lease
+	b.mu.Unlock()
+	return nil
+}
+
+// Unblock removes the registration of the key
+func (b *etcdBroker) Unblock(key string) error {
+	b.mu.Lock()
+	lease, ok := b.owned[key]
+	delete(b.owned, key)
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	_, err := b.cli.Delete(context.Background(), blockedKey(key, lease))
+	return err
+}
+
+// Blocked reports whether the key is registered by any instance
+func (b *etcdBroker) Blocked(key string) bool {
+	b.bmu.RLock()
+	defer b.bmu.RUnlock()
+	return b.blocked[key] > 0
+}
+
+// watchBlocked counts the registrations of the keys, it resumes from the next revision
+// after the watch channel is broken
+func (b *etcdBroker) watchBlocked(ctx context.Context, rev int64) {
+	for {
+		wch := b.cli.Watch(ctx, etcdBlockedPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+		for wresp := range wch {
+			if err := wresp.Err(); err != nil {
+				zap.L().Error("[PubSub] watch blocked keys failed", zap.Int64("revision", rev), zap.Error(err))
+				if wresp.CompactRevision > rev {
+					rev = wresp.CompactRevision
+				}
+				continue
+			}
+			b.bmu.Lock()
+			for _, ev := range wresp.Events {
+				rev = ev.Kv.ModRevision + 1
+				key, ok := splitBlockedKey(string(ev.Kv.Key))
+				if !ok {
+					continue
+				}
+				switch {
+				case ev.Type == clientv3.EventTypeDelete:
+					if b.blocked[key]--; b.blocked[key] <= 0 {
+						delete(b.blocked, key)
+					}
+				case ev.IsCreate():
+					b.blocked[key]++
+				}
+			}
+			b.bmu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// watch dispatches every message put into etcd, it resumes from the next revision
+// after the watch channel is broken
+func (b *etcdBroker) watch(ctx context.Context, rev int64) {
+	for {
+		wch := b.cli.Watch(ctx, etcdPubSubPrefix, clientv3.WithPrefix(), clientv3.WithRev(rev))
+		for wresp := range wch {
+			if err := wresp.Err(); err != nil {
+				zap.L().Error("[PubSub] watch failed", zap.Int64("revision", rev), zap.Error(err))
+				if wresp.CompactRevision > rev {
+					// the signals in the compacted revisions are lost, the blocked clients check
+					// their keys now instead of waiting for the next recheck
+					zap.L().Warn("[PubSub] messages are compacted before they are watched",
+						zap.Int64("from", rev), zap.Int64("to", wresp.CompactRevision))
+					rev = wresp.CompactRevision
+					b.hub.notifier.wakeAll()
+				}
+				continue
+			}
+			for _, ev := range wresp.Events {
+				rev = ev.Kv.ModRevision + 1
+				if ev.Type != clientv3.EventTypePut {
+					continue
+				}
+				namespace, channel, ok := splitMessageKey(string(ev.Kv.Key))
+				if !ok {
+					continue
+				}
+				b.hub.dispatch(namespace, channel, ev.Kv.Value)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		// the signals may be delayed while the watch is broken
+		zap.L().Warn("[PubSub] watch is broken, resume it", zap.Int64("revision", rev))
+		b.hub.notifier.wakeAll()
+	}
+}
+
+func (b *etcdBroker) Close() error {
+	b.cancel()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.session != nil {
+		return b.session.Close()
+	}
+	return nil
+}
+
+// messageKey returns the key of a message, see etcdPubSubPrefix for its layout
+func messageKey(namespace, channel string) string {
+	return etcdPubSubPrefix + lengthPrefixed(namespace) + channel
+}
+
+// splitMessageKey splits a key returned by messageKey
+func splitMessageKey(key string) (string, string, bool) {
+	if !strings.HasPrefix(key, etcdPubSubPrefix) {
+		return "", "", false
+	}
+	return cutLengthPrefixed(key[len(etcdPubSubPrefix):])
+}
+
+// blockedKey returns the key registering a blocked key, see etcdBlockedPrefix for its layout
+func blockedKey(key string, lease clientv3.LeaseID) string {
+	return etcdBlockedPrefix + lengthPrefixed(key) + strconv.FormatInt(int64(lease), 16)
+}
+
+// splitBlockedKey returns the blocked key of a key returned by blockedKey
+func splitBlockedKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, etcdBlockedPrefix) {
+		return "", false
+	}
+	key, _, ok := cutLengthPrefixed(key[len(etcdBlockedPrefix):])
+	return key, ok
+}
+
+// lengthPrefixed encodes s as {len(s)}:{s}: so it can be followed by anything
+func lengthPrefixed(s string) string {
+	return strconv.Itoa(len(s)) + ":" + s + ":"
+}
+
+// cutLengthPrefixed cuts a string encoded by lengthPrefixed from the head of s
+func cutLengthPrefixed(s string) (string, string, bool) {
+	idx := strings.IndexByte(s, ':')
+	if idx < 0 {
+		return "", "", false
+	}
+	n, err := strconv.Atoi(s[:idx])
+	s = s[idx+1:]
+	if err != nil || n < 0 || n >= len(s) || s[n] != ':' {
+		return "", "", false
+	}
+	return s[:n], s[n+1:], true
+}
@@ -0,0 +1,449 @@
+package pubsub
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/distributedio/titan/encoding/resp"
+	"github.com/distributedio/titan/metrics"
+	"go.uber.org/zap"
+)
+
+// subscriptionQueueLimit is the most messages queued for a subscriber, a slow subscriber
+// reaching it is disconnected like redis does by client-output-buffer-limit pubsub
+const subscriptionQueueLimit = 1024
+
+// Subscription is the pub/sub state of a client connection
+type Subscription struct {
+	ID        int64
+	Namespace string
+	Protocol  int          // the version of RESP of the messages, it is set before subscribing
+	Close     func() error // Close disconnects the client once it is too slow to take the messages
+
+	out      io.Writer
+	mu       sync.Mutex
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// messages are written by a goroutine of the subscription which exits once the
+	// queue is drained, so a slow subscriber never blocks the delivery to others
+	qmu     sync.Mutex
+	queue   [][]byte
+	writing bool
+	overrun bool // the queue has reached the limit and the client is disconnected
+}
+
+// NewSubscription creates a subscription which sends messages to out
+func NewSubscription(id int64, namespace string, out io.Writer) *Subscription {
+	return &Subscription{
+		ID:        id,
+		Namespace: namespace,
+		out:       out,
+		channels:  make(map[string]struct{}),
+		patterns:  make(map[string]struct{}),
+	}
+}
+
+// Count returns the number of channels and patterns subscribed
+func (s *Subscription) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels) + len(s.patterns)
+}
+
+// Channels returns the channels subscribed in order
+func (s *Subscription) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.channels)
+}
+
+// Patterns returns the patterns subscribed in order
+func (s *Subscription) Patterns() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortedKeys(s.patterns)
+}
+
+// send queues a message for the client, it is encoded to be written in one write so it never
+// interleaves with other replies. It returns false if the message is dropped
+func (s *Subscription) send(kind, pattern, channel string, message []byte) bool {
+	buf := bytes.NewBuffer(nil)
+	e := resp.NewEncoderVersion(buf, s.Protocol)
+	if pattern != "" {
+		e.Push(4)
+		e.BulkString(kind)
+		e.BulkString(pattern)
+	} else {
+		e.Push(3)
+		e.BulkString(kind)
+	}
+	e.BulkString(channel)
+	e.BulkString(string(message))
+
+	s.qmu.Lock()
+	if s.overrun {
+		s.qmu.Unlock()
+		return false
+	}
+	if len(s.queue) >= subscriptionQueueLimit {
+		s.overrun = true
+		s.queue = nil
+		s.qmu.Unlock()
+
+		zap.L().Warn("[PubSub] subscriber is too slow, client disconnected",
+			zap.Int64("clientid", s.ID),
+			zap.String("namespace", s.Namespace),
+			zap.Int("queued", subscriptionQueueLimit))
+		if s.Close != nil {
+			s.Close()
+		}
+		return false
+	}
+	defer s.qmu.Unlock()
+	s.queue = append(s.queue, buf.Bytes())
+	if !s.writing {
+		s.writing = true
+		go s.flush()
+	}
+	return true
+}
+
+// flush writes the queued messages until the queue is empty
+func (s *Subscription) flush() {
+	for {
+		s.qmu.Lock()
+		msgs := s.queue
+		s.queue = nil
+		if len(msgs) == 0 {
+			s.writing = false
+			s.qmu.Unlock()
+			return
+		}
+		s.qmu.Unlock()
+
+		for _, msg := range msgs {
+			if _, err := s.out.Write(msg); err != nil {
+				// the rest of the batch would fail in the same way
+				zap.L().Error("[PubSub] deliver message failed", zap.Int64("clientid", s.ID),
+					zap.String("namespace", s.Namespace), zap.Int("dropped", len(msgs)), zap.Error(err))
+				break
+			}
+		}
+	}
+}
+
+// Hub keeps the subscriptions of this titan instance and delivers messages published
+// from any instance through a Broker
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[string]map[int64]*Subscription // namespace -> channel -> subscribers
+	patterns map[string]map[string]map[int64]*Subscription // namespace -> pattern -> subscribers
+	broker   Broker
+	notifier *Notifier
+}
+
+// NewHub creates a hub which only delivers messages inside this instance
+func NewHub() *Hub {
+	h := &Hub{
+		channels: make(map[string]map[string]map[int64]*Subscription),
+		patterns: make(map[string]map[string]map[int64]*Subscription),
+	}
+	h.broker = &localBroker{hub: h}
+	h.notifier = newNotifier(h)
+	return h
+}
+
+// Notifier returns the notifier which wakes up blocked clients
+func (h *Hub) Notifier() *Notifier {
+	return h.notifier
+}
+
+// Subscribe adds channels to the subscription, it returns the subscription count after each channel is added
+func (h *Hub) Subscribe(sub *Subscription, channels ...string) []int {
+	return h.add(h.channels, sub, sub.channels, channels)
+}
+
+// PSubscribe adds patterns to the subscription, it returns the subscription count after each pattern is added
+func (h *Hub) PSubscribe(sub *Subscription, patterns ...string) []int {
+	return h.add(h.patterns, sub, sub.patterns, patterns)
+}
+
+// Unsubscribe removes channels from the subscription, all the channels are removed if none is given.
+// It returns the channels removed and the subscription count after each removal
+func (h *Hub) Unsubscribe(sub *Subscription, channels ...string) ([]string, []int) {
+	if len(channels) == 0 {
+		channels = sub.Channels()
+	}
+	return channels, h.remove(h.channels, sub, sub.channels, channels)
+}
+
+// PUnsubscribe removes patterns from the subscription, all the patterns are removed if none is given.
+// It returns the patterns removed and the subscription count after each removal
+func (h *Hub) PUnsubscribe(sub *Subscription, patterns ...string) ([]string, []int) {
+	if len(patterns) == 0 {
+		patterns = sub.Patterns()
+	}
+	return patterns, h.remove(h.patterns, sub, sub.patterns, patterns)
+}
+
+// Close removes all the channels and patterns of the subscription
+func (h *Hub) Close(sub *Subscription) {
+	h.Unsubscribe(sub)
+	h.PUnsubscribe(sub)
+}
+
+func (h *Hub) add(table map[string]map[string]map[int64]*Subscription, sub *Subscription,
+	owned map[string]struct{}, names []string) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	ns := table[sub.Namespace]
+	if ns == nil {
+		ns = make(map[string]map[int64]*Subscription)
+		table[sub.Namespace] = ns
+	}
+	counts := make([]int, len(names))
+	for i, name := range names {
+		if _, ok := owned[name]; !ok {
+			owned[name] = struct{}{}
+			subs := ns[name]
+			if subs == nil {
+				subs = make(map[int64]*Subscription)
+				ns[name] = subs
+			}
+			subs[sub.ID] = sub
+		}
+		counts[i] = len(sub.channels) + len(sub.patterns)
+	}
+	return counts
+}
+
+func (h *Hub) remove(table map[string]map[string]map[int64]*Subscription, sub *Subscription,
+	owned map[string]struct{}, names []string) []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	ns := table[sub.Namespace]
+	counts := make([]int, len(names))
+	for i, name := range names {
+		if _, ok := owned[name]; ok {
+			delete(owned, name)
+			if subs := ns[name]; subs != nil {
+				delete(subs, sub.ID)
+				if len(subs) == 0 {
+					delete(ns, name)
+				}
+			}
+		}
+		counts[i] = len(sub.channels) + len(sub.patterns)
+	}
+	if ns != nil && len(ns) == 0 {
+		delete(table, sub.Namespace)
+	}
+	return counts
+}
+
+// Publish posts a message to a channel of the namespace on every titan instance,
+// it returns the number of clients on this instance that receive the message since
+// the subscribers of the other instances are not known when it is published
+func (h *Hub) Publish(namespace, channel string, message []byte) (int64, error) {
+	n := h.receivers(namespace, channel)
+	if err := h.getBroker().Publish(namespace, channel, message); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// receivers counts the local subscribers that match the channel
+func (h *Hub) receivers(namespace, channel string) int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := int64(len(h.channels[namespace][channel]))
+	for pattern, subs := range h.patterns[namespace] {
+		if match([]byte(pattern), []byte(channel)) {
+			n += int64(len(subs))
+		}
+	}
+	return n
+}
+
+// dispatch delivers a message to the local subscribers, it is called by brokers
+func (h *Hub) dispatch(namespace, channel string, message []byte) int {
+	if namespace == notifyNamespace {
+		h.notifier.wake(channel)
+		return 0
+	}
+
+	type delivery struct {
+		sub     *Subscription
+		pattern string
+	}
+	var deliveries []delivery
+
+	h.mu.RLock()
+	for _, sub := range h.channels[namespace][channel] {
+		deliveries = append(deliveries, delivery{sub: sub})
+	}
+	for pattern, subs := range h.patterns[namespace] {
+		if !match([]byte(pattern), []byte(channel)) {
+			continue
+		}
+		for _, sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, pattern: pattern})
+		}
+	}
+	h.mu.RUnlock()
+
+	// queue outside the lock, the messages are written by the subscriptions
+	for _, d := range deliveries {
+		var ok bool
+		if d.pattern == "" {
+			ok = d.sub.send("message", "", channel, message)
+		} else {
+			ok = d.sub.send("pmessage", d.pattern, channel, message)
+		}
+		if !ok {
+			metrics.GetMetrics().PubSubDroppedCounterVec.WithLabelValues(namespace).Inc()
+		}
+	}
+	return len(deliveries)
+}
+
+// Channels lists the active channels of the namespace which match the pattern,
+// all the channels are returned if pattern is empty
+func (h *Hub) Channels(namespace, pattern string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var channels []string
+	for channel := range h.channels[namespace] {
+		if pattern == "" || match([]byte(pattern), []byte(channel)) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of the channel
+func (h *Hub) NumSub(namespace, channel string) int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return int64(len(h.channels[namespace][channel]))
+}
+
+// NumPat returns the number of patterns subscribed in the namespace
+func (h *Hub) NumPat(namespace string) int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var n int64
+	for _, subs := range h.patterns[namespace] {
+		n += int64(len(subs))
+	}
+	return n
+}
+
+// Stop stops delivering messages from other instances
+func (h *Hub) Stop() error {
+	return h.getBroker().Close()
+}
+
+func (h *Hub) getBroker() Broker {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.broker
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// match reports whether val matches the glob-style pattern in the way redis does
+func match(pattern, val []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(val); i++ {
+				if match(pattern[1:], val[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(val) == 0 {
+				return false
+			}
+			val = val[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(val) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					if pattern[1] == val[0] {
+						matched = true
+					}
+					pattern = pattern[2:]
+				case len(pattern) >= 3 && pattern[1] == '-' && pattern[2] != ']':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					if val[0] >= lo && val[0] <= hi {
+						matched = true
+					}
+					pattern = pattern[3:]
+				default:
+					if pattern[0] == val[0] {
+						matched = true
+					}
+					pattern = pattern[1:]
+				}
+			}
+			if len(pattern) > 0 {
+				pattern = pattern[1:] // skip ']'
+			}
+			if matched == not {
+				return false
+			}
+			val = val[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(val) == 0 || pattern[0] != val[0] {
+				return false
+			}
+			val = val[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(val) == 0
+}
@@ -0,0 +1,267 @@
+package pubsub
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/etcd/integration"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writing and reading
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// wait returns the content once it contains s or it times out
+func (b *syncBuffer) wait(s string) string {
+	for i := 0; i < 100 && !strings.Contains(b.String(), s); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return b.String()
+}
+
+func TestHubSubscribe(t *testing.T) {
+	assert := assert.New(t)
+	hub := NewHub()
+	out := &syncBuffer{}
+	sub := NewSubscription(1, "ns", out)
+
+	assert.Equal([]int{1, 2, 2}, hub.Subscribe(sub, "a", "b", "a"))
+	assert.Equal([]int{3}, hub.PSubscribe(sub, "c*"))
+	assert.Equal(3, sub.Count())
+	assert.Equal([]string{"a", "b"}, hub.Channels("ns", ""))
+	assert.Equal([]string{"b"}, hub.Channels("ns", "b*"))
+	assert.Equal(int64(1), hub.NumSub("ns", "a"))
+	assert.Equal(int64(1), hub.NumPat("ns"))
+
+	channels, counts := hub.Unsubscribe(sub)
+	assert.Equal([]string{"a", "b"}, channels)
+	assert.Equal([]int{2, 1}, counts)
+	patterns, counts := hub.PUnsubscribe(sub, "c*")
+	assert.Equal([]string{"c*"}, patterns)
+	assert.Equal([]int{0}, counts)
+	assert.Equal(0, sub.Count())
+	assert.Empty(hub.Channels("ns", ""))
+}
+
+func TestHubPublish(t *testing.T) {
+	assert := assert.New(t)
+	hub := NewHub()
+	out := &syncBuffer{}
+	sub := NewSubscription(1, "ns", out)
+	hub.Subscribe(sub, "news")
+	hub.PSubscribe(sub, "n*")
+
+	// namespaces are isolated
+	other := &syncBuffer{}
+	hub.Subscribe(NewSubscription(2, "other", other), "news")
+
+	n, err := hub.Publish("ns", "news", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal(int64(2), n)
+	msgs := out.wait("*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n*4\r\n$8\r\npmessage\r\n")
+	assert.Contains(msgs, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	assert.Contains(msgs, "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+	assert.Empty(other.String())
+
+	hub.Close(sub)
+	n, err = hub.Publish("ns", "news", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal(int64(0), n)
+
+	// the messages are pushed to the clients speaking RESP3
+	out = &syncBuffer{}
+	sub = NewSubscription(3, "ns", out)
+	sub.Protocol = 3
+	hub.PSubscribe(sub, "n*")
+	_, err = hub.Publish("ns", "news", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal(">4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n", out.wait("hello"))
+	hub.Close(sub)
+}
+
+// blockedWriter blocks writing until it is released
+type blockedWriter struct {
+	release chan struct{}
+}
+
+func (w *blockedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	assert := assert.New(t)
+	hub := NewHub()
+	slow := &blockedWriter{release: make(chan struct{})}
+	defer close(slow.release)
+	sub := NewSubscription(1, "ns", slow)
+	closed := make(chan struct{})
+	sub.Close = func() error {
+		close(closed)
+		return nil
+	}
+	hub.Subscribe(sub, "news")
+
+	// the slow subscriber neither blocks publishing nor the others
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriptionQueueLimit+10; i++ {
+			hub.Publish("ns", "news", []byte("hello"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("publishing is blocked by the slow subscriber")
+	}
+	// the slow subscriber is disconnected once and the rest of the messages are dropped
+	select {
+	case <-closed:
+	default:
+		assert.Fail("the slow subscriber is not disconnected")
+	}
+	assert.False(sub.send("message", "", "news", []byte("hello")))
+
+	out := &syncBuffer{}
+	hub.Subscribe(NewSubscription(2, "ns", out), "news")
+	hub.Publish("ns", "news", []byte("hello"))
+	assert.Contains(out.wait("hello"), "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n")
+}
+
+func TestMessageKey(t *testing.T) {
+	assert := assert.New(t)
+	namespace, channel, ok := splitMessageKey(messageKey("a:b", "c:d"))
+	assert.True(ok)
+	assert.Equal("a:b", namespace)
+	assert.Equal("c:d", channel)
+	namespace, channel, ok = splitMessageKey(messageKey("", ""))
+	assert.True(ok)
+	assert.Equal("", namespace+channel)
+
+	_, _, ok = splitMessageKey(etcdPubSubPrefix + "5:ns:c")
+	assert.False(ok)
+	_, _, ok = splitMessageKey(etcdPubSubPrefix + "ns:c")
+	assert.False(ok)
+}
+
+func TestHubEtcd(t *testing.T) {
+	assert := assert.New(t)
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer clus.Terminate(t)
+
+	// two hubs stand for two titan instances
+	publisher, subscriber := NewHub(), NewHub()
+	assert.NoError(publisher.UseEtcd(clus.RandClient()))
+	assert.NoError(subscriber.UseEtcd(clus.RandClient()))
+	defer publisher.Stop()
+	defer subscriber.Stop()
+
+	out := &syncBuffer{}
+	subscriber.Subscribe(NewSubscription(1, "ns", out), "news")
+
+	n, err := publisher.Publish("ns", "news", []byte("hello"))
+	assert.NoError(err)
+	assert.Equal(int64(0), n)
+
+	expected := "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n"
+	for i := 0; i < 50 && out.String() != expected; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.Equal(expected, out.String())
+}
+
+func TestNotifierEtcd(t *testing.T) {
+	assert := assert.New(t)
+	clus := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer clus.Terminate(t)
+
+	signaler, waiter := NewHub(), NewHub()
+	assert.NoError(signaler.UseEtcd(clus.RandClient()))
+	assert.NoError(waiter.UseEtcd(clus.RandClient()))
+	defer signaler.Stop()
+	defer waiter.Stop()
+
+	// keys without waiters are not published
+	signaler.Notifier().Signal("key")
+	assert.False(signaler.getBroker().Blocked("key"))
+
+	w := waiter.Notifier().Wait(1, "key")
+	for i := 0; i < 50 && !signaler.getBroker().Blocked("key"); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.True(signaler.getBroker().Blocked("key"))
+	signaler.Notifier().Signal("key")
+	select {
+	case <-w.Ready():
+	case <-time.After(5 * time.Second):
+		assert.Fail("waiter is not woken up")
+	}
+
+	// unregistering the key is seen by the other instances
+	waiter.Notifier().Done(w)
+	assert.NoError(waiter.getBroker().Unblock("key"))
+	for i := 0; i < 50 && signaler.getBroker().Blocked("key"); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.False(signaler.getBroker().Blocked("key"))
+}
+
+func TestNotifierWakeAll(t *testing.T) {
+	assert := assert.New(t)
+	n := NewHub().Notifier()
+	first := n.Wait(1, "key")
+	second := n.Wait(2, "key")
+	defer n.Done(first)
+	defer n.Done(second)
+
+	// all the waiters check their keys again after the signals may have been missed
+	n.wakeAll()
+	for _, w := range []*Waiter{first, second} {
+		select {
+		case <-w.Ready():
+		default:
+			assert.Fail("waiter is not woken up")
+		}
+	}
+}
+
+func TestBlockedKey(t *testing.T) {
+	assert := assert.New(t)
+	key, ok := splitBlockedKey(blockedKey("a:b", 0x1f))
+	assert.True(ok)
+	assert.Equal("a:b", key)
+	_, ok = splitBlockedKey(etcdBlockedPrefix + "4:ab:1f")
+	assert.False(ok)
+}
+
+func TestMatch(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(match([]byte("*"), []byte("anything")))
+	assert.True(match([]byte("h?llo"), []byte("hello")))
+	assert.True(match([]byte("h*llo"), []byte("heeello")))
+	assert.True(match([]byte("h[ae]llo"), []byte("hallo")))
+	assert.False(match([]byte("h[^e]llo"), []byte("hello")))
+	assert.True(match([]byte("h[a-b]llo"), []byte("hbllo")))
+	assert.True(match([]byte("h\\*llo"), []byte("h*llo")))
+	assert.False(match([]byte("h*llo"), []byte("hell")))
+	assert.False(match([]byte("news"), []byte("news.1")))
+}
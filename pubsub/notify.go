@@ -0,0 +1,277 @@
+package pubsub
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// keys are signaled to all the titan instances as messages of this namespace,
+// the channel of the message is the signaled key
+const notifyNamespace = "$sys.notify"
+
+// Waiter is a client blocked on keys
+type Waiter struct {
+	ID    int64
+	keys  []string
+	elems []*list.Element
+	woken bool
+
+	ready   chan struct{}
+	unblock chan bool
+}
+
+// Ready is notified when one of the keys is signaled
+func (w *Waiter) Ready() <-chan struct{} { return w.ready }
+
+// Unblocked is notified when the client is unblocked by CLIENT UNBLOCK,
+// true is sent if the client should be unblocked with an error
+func (w *Waiter) Unblocked() <-chan bool { return w.unblock }
+
+// blockRegistryLinger is how long a key stays registered to the broker after its last
+// waiter leaves, clients blocking on the same key repeatedly do not register it every time
+var blockRegistryLinger = 30 * time.Second
+
+// Notifier wakes up the clients blocked on keys when the keys are signaled by any titan instance,
+// clients blocked on the same key are woken up in the order they are blocked
+type Notifier struct {
+	hub     *Hub
+	mu      sync.Mutex
+	queues  map[string]*list.List
+	waiters map[int64]*Waiter
+
+	// signals are published in background so that pushing is not slowed down by the broker,
+	// the keys signaled before they are published are merged
+	once    sync.Once
+	pending map[string]struct{}
+	wakeup  chan struct{}
+
+	// registered are the keys registered to the broker, the time is when the last waiter
+	// of the key left, it is zero if the key still has waiters
+	regMu      sync.Mutex
+	registered map[string]time.Time
+}
+
+func newNotifier(hub *Hub) *Notifier {
+	return &Notifier{
+		hub:        hub,
+		queues:     make(map[string]*list.List),
+		waiters:    make(map[int64]*Waiter),
+		pending:    make(map[string]struct{}),
+		wakeup:     make(chan struct{}, 1),
+		registered: make(map[string]time.Time),
+	}
+}
+
+// Wait blocks the client on keys, the waiter is queued at the tail of every key
+func (n *Notifier) Wait(id int64, keys ...string) *Waiter {
+	w := &Waiter{
+		ID:      id,
+		keys:    keys,
+		elems:   make([]*list.Element, len(keys)),
+		ready:   make(chan struct{}, 1),
+		unblock: make(chan bool, 1),
+	}
+	n.mu.Lock()
+	for i, key := range keys {
+		q := n.queues[key]
+		if q == nil {
+			q = list.New()
+			n.queues[key] = q
+		}
+		w.elems[i] = q.PushBack(w)
+	}
+	n.waiters[id] = w
+	n.mu.Unlock()
+
+	// the keys are registered before the client tries again, so the signals of the
+	// keys changed by other instances after then will not be skipped
+	n.register(keys)
+	return w
+}
+
+// register registers the keys to the broker if they have not been registered
+func (n *Notifier) register(keys []string) {
+	n.once.Do(n.start)
+	n.regMu.Lock()
+	defer n.regMu.Unlock()
+	broker := n.hub.getBroker()
+	for _, key := range keys {
+		if _, ok := n.registered[key]; !ok {
+			if err := broker.Block(key); err != nil {
+				zap.L().Error("[PubSub] register blocked key failed", zap.String("key", key), zap.Error(err))
+				continue
+			}
+		}
+		n.registered[key] = time.Time{}
+	}
+}
+
+// sweep unregisters the keys which have had no waiters for a while, the keys having waiters are
+// registered again in case the registrations were lost
+func (n *Notifier) sweep() {
+	n.regMu.Lock()
+	defer n.regMu.Unlock()
+	broker := n.hub.getBroker()
+	now := time.Now()
+	for key, left := range n.registered {
+		n.mu.Lock()
+		_, waiting := n.queues[key]
+		n.mu.Unlock()
+
+		var err error
+		switch {
+		case waiting:
+			n.registered[key] = time.Time{}
+			err = broker.Block(key)
+		case left.IsZero():
+			n.registered[key] = now
+		case now.Sub(left) >= blockRegistryLinger:
+			delete(n.registered, key)
+			err = broker.Unblock(key)
+		}
+		if err != nil {
+			zap.L().Error("[PubSub] sync blocked key failed", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// Rearm makes the waiter wakeable again after it failed to get what it waits for,
+// it keeps its position in the queues
+func (n *Notifier) Rearm(w *Waiter) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	w.woken = false
+	select {
+	case <-w.ready:
+	default:
+	}
+}
+
+// Done removes the waiter from all the queues
+func (n *Notifier) Done(w *Waiter) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i, key := range w.keys {
+		q := n.queues[key]
+		if q == nil {
+			continue
+		}
+		q.Remove(w.elems[i])
+		if q.Len() == 0 {
+			delete(n.queues, key)
+		}
+	}
+	if n.waiters[w.ID] == w {
+		delete(n.waiters, w.ID)
+	}
+}
+
+// Signal wakes up the first waiter of the key on every titan instance, the key is only
+// published if any instance has clients blocked on it. It never blocks the caller
+func (n *Notifier) Signal(key string) {
+	n.mu.Lock()
+	_, waiting := n.queues[key]
+	n.mu.Unlock()
+	if !waiting && !n.hub.getBroker().Blocked(key) {
+		return
+	}
+
+	n.once.Do(n.start)
+	n.mu.Lock()
+	n.pending[key] = struct{}{}
+	n.mu.Unlock()
+	select {
+	case n.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// start starts the goroutines publishing the signals and sweeping the registered keys
+func (n *Notifier) start() {
+	go n.publish()
+	go func() {
+		ticker := time.NewTicker(blockRegistryLinger / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			n.sweep()
+		}
+	}()
+}
+
+// publish sends the pending signals to the broker
+func (n *Notifier) publish() {
+	for range n.wakeup {
+		n.mu.Lock()
+		keys := n.pending
+		n.pending = make(map[string]struct{})
+		n.mu.Unlock()
+
+		broker := n.hub.getBroker()
+		for key := range keys {
+			if err := broker.Publish(notifyNamespace, key, nil); err != nil {
+				zap.L().Error("[PubSub] signal key failed", zap.String("key", key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// wake wakes up the first waiter which has not been woken in the queue of the key
+func (n *Notifier) wake(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	q := n.queues[key]
+	if q == nil {
+		return
+	}
+	for e := q.Front(); e != nil; e = e.Next() {
+		w := e.Value.(*Waiter)
+		if w.woken {
+			continue
+		}
+		w.woken = true
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+		return
+	}
+}
+
+// wakeAll wakes up all the waiters to check their keys again, it is called when the signals
+// may have been missed
+func (n *Notifier) wakeAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, w := range n.waiters {
+		w.woken = true
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Unblock unblocks the client with id, it returns false if the client is not blocked
+func (n *Notifier) Unblock(id int64, withError bool) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	w, ok := n.waiters[id]
+	if !ok {
+		return false
+	}
+	select {
+	case w.unblock <- withError:
+	default:
+	}
+	return true
+}
+
+// Blocked returns the number of clients blocked on this instance
+func (n *Notifier) Blocked() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.waiters)
+}
@@ -2,10 +2,12 @@ package titan
 
 import (
 	"net"
+	"sync/atomic"
 	"time"
 
 	"github.com/distributedio/titan/command"
 	"github.com/distributedio/titan/context"
+	"github.com/distributedio/titan/encoding/resp"
 	"github.com/distributedio/titan/metrics"
 	"go.uber.org/zap"
 )
@@ -15,6 +17,7 @@ type Server struct {
 	servCtx *context.ServerContext
 	lis     net.Listener
 	idgen   func() int64
+	conns   int64 // the number of connections being served
 }
 
 //New a server instance
@@ -35,11 +38,25 @@ func (s *Server) Serve(lis net.Listener) error {
 			return err
 		}
 
+		atomic.AddInt64(&s.servCtx.ConnectionsReceived, 1)
+
+		// the limit may be changed by CONFIG SET
+		if max := s.servCtx.Options().MaxConnection; max > 0 && atomic.LoadInt64(&s.conns) >= max {
+			zap.L().Warn("max number of clients reached", zap.String("addr", conn.RemoteAddr().String()),
+				zap.Int64("max-connection", max))
+			resp.ReplyError(conn, "ERR max number of clients reached")
+			conn.Close()
+			atomic.AddInt64(&s.servCtx.RejectedConnections, 1)
+			continue
+		}
+		atomic.AddInt64(&s.conns, 1)
+
 		cliCtx := context.NewClientContext(s.idgen(), conn)
 		cliCtx.DB = s.servCtx.Store.DB(cliCtx.Namespace, 0)
 		s.servCtx.Clients.Store(cliCtx.ID, cliCtx)
 
 		cli := newClient(cliCtx, s, command.NewExecutor())
+		cliCtx.Writer = cli
 
 		zap.L().Info("recv connection", zap.String("addr", cliCtx.RemoteAddr),
 			zap.Int64("clientid", cliCtx.ID), zap.String("namespace", cliCtx.Namespace))
@@ -51,7 +68,11 @@ func (s *Server) Serve(lis net.Listener) error {
 					zap.Int64("clientid", cliCtx.ID), zap.Error(err))
 			}
 			metrics.GetMetrics().ConnectionOnlineGaugeVec.WithLabelValues(cli.cliCtx.Namespace).Dec()
+			if cli.cliCtx.Subscription != nil {
+				s.servCtx.PubSub.Close(cli.cliCtx.Subscription)
+			}
 			s.servCtx.Clients.Delete(cli.cliCtx.ID)
+			atomic.AddInt64(&s.conns, -1)
 		}(cli, conn)
 	}
 }
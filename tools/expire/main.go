@@ -43,13 +43,12 @@ func cleanUp(txn kv.Transaction, mkey kv.Key, database *db.DB,
 	if err := txn.Delete(mkey); err != nil {
 		return err
 	}
-	switch obj.Type {
-	case db.ObjectString:
+	// only the chunked strings have data keys
+	if obj.Type == db.ObjectString && obj.Encoding != db.ObjectEncodingChunked {
 		return nil
-	default:
-		dkey := db.DataKey(database, obj.ID)
-		return deletePrefix(txn, dkey)
 	}
+	dkey := db.DataKey(database, obj.ID)
+	return deletePrefix(txn, dkey)
 }
 
 func doExpire(s kv.Storage, database *db.DB, prefix kv.Key,
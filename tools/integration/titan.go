@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/distributedio/titan/conf"
 	"github.com/distributedio/titan/context"
 	"github.com/distributedio/titan/db"
+	"github.com/distributedio/titan/pubsub"
 )
 
 var (
@@ -26,7 +28,7 @@ var (
 	lis        net.Listener
 )
 
-//SetAuth default no verify
+// SetAuth default no verify
 // specify auth to enable validation
 func SetAuth(auth string) {
 	cfg.Auth = auth
@@ -41,9 +43,9 @@ func SetEtcdAddrs(addrs []string) {
 	tikvConf.EtcdAddrs = addrs
 }
 
-//Start start server
-//1.open db
-//2.start server fd
+// Start start server
+// 1.open db
+// 2.start server fd
 func Start() {
 	zap.ReplaceGlobals(zap.NewNop())
 	var err error
@@ -52,18 +54,28 @@ func Start() {
 		log.Fatalln(err)
 	}
 
-	svr = titan.New(&context.ServerContext{
-		RequirePass:      cfg.Auth,
-		Store:            store,
+	servCtx := &context.ServerContext{
+		RequirePass: cfg.Auth,
+		Store:       store,
+		PubSub:      pubsub.NewHub(),
+	}
+	servCtx.SetOptions(context.Options{
 		ListZipThreshold: 100,
+		SortMaxElements:  100000,
+		MaxConnection:    cfg.MaxConnection,
+
+		SlowlogLogSlowerThan: 10 * time.Millisecond,
+		SlowlogMaxLen:        128,
+		LuaTimeLimit:         5 * time.Second,
 	})
+	svr = titan.New(servCtx)
 	err = svr.ListenAndServe(cfg.Listen)
 	if err != nil {
 		return
 	}
 }
 
-//Close close server listen fd
+// Close close server listen fd
 func Close() {
 	if err := svr.Stop(); err != nil {
 		fmt.Println(err)